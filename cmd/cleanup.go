@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+var (
+	cleanupSecretNames        []string
+	cleanupAllServiceAccounts bool
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete the managed image pull secrets and their service account references",
+	Long: `Delete the managed image pull secrets and their service account references.
+
+Every managed secret with one of the names given with --secret-name is
+deleted, and the references to them are removed from the service accounts
+labelled as injected by the controller. Service accounts injected before the
+label was introduced are only labelled on their next modification; pass
+--all-service-accounts to scan every service account instead. Stop the
+controller first, or it will provision everything again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var names []string
+		for _, name := range cleanupSecretNames {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("--secret-name or AURORA_SECRET_NAME is required")
+		}
+
+		cfg, err := buildConfig()
+		if err != nil {
+			return fmt.Errorf("error building kubeconfig: %w", err)
+		}
+		cfg.UserAgent = userAgentFor(cmd)
+
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %w", err)
+		}
+
+		selector := labels.SelectorFromSet(labels.Set{injectedLabel: injectedValue})
+		if cleanupAllServiceAccounts {
+			selector = labels.Everything()
+		}
+
+		// The cleanup command writes directly: none of the write gates of the
+		// controllers apply to it.
+		return cleanupManagedResources(cmd.Context(), kubeClient, names, selector, defaultFieldManager, func(fn func(ctx context.Context) error) error {
+			return fn(cmd.Context())
+		})
+	},
+}
+
+// cleanupManagedResources deletes every managed secret with one of the names
+// and removes the references to the deleted secrets, and the injected label,
+// from every service account of their namespaces matching the selector. A
+// reference to a secret of that name that is not managed is left alone. It
+// reads from the API server rather than the informer caches, which are
+// stopped by then, and runs every write through write.
+func cleanupManagedResources(ctx context.Context, kubeClient kubernetes.Interface, names []string, serviceAccountSelector labels.Selector, fieldManager string, write func(fn func(ctx context.Context) error) error) error {
+	secretNames := sets.New(names...)
+
+	var errs []error
+
+	secrets, err := kubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue}).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing managed secrets: %w", err)
+	}
+
+	// deleted holds the names of the secrets deleted in each namespace.
+	deleted := map[string]sets.Set[string]{}
+	for _, secret := range secrets.Items {
+		if !secretNames.Has(secret.Name) {
+			continue
+		}
+
+		klog.Infof("Cleanup: deleting secret %s/%s", secret.Namespace, secret.Name)
+		err := write(func(ctx context.Context) error {
+			return kubeClient.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting secret %s/%s: %w", secret.Namespace, secret.Name, err))
+			continue
+		}
+
+		if deleted[secret.Namespace] == nil {
+			deleted[secret.Namespace] = sets.New[string]()
+		}
+		deleted[secret.Namespace].Insert(secret.Name)
+	}
+
+	serviceAccounts, err := kubeClient.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: serviceAccountSelector.String(),
+	})
+	if err != nil {
+		return utilerrors.NewAggregate(append(errs, fmt.Errorf("listing service accounts: %w", err)))
+	}
+
+	for _, serviceAccount := range serviceAccounts.Items {
+		removed := deleted[serviceAccount.Namespace]
+		if removed.Len() == 0 {
+			continue
+		}
+
+		imagePullSecrets := []corev1.LocalObjectReference{}
+		for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
+			if !removed.Has(imagePullSecret.Name) {
+				imagePullSecrets = append(imagePullSecrets, imagePullSecret)
+			}
+		}
+
+		if len(imagePullSecrets) == len(serviceAccount.ImagePullSecrets) {
+			continue
+		}
+
+		klog.Infof("Cleanup: removing image pull secret from %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+		updated := serviceAccount.DeepCopy()
+		updated.ImagePullSecrets = imagePullSecrets
+		delete(updated.Labels, injectedLabel)
+
+		err := write(func(ctx context.Context) error {
+			_, err := kubeClient.CoreV1().ServiceAccounts(serviceAccount.Namespace).Update(ctx, updated, metav1.UpdateOptions{FieldManager: fieldManager})
+			return err
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("updating service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// cleanupOnShutdown deletes every managed secret and removes the references
+// to them from all service accounts, once the controllers have stopped on a
+// graceful shutdown, and with leader election before the lease is released.
+// It is skipped on a replica that does not lead, including a former leader,
+// and while the emergency stop is engaged. The caches are stopped by then, but still hold
+// the overrides of the namespaces.
+func (r *imagePullSecretsReconciler) cleanupOnShutdown(ctx context.Context) error {
+	if !r.leadership.isLeading() {
+		klog.Info("Skipping the cleanup on shutdown: this replica was a standby")
+		return nil
+	}
+
+	if r.emergencyStop.check() != nil {
+		klog.Warning("Skipping the cleanup on shutdown: the emergency stop is engaged")
+		return nil
+	}
+
+	klog.Warning("Cleaning up all managed secrets and service account references before shutting down")
+
+	names := sets.New(r.managedImagePullSecretNames(nil)...)
+	if namespaces, err := r.namespaceLister.List(labels.Everything()); err == nil {
+		for _, namespace := range namespaces {
+			names.Insert(r.auroraSecretName(namespace))
+		}
+	}
+
+	// Every service account is scanned, since those injected before the
+	// label was introduced are not labelled.
+	write := func(fn func(ctx context.Context) error) error {
+		return r.writeFrom(ctx, fn)
+	}
+	if err := cleanupManagedResources(ctx, r.kubeClient, sets.List(names), labels.Everything(), r.fieldManager, write); err != nil {
+		return err
+	}
+
+	klog.Info("Cleanup complete")
+	return nil
+}
+
+func init() {
+	cleanupCmd.Flags().StringSliceVar(&cleanupSecretNames, "secret-name", []string{os.Getenv("AURORA_SECRET_NAME")}, "Names of the managed secrets to delete, including any additional registry secrets")
+	cleanupCmd.Flags().BoolVar(&cleanupAllServiceAccounts, "all-service-accounts", false, "Scan every service account rather than only those labelled as injected")
+
+	rootCmd.AddCommand(cleanupCmd)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCleanupOnShutdown(t *testing.T) {
+	team := testNamespace("team", nil)
+	renamed := testNamespace("renamed", nil)
+	renamed.Annotations = map[string]string{pullSecretNameAnnotation: "renamed-pull"}
+
+	unmanaged := testSecret(team, "other-pull", testDockerConfigJSON)
+	unmanaged.Labels = nil
+	injected := testServiceAccount("team", "default", "keep", testSecretName)
+	injected.Labels = map[string]string{injectedLabel: injectedValue}
+	// The secret of the foreign namespace is not managed, so its references
+	// are not the controller's.
+	foreign := testNamespace("foreign", nil)
+	foreignSecret := testSecret(foreign, testSecretName, testDockerConfigJSON)
+	foreignSecret.Labels = nil
+
+	tests := []struct {
+		name        string
+		leadership  *leadership
+		stopEngaged bool
+		readOnly    bool
+		cleaned     bool
+		wantErr     bool
+	}{
+		{name: "leader", cleaned: true},
+		{name: "elected leader", leadership: leading(), cleaned: true},
+		{name: "standby", leadership: &leadership{}},
+		{name: "emergency stop", stopEngaged: true},
+		{name: "read-only", readOnly: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, kubeClient := newTestReconciler(t,
+				team, renamed, foreign,
+				foreignSecret,
+				testServiceAccount("foreign", "default", testSecretName),
+				testSecret(team, testSecretName, testDockerConfigJSON),
+				testSecret(renamed, "renamed-pull", testDockerConfigJSON),
+				unmanaged,
+				injected,
+				testServiceAccount("renamed", "default", "renamed-pull"),
+			)
+			r.secretNameOverride = true
+			r.leadership = tt.leadership
+			r.emergencyStop = &emergencyStop{}
+			r.readOnly = tt.readOnly
+			if tt.stopEngaged {
+				t.Setenv(emergencyStopEnv, "true")
+			}
+
+			if err := r.cleanupOnShutdown(context.Background()); (err != nil) != tt.wantErr {
+				t.Fatalf("cleanupOnShutdown() = %v, want error %v", err, tt.wantErr)
+			}
+
+			for _, key := range [][2]string{{"team", testSecretName}, {"renamed", "renamed-pull"}} {
+				if exists := secretExists(t, kubeClient, key[0], key[1]); exists == tt.cleaned {
+					t.Errorf("secret %s/%s exists = %v, want %v", key[0], key[1], exists, !tt.cleaned)
+				}
+			}
+			for _, key := range [][2]string{{"team", "other-pull"}, {"foreign", testSecretName}} {
+				if !secretExists(t, kubeClient, key[0], key[1]) {
+					t.Errorf("unmanaged secret %s/%s was deleted", key[0], key[1])
+				}
+			}
+			foreignServiceAccount, err := kubeClient.CoreV1().ServiceAccounts("foreign").Get(context.Background(), "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []corev1.LocalObjectReference{{Name: testSecretName}}; !reflect.DeepEqual(foreignServiceAccount.ImagePullSecrets, want) {
+				t.Errorf("foreign image pull secrets = %v, want the unmanaged reference kept", foreignServiceAccount.ImagePullSecrets)
+			}
+
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(context.Background(), "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []corev1.LocalObjectReference{{Name: "keep"}, {Name: testSecretName}}
+			if tt.cleaned {
+				want = []corev1.LocalObjectReference{{Name: "keep"}}
+			}
+			if !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+				t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+			}
+			if _, labelled := serviceAccount.Labels[injectedLabel]; labelled == tt.cleaned {
+				t.Errorf("injected label present = %v, want %v", labelled, !tt.cleaned)
+			}
+		})
+	}
+}
+
+// leading returns a leadership that leads.
+func leading() *leadership {
+	l := &leadership{}
+	l.leading.Store(true)
+	return l
+}
+
+// secretExists reports whether the clientset holds the secret.
+func secretExists(t *testing.T, kubeClient *fake.Clientset, namespace, name string) bool {
+	t.Helper()
+
+	_, err := kubeClient.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	return true
+}
+
+func TestCleanupManagedResourcesInjectedSelector(t *testing.T) {
+	team := testNamespace("team", nil)
+	injected := testServiceAccount("team", "default", "keep", testSecretName)
+	injected.Labels = map[string]string{injectedLabel: injectedValue, "app": "web"}
+	kubeClient := fake.NewSimpleClientset(
+		team,
+		testSecret(team, testSecretName, testDockerConfigJSON),
+		injected,
+		// Injected before the label was introduced.
+		testServiceAccount("team", "builder", testSecretName),
+	)
+
+	selector := labels.SelectorFromSet(labels.Set{injectedLabel: injectedValue})
+	write := func(fn func(ctx context.Context) error) error { return fn(context.Background()) }
+	if err := cleanupManagedResources(context.Background(), kubeClient, []string{testSecretName}, selector, defaultFieldManager, write); err != nil {
+		t.Fatalf("cleanupManagedResources() = %v", err)
+	}
+
+	if secretExists(t, kubeClient, "team", testSecretName) {
+		t.Errorf("secret team/%s not deleted", testSecretName)
+	}
+	tests := []struct {
+		name   string
+		want   []corev1.LocalObjectReference
+		labels map[string]string
+	}{
+		{name: "default", want: []corev1.LocalObjectReference{{Name: "keep"}}, labels: map[string]string{"app": "web"}},
+		{name: "builder", want: []corev1.LocalObjectReference{{Name: testSecretName}}},
+	}
+	for _, tt := range tests {
+		serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(context.Background(), tt.name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(serviceAccount.ImagePullSecrets, tt.want) {
+			t.Errorf("image pull secrets of %s = %v, want %v", tt.name, serviceAccount.ImagePullSecrets, tt.want)
+		}
+		if !reflect.DeepEqual(serviceAccount.Labels, tt.labels) {
+			t.Errorf("labels of %s = %v, want %v", tt.name, serviceAccount.Labels, tt.labels)
+		}
+	}
+}
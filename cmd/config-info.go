@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// controllerWorkers is the number of workers of each controller.
+const controllerWorkers = 2
+
+// configInfo returns the labels of the config info metric: the settings of
+// the running controller that dashboards and alerts key off. Only
+// non-sensitive values belong here, never credentials or their paths.
+func configInfo() map[string]string {
+	return map[string]string{
+		"secret_name":             os.Getenv("AURORA_SECRET_NAME"),
+		"credential_source":       strings.Join(credentialSources, ","),
+		"namespace_resync":        namespaceResync.String(),
+		"serviceaccount_resync":   serviceAccountResync.String(),
+		"secret_resync":           secretResync.String(),
+		"workers":                 strconv.Itoa(controllerWorkers),
+		"serviceaccount_mode":     serviceAccountMode,
+		"sa_update_strategy":      saUpdateStrategy,
+		"secret_update_strategy":  secretUpdateStrategy,
+		"namespace_selector":      namespaceSelector,
+		"serviceaccount_selector": saSelector,
+		"read_only":               strconv.FormatBool(readOnly),
+		"unified_reconcile":       strconv.FormatBool(unifiedReconcile),
+		"prune_orphans":           strconv.FormatBool(pruneOrphans),
+		"leader_elect":            strconv.FormatBool(leaderElect),
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigInfo(t *testing.T) {
+	t.Setenv("AURORA_SECRET_NAME", testSecretName)
+	t.Setenv("AURORA_SECRET_DOCKERCONFIGJSON", testDockerConfigJSON)
+	saved := credentialSources
+	t.Cleanup(func() { credentialSources = saved })
+	credentialSources = []string{"env", "file"}
+	savedResync := namespaceResync
+	t.Cleanup(func() { namespaceResync = savedResync })
+	namespaceResync = 10 * time.Minute
+
+	info := configInfo()
+
+	var keys []string
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{
+		"credential_source", "leader_elect", "namespace_resync", "namespace_selector", "prune_orphans", "read_only",
+		"sa_update_strategy", "secret_name", "secret_resync", "secret_update_strategy", "serviceaccount_mode",
+		"serviceaccount_resync", "serviceaccount_selector", "unified_reconcile", "workers",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("config info labels = %v, want %v", keys, want)
+	}
+
+	for label, want := range map[string]string{
+		"secret_name":       testSecretName,
+		"credential_source": "env,file",
+		"namespace_resync":  "10m0s",
+		"workers":           "2",
+	} {
+		if got := info[label]; got != want {
+			t.Errorf("config info %s = %q, want %q", label, got, want)
+		}
+	}
+
+	// The credentials themselves are never reported.
+	for label, value := range info {
+		if strings.Contains(value, "auths") {
+			t.Errorf("config info %s carries the credentials: %q", label, value)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+)
+
+// buildConfig returns the client configuration of the command's API clients.
+//
+// An explicit --kubeconfig or --apiserver is always used. Otherwise the
+// in-cluster configuration is preferred, falling back to the default
+// kubeconfig loading rules (KUBECONFIG, then ~/.kube/config) when not running
+// in a pod. --apiserver and --kubeconfig may be combined only when they point
+// at the same server.
+func buildConfig() (*rest.Config, error) {
+	var cfg *rest.Config
+	var source string
+	var err error
+
+	switch {
+	case kubeconfig != "" && apiserver != "":
+		if err = checkKubeconfigServer(kubeconfig, apiserver); err != nil {
+			return nil, err
+		}
+
+		cfg, err = clientcmd.BuildConfigFromFlags(apiserver, kubeconfig)
+		source = fmt.Sprintf("kubeconfig %s", kubeconfig)
+	case kubeconfig != "":
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		source = fmt.Sprintf("kubeconfig %s", kubeconfig)
+	case apiserver != "":
+		cfg, err = clientcmd.BuildConfigFromFlags(apiserver, "")
+		source = fmt.Sprintf("API server %s", apiserver)
+	default:
+		cfg, err = rest.InClusterConfig()
+		source = "in-cluster service account"
+
+		if errors.Is(err, rest.ErrNotInCluster) {
+			rules := clientcmd.NewDefaultClientConfigLoadingRules()
+			cfg, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+			source = "default kubeconfig"
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	klog.Infof("Using %s for API server %s", source, cfg.Host)
+	return cfg, nil
+}
+
+// checkKubeconfigServer returns an error when the current context of the
+// kubeconfig targets another server than apiserver.
+func checkKubeconfigServer(path, apiserver string) error {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return nil
+	}
+
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok || cluster.Server == "" {
+		return nil
+	}
+
+	if strings.TrimSuffix(cluster.Server, "/") != strings.TrimSuffix(apiserver, "/") {
+		return fmt.Errorf("--apiserver %s conflicts with the server %s of --kubeconfig %s", apiserver, cluster.Server, path)
+	}
+
+	return nil
+}
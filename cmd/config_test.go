@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKubeconfig writes a kubeconfig whose current context targets server.
+func writeKubeconfig(t *testing.T, server string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: %s
+contexts:
+- name: context
+  context:
+    cluster: cluster
+    user: user
+current-context: context
+users:
+- name: user
+  user:
+    token: token
+`, server)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestBuildConfig(t *testing.T) {
+	flagKubeconfig := writeKubeconfig(t, "https://flag.example.com:6443")
+	defaultKubeconfig := writeKubeconfig(t, "https://default.example.com:6443")
+
+	tests := []struct {
+		name       string
+		kubeconfig string
+		apiserver  string
+		wantHost   string
+		wantErr    string
+	}{
+		{name: "kubeconfig", kubeconfig: flagKubeconfig, wantHost: "https://flag.example.com:6443"},
+		{name: "apiserver", apiserver: "https://apiserver.example.com", wantHost: "https://apiserver.example.com"},
+		{name: "kubeconfig and its apiserver", kubeconfig: flagKubeconfig, apiserver: "https://flag.example.com:6443/", wantHost: "https://flag.example.com:6443/"},
+		{
+			name: "kubeconfig and another apiserver", kubeconfig: flagKubeconfig, apiserver: "https://apiserver.example.com",
+			wantErr: "--apiserver https://apiserver.example.com conflicts with the server https://flag.example.com:6443 of --kubeconfig " + flagKubeconfig,
+		},
+		{name: "default kubeconfig outside a pod", wantHost: "https://default.example.com:6443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(kubeconfigFlag, apiserverFlag string) { kubeconfig, apiserver = kubeconfigFlag, apiserverFlag }(kubeconfig, apiserver)
+			kubeconfig, apiserver = tt.kubeconfig, tt.apiserver
+			t.Setenv("KUBERNETES_SERVICE_HOST", "")
+			t.Setenv("KUBERNETES_SERVICE_PORT", "")
+			t.Setenv("KUBECONFIG", defaultKubeconfig)
+
+			cfg, err := buildConfig()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("buildConfig = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildConfig = %v", err)
+			}
+			if cfg.Host != tt.wantHost {
+				t.Errorf("host = %s, want %s", cfg.Host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestCheckKubeconfigServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    string
+		apiserver string
+		wantErr   bool
+	}{
+		{name: "same server", server: "https://cluster.example.com", apiserver: "https://cluster.example.com"},
+		{name: "trailing slash", server: "https://cluster.example.com/", apiserver: "https://cluster.example.com"},
+		{name: "another server", server: "https://cluster.example.com", apiserver: "https://other.example.com", wantErr: true},
+		{name: "no server", apiserver: "https://other.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKubeconfigServer(writeKubeconfig(t, tt.server), tt.apiserver)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkKubeconfigServer = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// newCredentialProvider returns the provider selected by --credential-source.
+// Several sources are merged into a single dockerconfigjson, resolving
+// registries configured by more than one source with --credential-conflicts.
+// With --fallback-dockerconfigjson-file, that file is used whenever the
+// sources fail. The credential of every source, but ACR which generates its
+// own, is checked to be plaintext JSON. The informers of the sources are
+// stopped with stopCh.
+func newCredentialProvider(kubeClient kubernetes.Interface, stopCh <-chan struct{}) (credentials.Provider, error) {
+	if len(credentialSources) == 0 {
+		return nil, fmt.Errorf("--credential-source is required")
+	}
+
+	conflicts := credentials.ConflictPolicy(credentialConflicts)
+	if conflicts != credentials.ConflictLastWins && conflicts != credentials.ConflictError {
+		return nil, fmt.Errorf("unknown --credential-conflicts %q, expected last-wins or error", credentialConflicts)
+	}
+
+	providers := []credentials.Provider{}
+	for _, source := range credentialSources {
+		provider, err := newCredentialSource(kubeClient, source, stopCh)
+		if err != nil {
+			return nil, err
+		}
+		if source != "acr" {
+			provider = &credentials.Validated{Provider: provider, DecodeBase64: decodeBase64}
+		}
+
+		providers = append(providers, provider)
+	}
+
+	provider := providers[0]
+	if len(providers) > 1 {
+		provider = &credentials.Merged{Providers: providers, Conflicts: conflicts}
+	}
+
+	if fallbackDockerConfig != "" {
+		provider = &credentials.Failover{
+			Primary:  provider,
+			Fallback: &credentials.Validated{Provider: &credentials.File{Path: fallbackDockerConfig}, DecodeBase64: decodeBase64},
+		}
+	}
+
+	return provider, nil
+}
+
+// newCredentialSource returns the provider of a single credential source.
+func newCredentialSource(kubeClient kubernetes.Interface, source string, stopCh <-chan struct{}) (credentials.Provider, error) {
+	switch source {
+	case "env":
+		return credentials.Env("AURORA_SECRET_DOCKERCONFIGJSON"), nil
+	case "file":
+		if dockerConfigJSONPath == "" {
+			return nil, fmt.Errorf("--dockerconfigjson-file is required with --credential-source=file")
+		}
+
+		return &credentials.File{Path: dockerConfigJSONPath}, nil
+	case "secret":
+		source, err := newSourceSecret(kubeClient)
+		if err != nil {
+			return nil, err
+		}
+
+		// Read the source secret from a cache scoped to it, rather than
+		// from the API server on every refresh, and watch its changes.
+		factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, secretResync,
+			kubeinformers.WithNamespace(source.Namespace),
+			kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", source.Name).String()
+			}))
+		source.Informer = factory.Core().V1().Secrets()
+		source.Informer.Informer()
+		factory.Start(stopCh)
+
+		return source, nil
+	case "acr":
+		if acrRegistry == "" {
+			return nil, fmt.Errorf("--acr-registry is required with --credential-source=acr")
+		}
+
+		provider := credentials.NewACRFromEnvironment(acrRegistry, credentials.AzureIdentity(acrIdentity))
+		if acrClientID != "" {
+			provider.ClientID = acrClientID
+		}
+		if acrTenantID != "" {
+			provider.TenantID = acrTenantID
+		}
+
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unknown credential source %q", source)
+	}
+}
+
+// newSourceSecret returns the provider of the secret credential source.
+func newSourceSecret(kubeClient kubernetes.Interface) (*credentials.Secret, error) {
+	namespace, name, ok := strings.Cut(sourceSecretRef, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("--source-secret-ref must be namespace/name with --credential-source=secret")
+	}
+
+	return &credentials.Secret{
+		KubeClient: kubeClient,
+		Namespace:  namespace,
+		Name:       name,
+		Key:        sourceSecretKey,
+	}, nil
+}
+
+// bootstrapSourceSecret creates the source secret from the credential of
+// --dockerconfigjson-file, or else of AURORA_SECRET_DOCKERCONFIGJSON, when
+// the secret does not exist yet, and reports whether it did. An existing
+// source secret is left as it is, and nothing is created without a
+// credential. The creation goes through write, so that only the leader
+// bootstraps.
+func (r *imagePullSecretsReconciler) bootstrapSourceSecret(source *credentials.Secret, provider credentials.Provider) (bool, error) {
+	ctx, cancel := r.callContext()
+	defer cancel()
+
+	dockerConfigJSON, _, err := provider.GetDockerConfigJSON(ctx)
+	if err != nil {
+		return false, fmt.Errorf("reading the bootstrap credential: %w", err)
+	}
+	if len(dockerConfigJSON) == 0 {
+		klog.Warningf("not bootstrapping source secret %s/%s: no credential in --dockerconfigjson-file or AURORA_SECRET_DOCKERCONFIGJSON", source.Namespace, source.Name)
+		return false, nil
+	}
+
+	var created bool
+	err = r.write(func(ctx context.Context) error {
+		created, err = source.Bootstrap(ctx, dockerConfigJSON)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if created {
+		klog.Infof("bootstrapped source secret %s/%s", source.Namespace, source.Name)
+	} else {
+		klog.V(4).Infof("source secret %s/%s already exists, not bootstrapping it", source.Namespace, source.Name)
+	}
+
+	return created, nil
+}
+
+// bootstrapCredential returns the provider of the credential the source
+// secret is bootstrapped from.
+func bootstrapCredential() credentials.Provider {
+	var provider credentials.Provider = credentials.Env("AURORA_SECRET_DOCKERCONFIGJSON")
+	if dockerConfigJSONPath != "" {
+		provider = &credentials.File{Path: dockerConfigJSONPath}
+	}
+
+	return &credentials.Validated{Provider: provider, DecodeBase64: decodeBase64}
+}
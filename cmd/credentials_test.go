@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestBootstrapSourceSecret(t *testing.T) {
+	const existingDockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"b3duZXI6a2VlcA=="}}}`
+
+	existing := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-source", Namespace: "aurora-system"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(existingDockerConfigJSON)},
+	}
+
+	tests := []struct {
+		name       string
+		existing   *corev1.Secret
+		credential string
+		leadership *leadership
+		created    bool
+		wantErr    error
+		// want is the credential of the source secret afterwards, empty if
+		// it does not exist.
+		want string
+	}{
+		{name: "missing", credential: testDockerConfigJSON, created: true, want: testDockerConfigJSON},
+		{name: "existing not overwritten", existing: existing, credential: testDockerConfigJSON, want: existingDockerConfigJSON},
+		{name: "no credential", credential: ""},
+		{name: "standby", credential: testDockerConfigJSON, leadership: &leadership{}, wantErr: errNotLeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing.DeepCopy())
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.leadership = tt.leadership
+			source := &credentials.Secret{KubeClient: kubeClient, Namespace: "aurora-system", Name: "registry-source", Key: corev1.DockerConfigJsonKey}
+
+			created, err := r.bootstrapSourceSecret(source, credentials.Static(tt.credential))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("bootstrapSourceSecret() = %v, want %v", err, tt.wantErr)
+			}
+			if created != tt.created {
+				t.Errorf("created = %v, want %v", created, tt.created)
+			}
+
+			if tt.want == "" {
+				if secretExists(t, kubeClient, "aurora-system", "registry-source") {
+					t.Error("source secret created")
+				}
+				return
+			}
+			dockerConfigJSON, _, err := source.GetDockerConfigJSON(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dockerConfigJSON) != tt.want {
+				t.Errorf("source credential = %s, want %s", dockerConfigJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerConfigJSONFileUpdate(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, oldHostDockerConfigJSON))
+
+	path := filepath.Join(t.TempDir(), ".dockerconfigjson")
+	if err := os.WriteFile(path, []byte(oldHostDockerConfigJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r.credentials = credentials.NewCache(&credentials.File{Path: path}, 0)
+	if _, err := r.credentials.Refresh(r.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	controller := runNamespacesController(t, r, kubeClient, nil)
+	go r.credentials.Run(r.ctx, func() { controller.EnqueueAll() })
+
+	// Rewrite the file until the watch, started asynchronously, observes
+	// it and the resync updates the secret.
+	err := wait.PollUntilContextTimeout(r.ctx, 50*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		if err := os.WriteFile(path, []byte(testDockerConfigJSON), 0o600); err != nil {
+			return false, err
+		}
+		secret, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return string(secret.Data[corev1.DockerConfigJsonKey]) == testDockerConfigJSON, nil
+	})
+	if err != nil {
+		t.Errorf("secret team/%s not updated with the file's credential: %v", testSecretName, err)
+	}
+}
+
+func TestNewCredentialProvider(t *testing.T) {
+	const fileDockerConfigJSON = `{"auths":{"file.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+
+	path := filepath.Join(t.TempDir(), ".dockerconfigjson")
+	if err := os.WriteFile(path, []byte(fileDockerConfigJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AURORA_SECRET_DOCKERCONFIGJSON", testDockerConfigJSON)
+
+	tests := []struct {
+		name      string
+		sources   []string
+		conflicts string
+		file      string
+		want      string
+		wantErr   string
+	}{
+		{name: "env", sources: []string{"env"}, want: testDockerConfigJSON},
+		{name: "file", sources: []string{"file"}, file: path, want: fileDockerConfigJSON},
+		{name: "merged", sources: []string{"env", "file"}, file: path,
+			want: `{"auths":{"file.example.com":{"auth":"dXNlcjpwYXNz"},"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`},
+		{name: "file without path", sources: []string{"file"}, wantErr: "--dockerconfigjson-file is required with --credential-source=file"},
+		{name: "unknown source", sources: []string{"vault"}, wantErr: `unknown credential source "vault"`},
+		{name: "unknown conflict policy", sources: []string{"env"}, conflicts: "first-wins", wantErr: `unknown --credential-conflicts "first-wins", expected last-wins or error`},
+		{name: "no source", wantErr: "--credential-source is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(sources []string, conflicts, file string) {
+				credentialSources, credentialConflicts, dockerConfigJSONPath = sources, conflicts, file
+			}(credentialSources, credentialConflicts, dockerConfigJSONPath)
+			credentialSources, credentialConflicts, dockerConfigJSONPath = tt.sources, string(credentials.ConflictLastWins), tt.file
+			if tt.conflicts != "" {
+				credentialConflicts = tt.conflicts
+			}
+
+			provider, err := newCredentialProvider(nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("newCredentialProvider = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newCredentialProvider = %v", err)
+			}
+
+			got, _, err := provider.GetDockerConfigJSON(context.Background())
+			if err != nil {
+				t.Fatalf("GetDockerConfigJSON = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetDockerConfigJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialPollResync(t *testing.T) {
+	const (
+		env          = "AURORA_TEST_DOCKERCONFIGJSON"
+		pollInterval = 20 * time.Millisecond
+	)
+
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, oldHostDockerConfigJSON))
+	t.Setenv(env, oldHostDockerConfigJSON)
+	// Environment variables are never watched, so changes are only seen by
+	// polling.
+	r.credentials = credentials.NewCache(credentials.Env(env), pollInterval)
+	if _, err := r.credentials.Refresh(r.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var resyncs atomic.Int32
+	controller := runNamespacesController(t, r, kubeClient, nil)
+	go r.credentials.Run(r.ctx, func() {
+		resyncs.Add(1)
+		controller.EnqueueAll()
+	})
+
+	// An unchanged credential triggers no resync.
+	time.Sleep(5 * pollInterval)
+	if got := resyncs.Load(); got != 0 {
+		t.Errorf("resyncs of an unchanged credential = %d, want 0", got)
+	}
+
+	os.Setenv(env, testDockerConfigJSON)
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		secret, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return string(secret.Data[corev1.DockerConfigJsonKey]) == testDockerConfigJSON, nil
+	})
+	if err != nil {
+		t.Errorf("secret team/%s not updated with the polled credential: %v", testSecretName, err)
+	}
+	if got := resyncs.Load(); got != 1 {
+		t.Errorf("resyncs after a credential change = %d, want 1", got)
+	}
+}
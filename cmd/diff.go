@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// diffHashLength is the number of hex digits of the credential hashes
+// printed by the diff command.
+const diffHashLength = 12
+
+var (
+	diffDockerConfigJSONPath string
+	diffRegistryConfigPath   string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff NAMESPACE",
+	Short: "Show the differences between the desired and actual state of a namespace",
+	Long: `Show the differences between the desired and actual state of a namespace.
+
+The image pull secrets the controller would provision in the namespace, and
+the references it would add to its service accounts, are computed with the
+reconcile logic and compared with what exists in the cluster. Credentials are
+never printed: they are compared by hash, along with their registry hosts.
+
+The desired default credential is read from --dockerconfigjson-file, or else
+from AURORA_SECRET_DOCKERCONFIGJSON, and the additional secrets and mappings
+from --registry-config. Service account exclusions and the reference service
+account mode are not taken into account. The cluster is only read, never
+modified.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if os.Getenv("AURORA_SECRET_NAME") == "" {
+			return fmt.Errorf("AURORA_SECRET_NAME is required")
+		}
+
+		var provider credentials.Provider = credentials.Env("AURORA_SECRET_DOCKERCONFIGJSON")
+		if diffDockerConfigJSONPath != "" {
+			provider = &credentials.File{Path: diffDockerConfigJSONPath}
+		}
+		credentialsCache := credentials.NewCache(provider, 0)
+		if _, err := credentialsCache.Refresh(cmd.Context()); err != nil {
+			return fmt.Errorf("error reading the desired credential: %w", err)
+		}
+
+		var registries *registryConfig
+		if diffRegistryConfigPath != "" {
+			var err error
+			if registries, err = loadRegistryConfig(diffRegistryConfigPath); err != nil {
+				return fmt.Errorf("error loading registry config: %w", err)
+			}
+		}
+
+		cfg, err := buildConfig()
+		if err != nil {
+			return fmt.Errorf("error building kubeconfig: %w", err)
+		}
+		cfg.UserAgent = userAgentFor(cmd)
+
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %w", err)
+		}
+
+		// The reconciler only computes the desired state: it is given no
+		// listers, and never writes.
+		reconciler := &imagePullSecretsReconciler{
+			registries:  registries,
+			credentials: credentialsCache,
+		}
+
+		return diffNamespace(cmd.Context(), kubeClient, reconciler, args[0], os.Stdout)
+	},
+}
+
+// diffNamespace writes the differences between the desired state of the
+// namespace, as computed by the reconciler, and its actual state.
+func diffNamespace(ctx context.Context, kubeClient kubernetes.Interface, r *imagePullSecretsReconciler, name string, w io.Writer) error {
+	namespace, err := kubeClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting namespace %s: %w", name, err)
+	}
+
+	managed, reason := r.namespacePlan(namespace)
+	if !managed {
+		fmt.Fprintf(w, "Namespace %s is skipped: %s\n", name, reason)
+		return nil
+	}
+	fmt.Fprintf(w, "Namespace %s is managed: %s\n", name, reason)
+
+	for _, desired := range r.generateSecrets(namespace) {
+		current, err := kubeClient.CoreV1().Secrets(name).Get(ctx, desired.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			current = nil
+		} else if err != nil {
+			return fmt.Errorf("getting secret %s/%s: %w", name, desired.Name, err)
+		}
+
+		writeDiff(w, "Secret "+name+"/"+desired.Name, secretDiff(current, desired, namespace))
+	}
+
+	serviceAccounts, err := kubeClient.CoreV1().ServiceAccounts(name).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing service accounts of namespace %s: %w", name, err)
+	}
+	sort.Slice(serviceAccounts.Items, func(i, j int) bool {
+		return serviceAccounts.Items[i].Name < serviceAccounts.Items[j].Name
+	})
+
+	names := r.imagePullSecretNames(namespace)
+	for i := range serviceAccounts.Items {
+		serviceAccount := &serviceAccounts.Items[i]
+
+		var changes []string
+		for _, missing := range missingImagePullSecrets(serviceAccount, names) {
+			changes = append(changes, "+ imagePullSecrets: "+missing)
+		}
+		writeDiff(w, "ServiceAccount "+name+"/"+serviceAccount.Name, changes)
+	}
+
+	return nil
+}
+
+// secretDiff returns the changes that would bring the current secret, nil if
+// it does not exist, to the desired one. Credentials are only described by
+// their hash and registry hosts.
+func secretDiff(current, desired *corev1.Secret, namespace *corev1.Namespace) []string {
+	if current == nil {
+		return []string{"+ created, " + describeCredential(desired.Data[corev1.DockerConfigJsonKey])}
+	}
+
+	var changes []string
+	if current.Labels[managedByLabel] != managedByValue {
+		changes = append(changes, fmt.Sprintf("! not labelled %s=%s: only taken over with --adopt-existing-secrets", managedByLabel, managedByValue))
+	}
+	if current.Type != desired.Type {
+		changes = append(changes, fmt.Sprintf("~ type: %s -> %s, recreated", current.Type, desired.Type))
+	}
+	if !isOwnedByNamespace(current, namespace) {
+		changes = append(changes, "~ ownerReferences: + Namespace "+namespace.Name)
+	}
+
+	for _, key := range sets.List(sets.KeySet(desired.Labels)) {
+		if key == managedByLabel {
+			continue
+		}
+		if value, ok := current.Labels[key]; !ok || value != desired.Labels[key] {
+			changes = append(changes, fmt.Sprintf("~ labels[%s]: %q -> %q", key, value, desired.Labels[key]))
+		}
+	}
+	for _, key := range sets.List(sets.KeySet(desired.Annotations)) {
+		if value, ok := current.Annotations[key]; !ok || value != desired.Annotations[key] {
+			changes = append(changes, redact.String(fmt.Sprintf("~ annotations[%s]: %q -> %q", key, value, desired.Annotations[key])))
+		}
+	}
+
+	currentData, desiredData := current.Data[corev1.DockerConfigJsonKey], desired.Data[corev1.DockerConfigJsonKey]
+	if credentialHash(currentData) != credentialHash(desiredData) {
+		changes = append(changes, fmt.Sprintf("~ data[%s]: %s -> %s", corev1.DockerConfigJsonKey, describeCredential(currentData), describeCredential(desiredData)))
+	}
+
+	return changes
+}
+
+// describeCredential describes a dockerconfigjson by its hash and registry
+// hosts, without its content.
+func describeCredential(dockerConfigJSON []byte) string {
+	if len(dockerConfigJSON) == 0 {
+		return "empty"
+	}
+
+	return fmt.Sprintf("sha256:%s %v", credentialHash(dockerConfigJSON)[:diffHashLength], sets.List(registryHosts(dockerConfigJSON)))
+}
+
+// writeDiff writes the changes of an object, or that it is in sync.
+func writeDiff(w io.Writer, object string, changes []string) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s: in sync\n", object)
+		return
+	}
+
+	fmt.Fprintf(w, "%s:\n", object)
+	for _, change := range changes {
+		fmt.Fprintf(w, "  %s\n", change)
+	}
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffDockerConfigJSONPath, "dockerconfigjson-file", "", "Path to the desired default dockerconfigjson; defaults to AURORA_SECRET_DOCKERCONFIGJSON")
+	diffCmd.Flags().StringVar(&diffRegistryConfigPath, "registry-config", "", "Path to the registry config file defining the credential mappings and additional secrets")
+
+	rootCmd.AddCommand(diffCmd)
+}
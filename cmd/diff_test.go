@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDiffNamespaceRedacted(t *testing.T) {
+	const (
+		staleDockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"b2xkOnBhc3M="}}}`
+		authAnnotation        = "example.com/registry-auth"
+	)
+
+	drifted := testNamespace("drifted", nil)
+	annotated := testNamespace("annotated", nil)
+	annotated.Annotations = map[string]string{authAnnotation: testDockerConfigJSON}
+
+	tests := []struct {
+		name      string
+		namespace string
+		want      []string
+	}{
+		{name: "missing secret", namespace: "missing", want: []string{"+ created, sha256:", "[registry.example.com]"}},
+		{name: "drifted credential", namespace: "drifted", want: []string{"~ data[.dockerconfigjson]: sha256:"}},
+		{name: "credential in an annotation", namespace: "annotated", want: []string{"~ annotations[" + authAnnotation + "]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, kubeClient := newTestReconciler(t,
+				testNamespace("missing", nil),
+				drifted, testSecret(drifted, testSecretName, staleDockerConfigJSON),
+				annotated, testSecret(annotated, testSecretName, testDockerConfigJSON),
+			)
+			r.copyAnnotations = []string{authAnnotation}
+
+			var out bytes.Buffer
+			if err := diffNamespace(context.Background(), kubeClient, r, tt.namespace, &out); err != nil {
+				t.Fatalf("diffNamespace() = %v", err)
+			}
+
+			for _, credential := range []string{"dXNlcjpwYXNz", "b2xkOnBhc3M=", "user:pass"} {
+				if strings.Contains(out.String(), credential) {
+					t.Errorf("diff contains the credential %s:\n%s", credential, out.String())
+				}
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("diff does not contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"k8s.io/klog"
+)
+
+const (
+	// emergencyStopEnv engages the emergency stop when set to true.
+	emergencyStopEnv = "AURORA_CONTROLLER_DISABLED"
+
+	// emergencyStopRecheckDelay is how long a sync stopped at a write by the
+	// emergency stop waits before it is retried.
+	emergencyStopRecheckDelay = 30 * time.Second
+)
+
+// emergencyStop is a break-glass switch halting every write without a
+// restart. It is engaged by the AURORA_CONTROLLER_DISABLED environment
+// variable, or by the content of a file, typically mounted from a ConfigMap,
+// both checked on every write.
+type emergencyStop struct {
+	// path is the file holding true to engage the stop. Empty only checks
+	// the environment.
+	path string
+
+	engaged atomic.Bool
+}
+
+// check returns a requeue error while the stop is engaged, logging when it is
+// engaged and released. A nil stop never engages.
+func (s *emergencyStop) check() error {
+	if s == nil {
+		return nil
+	}
+
+	source, engaged := s.source()
+	if !engaged {
+		if s.engaged.CompareAndSwap(true, false) {
+			klog.Warning("EMERGENCY STOP RELEASED: resuming writes")
+		}
+		return nil
+	}
+
+	if s.engaged.CompareAndSwap(false, true) {
+		klog.Errorf("EMERGENCY STOP ENGAGED by %s: every write is skipped until it is released", source)
+	}
+
+	return requeue.After(emergencyStopRecheckDelay, "writes are disabled by the emergency stop")
+}
+
+// source returns what engages the stop, if anything. A file that exists but
+// cannot be read or parsed engages it, so that a broken brake fails closed.
+func (s *emergencyStop) source() (string, bool) {
+	if disabled, _ := strconv.ParseBool(os.Getenv(emergencyStopEnv)); disabled {
+		return emergencyStopEnv, true
+	}
+
+	if s.path == "" {
+		return "", false
+	}
+
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return "", false
+	}
+	if err != nil {
+		klog.Errorf("error reading emergency stop file %s: %v", s.path, err)
+		return s.path, true
+	}
+
+	text := strings.TrimSpace(string(content))
+	if text == "" {
+		return "", false
+	}
+
+	disabled, err := strconv.ParseBool(text)
+	if err != nil {
+		klog.Errorf("error parsing emergency stop file %s, expected true or false: %v", s.path, err)
+		return s.path, true
+	}
+
+	return s.path, disabled
+}
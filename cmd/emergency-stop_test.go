@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+)
+
+func TestEmergencyStopSource(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		// file is the content of the stop file, which does not exist when
+		// empty.
+		file    string
+		dir     bool
+		engaged bool
+	}{
+		{name: "nothing set"},
+		{name: "environment", env: "true", engaged: true},
+		{name: "environment false", env: "false"},
+		{name: "missing file"},
+		{name: "file true", file: "true\n", engaged: true},
+		{name: "file false", file: "false"},
+		{name: "empty file", file: "  \n"},
+		{name: "unparsable file fails closed", file: "yes please", engaged: true},
+		{name: "unreadable file fails closed", dir: true, engaged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(emergencyStopEnv, tt.env)
+
+			path := filepath.Join(t.TempDir(), "disabled")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.dir {
+				if err := os.Mkdir(path, 0o700); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := (&emergencyStop{path: path}).check()
+			if engaged := err != nil; engaged != tt.engaged {
+				t.Fatalf("check() = %v, want engaged %v", err, tt.engaged)
+			}
+			if err != nil {
+				if delay, ok := requeue.Delay(err); !ok || delay != emergencyStopRecheckDelay {
+					t.Errorf("requeue delay = %v, %v, want %v", delay, ok, emergencyStopRecheckDelay)
+				}
+			}
+		})
+	}
+
+	if err := (*emergencyStop)(nil).check(); err != nil {
+		t.Errorf("nil stop check() = %v, want nil", err)
+	}
+}
+
+func TestEmergencyStopToggled(t *testing.T) {
+	t.Setenv(emergencyStopEnv, "")
+	path := filepath.Join(t.TempDir(), "disabled")
+	setStop := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, second := testNamespace("first", nil), testNamespace("second", nil)
+	r, kubeClient := newTestReconciler(t, first, second)
+	r.emergencyStop = &emergencyStop{path: path}
+
+	// Engaged: the sync is requeued, without any write.
+	setStop("true")
+	err := r.syncNamespace(first)
+	if delay, ok := requeue.Delay(err); !ok || delay != emergencyStopRecheckDelay {
+		t.Fatalf("engaged sync = %v, want a requeue after %v", err, emergencyStopRecheckDelay)
+	}
+	if writes := writeActions(kubeClient); len(writes) != 0 {
+		t.Fatalf("writes = %v, want none while engaged", writes)
+	}
+
+	// Released without a restart: the retried sync writes.
+	setStop("false")
+	if err := r.syncNamespace(first); err != nil {
+		t.Fatalf("released sync = %v", err)
+	}
+	if !secretExists(t, kubeClient, "first", testSecretName) {
+		t.Fatal("secret first/" + testSecretName + " not created once released")
+	}
+	if r.emergencyStop.engaged.Load() {
+		t.Error("stop still marked engaged once released")
+	}
+
+	// Engaged again: the next sync stops at its first write.
+	writes := len(writeActions(kubeClient))
+	setStop("true")
+	if err := r.syncNamespace(second); !requeue.IsRequested(err) {
+		t.Fatalf("re-engaged sync = %v, want a requeue", err)
+	}
+	if got := writeActions(kubeClient); len(got) != writes {
+		t.Errorf("writes = %v, want no new write once re-engaged", got[writes:])
+	}
+	if !r.emergencyStop.engaged.Load() {
+		t.Error("stop not marked engaged")
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/signals"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// TestEnvtestImagePullSecrets runs the image-pull-secrets command against a
+// real API server and etcd, so that the wiring of its informers, handlers and
+// workqueues is exercised end to end. It needs the envtest binaries, located
+// by KUBEBUILDER_ASSETS: run task go:test:envtest. As the command registers
+// the signal handler, it can only run once per test binary.
+func TestEnvtestImagePullSecrets(t *testing.T) {
+	if testing.Short() || os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, run task go:test:envtest")
+	}
+
+	testEnv := &envtest.Environment{}
+	if _, err := testEnv.Start(); err != nil {
+		t.Fatalf("starting envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := testEnv.Stop(); err != nil {
+			t.Errorf("stopping envtest: %v", err)
+		}
+	})
+
+	user, err := testEnv.AddUser(envtest.User{Name: "aurora-controller", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := user.KubeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, config, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(user.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("AURORA_SECRET_NAME", testSecretName)
+	t.Setenv("AURORA_SECRET_DOCKERCONFIGJSON", testDockerConfigJSON)
+
+	rootCmd.SetArgs([]string{"image-pull-secrets", "--kubeconfig", kubeconfigPath})
+	done := make(chan error)
+	go func() { done <- rootCmd.Execute() }()
+	t.Cleanup(func() {
+		signals.RequestShutdown()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("image-pull-secrets = %v", err)
+			}
+		case <-time.After(30 * time.Second):
+			t.Error("image-pull-secrets did not shut down")
+		}
+	})
+
+	// Without a controller manager, the default service account of a new
+	// namespace is not created for it.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := kubeClient.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kubeClient.CoreV1().ServiceAccounts("team").Create(ctx, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		secret, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return string(secret.Data[corev1.DockerConfigJsonKey]) == testDockerConfigJSON, nil
+	})
+	if err != nil {
+		t.Fatalf("secret team/%s not provisioned: %v", testSecretName, err)
+	}
+
+	err = wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(ctx, "default", metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
+			if imagePullSecret.Name == testSecretName {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("service account team/default does not reference %s: %v", testSecretName, err)
+	}
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
+)
+
+// exportPageSize is the number of objects requested per list page.
+const exportPageSize = 500
+
+var (
+	exportFormat     string
+	exportSecretName string
+)
+
+// namespaceReport is the managed state of a namespace.
+type namespaceReport struct {
+	Namespace string `json:"namespace"`
+
+	// SecretExists and SecretManaged report whether the secret exists and
+	// carries the managed-by label.
+	SecretExists  bool `json:"secretExists"`
+	SecretManaged bool `json:"secretManaged"`
+
+	// DataHash is the SHA-256 of the secret's dockerconfigjson, so that
+	// credentials can be compared without being exported.
+	DataHash string `json:"dataHash,omitempty"`
+
+	// ServiceAccounts are the service accounts referencing the secret.
+	ServiceAccounts []string `json:"serviceAccounts"`
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the managed state of every namespace",
+	Long: `Export the managed state of every namespace as a JSON or CSV report.
+
+For each namespace the report lists whether the managed image pull secret
+exists, a hash of its dockerconfigjson and the service accounts referencing
+it. The cluster is only read, never modified.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportFormat != "json" && exportFormat != "csv" {
+			return fmt.Errorf("unknown --format %q, expected json or csv", exportFormat)
+		}
+		if exportSecretName == "" {
+			return fmt.Errorf("--secret-name or AURORA_SECRET_NAME is required")
+		}
+
+		cfg, err := buildConfig()
+		if err != nil {
+			return fmt.Errorf("error building kubeconfig: %w", err)
+		}
+		cfg.UserAgent = userAgentFor(cmd)
+
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %w", err)
+		}
+
+		reports, err := buildReports(cmd.Context(), kubeClient, exportSecretName)
+		if err != nil {
+			return err
+		}
+
+		if exportFormat == "csv" {
+			return writeReportsCSV(os.Stdout, reports)
+		}
+
+		return writeReportsJSON(os.Stdout, reports)
+	},
+}
+
+// buildReports lists the namespaces, managed secrets and service accounts,
+// page by page, and returns the report of each namespace sorted by name.
+func buildReports(ctx context.Context, kubeClient kubernetes.Interface, secretName string) ([]*namespaceReport, error) {
+	reports := map[string]*namespaceReport{}
+
+	err := listEach(ctx, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.CoreV1().Namespaces().List(ctx, options)
+	}, metav1.ListOptions{}, func(obj runtime.Object) {
+		if namespace, ok := obj.(*corev1.Namespace); ok {
+			reports[namespace.Name] = &namespaceReport{Namespace: namespace.Name, ServiceAccounts: []string{}}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing namespaces: %w", err)
+	}
+
+	err = listEach(ctx, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, options)
+	}, metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", secretName).String()}, func(obj runtime.Object) {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok || secret.Name != secretName || reports[secret.Namespace] == nil {
+			return
+		}
+
+		report := reports[secret.Namespace]
+		report.SecretExists = true
+		report.SecretManaged = secret.Labels[managedByLabel] == managedByValue
+		report.DataHash = credentialHash(secret.Data[corev1.DockerConfigJsonKey])
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing secrets: %w", err)
+	}
+
+	err = listEach(ctx, func(options metav1.ListOptions) (runtime.Object, error) {
+		return kubeClient.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, options)
+	}, metav1.ListOptions{}, func(obj runtime.Object) {
+		serviceAccount, ok := obj.(*corev1.ServiceAccount)
+		if !ok || reports[serviceAccount.Namespace] == nil {
+			return
+		}
+
+		if hasLocalObjectReference(serviceAccount.ImagePullSecrets, secretName) {
+			report := reports[serviceAccount.Namespace]
+			report.ServiceAccounts = append(report.ServiceAccounts, serviceAccount.Name)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing service accounts: %w", err)
+	}
+
+	sorted := make([]*namespaceReport, 0, len(reports))
+	for _, report := range reports {
+		sort.Strings(report.ServiceAccounts)
+		sorted = append(sorted, report)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Namespace < sorted[j].Namespace
+	})
+
+	return sorted, nil
+}
+
+// listEach runs fn for each object returned by list, page by page.
+func listEach(ctx context.Context, list func(metav1.ListOptions) (runtime.Object, error), options metav1.ListOptions, fn func(runtime.Object)) error {
+	listPager := pager.New(pager.SimplePageFunc(list))
+	listPager.PageSize = exportPageSize
+
+	return listPager.EachListItem(ctx, options, func(obj runtime.Object) error {
+		fn(obj)
+		return nil
+	})
+}
+
+// writeReportsJSON writes the reports as an indented JSON array.
+func writeReportsJSON(w io.Writer, reports []*namespaceReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reports)
+}
+
+// writeReportsCSV writes the reports as CSV with a header row. The service
+// accounts of a namespace are joined with semicolons.
+func writeReportsCSV(w io.Writer, reports []*namespaceReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"namespace", "secret_exists", "secret_managed", "data_hash", "service_accounts"}); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		err := writer.Write([]string{
+			report.Namespace,
+			strconv.FormatBool(report.SecretExists),
+			strconv.FormatBool(report.SecretManaged),
+			report.DataHash,
+			strings.Join(report.ServiceAccounts, ";"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "json", "Report format: json or csv")
+	exportCmd.Flags().StringVar(&exportSecretName, "secret-name", os.Getenv("AURORA_SECRET_NAME"), "Name of the managed secret in each namespace")
+
+	rootCmd.AddCommand(exportCmd)
+}
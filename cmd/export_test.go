@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExportReports(t *testing.T) {
+	team := testNamespace("team", nil)
+	unmanaged := testNamespace("unmanaged", nil)
+	unmanagedSecret := testSecret(unmanaged, testSecretName, testDockerConfigJSON)
+	unmanagedSecret.Labels = nil
+	kubeClient := fake.NewSimpleClientset(
+		team, testSecret(team, testSecretName, testDockerConfigJSON), testSecret(team, "other", testDockerConfigJSON),
+		testServiceAccount("team", "default", testSecretName), testServiceAccount("team", "builder", "other", testSecretName), testServiceAccount("team", "runner", "other"),
+		unmanaged, unmanagedSecret,
+		testNamespace("missing", nil), testServiceAccount("missing", "default"),
+	)
+
+	reports, err := buildReports(context.Background(), kubeClient, testSecretName)
+	if err != nil {
+		t.Fatalf("buildReports() = %v", err)
+	}
+
+	hash := credentialHash([]byte(testDockerConfigJSON))
+	want := []*namespaceReport{
+		{Namespace: "missing", ServiceAccounts: []string{}},
+		{Namespace: "team", SecretExists: true, SecretManaged: true, DataHash: hash, ServiceAccounts: []string{"builder", "default"}},
+		{Namespace: "unmanaged", SecretExists: true, DataHash: hash, ServiceAccounts: []string{}},
+	}
+	if !reflect.DeepEqual(reports, want) {
+		for _, report := range reports {
+			t.Logf("%+v", *report)
+		}
+		t.Fatalf("buildReports() returned unexpected reports")
+	}
+	if writes := writeActions(kubeClient); len(writes) > 0 {
+		t.Errorf("writes = %v, want none", writes)
+	}
+
+	var csv bytes.Buffer
+	if err := writeReportsCSV(&csv, reports); err != nil {
+		t.Fatalf("writeReportsCSV() = %v", err)
+	}
+	wantCSV := "namespace,secret_exists,secret_managed,data_hash,service_accounts\n" +
+		"missing,false,false,,\n" +
+		"team,true,true," + hash + ",builder;default\n" +
+		"unmanaged,true,false," + hash + ",\n"
+	if csv.String() != wantCSV {
+		t.Errorf("CSV report =\n%s\nwant\n%s", csv.String(), wantCSV)
+	}
+
+	var json bytes.Buffer
+	if err := writeReportsJSON(&json, reports[:1]); err != nil {
+		t.Fatalf("writeReportsJSON() = %v", err)
+	}
+	wantJSON := `[
+  {
+    "namespace": "missing",
+    "secretExists": false,
+    "secretManaged": false,
+    "serviceAccounts": []
+  }
+]
+`
+	if json.String() != wantJSON {
+		t.Errorf("JSON report =\n%s\nwant\n%s", json.String(), wantJSON)
+	}
+}
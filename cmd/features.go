@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/gccloudone-aurora/aurora-controller/pkg/featuregate"
+)
+
+const (
+	// skipCompliantResyncs skips the periodic resyncs of service accounts that
+	// already reference the image pull secret.
+	skipCompliantResyncs featuregate.Feature = "SkipCompliantResyncs"
+
+	// namespaceFairQueue shares the service accounts workers fairly between
+	// namespaces.
+	namespaceFairQueue featuregate.Feature = "NamespaceFairQueue"
+)
+
+// featureGates holds the features set with --feature-gates.
+var featureGates = featuregate.New(map[featuregate.Feature]featuregate.Spec{
+	skipCompliantResyncs: {Default: true, Stage: featuregate.Beta},
+	namespaceFairQueue:   {Default: false, Stage: featuregate.Alpha},
+})
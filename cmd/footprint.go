@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// objectCounter is an informer event handler keeping track of the cached
+// objects matching a predicate, and setting a gauge to their number as they
+// are added, updated and deleted.
+type objectCounter struct {
+	matches func(obj interface{}) bool
+	set     func(float64)
+
+	mu   sync.Mutex
+	keys sets.Set[string]
+}
+
+func newObjectCounter(matches func(obj interface{}) bool, set func(float64)) *objectCounter {
+	return &objectCounter{
+		matches: matches,
+		set:     set,
+		keys:    sets.New[string](),
+	}
+}
+
+func (c *objectCounter) OnAdd(obj interface{}, isInInitialList bool) {
+	c.observe(obj, c.matches(obj))
+}
+
+func (c *objectCounter) OnUpdate(old, new interface{}) {
+	c.observe(new, c.matches(new))
+}
+
+func (c *objectCounter) OnDelete(obj interface{}) {
+	c.observe(obj, false)
+}
+
+// observe records whether the object matches, and updates the gauge when the
+// count changes.
+func (c *objectCounter) observe(obj interface{}, matches bool) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("error getting the key of a counted object: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := c.keys.Len()
+	if matches {
+		c.keys.Insert(key)
+	} else {
+		c.keys.Delete(key)
+	}
+
+	if c.keys.Len() != count {
+		c.set(float64(c.keys.Len()))
+	}
+}
+
+// isManagedSecret reports whether the object is a secret carrying the
+// managed-by label.
+func isManagedSecret(obj interface{}) bool {
+	secret, ok := obj.(*corev1.Secret)
+	return ok && secret.Labels[managedByLabel] == managedByValue
+}
+
+// isInjectedServiceAccount reports whether the object is a service account
+// referencing one of the image pull secrets managed in its namespace.
+func (r *imagePullSecretsReconciler) isInjectedServiceAccount(obj interface{}) bool {
+	serviceAccount, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return false
+	}
+
+	namespace, _ := r.namespaceLister.Get(serviceAccount.Namespace)
+	managed := sets.New(r.managedImagePullSecretNames(namespace)...)
+	for _, reference := range serviceAccount.ImagePullSecrets {
+		if managed.Has(reference.Name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestManagedSecretsGauge(t *testing.T) {
+	team := testNamespace("team", nil)
+	managed := testSecret(team, testSecretName, testDockerConfigJSON)
+	unmanaged := testSecret(team, "other-pull", testDockerConfigJSON)
+	unmanaged.Labels = nil
+	metrics.ManagedSecrets.Set(0)
+	counter := newObjectCounter(isManagedSecret, metrics.ManagedSecrets.Set)
+
+	steps := []struct {
+		name  string
+		event func()
+		want  float64
+	}{
+		{name: "managed secret added", event: func() { counter.OnAdd(managed, true) }, want: 1},
+		{name: "unmanaged secret added", event: func() { counter.OnAdd(unmanaged, false) }, want: 1},
+		{name: "managed secret resynced", event: func() { counter.OnUpdate(managed, managed) }, want: 1},
+		{name: "unmanaged secret labelled", event: func() { counter.OnUpdate(unmanaged, testSecret(team, "other-pull", testDockerConfigJSON)) }, want: 2},
+		{name: "label removed", event: func() { counter.OnUpdate(testSecret(team, "other-pull", testDockerConfigJSON), unmanaged) }, want: 1},
+		{name: "managed secret deleted", event: func() {
+			counter.OnDelete(cache.DeletedFinalStateUnknown{Key: "team/" + testSecretName, Obj: managed})
+		}, want: 0},
+	}
+
+	for _, step := range steps {
+		step.event()
+		if got := testutil.ToFloat64(metrics.ManagedSecrets); got != step.want {
+			t.Errorf("%s: managed secrets = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestInjectedServiceAccountsGauge(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, _ := newTestReconciler(t, team)
+	metrics.InjectedServiceAccounts.Set(0)
+	counter := newObjectCounter(r.isInjectedServiceAccount, metrics.InjectedServiceAccounts.Set)
+
+	injected := testServiceAccount("team", "default", testSecretName)
+	builder := testServiceAccount("team", "builder", "other-pull", testSecretName)
+	uninjected := testServiceAccount("team", "builder", "other-pull")
+
+	steps := []struct {
+		name  string
+		event func()
+		want  float64
+	}{
+		{name: "injected service account added", event: func() { counter.OnAdd(injected, true) }, want: 1},
+		{name: "service account without the secret added", event: func() { counter.OnAdd(uninjected, false) }, want: 1},
+		{name: "service account injected", event: func() { counter.OnUpdate(uninjected, builder) }, want: 2},
+		{name: "reference removed", event: func() { counter.OnUpdate(builder, uninjected) }, want: 1},
+		{name: "injected service account deleted", event: func() { counter.OnDelete(injected) }, want: 0},
+	}
+
+	for _, step := range steps {
+		step.event()
+		if got := testutil.ToFloat64(metrics.InjectedServiceAccounts); got != step.want {
+			t.Errorf("%s: injected service accounts = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if r.isInjectedServiceAccount(&corev1.Secret{}) {
+		t.Error("isInjectedServiceAccount() = true for a secret")
+	}
+}
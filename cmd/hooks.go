@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/hooks"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/eventsink"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// metricsHook observes the provisioning time of the namespaces.
+var metricsHook = hooks.Funcs{
+	SecretCreated: func(namespace *corev1.Namespace, secret *corev1.Secret) {
+		metrics.NamespaceProvisionDuration.Observe(time.Since(namespace.CreationTimestamp.Time).Seconds())
+	},
+}
+
+// eventSinkHook pushes the created secrets, injected service accounts and
+// failed syncs to the event sink, with the credentials redacted from the
+// errors.
+func eventSinkHook(events *eventsink.Sink) hooks.Hook {
+	return hooks.Funcs{
+		SecretCreated: func(namespace *corev1.Namespace, secret *corev1.Secret) {
+			events.Send(eventsink.Event{Type: eventsink.TypeNormal, Reason: "SecretCreated", Namespace: secret.Namespace, Name: secret.Name, Message: "Image pull secret created"})
+		},
+		SAInjected: func(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+			events.Send(eventsink.Event{Type: eventsink.TypeNormal, Reason: "ServiceAccountInjected", Namespace: serviceAccount.Namespace, Name: serviceAccount.Name, Message: "Image pull secret added to the service account"})
+		},
+		Error: func(kind, namespace, name string, err error) {
+			events.Send(eventsink.Event{Type: eventsink.TypeWarning, Reason: "SyncFailed", Namespace: namespace, Name: name, Message: redact.Error(err)})
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/hooks"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// recordingHook returns a hook recording its calls to calls.
+func recordingHook(calls *[]string) hooks.Hook {
+	return hooks.Funcs{
+		SecretCreated: func(namespace *corev1.Namespace, secret *corev1.Secret) {
+			*calls = append(*calls, "created "+secret.Namespace+"/"+secret.Name)
+		},
+		SAInjected: func(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+			*calls = append(*calls, "injected "+serviceAccount.Namespace+"/"+serviceAccount.Name)
+		},
+		Error: func(kind, namespace, name string, err error) {
+			*calls = append(*calls, "error "+kind+" "+namespace+"/"+name)
+		},
+	}
+}
+
+func TestReconcileHooks(t *testing.T) {
+	team := testNamespace("team", nil)
+	paused := testNamespace("team", nil)
+	paused.Annotations = map[string]string{pauseUntilAnnotation: time.Now().Add(time.Hour).Format(time.RFC3339)}
+
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		objects   []runtime.Object
+		// failCreate makes the secret creation fail.
+		failCreate bool
+		want       []string
+	}{
+		{
+			name:      "provisioned",
+			namespace: team,
+			objects:   []runtime.Object{testServiceAccount("team", "default")},
+			want:      []string{"created team/" + testSecretName, "injected team/default"},
+		},
+		{
+			name:      "already provisioned",
+			namespace: team,
+			objects: []runtime.Object{
+				testSecret(team, testSecretName, testDockerConfigJSON),
+				testServiceAccount("team", "default", testSecretName),
+			},
+		},
+		{
+			name:       "failed",
+			namespace:  team,
+			objects:    []runtime.Object{testServiceAccount("team", "default", testSecretName)},
+			failCreate: true,
+			want:       []string{"error Namespace team/"},
+		},
+		{
+			name:      "requeued",
+			namespace: paused,
+			objects:   []runtime.Object{testServiceAccount("team", "default")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, kubeClient := newTestReconciler(t, append([]runtime.Object{tt.namespace}, tt.objects...)...)
+			if tt.failCreate {
+				kubeClient.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.NewForbidden(corev1.Resource("secrets"), testSecretName, nil)
+				})
+			}
+			var calls []string
+			r.hooks.Add(recordingHook(&calls))
+
+			r.syncNamespaceAndNotify(tt.namespace)
+			r.syncServiceAccountAndNotify(tt.objects[len(tt.objects)-1].(*corev1.ServiceAccount))
+
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("hook calls = %q, want %q", calls, tt.want)
+			}
+		})
+	}
+}
@@ -2,24 +2,131 @@ package cmd
 
 import (
 	"context"
+	"math"
 	"os"
-	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/batch"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
 	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/namespaces"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
 	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/serviceaccounts"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/eventsink"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/heartbeat"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/logsampler"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
 	"github.com/gccloudone-aurora/aurora-controller/pkg/signals"
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 )
 
+var (
+	registryConfigPath   string
+	metricsBindAddress   string
+	healthBindAddress    string
+	enableShutdown       bool
+	statusAPI            bool
+	fieldManagerName     string
+	skipDeletionLabeled  string
+	unifiedReconcile     bool
+	waitForSecret        bool
+	cacheMissRetries     int
+	namespaceResync      time.Duration
+	serviceAccountResync time.Duration
+	secretResync         time.Duration
+	convergenceDeadline  time.Duration
+	adoptExistingSecrets bool
+	writeRateLimit       float64
+	maxWritesPerRun      int
+	maxWritesWindow      time.Duration
+	confirmMassChange    bool
+	credentialSources    []string
+	credentialConflicts  string
+	dockerConfigJSONPath string
+	fallbackDockerConfig string
+	decodeBase64         bool
+	sourceSecretRef      string
+	sourceSecretKey      string
+	acrRegistry          string
+	acrIdentity          string
+	acrClientID          string
+	acrTenantID          string
+	serviceAccountMode   string
+	serviceAccountPoll   time.Duration
+	saUpdateStrategy     string
+	secretUpdateStrategy string
+	minUpdateInterval    time.Duration
+	requireOwnerKind     string
+	requireOwnerLabel    string
+	logSampleRate        float64
+	excludeNamespaces    []string
+	excludeSAs           []string
+	secretCopyLabels     []string
+	secretCopyAnnots     []string
+	heartbeatLease       bool
+	leaderElect          bool
+	leaderElectLease     time.Duration
+	leaderElectRenew     time.Duration
+	leaderElectRetry     time.Duration
+	heartbeatInterval    time.Duration
+	apiCallTimeout       time.Duration
+	transientErrorDelay  time.Duration
+	minServerVersion     string
+	saExcludeSelector    string
+	namespaceSelector    string
+	namespaceSelectors   []string
+	nsSelectorMode       string
+	nsExcludeSelectors   []string
+	saSelector           string
+	onceThenWatch        bool
+	sequenceStartup      bool
+	saRevalidate         time.Duration
+	createOnly           bool
+	cleanupOnShutdown    bool
+	reactivePullSecret   bool
+	eventWebhook         string
+	monitorPullResults   bool
+	logNamespacePlan     bool
+	prioritySelector     string
+	provisionDelay       time.Duration
+	namespaceSettleDelay time.Duration
+	pruneOrphans         bool
+	namespaceListConfig  string
+	referenceSA          string
+	readOnly             bool
+	emergencyStopFile    string
+	removeInapplicable   bool
+	forceApply           bool
+	bootstrapSource      bool
+	credentialHashAnnot  bool
+	secretNameOverride   bool
+	sweepBatchSize       int
+	sweepBatchDelay      time.Duration
+	credentialPoll       time.Duration
+
+	requireNonemptyCredentials bool
+
+	defaultDenyNetworkPolicy bool
+	resourceQuotaHard        string
+)
+
 var imagePullSecretsCmd = &cobra.Command{
 	Use:   "image-pull-secrets",
 	Short: "Configure image pull secrets for Aurora resources",
@@ -29,175 +136,1018 @@ var imagePullSecretsCmd = &cobra.Command{
 		stopCh := signals.SetupSignalHandler()
 
 		// Create Kubernetes config
-		cfg, err := clientcmd.BuildConfigFromFlags(apiserver, kubeconfig)
+		cfg, err := buildConfig()
 		if err != nil {
 			klog.Fatalf("error building kubeconfig: %v", err)
 		}
+		cfg.UserAgent = userAgentFor(cmd)
 
 		kubeClient, err := kubernetes.NewForConfig(cfg)
 		if err != nil {
 			klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
 		}
 
-		// Setup informers
-		kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Minute*5)
+		// Fail fast with a report when permissions are missing
+		if preflightRBAC {
+			if err := checkPermissions(context.Background(), kubeClient.AuthorizationV1(), requiredPermissions(), os.Stdout); err != nil {
+				klog.Fatalf("preflight RBAC check failed: %v", err)
+			}
+		}
+
+		if gates := featureGates.String(); gates != "" {
+			klog.Infof("Feature gates: %s", gates)
+		}
 
-		// Namespaces informer
-		namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
+		// Warn early when running against a cluster that is too old
+		if minServerVersion != "" {
+			if err := checkServerVersion(kubeClient.Discovery(), minServerVersion); err != nil {
+				klog.Errorf("error checking server version: %v", err)
+			}
+		}
 
-		// Serviceaccount informer
-		serviceAccountsInformer := kubeInformerFactory.Core().V1().ServiceAccounts()
-		// serviceAccountsLister := serviceAccountsInformer.Lister()
+		// A read-only controller performs no write at all.
+		if readOnly && (cleanupOnShutdown || heartbeatLease || pruneOrphans || leaderElect) {
+			klog.Fatalf("--read-only cannot be combined with --cleanup-on-shutdown, --heartbeat-lease, --prune-orphans or --leader-elect")
+		}
 
-		// Secrets informer
-		secretsInformer := kubeInformerFactory.Core().V1().Secrets()
-		secretsLister := secretsInformer.Lister()
+		// Setup events. In read-only mode they are only logged.
+		eventBroadcaster := record.NewBroadcaster()
+		if readOnly {
+			eventBroadcaster.StartLogging(klog.Infof)
+		} else {
+			eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+		}
+		defer eventBroadcaster.Shutdown()
+		recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "aurora-controller"})
 
-		// Setup controller
-		controllerServiceAccounts := serviceaccounts.NewController(
-			serviceAccountsInformer,
-			func(serviceAccount *corev1.ServiceAccount) error {
-
-				found := false
-				for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
-					if imagePullSecret.Name == os.Getenv("AURORA_SECRET_NAME") {
-						found = true
-						break
-					}
-				}
+		// Push notifications to the event webhook
+		var events *eventsink.Sink
+		if eventWebhook != "" {
+			events = eventsink.New(eventWebhook, 1000)
+			go events.Run(stopCh)
+		}
+
+		// Serve metrics
+		if metricsBindAddress != "" {
+			go serveMetrics(metricsBindAddress, stopCh)
+		}
+
+		// Serve health probes. The controllers are ready once the informer
+		// caches are synced and, with a convergence deadline, stop being
+		// ready while objects have not converged past the deadline.
+		var synced atomic.Bool
+		namespacesConvergence := convergence.NewTracker("Namespaces")
+		serviceAccountsConvergence := convergence.NewTracker("ServiceAccounts")
+		startTime := time.Now()
+		ready := func() bool {
+			if !synced.Load() {
+				return false
+			}
+
+			if convergenceDeadline <= 0 || time.Since(startTime) < convergenceDeadline {
+				return true
+			}
+
+			return namespacesConvergence.Len()+serviceAccountsConvergence.Len() == 0
+		}
+
+		if enableShutdown && healthBindAddress == "" {
+			klog.Fatalf("--enable-shutdown-endpoint requires --health-probe-bind-address")
+		}
+		if statusAPI && healthBindAddress == "" {
+			klog.Fatalf("--status-api requires --health-probe-bind-address")
+		}
+
+		var namespacesStatus, serviceAccountsStatus *convergence.Status
+		if statusAPI {
+			namespacesStatus = convergence.NewStatus()
+			serviceAccountsStatus = convergence.NewStatus()
+		}
+		if healthBindAddress != "" {
+			go serveHealth(healthBindAddress, ready, enableShutdown, namespacesStatus, serviceAccountsStatus, stopCh)
+		}
+
+		// Detect the controller's own namespace via the downward API
+		podNamespace := os.Getenv("POD_NAMESPACE")
+		if podNamespace == "" {
+			klog.Warning("POD_NAMESPACE is not set, the controller's own namespace cannot be detected")
+		}
+
+		// Never inject the service account the controller runs as, so that it
+		// does not depend on the secrets it provisions
+		excludedServiceAccounts := sets.New(excludeSAs...)
+		if podServiceAccount := os.Getenv("POD_SERVICE_ACCOUNT"); podServiceAccount != "" && podNamespace != "" {
+			excludedServiceAccounts.Insert(podNamespace + "/" + podServiceAccount)
+		}
+
+		// Publish liveness as a Lease. With leader election, only the leader
+		// publishes it, once it runs the controllers.
+		var beat *heartbeat.Heartbeat
+		if heartbeatLease {
+			if podNamespace == "" {
+				klog.Fatalf("POD_NAMESPACE must be set to use --heartbeat-lease")
+			}
+
+			holder, err := podIdentity()
+			if err != nil {
+				klog.Fatalf("error getting hostname: %v", err)
+			}
+
+			beat = heartbeat.New(kubeClient, podNamespace, "aurora-controller-image-pull-secrets", holder, heartbeatInterval)
+			if !leaderElect {
+				go beat.Run(stopCh)
+			}
+		}
+
+		// Load the namespace to registry mapping
+		var registries *registryConfig
+		if registryConfigPath != "" {
+			if registries, err = loadRegistryConfig(registryConfigPath); err != nil {
+				klog.Fatalf("error loading registry config: %v", err)
+			}
+		}
+		if referenceSA != "" && len(registries.secretNames()) > 0 {
+			klog.Fatalf("--reference-sa cannot be combined with additional secrets in --registry-config")
+		}
+
+		// Cancel in-flight API calls on shutdown
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stopCh
+			cancel()
+		}()
+
+		// Setup the default credential source. Before --credential-source
+		// existed, setting --dockerconfigjson-file selected the file source.
+		if !cmd.Flags().Changed("credential-source") && dockerConfigJSONPath != "" {
+			credentialSources = []string{"file"}
+		}
+
+		credentialProvider, err := newCredentialProvider(kubeClient, stopCh)
+		if err != nil {
+			klog.Fatalf("error configuring credentials: %v", err)
+		}
+
+		// Report the build and the running configuration
+		metrics.BuildInfo.WithLabelValues(controllerVersion, controllerCommit).Set(1)
+		metrics.RegisterConfigInfo(configInfo())
+
+		// The source secret is created on first installation by the leader,
+		// once it runs the controllers.
+		var bootstrapSecret *credentials.Secret
+		if bootstrapSource {
+			if !sets.New(credentialSources...).Has("secret") {
+				klog.Fatalf("--bootstrap-source requires --credential-source=secret")
+			}
+			if readOnly {
+				klog.Fatalf("--read-only cannot be combined with --bootstrap-source")
+			}
+
+			if bootstrapSecret, err = newSourceSecret(kubeClient); err != nil {
+				klog.Fatalf("error configuring the source secret bootstrap: %v", err)
+			}
+		}
+
+		// Static credentials are re-read on the poll interval, as a fallback
+		// for the file watch; expiring ones are refreshed before they expire.
+		if credentialPoll < 0 {
+			klog.Fatalf("--credential-poll-interval must not be negative")
+		}
+		credentialsCache := credentials.NewCache(credentialProvider, credentialPoll)
+		if _, err := credentialsCache.Refresh(ctx); err != nil {
+			klog.Errorf("error fetching credentials, retrying in the background: %v", err)
+		}
+
+		// Parse the service account exclusion selector
+		var serviceAccountExcludeSelector labels.Selector
+		if saExcludeSelector != "" {
+			if serviceAccountExcludeSelector, err = labels.Parse(saExcludeSelector); err != nil {
+				klog.Fatalf("error parsing --sa-exclude-selector: %v", err)
+			}
+		}
+
+		// Parse the informer selectors
+		namespaceSelectorSet, err := newSelectorSet(namespaceSelectors, nsSelectorMode, nsExcludeSelectors)
+		if err != nil {
+			klog.Fatalf("error parsing the namespace selectors: %v", err)
+		}
+
+		var namespaceLabelSelector, serviceAccountSelector labels.Selector
+		if namespaceSelector != "" {
+			if namespaceLabelSelector, err = labels.Parse(namespaceSelector); err != nil {
+				klog.Fatalf("error parsing --namespace-selector: %v", err)
+			}
+		}
+		if saSelector != "" {
+			if serviceAccountSelector, err = labels.Parse(saSelector); err != nil {
+				klog.Fatalf("error parsing --sa-selector: %v", err)
+			}
+		}
+
+		if serviceAccountMode != "watch" && serviceAccountMode != "poll" {
+			klog.Fatalf("unknown --serviceaccount-mode %q, expected watch or poll", serviceAccountMode)
+		}
+		// Parse the namespace governance requirements
+		var requiredOwnerKind *schema.GroupKind
+		if requireOwnerKind != "" {
+			groupKind := schema.ParseGroupKind(requireOwnerKind)
+			requiredOwnerKind = &groupKind
+		}
+
+		var requiredOwnerSelector labels.Selector
+		if requireOwnerLabel != "" {
+			if requiredOwnerSelector, err = labels.Parse(requireOwnerLabel); err != nil {
+				klog.Fatalf("error parsing --require-owner-label: %v", err)
+			}
+		}
+
+		var deletionSelector labels.Selector
+		if skipDeletionLabeled != "" {
+			if deletionSelector, err = labels.Parse(skipDeletionLabeled); err != nil {
+				klog.Fatalf("error parsing --skip-deletion-labeled: %v", err)
+			}
+		}
+
+		if saUpdateStrategy != "optimistic" && saUpdateStrategy != "force" && saUpdateStrategy != "apply" {
+			klog.Fatalf("unknown --sa-update-strategy %q, expected optimistic, force or apply", saUpdateStrategy)
+		}
+		if forceApply && saUpdateStrategy != "apply" {
+			klog.Fatalf("--force-apply requires --sa-update-strategy=apply")
+		}
+		if secretUpdateStrategy != "patch" && secretUpdateStrategy != "update" {
+			klog.Fatalf("unknown --secret-update-strategy %q, expected patch or update", secretUpdateStrategy)
+		}
+		if serviceAccountMode == "poll" && serviceAccountPoll <= 0 {
+			klog.Fatalf("--serviceaccount-poll-interval must be positive")
+		}
+
+		// Setup informers. Namespaces, service accounts and secrets each get
+		// their own factory, so that they resync at their own period.
+		if namespaceResync < 0 || serviceAccountResync < 0 || secretResync < 0 {
+			klog.Fatalf("--namespace-resync, --serviceaccount-resync and --secret-resync must not be negative")
+		}
+		// Push the selectors down to the service accounts informer so that
+		// objects they filter out are never cached. The exclusion selector can
+		// only be pushed down when it can be negated; excluded service accounts
+		// are still filtered during reconcile.
+		serviceAccountsSelector := labels.NewSelector()
+		if serviceAccountSelector != nil {
+			requirements, _ := serviceAccountSelector.Requirements()
+			serviceAccountsSelector = serviceAccountsSelector.Add(requirements...)
+		}
+		if serviceAccountExcludeSelector != nil {
+			if includeSelector, ok := negateSelector(serviceAccountExcludeSelector); ok {
+				requirements, _ := includeSelector.Requirements()
+				serviceAccountsSelector = serviceAccountsSelector.Add(requirements...)
+			}
+		}
+		serviceAccountsLabelSelector := serviceAccountsSelector.String()
+		var serviceAccountsTweak func(*metav1.ListOptions)
+		if serviceAccountsLabelSelector != "" {
+			serviceAccountsTweak = func(options *metav1.ListOptions) {
+				options.LabelSelector = serviceAccountsLabelSelector
+			}
+		}
+		serviceAccountsInformerFactory := newInformerFactory(kubeClient, serviceAccountResync, serviceAccountsTweak)
+
+		// Namespaces informer. Namespaces outside the namespace selector are
+		// never cached. The selector cannot be pushed down to the service
+		// accounts informer, so their namespace is checked during reconcile.
+		var namespacesTweak func(*metav1.ListOptions)
+		if namespaceLabelSelector != nil {
+			namespacesTweak = func(options *metav1.ListOptions) {
+				options.LabelSelector = namespaceLabelSelector.String()
+			}
+		}
+		namespacesInformerFactory := newInformerFactory(kubeClient, namespaceResync, namespacesTweak)
+		namespaceInformer := namespacesInformerFactory.Core().V1().Namespaces()
+
+		// Serviceaccount informer. It is only started in watch mode, since
+		// informers are registered with the factory on first use.
+		serviceAccountsInformer := serviceAccountsInformerFactory.Core().V1().ServiceAccounts()
+
+		// Secrets informer. Only the Aurora secrets are ever read, so other
+		// secrets, such as Helm releases, are never cached. The secrets
+		// mirrored from a reference service account are only known at
+		// runtime, and a field selector cannot match the several names of
+		// additional secrets or of namespace overrides, so every secret is
+		// cached then.
+		var secretsTweak func(*metav1.ListOptions)
+		if referenceSA == "" && len(registries.secretNames()) == 0 && !secretNameOverride {
+			secretsTweak = func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", os.Getenv("AURORA_SECRET_NAME")).String()
+			}
+		}
+		secretsInformerFactory := newInformerFactory(kubeClient, secretResync, secretsTweak)
+
+		// The other resources provisioned into the namespaces resync with the
+		// secrets, each from its own factory: the factory of the secrets may
+		// select them by name.
+		var providerInformerFactories []kubeinformers.SharedInformerFactory
+		secretsInformer := secretsInformerFactory.Core().V1().Secrets()
+
+		// Reference service account informers, caching its namespace only
+		var reference *referenceServiceAccount
+		var referenceInformerFactory kubeinformers.SharedInformerFactory
+		if referenceSA != "" {
+			namespace, name, err := cache.SplitMetaNamespaceKey(referenceSA)
+			if err != nil || namespace == "" || name == "" {
+				klog.Fatalf("--reference-sa must be namespace/name, got %q", referenceSA)
+			}
+
+			referenceInformerFactory = kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Minute*5, kubeinformers.WithNamespace(namespace))
+			reference = &referenceServiceAccount{
+				namespace:            namespace,
+				name:                 name,
+				serviceAccountLister: referenceInformerFactory.Core().V1().ServiceAccounts().Lister(),
+				secretLister:         referenceInformerFactory.Core().V1().Secrets().Lister(),
+			}
+		}
+
+		// Namespace list informer, caching the namespace list ConfigMap only
+		var listedNamespaces *namespaceList
+		var namespaceListInformerFactory kubeinformers.SharedInformerFactory
+		if namespaceListConfig != "" {
+			namespace, name, err := cache.SplitMetaNamespaceKey(namespaceListConfig)
+			if err != nil || namespace == "" || name == "" {
+				klog.Fatalf("--namespace-list-configmap must be namespace/name, got %q", namespaceListConfig)
+			}
+
+			namespaceListInformerFactory = kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Minute*5,
+				kubeinformers.WithNamespace(namespace),
+				kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+					options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+				}))
+			listedNamespaces = &namespaceList{
+				namespace: namespace,
+				name:      name,
+				lister:    namespaceListInformerFactory.Core().V1().ConfigMaps().Lister(),
+			}
+		}
+
+		requeue.TransientErrorDelay = transientErrorDelay
+
+		var writeLimiter *rate.Limiter
+		if writeRateLimit > 0 {
+			writeLimiter = rate.NewLimiter(rate.Limit(writeRateLimit), int(math.Max(1, writeRateLimit)))
+		}
+
+		// Guard against mass changes within each resync period
+		var writeGuard *massChangeGuard
+		if maxWritesPerRun > 0 {
+			// The cap applies to each full sweep, which the namespace
+			// resyncs start.
+			window := maxWritesWindow
+			if window <= 0 {
+				window = namespaceResync
+			}
+			if window <= 0 {
+				klog.Fatalf("--max-writes-per-run requires --max-writes-window when --namespace-resync is 0")
+			}
+			writeGuard = &massChangeGuard{max: maxWritesPerRun, window: window, confirmed: confirmMassChange}
+		}
+
+		if unifiedReconcile && serviceAccountMode != "watch" {
+			klog.Fatalf("--unified-reconcile requires --serviceaccount-mode=watch")
+		}
+		var leader *leadership
+		if leaderElect {
+			if podNamespace == "" {
+				klog.Fatalf("POD_NAMESPACE must be set to use --leader-elect")
+			}
+			leader = &leadership{}
+		}
+		if saRevalidate < 0 {
+			klog.Fatalf("--sa-revalidate-interval must not be negative")
+		}
+		if saRevalidate > 0 && serviceAccountMode != "watch" {
+			klog.Fatalf("--sa-revalidate-interval requires --serviceaccount-mode=watch, poll mode already revalidates every poll")
+		}
+		if fieldManagerName == "" {
+			klog.Fatalf("--field-manager must not be empty")
+		}
+		if namespaceSettleDelay < 0 {
+			klog.Fatalf("--namespace-settle-delay must not be negative")
+		}
+		if cacheMissRetries < 0 {
+			klog.Fatalf("--cache-miss-retries must not be negative")
+		}
+
+		reconciler := &imagePullSecretsReconciler{
+			ctx:             ctx,
+			podNamespace:    podNamespace,
+			kubeClient:      kubeClient,
+			namespaceLister: namespaceInformer.Lister(),
+			secretsLister:   secretsInformer.Lister(),
+			registries:      registries,
+			recorder:        recorder,
+			events:          events,
+
+			credentials:    credentialsCache,
+			apiCallTimeout: apiCallTimeout,
+			writeLimiter:   writeLimiter,
+			writeGuard:     writeGuard,
+			emergencyStop:  &emergencyStop{path: emergencyStopFile},
+			leadership:     leader,
 
-				if !found {
-					klog.Infof("Adding image pull secret to %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+			adoptExistingSecrets: adoptExistingSecrets,
+			copyLabels:           sets.List(sets.New(secretCopyLabels...).Delete(managedByLabel)),
+			copyAnnotations:      secretCopyAnnots,
+			createOnly:           createOnly,
 
-					updated := serviceAccount.DeepCopy()
-					updated.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: os.Getenv("AURORA_SECRET_NAME")})
+			requireNonemptyCredentials: requireNonemptyCredentials,
+			excludedNamespaces:         sets.New(excludeNamespaces...),
 
-					if _, err := kubeClient.CoreV1().ServiceAccounts(serviceAccount.Namespace).Update(context.Background(), updated, metav1.UpdateOptions{}); err != nil {
-						return err
+			requiredOwnerKind:     requiredOwnerKind,
+			requiredOwnerSelector: requiredOwnerSelector,
+
+			forceServiceAccountUpdates:    saUpdateStrategy == "force",
+			applyServiceAccounts:          saUpdateStrategy == "apply",
+			forceApply:                    forceApply,
+			patchSecretData:               secretUpdateStrategy == "patch",
+			stampCredentialHash:           credentialHashAnnot,
+			updateDebouncer:               newUpdateDebouncer(minUpdateInterval),
+			provisionDelay:                provisionDelay,
+			settler:                       newNamespaceSettler(namespaceSettleDelay),
+			pruneOrphans:                  pruneOrphans,
+			namespaceList:                 listedNamespaces,
+			waitForSecret:                 waitForSecret,
+			fieldManager:                  fieldManagerName,
+			deletionSelector:              deletionSelector,
+			namespacesStatus:              namespacesStatus,
+			serviceAccountsStatus:         serviceAccountsStatus,
+			excludedServiceAccounts:       excludedServiceAccounts,
+			serviceAccountExcludeSelector: serviceAccountExcludeSelector,
+			namespaceSelector:             namespaceLabelSelector,
+			namespaceSelectors:            namespaceSelectorSet,
+			serviceAccountSelector:        serviceAccountSelector,
+			reference:                     reference,
+			readOnly:                      readOnly,
+			removeInapplicableSecrets:     removeInapplicable,
+			secretNameOverride:            secretNameOverride,
+		}
+		reconciler.hooks.Add(metricsHook)
+		if events != nil {
+			reconciler.hooks.Add(eventSinkHook(events))
+		}
+		if readOnly {
+			reconciler.namespacesCompliance = convergence.NewCompliance("Namespaces")
+			reconciler.serviceAccountsCompliance = convergence.NewCompliance("ServiceAccounts")
+		}
+
+		// Setup the per-namespace resource providers. Secrets always come first.
+		if reference != nil {
+			reconciler.providers = append(reconciler.providers, referenceSecretsProvider{reconciler})
+		} else {
+			reconciler.providers = append(reconciler.providers, secretsProvider{reconciler})
+		}
+		cacheSyncs := []cache.InformerSynced{
+			namespaceInformer.Informer().HasSynced,
+			secretsInformer.Informer().HasSynced,
+		}
+		if reference != nil {
+			cacheSyncs = append(cacheSyncs,
+				referenceInformerFactory.Core().V1().ServiceAccounts().Informer().HasSynced,
+				referenceInformerFactory.Core().V1().Secrets().Informer().HasSynced,
+			)
+		}
+		if listedNamespaces != nil {
+			cacheSyncs = append(cacheSyncs, namespaceListInformerFactory.Core().V1().ConfigMaps().Informer().HasSynced)
+		}
+		ownedInformers := []cache.SharedIndexInformer{secretsInformer.Informer()}
+
+		// The namespaces listed at startup have already settled. Waiting for
+		// the handler to sync ensures they are recorded before the first sync.
+		if settler := reconciler.settler; settler != nil {
+			registration, err := namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+				AddFunc: func(obj interface{}, isInInitialList bool) {
+					if namespace, ok := obj.(*corev1.Namespace); ok && isInInitialList {
+						settler.settled(namespace.Name)
 					}
-				}
+				},
+			})
+			if err != nil {
+				klog.Fatalf("error registering the namespace settle handler: %v", err)
+			}
+			cacheSyncs = append(cacheSyncs, registration.HasSynced)
+		}
 
-				return nil
-			},
-		)
+		if defaultDenyNetworkPolicy {
+			networkPoliciesInformerFactory := newInformerFactory(kubeClient, secretResync, nil)
+			providerInformerFactories = append(providerInformerFactories, networkPoliciesInformerFactory)
+			networkPoliciesInformer := networkPoliciesInformerFactory.Networking().V1().NetworkPolicies()
+			reconciler.providers = append(reconciler.providers, &networkPolicyProvider{
+				imagePullSecretsReconciler: reconciler,
+				networkPolicyLister:        networkPoliciesInformer.Lister(),
+			})
+			cacheSyncs = append(cacheSyncs, networkPoliciesInformer.Informer().HasSynced)
+			ownedInformers = append(ownedInformers, networkPoliciesInformer.Informer())
+		}
+
+		if resourceQuotaHard != "" {
+			hard, err := parseResourceList(resourceQuotaHard)
+			if err != nil {
+				klog.Fatalf("error parsing --resource-quota: %v", err)
+			}
+
+			resourceQuotasInformerFactory := newInformerFactory(kubeClient, secretResync, nil)
+			providerInformerFactories = append(providerInformerFactories, resourceQuotasInformerFactory)
+			resourceQuotasInformer := resourceQuotasInformerFactory.Core().V1().ResourceQuotas()
+			reconciler.providers = append(reconciler.providers, &resourceQuotaProvider{
+				imagePullSecretsReconciler: reconciler,
+				resourceQuotaLister:        resourceQuotasInformer.Lister(),
+				hard:                       hard,
+			})
+			cacheSyncs = append(cacheSyncs, resourceQuotasInformer.Informer().HasSynced)
+			ownedInformers = append(ownedInformers, resourceQuotasInformer.Informer())
+		}
+
+		// Setup controller. In poll mode service accounts are listed
+		// periodically instead of being watched and cached.
+		var controllerServiceAccounts *serviceaccounts.Controller
+		var pollerServiceAccounts *serviceaccounts.Poller
+		if serviceAccountMode == "poll" {
+			pollerServiceAccounts = serviceaccounts.NewPoller(
+				kubeClient,
+				serviceAccountPoll,
+				serviceAccountsLabelSelector,
+				reconciler.syncServiceAccountAndNotify,
+			)
+		} else {
+			controllerServiceAccounts = serviceaccounts.NewController(
+				serviceAccountsInformer,
+				reconciler.syncServiceAccountAndNotify,
+			)
+			controllerServiceAccounts.SetConvergenceTracker(serviceAccountsConvergence)
+			controllerServiceAccounts.SetStartupGate(batch.NewGate("ServiceAccounts", sweepBatchSize, sweepBatchDelay))
+			controllerServiceAccounts.SetCacheMissRetries(cacheMissRetries, cacheLagRequeueDelay)
+			if featureGates.Enabled(namespaceFairQueue) {
+				controllerServiceAccounts.UseNamespaceFairQueue(metrics.WorkqueueMetricsProvider)
+			}
+			if featureGates.Enabled(skipCompliantResyncs) {
+				controllerServiceAccounts.SetInSyncFunc(reconciler.serviceAccountInSync)
+			}
+			cacheSyncs = append(cacheSyncs, serviceAccountsInformer.Informer().HasSynced)
+
+			if unifiedReconcile {
+				reconciler.serviceAccountLister = serviceAccountsInformer.Lister()
+			}
+		}
 
 		// Setup controller
 		controllerNamespaces := namespaces.NewController(
 			namespaceInformer,
-			func(namespace *corev1.Namespace) error {
-				// Generate Secrets
-				secrets := generateSecrets(namespace)
-
-				for _, secret := range secrets {
-					currentSecret, err := secretsLister.Secrets(secret.Namespace).Get(secret.Name)
-					if errors.IsNotFound(err) {
-						klog.Infof("creating secret %s/%s", secret.Namespace, secret.Name)
-						currentSecret, err = kubeClient.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
-						if err != nil {
-							return err
-						}
-					}
+			reconciler.syncNamespaceAndNotify,
+		)
+		controllerNamespaces.SetDeletedFunc(reconciler.namespaceDeleted)
+		controllerNamespaces.SetConvergenceTracker(namespacesConvergence)
+		namespacesSweep := convergence.NewSweep("Namespaces")
+		controllerNamespaces.SetSweep(namespacesSweep)
+		controllerNamespaces.SetStartupGate(batch.NewGate("Namespaces", sweepBatchSize, sweepBatchDelay))
+		controllerNamespaces.SetCacheMissRetries(cacheMissRetries, cacheLagRequeueDelay)
+
+		// Process the namespaces matching the priority selector, and their
+		// service accounts, before the others.
+		if prioritySelector != "" {
+			selector, err := labels.Parse(prioritySelector)
+			if err != nil {
+				klog.Fatalf("error parsing --priority-namespace-selector: %v", err)
+			}
+
+			isPriority := func(name string) bool {
+				namespace, err := namespaceInformer.Lister().Get(name)
+				return err == nil && selector.Matches(labels.Set(namespace.Labels))
+			}
 
-					if !reflect.DeepEqual(secret.Data, currentSecret.Data) {
-						klog.Infof("updating secret %s/%s", secret.Namespace, secret.Name)
-						currentSecret.Data = secret.Data
+			controllerNamespaces.UsePriorityQueue(isPriority, metrics.WorkqueueMetricsProvider)
+			if controllerServiceAccounts != nil {
+				controllerServiceAccounts.UsePriorityQueue(func(key string) bool {
+					namespace, _, err := cache.SplitMetaNamespaceKey(key)
+					return err == nil && isPriority(namespace)
+				}, metrics.WorkqueueMetricsProvider)
+			}
+		}
+
+		// Sample the routine success logs
+		if logSampleRate < 1 {
+			if controllerServiceAccounts != nil {
+				controllerServiceAccounts.SetSuccessLogSampler(logsampler.New(logSampleRate))
+			}
+			controllerNamespaces.SetSuccessLogSampler(logsampler.New(logSampleRate))
+		}
+
+		// Service accounts are enqueued directly by the Add/Update handlers
+		// registered in serviceaccounts.NewController, so a service account
+		// created after its namespace was provisioned is injected as soon as
+		// it is observed. HandleObject is not wired here: service accounts are
+		// not controlled by another service account, so it would never enqueue.
 
-						_, err = kubeClient.CoreV1().Secrets(secret.Namespace).Update(context.Background(), currentSecret, metav1.UpdateOptions{})
-						if err != nil {
-							return err
-						}
+		// Requeue the namespace when one of its provisioned resources changes
+		for _, informer := range ownedInformers {
+			informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				UpdateFunc: func(old, new interface{}) {
+					newObj := new.(metav1.Object)
+					oldObj := old.(metav1.Object)
+
+					if newObj.GetResourceVersion() == oldObj.GetResourceVersion() {
+						return
 					}
-				}
 
-				return nil
-			},
-		)
+					controllerNamespaces.HandleObject(new)
+				},
+				DeleteFunc: controllerNamespaces.HandleObject,
+			})
+		}
+
+		// Count the managed secrets, and the injected service accounts when
+		// they are cached, for the footprint gauges.
+		secretsInformer.Informer().AddEventHandler(newObjectCounter(isManagedSecret, metrics.ManagedSecrets.Set))
+		if controllerServiceAccounts != nil {
+			serviceAccountsInformer.Informer().AddEventHandler(newObjectCounter(reconciler.isInjectedServiceAccount, metrics.InjectedServiceAccounts.Set))
+		}
 
-		serviceAccountsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: controllerServiceAccounts.HandleObject,
-			UpdateFunc: func(old, new interface{}) {
-				newNP := new.(*corev1.ServiceAccount)
-				oldNP := old.(*corev1.ServiceAccount)
+		// React to image pull failures. Only Warning events about pods are
+		// cached, in a separate factory so that the field selector does not
+		// apply to the other informers.
+		if reactivePullSecret {
+			eventsInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Minute*5,
+				kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+					options.FieldSelector = fields.AndSelectors(
+						fields.OneTermEqualSelector("type", corev1.EventTypeWarning),
+						fields.OneTermEqualSelector("involvedObject.kind", "Pod"),
+					).String()
+				}))
+
+			provisioner := newReactiveProvisioner(ctx, kubeClient, controllerNamespaces, controllerServiceAccounts)
+			eventsInformerFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: provisioner.handleEvent,
+				UpdateFunc: func(old, new interface{}) {
+					provisioner.handleEvent(new)
+				},
+			})
+			eventsInformerFactory.Start(stopCh)
+		}
+
+		if monitorPullResults {
+			podsInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Minute*30)
+			podsInformer := podsInformerFactory.Core().V1().Pods().Informer()
+			if err := podsInformer.SetTransform(trimPod); err != nil {
+				klog.Fatalf("error setting the pods informer transform: %v", err)
+			}
+
+			monitor := newPullMonitor(reconciler.auroraSecretNameIn, secretsInformer.Lister())
+			podsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: monitor.handlePod,
+				UpdateFunc: func(old, new interface{}) {
+					monitor.handlePod(new)
+				},
+			})
+			podsInformerFactory.Start(stopCh)
+		}
+
+		// The additional secrets of a namespace depend on its labels, and the
+		// name of its Aurora secret on its annotation, so resync its service
+		// accounts when they change.
+		if (len(registries.secretNames()) > 0 || secretNameOverride) && controllerServiceAccounts != nil {
+			namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+				UpdateFunc: func(old, new interface{}) {
+					oldNamespace := old.(*corev1.Namespace)
+					newNamespace := new.(*corev1.Namespace)
+
+					if labels.Equals(oldNamespace.Labels, newNamespace.Labels) &&
+						oldNamespace.Annotations[pullSecretNameAnnotation] == newNamespace.Annotations[pullSecretNameAnnotation] {
+						return
+					}
+
+					klog.V(4).Infof("Labels or secret name of namespace %s changed, resyncing its service accounts", newNamespace.Name)
+					controllerServiceAccounts.EnqueueNamespace(newNamespace.Name)
+				},
+			})
+		}
 
-				if newNP.ResourceVersion == oldNP.ResourceVersion {
+		// Resync everything when the reference service account or one of
+		// the secrets it references changes.
+		if reference != nil {
+			resync := func(obj interface{}) {
+				object, ok := obj.(metav1.Object)
+				if !ok {
+					if tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown); isTombstone {
+						object, ok = tombstone.Obj.(metav1.Object)
+					}
+				}
+				if !ok {
 					return
 				}
 
-				controllerServiceAccounts.HandleObject(new)
-			},
-		})
+				if _, isServiceAccount := obj.(*corev1.ServiceAccount); isServiceAccount {
+					if object.GetName() != reference.name {
+						return
+					}
+				} else if !sets.New(reference.secretNames()...).Has(object.GetName()) {
+					return
+				}
 
-		secretsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			UpdateFunc: func(old, new interface{}) {
-				newNP := new.(*corev1.Secret)
-				oldNP := old.(*corev1.Secret)
+				klog.V(4).Infof("Reference %s/%s changed, resyncing every namespace and service account", object.GetNamespace(), object.GetName())
+				controllerNamespaces.EnqueueAll()
+				if controllerServiceAccounts != nil {
+					controllerServiceAccounts.EnqueueAll()
+				}
+			}
+			handler := cache.ResourceEventHandlerFuncs{
+				AddFunc: resync,
+				UpdateFunc: func(old, new interface{}) {
+					resync(new)
+				},
+				DeleteFunc: resync,
+			}
+			referenceInformerFactory.Core().V1().ServiceAccounts().Informer().AddEventHandler(handler)
+			referenceInformerFactory.Core().V1().Secrets().Informer().AddEventHandler(handler)
+			referenceInformerFactory.Start(stopCh)
+		}
 
-				if newNP.ResourceVersion == oldNP.ResourceVersion {
+		// Reconcile the namespaces added to or removed from the namespace
+		// list. The secrets left in the removed ones are orphaned, and are
+		// reported, or pruned, right away.
+		if listedNamespaces != nil {
+			configMapOf := func(obj interface{}) *corev1.ConfigMap {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				configMap, _ := obj.(*corev1.ConfigMap)
+				return configMap
+			}
+			resync := func(old, new *corev1.ConfigMap) {
+				oldNames, newNames := parseNamespaceList(old), parseNamespaceList(new)
+				added, removed := newNames.Difference(oldNames), oldNames.Difference(newNames)
+				if added.Len() == 0 && removed.Len() == 0 {
 					return
 				}
 
-				controllerNamespaces.HandleObject(new)
-			},
-			DeleteFunc: controllerNamespaces.HandleObject,
-		})
+				klog.Infof("Namespace list changed, added %v and removed %v", sets.List(added), sets.List(removed))
+				for _, name := range sets.List(added.Union(removed)) {
+					controllerNamespaces.EnqueueKey(name)
+					if controllerServiceAccounts != nil {
+						controllerServiceAccounts.EnqueueNamespace(name)
+					}
+				}
+				if removed.Len() > 0 {
+					go reconciler.scanOrphans()
+				}
+			}
+			namespaceListInformerFactory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					resync(nil, configMapOf(obj))
+				},
+				UpdateFunc: func(old, new interface{}) {
+					resync(configMapOf(old), configMapOf(new))
+				},
+				DeleteFunc: func(obj interface{}) {
+					klog.Warningf("namespace list %s was deleted, no namespace is reconciled until it is recreated", namespaceListConfig)
+				},
+			})
+			namespaceListInformerFactory.Start(stopCh)
+		}
 
 		// Start informers
-		kubeInformerFactory.Start(stopCh)
+		for _, factory := range providerInformerFactories {
+			factory.Start(stopCh)
+		}
+		namespacesInformerFactory.Start(stopCh)
+		secretsInformerFactory.Start(stopCh)
+		serviceAccountsInformerFactory.Start(stopCh)
 
 		// Wait for caches
 		klog.Info("Waiting for informer caches to sync")
-		if ok := cache.WaitForCacheSync(stopCh, serviceAccountsInformer.Informer().HasSynced, secretsInformer.Informer().HasSynced); !ok {
+		if ok := cache.WaitForCacheSync(stopCh, cacheSyncs...); !ok {
 			klog.Fatalf("failed to wait for caches to sync")
 		}
+		synced.Store(true)
 
-		var quit = make(chan int)
+		if listedNamespaces != nil {
+			if _, ok := listedNamespaces.names(); !ok {
+				klog.Warningf("namespace list %s does not exist, no namespace is reconciled until it is created", namespaceListConfig)
+			}
+		}
 
-		// Run the controllerServiceAccounts
-		go func() {
-			if err = controllerServiceAccounts.Run(2, stopCh); err != nil {
-				klog.Fatalf("error running controller: %v", err)
+		if logNamespacePlan {
+			namespaces, err := namespaceInformer.Lister().List(labels.Everything())
+			if err != nil {
+				klog.Errorf("error listing namespaces for the namespace plan: %v", err)
+			} else {
+				reconciler.logNamespacePlan(namespaces)
 			}
+		}
 
-			close(quit)
-		}()
+		// Reconcile everything once before relying on watch events. Keys the
+		// informers already queued and that have not been processed yet are
+		// deduplicated by the workqueues. In poll mode the first poll already
+		// covers every service account.
+		// With --sequence-startup, the namespaces are enqueued as a sweep
+		// whose completion starts the service accounts.
+		if onceThenWatch && controllerServiceAccounts != nil && !sequenceStartup {
+			klog.Infof("Initial sweep enqueued %d namespaces and %d service accounts", controllerNamespaces.EnqueueAll(), controllerServiceAccounts.EnqueueAll())
+		} else if onceThenWatch || sequenceStartup {
+			klog.Infof("Initial sweep enqueued %d namespaces", controllerNamespaces.EnqueueAll())
+		}
 
-		go func() {
-			if err = controllerNamespaces.Run(2, stopCh); err != nil {
+		// Resync every namespace when the credentials change
+		go credentialsCache.Run(ctx, func() { controllerNamespaces.EnqueueAll() })
+
+		// Reconcile every service account periodically, whatever the events
+		if saRevalidate > 0 {
+			go revalidatePeriodically(saRevalidate, stopCh, controllerServiceAccounts.EnqueueAll)
+		}
+
+		// stopped is closed once both controllers have stopped.
+		var stopped = make(chan struct{})
+
+		// shutdown runs once the controllers have stopped on a graceful
+		// shutdown: fatal errors exit directly. With leader election, it
+		// only runs on the leader, before it releases the lease.
+		shutdown := func() {
+			<-stopped
+
+			if cleanupOnShutdown {
+				cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cleanupCancel()
+
+				if err := reconciler.cleanupOnShutdown(cleanupCtx); err != nil {
+					klog.Errorf("error cleaning up on shutdown: %v", err)
+				}
+			}
+		}
+
+		// Run the controllerServiceAccounts, once the initial sweep of the
+		// namespaces has provisioned their secrets with --sequence-startup
+		runServiceAccounts := func() {
+			if pollerServiceAccounts != nil {
+				pollerServiceAccounts.Run(stopCh)
+				return
+			}
+
+			if onceThenWatch && sequenceStartup {
+				klog.Infof("Initial sweep enqueued %d service accounts", controllerServiceAccounts.EnqueueAll())
+			}
+			if err := controllerServiceAccounts.Run(controllerWorkers, stopCh); err != nil {
 				klog.Fatalf("error running controller: %v", err)
 			}
+		}
+		runControllers := func() {
+			// Create the source secret on first installation
+			if bootstrapSecret != nil {
+				created, err := reconciler.bootstrapSourceSecret(bootstrapSecret, bootstrapCredential())
+				if err != nil {
+					klog.Errorf("error bootstrapping the source secret: %v", err)
+				} else if created {
+					if _, err := credentialsCache.Refresh(ctx); err != nil {
+						klog.Errorf("error fetching the bootstrapped credentials, retrying in the background: %v", err)
+					}
+				}
+			}
 
-			close(quit)
-		}()
+			var controllers sync.WaitGroup
+			controllers.Add(2)
 
-		// Block, the go routines are running in the background.
-		<-quit
-	},
-}
+			go func() {
+				defer controllers.Done()
+
+				if sequenceStartup && !waitForNamespacesSweep(namespacesSweep, stopCh) {
+					return
+				}
+				runServiceAccounts()
+			}()
+
+			go func() {
+				defer controllers.Done()
+
+				if err := controllerNamespaces.Run(controllerWorkers, stopCh); err != nil {
+					klog.Fatalf("error running controller: %v", err)
+				}
+			}()
+
+			// Both controllers have stopped before the cleanup on shutdown
+			// starts, so that no worker provisions what it deletes.
+			go func() {
+				controllers.Wait()
+				close(stopped)
+			}()
 
-// generateSecrets generates secrets for Aurora platform.
-func generateSecrets(namespace *corev1.Namespace) []*corev1.Secret {
-	secrets := []*corev1.Secret{}
-
-	secret := &corev1.Secret{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "core/v1",
-			Kind:       "Secret",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      os.Getenv("AURORA_SECRET_NAME"),
-			Namespace: namespace.Name,
-		},
-		Type: corev1.SecretTypeDockerConfigJson,
-		Data: map[string][]byte{
-			".dockerconfigjson": []byte(os.Getenv("AURORA_SECRET_DOCKERCONFIGJSON")),
-		},
-	}
-
-	secrets = append(secrets, secret)
-
-	return secrets
+			// Report, or prune, the managed secrets left behind when
+			// namespaces leave the scope of the controller.
+			go wait.Until(reconciler.scanOrphans, orphanScanInterval, stopCh)
+
+			if beat != nil && leaderElect {
+				go beat.Run(stopCh)
+			}
+		}
+
+		// With leader election, only the leader runs the workers: the
+		// informers of the standbys keep running, and their queues filling,
+		// so that they take over with warm caches.
+		if leaderElect {
+			identity, err := podIdentity()
+			if err != nil {
+				klog.Fatalf("error getting hostname: %v", err)
+			}
+
+			// A standby never started the controllers, and has nothing to
+			// shut down.
+			reconciler.leadership.run(ctx, kubeClient, podNamespace, identity, leaderElectLease, leaderElectRenew, leaderElectRetry, runControllers, shutdown)
+		} else {
+			runControllers()
+			shutdown()
+		}
+	},
 }
 
 func init() {
+	imagePullSecretsCmd.Flags().StringVar(&serviceAccountMode, "serviceaccount-mode", "watch", "How service accounts are observed: watch caches and watches them, poll lists them every --serviceaccount-poll-interval")
+	imagePullSecretsCmd.Flags().DurationVar(&serviceAccountPoll, "serviceaccount-poll-interval", 10*time.Minute, "Interval between service account lists in poll mode")
+	imagePullSecretsCmd.Flags().DurationVar(&namespaceResync, "namespace-resync", time.Minute*5, "Resync period of the namespaces informer, which resyncs every namespace; 0 disables it")
+	imagePullSecretsCmd.Flags().DurationVar(&serviceAccountResync, "serviceaccount-resync", time.Minute*5, "Resync period of the service accounts informer in watch mode, which resyncs every service account; 0 disables it")
+	imagePullSecretsCmd.Flags().DurationVar(&saRevalidate, "sa-revalidate-interval", 0, "Interval between full reconciles of every service account, including the compliant ones resyncs skip, to revalidate the injected references against the current configuration; 0 disables it")
+	imagePullSecretsCmd.Flags().DurationVar(&secretResync, "secret-resync", time.Minute*5, "Resync period of the secrets informer; 0 disables it")
+	imagePullSecretsCmd.Flags().IntVar(&cacheMissRetries, "cache-miss-retries", 0, "How many times a key missing from the informer cache, but not observed deleted, is retried 2 seconds apart before it is considered gone")
+	imagePullSecretsCmd.Flags().BoolVar(&waitForSecret, "wait-for-secret-before-inject", false, "Only inject the image pull secrets already provisioned in the namespace of a service account, requeueing it for the others")
+	imagePullSecretsCmd.Flags().BoolVar(&unifiedReconcile, "unified-reconcile", false, "Inject the service accounts of each namespace in the same sync that provisions its secrets, rather than only from the service accounts controller")
+	imagePullSecretsCmd.Flags().StringVar(&saUpdateStrategy, "sa-update-strategy", "optimistic", "How service accounts are modified: optimistic updates with a resourceVersion and requeues on conflict, force patches without one, apply uses server-side apply")
+	imagePullSecretsCmd.Flags().StringVar(&fieldManagerName, "field-manager", defaultFieldManager, "Field manager of the service account updates, patches and applies")
+	imagePullSecretsCmd.Flags().BoolVar(&forceApply, "force-apply", false, "With --sa-update-strategy=apply, take the ownership of imagePullSecrets from other field managers instead of backing off on conflicts")
+	imagePullSecretsCmd.Flags().StringVar(&secretUpdateStrategy, "secret-update-strategy", "patch", "How secrets whose credential alone drifted are modified: patch sends a JSON merge patch of the data, update rewrites the whole object")
+	imagePullSecretsCmd.Flags().BoolVar(&credentialHashAnnot, "credential-hash-annotation", false, "Annotate the managed secrets with a hash of their credential, kept up to date along with their data")
+	imagePullSecretsCmd.Flags().DurationVar(&minUpdateInterval, "min-update-interval", 0, "Minimum time between two updates of the same secret, smoothing out a flapping credential source (0 disables it)")
+	imagePullSecretsCmd.Flags().DurationVar(&provisionDelay, "provision-delay", 0, "Minimum age of a namespace before it is provisioned, skipping short-lived namespaces (0 provisions immediately)")
+	imagePullSecretsCmd.Flags().StringVar(&namespaceListConfig, "namespace-list-configmap", "", "ConfigMap, as namespace/name, whose namespaces key lists the only namespaces to reconcile, separated by commas or whitespace")
+	imagePullSecretsCmd.Flags().BoolVar(&pruneOrphans, "prune-orphans", false, "Delete the managed secrets in namespaces out of the namespace selector or list, or ungoverned, instead of only reporting them")
+	imagePullSecretsCmd.Flags().DurationVar(&namespaceSettleDelay, "namespace-settle-delay", 0, "Delay before a namespace first observed after startup is reconciled, letting other controllers set it up (0 reconciles immediately)")
+	imagePullSecretsCmd.Flags().StringVar(&referenceSA, "reference-sa", "", "Reference service account, as namespace/name, whose image pull secrets are copied to every namespace and injected into its service accounts instead of the Aurora secret")
+	imagePullSecretsCmd.Flags().BoolVar(&removeInapplicable, "remove-inapplicable-secrets", false, "Delete the additional secrets of the registry config that no longer apply to a namespace, and remove them from its service accounts")
+	imagePullSecretsCmd.Flags().BoolVar(&secretNameOverride, "allow-secret-name-override", false, "Honour the aurora.gccloudone/pull-secret-name annotation of namespaces, overriding AURORA_SECRET_NAME in them; every secret is cached then")
+	imagePullSecretsCmd.Flags().BoolVar(&readOnly, "read-only", false, "Only observe: log drift and report compliant and noncompliant objects in the metrics without writing anything")
+	imagePullSecretsCmd.Flags().StringVar(&emergencyStopFile, "emergency-stop-file", "", "Path to a file, typically mounted from a ConfigMap, halting every write while it holds true; checked on every write, like the AURORA_CONTROLLER_DISABLED environment variable")
+	imagePullSecretsCmd.Flags().StringVar(&requireOwnerKind, "require-owner-kind", "", "Only provision namespaces with an owner reference of this kind, as Kind or Kind.group")
+	imagePullSecretsCmd.Flags().StringVar(&requireOwnerLabel, "require-owner-label", "", "Only provision namespaces matching this label selector")
+	imagePullSecretsCmd.Flags().StringVar(&skipDeletionLabeled, "skip-deletion-labeled", "", "Label selector of the namespaces pending deletion, which are not reconciled, such as example.com/pending-deletion=true")
+	imagePullSecretsCmd.Flags().Float64Var(&logSampleRate, "log-sample-rate", 1, "Fraction of successful syncs that are logged; errors, warnings and changes are always logged")
+	imagePullSecretsCmd.Flags().BoolVar(&preflightRBAC, "preflight-rbac", false, "Check the RBAC permissions needed with the current flags at startup and exit if any is missing")
+	imagePullSecretsCmd.Flags().StringVar(&registryConfigPath, "registry-config", "", "Path to a file mapping namespaces to registry credentials")
+	imagePullSecretsCmd.Flags().StringSliceVar(&credentialSources, "credential-source", []string{"env"}, "Sources of the default credential: env, file, secret or acr; the auths of several sources are merged")
+	imagePullSecretsCmd.Flags().StringVar(&credentialConflicts, "credential-conflicts", "last-wins", "How a registry configured by several credential sources is resolved: last-wins or error")
+	imagePullSecretsCmd.Flags().StringVar(&dockerConfigJSONPath, "dockerconfigjson-file", "", "Path to the dockerconfigjson file used by the file credential source; changes are propagated automatically")
+	imagePullSecretsCmd.Flags().StringVar(&fallbackDockerConfig, "fallback-dockerconfigjson-file", "", "Path to a dockerconfigjson used while the credential sources cannot be fetched")
+	imagePullSecretsCmd.Flags().BoolVar(&decodeBase64, "decode-base64-credential", false, "Decode a credential that was base64 encoded before being provided, instead of rejecting it")
+	imagePullSecretsCmd.Flags().StringVar(&sourceSecretRef, "source-secret-ref", "", "Secret, as namespace/name, used by the secret credential source")
+	imagePullSecretsCmd.Flags().StringVar(&acrRegistry, "acr-registry", "", "Azure Container Registry login server used by the acr credential source, such as example.azurecr.io")
+	imagePullSecretsCmd.Flags().StringVar(&acrIdentity, "acr-identity", "workload", "Azure identity used by the acr credential source: workload or managed")
+	imagePullSecretsCmd.Flags().StringVar(&acrClientID, "acr-client-id", "", "Client ID of the Azure identity, defaulting to AZURE_CLIENT_ID")
+	imagePullSecretsCmd.Flags().StringVar(&acrTenantID, "acr-tenant-id", "", "Azure tenant ID, defaulting to AZURE_TENANT_ID")
+	imagePullSecretsCmd.Flags().StringVar(&sourceSecretKey, "source-secret-key", corev1.DockerConfigJsonKey, "Key of the source secret holding the dockerconfigjson")
+	imagePullSecretsCmd.Flags().DurationVar(&credentialPoll, "credential-poll-interval", time.Minute*5, "How often credentials without an expiry, such as env, file and secret, are re-read to resync every namespace when they change; 0 relies on file watches alone")
+	imagePullSecretsCmd.Flags().BoolVar(&bootstrapSource, "bootstrap-source", false, "Create the source secret from --dockerconfigjson-file or AURORA_SECRET_DOCKERCONFIGJSON on startup if it does not exist; an existing source secret is never overwritten")
+	imagePullSecretsCmd.Flags().StringSliceVar(&excludeNamespaces, "exclude-namespaces", nil, "Namespaces to exclude; managed secrets and service account references already in them are removed")
+	imagePullSecretsCmd.Flags().StringSliceVar(&excludeSAs, "exclude-service-accounts", nil, "Service accounts never injected, as name in any namespace or namespace/name; the controller's own POD_SERVICE_ACCOUNT is always excluded")
+	imagePullSecretsCmd.Flags().StringVar(&saExcludeSelector, "sa-exclude-selector", "", "Label selector for service accounts that should not be injected")
+	imagePullSecretsCmd.Flags().StringVar(&namespaceSelector, "namespace-selector", "", "Label selector for the namespaces to manage; other namespaces are not cached nor reconciled")
+	imagePullSecretsCmd.Flags().StringArrayVar(&namespaceSelectors, "namespace-selectors", nil, "Label selector for the namespaces to manage, combined with the others according to --namespace-selector-mode; may be repeated, and is only applied during reconcile")
+	imagePullSecretsCmd.Flags().StringVar(&nsSelectorMode, "namespace-selector-mode", selectorSetAny, "How --namespace-selectors are combined: any manages the namespaces matching one of them, all the namespaces matching every one")
+	imagePullSecretsCmd.Flags().StringArrayVar(&nsExcludeSelectors, "namespace-exclude-selector", nil, "Label selector for namespaces not to manage even though they match --namespace-selectors; may be repeated")
+	imagePullSecretsCmd.Flags().StringVar(&saSelector, "sa-selector", "", "Label selector for the service accounts to inject; other service accounts are not cached nor reconciled")
+	imagePullSecretsCmd.Flags().BoolVar(&onceThenWatch, "once-then-watch", false, "Enqueue every namespace and service account once caches have synced, as a tracked initial sweep, before relying on watch events")
+	imagePullSecretsCmd.Flags().BoolVar(&sequenceStartup, "sequence-startup", false, "Start the service accounts controller only once the initial sweep of the namespaces has provisioned their secrets, so that no service account references a secret not created yet")
+	imagePullSecretsCmd.Flags().IntVar(&sweepBatchSize, "initial-sweep-batch-size", 0, "Process the keys queued at startup in batches of this size per controller, 0 to process them all at once")
+	imagePullSecretsCmd.Flags().DurationVar(&sweepBatchDelay, "initial-sweep-batch-delay", time.Second*5, "Pause between the batches of the initial sweep")
+	imagePullSecretsCmd.Flags().BoolVar(&heartbeatLease, "heartbeat-lease", false, "Periodically renew a Lease in POD_NAMESPACE to publish controller liveness")
+	imagePullSecretsCmd.Flags().BoolVar(&leaderElect, "leader-elect", false, "Elect a leader among the replicas with a Lease in POD_NAMESPACE: only the leader reconciles, while the standbys keep their caches synced to take over right away")
+	imagePullSecretsCmd.Flags().DurationVar(&leaderElectLease, "leader-elect-lease-duration", 15*time.Second, "How long the standbys wait after the last renewal of the leader lease before taking it over")
+	imagePullSecretsCmd.Flags().DurationVar(&leaderElectRenew, "leader-elect-renew-deadline", 10*time.Second, "How long the leader retries renewing its lease before giving up the leadership")
+	imagePullSecretsCmd.Flags().DurationVar(&leaderElectRetry, "leader-elect-retry-period", 2*time.Second, "Interval between the attempts to acquire or renew the leader lease")
+	imagePullSecretsCmd.Flags().DurationVar(&heartbeatInterval, "heartbeat-interval", 10*time.Second, "Interval between heartbeat Lease renewals")
+	imagePullSecretsCmd.Flags().DurationVar(&apiCallTimeout, "api-call-timeout", 30*time.Second, "Timeout for each individual API call, or 0 for no timeout")
+	imagePullSecretsCmd.Flags().DurationVar(&transientErrorDelay, "transient-error-requeue-delay", 30*time.Second, "Delay before retrying a sync that failed with 429, 503 or a timeout, unless the API server suggested one with Retry-After; 0 uses the rate limiter")
+	imagePullSecretsCmd.Flags().StringVar(&minServerVersion, "min-server-version", "1.26.0", "Log a warning at startup when the Kubernetes server is older than this version, or empty to skip the check")
+	imagePullSecretsCmd.Flags().StringVar(&metricsBindAddress, "metrics-bind-address", "", "Address to serve metrics on, such as :8080; empty disables them")
+	imagePullSecretsCmd.Flags().StringVar(&healthBindAddress, "health-probe-bind-address", "", "Address the /healthz and /readyz probes bind to, such as :8081; empty disables them")
+	imagePullSecretsCmd.Flags().BoolVar(&enableShutdown, "enable-shutdown-endpoint", false, "Serve POST /quit on the health probe address to shut the controllers down gracefully")
+	imagePullSecretsCmd.Flags().BoolVar(&statusAPI, "status-api", false, "Serve the reconcile status of the namespaces as JSON under /status/ on the health probe address")
+	imagePullSecretsCmd.Flags().DurationVar(&convergenceDeadline, "convergence-deadline", 0, "Fail /readyz while any object has not converged once this long has passed since startup; 0 disables")
+	imagePullSecretsCmd.Flags().Float64Var(&writeRateLimit, "write-rate-limit", 0, "Maximum secret and service account writes per second across all controllers, or 0 for no limit")
+	imagePullSecretsCmd.Flags().IntVar(&maxWritesPerRun, "max-writes-per-run", 0, "Halt all writes once more than this many are issued within one --max-writes-window; 0 disables the cap")
+	imagePullSecretsCmd.Flags().DurationVar(&maxWritesWindow, "max-writes-window", 0, "Window of --max-writes-per-run, such as the duration of one full sweep; 0 uses --namespace-resync")
+	imagePullSecretsCmd.Flags().BoolVar(&confirmMassChange, "confirm-mass-change", false, "Proceed, with a warning, when --max-writes-per-run is exceeded")
+	imagePullSecretsCmd.Flags().BoolVar(&createOnly, "create-only", false, "Create missing secrets but never update existing ones")
+	imagePullSecretsCmd.Flags().BoolVar(&cleanupOnShutdown, "cleanup-on-shutdown", false, "On graceful shutdown, delete every managed secret and remove the references to it from service accounts")
+	imagePullSecretsCmd.Flags().BoolVar(&reactivePullSecret, "reactive-pullsecret", false, "Watch pod Warning events and reprovision the namespace and service account of pods failing to pull images")
+	imagePullSecretsCmd.Flags().StringVar(&eventWebhook, "event-webhook", "", "URL receiving a JSON POST for each secret created or updated, service account injected and sync failure")
+	imagePullSecretsCmd.Flags().BoolVar(&monitorPullResults, "monitor-pull-results", false, "Watch pods and report those failing to pull images despite referencing the managed secret (caches every pod)")
+	imagePullSecretsCmd.Flags().BoolVar(&logNamespacePlan, "log-namespace-plan", false, "Log once after the caches sync whether each namespace is managed or skipped, and why")
+	imagePullSecretsCmd.Flags().StringVar(&prioritySelector, "priority-namespace-selector", "", "Label selector for the namespaces whose secrets and service accounts are processed before the others")
+	imagePullSecretsCmd.Flags().BoolVar(&defaultDenyNetworkPolicy, "default-deny-network-policy", false, "Provision a NetworkPolicy denying all ingress traffic into every namespace")
+	imagePullSecretsCmd.Flags().StringVar(&resourceQuotaHard, "resource-quota", "", "Provision a ResourceQuota with these hard limits into every namespace, for example pods=100,requests.cpu=10")
+	imagePullSecretsCmd.Flags().BoolVar(&requireNonemptyCredentials, "require-nonempty-credentials", true, "Requeue instead of provisioning a secret while the credential is empty")
+	imagePullSecretsCmd.Flags().BoolVar(&adoptExistingSecrets, "adopt-existing-secrets", true, "Take over existing secrets that are not labelled as managed by the controller")
+	imagePullSecretsCmd.Flags().StringSliceVar(&secretCopyLabels, "secret-copy-labels", nil, "Namespace label keys mirrored onto the managed secret")
+	imagePullSecretsCmd.Flags().StringSliceVar(&secretCopyAnnots, "secret-copy-annotations", nil, "Namespace annotation keys mirrored onto the managed secret")
+
 	rootCmd.AddCommand(imagePullSecretsCmd)
 }
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+// leaderElectionLease is the Lease the replicas compete for with
+// --leader-elect.
+const leaderElectionLease = "aurora-controller-image-pull-secrets-leader"
+
+// errNotLeader is returned by write on a standby replica, instead of
+// performing the write.
+var errNotLeader = errors.New("not the leader, the change was not made")
+
+// leadership gates a replica on leader election. Every replica runs its
+// informers, so that the caches of a standby stay warm and a new leader
+// reconciles right away, but only the leader runs the workers and writes. A
+// nil leadership always leads.
+type leadership struct {
+	leading atomic.Bool
+}
+
+// isLeading reports whether the replica may reconcile.
+func (l *leadership) isLeading() bool {
+	return l == nil || l.leading.Load()
+}
+
+// run competes for the lease in the namespace until ctx is cancelled, and
+// calls lead once the replica becomes the leader. The workers cannot be
+// stopped once started, so losing the lease other than on shutdown exits the
+// process, and the replica restarts as a standby. Once ctx is cancelled, a
+// leader calls beforeRelease while it still holds the lease, so that what it
+// does on shutdown cannot race a new leader, and only then releases it. It
+// returns whether the replica led.
+func (l *leadership) run(ctx context.Context, kubeClient kubernetes.Interface, namespace, identity string, leaseDuration, renewDeadline, retryPeriod time.Duration, lead, beforeRelease func()) bool {
+	// The election outlives ctx until the leader is done with beforeRelease.
+	electionCtx, cancelElection := context.WithCancel(context.Background())
+	defer cancelElection()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-electionCtx.Done():
+			return
+		}
+
+		if l.leading.Load() {
+			beforeRelease()
+		}
+		cancelElection()
+	}()
+
+	var led atomic.Bool
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: leaderElectionLease},
+			Client:     kubeClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaderElectionLease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				klog.Infof("Acquired the leader lease %s/%s, starting the controllers", namespace, leaderElectionLease)
+				led.Store(true)
+				l.leading.Store(true)
+				lead()
+			},
+			OnStoppedLeading: func() {
+				// Nothing is written once the lease is given up, whether
+				// released on shutdown or lost.
+				wasLeading := l.leading.Swap(false)
+				if electionCtx.Err() != nil {
+					klog.Infof("Released the leader lease %s/%s", namespace, leaderElectionLease)
+					return
+				}
+				if wasLeading {
+					klog.Fatalf("Lost the leader lease %s/%s, exiting", namespace, leaderElectionLease)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("Standing by with warm caches, %s is the leader", leader)
+				}
+			},
+		},
+	})
+
+	return led.Load()
+}
+
+// podIdentity returns the name identifying the replica in Leases: its pod
+// name, or else its hostname.
+func podIdentity() (string, error) {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name, nil
+	}
+
+	return os.Hostname()
+}
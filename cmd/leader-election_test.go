@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLeadershipStandby(t *testing.T) {
+	holder, duration := "other-pod", int32(60)
+	now := metav1.NewMicroTime(time.Now())
+	heldLease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: leaderElectionLease, Namespace: "aurora-system"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		lease  *coordinationv1.Lease
+		leader bool
+	}{
+		{name: "lease held by another replica", lease: heldLease},
+		{name: "lease free", leader: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			objects := []runtime.Object{team}
+			if tt.lease != nil {
+				objects = append(objects, tt.lease.DeepCopy())
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.leadership = &leadership{}
+
+			// The caches are warm whether or not the replica leads.
+			if _, err := r.namespaceLister.Get("team"); err != nil {
+				t.Fatalf("namespace not cached: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			led := make(chan struct{})
+			done := make(chan bool)
+			go func() {
+				done <- r.leadership.run(ctx, kubeClient, "aurora-system", "this-pod", 2*time.Second, time.Second, 100*time.Millisecond, func() { close(led) }, func() {})
+			}()
+
+			select {
+			case <-led:
+				if !tt.leader {
+					t.Fatal("led while the lease is held by another replica")
+				}
+			case <-time.After(time.Second):
+				if tt.leader {
+					t.Fatal("did not lead with a free lease")
+				}
+			}
+
+			// Only the writes of the reconciler are of interest.
+			kubeClient.ClearActions()
+			err := r.syncNamespace(team)
+			var writes []string
+			for _, write := range writeActions(kubeClient) {
+				if write != "update leases" && write != "create leases" {
+					writes = append(writes, write)
+				}
+			}
+
+			if tt.leader {
+				if err != nil {
+					t.Errorf("syncNamespace() = %v", err)
+				}
+				if len(writes) != 1 || writes[0] != "create secrets" {
+					t.Errorf("writes = %v, want [create secrets]", writes)
+				}
+			} else {
+				if !errors.Is(err, errNotLeader) {
+					t.Errorf("syncNamespace() = %v, want %v", err, errNotLeader)
+				}
+				if len(writes) > 0 {
+					t.Errorf("writes = %v, want none", writes)
+				}
+			}
+
+			cancel()
+			select {
+			case ledResult := <-done:
+				if ledResult != tt.leader {
+					t.Errorf("run() = %v, want %v", ledResult, tt.leader)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("run() did not return once cancelled")
+			}
+		})
+	}
+}
+
+func TestLeadershipIsLeading(t *testing.T) {
+	var unelected *leadership
+	if !unelected.isLeading() {
+		t.Error("a nil leadership does not lead")
+	}
+	if (&leadership{}).isLeading() {
+		t.Error("a standby leads")
+	}
+	if !leading().isLeading() {
+		t.Error("an elected leader does not lead")
+	}
+}
+
+func TestLeadershipHandOver(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON))
+	r.leadership = &leadership{}
+
+	holder := func() string {
+		t.Helper()
+		lease, err := kubeClient.CoordinationV1().Leases("aurora-system").Get(context.Background(), leaderElectionLease, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	// The old leader shuts down while it still holds the lease.
+	ctx, cancel := context.WithCancel(context.Background())
+	led := make(chan struct{})
+	done := make(chan bool)
+	var holderBeforeRelease string
+	var leadingBeforeRelease bool
+	go func() {
+		done <- r.leadership.run(ctx, kubeClient, "aurora-system", "old-pod", 2*time.Second, time.Second, 100*time.Millisecond, func() { close(led) }, func() {
+			holderBeforeRelease, leadingBeforeRelease = holder(), r.leadership.isLeading()
+		})
+	}()
+
+	select {
+	case <-led:
+	case <-time.After(5 * time.Second):
+		t.Fatal("old-pod did not lead with a free lease")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run() did not return once cancelled")
+	}
+
+	if holderBeforeRelease != "old-pod" || !leadingBeforeRelease {
+		t.Errorf("before the release, holder = %q and leading = %v, want old-pod still leading", holderBeforeRelease, leadingBeforeRelease)
+	}
+	if r.leadership.isLeading() {
+		t.Error("old-pod still leads once it released the lease")
+	}
+
+	// A new leader takes over.
+	newCtx, newCancel := context.WithCancel(context.Background())
+	defer newCancel()
+	newLed := make(chan struct{})
+	newDone := make(chan bool)
+	go func() {
+		newDone <- (&leadership{}).run(newCtx, kubeClient, "aurora-system", "new-pod", 2*time.Second, time.Second, 100*time.Millisecond, func() { close(newLed) }, func() {})
+	}()
+	select {
+	case <-newLed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new-pod did not take over the released lease")
+	}
+	if got := holder(); got != "new-pod" {
+		t.Fatalf("holder = %q, want new-pod", got)
+	}
+
+	// A cleanup of the old leader now would race the new one.
+	kubeClient.ClearActions()
+	if err := r.cleanupOnShutdown(context.Background()); err != nil {
+		t.Fatalf("cleanupOnShutdown() = %v", err)
+	}
+	for _, write := range writeActions(kubeClient) {
+		if write != "update leases" {
+			t.Errorf("old-pod wrote %s while new-pod leads", write)
+		}
+	}
+	if !secretExists(t, kubeClient, "team", testSecretName) {
+		t.Error("old-pod deleted the secret while new-pod leads")
+	}
+
+	newCancel()
+	<-newDone
+}
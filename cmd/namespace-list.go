@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// namespaceListKey is the key of the namespace list ConfigMap holding the
+// namespaces to reconcile.
+const namespaceListKey = "namespaces"
+
+// namespaceList is the authoritative list of the namespaces to reconcile,
+// maintained in a ConfigMap by the platform rather than with labels. The
+// ConfigMap is cached by its own informer.
+type namespaceList struct {
+	namespace string
+	name      string
+	lister    corev1listers.ConfigMapLister
+}
+
+// parseNamespaceList returns the namespaces listed in the ConfigMap,
+// separated by commas or whitespace. Lines starting with # are comments.
+func parseNamespaceList(configMap *corev1.ConfigMap) sets.Set[string] {
+	namespaces := sets.New[string]()
+	if configMap == nil {
+		return namespaces
+	}
+
+	for _, line := range strings.Split(configMap.Data[namespaceListKey], "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		namespaces.Insert(strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+
+	return namespaces
+}
+
+// names returns the listed namespaces, and false when there is no namespace
+// list or its ConfigMap does not exist.
+func (l *namespaceList) names() (sets.Set[string], bool) {
+	if l == nil {
+		return nil, false
+	}
+
+	configMap, err := l.lister.ConfigMaps(l.namespace).Get(l.name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("error getting namespace list %s/%s: %v", l.namespace, l.name, err)
+		}
+		return nil, false
+	}
+
+	return parseNamespaceList(configMap), true
+}
+
+// includes reports whether the namespace is listed. A nil list includes every
+// namespace, and a missing ConfigMap none.
+func (l *namespaceList) includes(namespace string) bool {
+	if l == nil {
+		return true
+	}
+
+	names, ok := l.names()
+	return ok && names.Has(namespace)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseNamespaceList(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]string
+		want []string
+	}{
+		{name: "no ConfigMap", want: []string{}},
+		{name: "no key", data: map[string]string{"other": "team"}, want: []string{}},
+		{name: "one per line", data: map[string]string{namespaceListKey: "team\nops\n"}, want: []string{"ops", "team"}},
+		{name: "commas and spaces", data: map[string]string{namespaceListKey: "team, ops\tbilling,,payments"}, want: []string{"billing", "ops", "payments", "team"}},
+		{name: "comments", data: map[string]string{namespaceListKey: "# managed by the platform\nteam\n  # ops\n"}, want: []string{"team"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configMap *corev1.ConfigMap
+			if tt.data != nil {
+				configMap = &corev1.ConfigMap{Data: tt.data}
+			}
+
+			if got := sets.List(parseNamespaceList(configMap)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNamespaceList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceListChanges(t *testing.T) {
+	team, other := testNamespace("team", nil), testNamespace("other", nil)
+	r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), other)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	r.namespaceList = &namespaceList{namespace: "aurora-system", name: "managed-namespaces", lister: corev1listers.NewConfigMapLister(indexer)}
+	r.pruneOrphans = true
+
+	setList := func(t *testing.T, list string) {
+		t.Helper()
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "aurora-system", Name: "managed-namespaces"},
+			Data:       map[string]string{namespaceListKey: list},
+		}
+		if err := indexer.Update(configMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sync := func(t *testing.T, namespace *corev1.Namespace, wantWrites []string) {
+		t.Helper()
+		kubeClient.ClearActions()
+		if err := r.syncNamespace(namespace); err != nil {
+			t.Fatalf("syncNamespace(%s) = %v", namespace.Name, err)
+		}
+		if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, wantWrites) {
+			t.Errorf("writes syncing %s = %v, want %v", namespace.Name, writes, wantWrites)
+		}
+	}
+	scan := func(t *testing.T, wantWrites []string) {
+		t.Helper()
+		kubeClient.ClearActions()
+		r.scanOrphans()
+		if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, wantWrites) {
+			t.Errorf("writes scanning orphans = %v, want %v", writes, wantWrites)
+		}
+	}
+
+	// Without its ConfigMap, the list includes no namespace, but no secret
+	// is pruned either.
+	sync(t, other, nil)
+	scan(t, nil)
+
+	// Adding a namespace to the list provisions it.
+	setList(t, "# managed by the platform\nteam, other\n")
+	sync(t, other, []string{"create secrets"})
+	scan(t, nil)
+
+	// Removing a namespace from the list stops reconciling it and prunes
+	// its orphaned secret.
+	setList(t, "other")
+	sync(t, team, nil)
+	scan(t, []string{"delete secrets"})
+	if secretExists(t, kubeClient, "team", testSecretName) {
+		t.Error("secret of the namespace removed from the list not pruned")
+	}
+	if !secretExists(t, kubeClient, "other", testSecretName) {
+		t.Error("secret of the listed namespace deleted")
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+// namespacePlan reports whether the namespace is provisioned, and its service
+// accounts injected, along with the reason. It mirrors the checks of
+// syncNamespace and syncServiceAccount.
+func (r *imagePullSecretsReconciler) namespacePlan(namespace *corev1.Namespace) (bool, string) {
+	switch {
+	case r.excludedNamespaces.Has(namespace.Name):
+		return false, "excluded by --exclude-namespaces"
+	case namespace.DeletionTimestamp != nil || namespace.Status.Phase == corev1.NamespaceTerminating:
+		return false, "terminating"
+	case r.isPendingDeletion(namespace):
+		return false, "labelled as pending deletion"
+	case !r.namespaceSelectors.Matches(labels.Set(namespace.Labels)):
+		return false, "not matching --namespace-selectors or matching --namespace-exclude-selector"
+	case !r.namespaceList.includes(namespace.Name):
+		return false, "not in the namespace list"
+	case !r.isGoverned(namespace):
+		return false, "not governed: no required owner reference or owner labels"
+	case pauseWait(namespace) > 0:
+		return false, fmt.Sprintf("paused until %s", namespace.Annotations[pauseUntilAnnotation])
+	}
+
+	reason := "uses the default credential"
+	if credential, ok := r.registries.credentialFor(namespace); ok {
+		reason = fmt.Sprintf("uses credential %q from the registry config", credential)
+	}
+
+	if name := r.auroraSecretName(namespace); r.reference == nil && name != os.Getenv("AURORA_SECRET_NAME") {
+		reason += fmt.Sprintf(", as secret %q", name)
+	}
+
+	if secrets := r.registries.secretsFor(namespace); len(secrets) > 0 {
+		var names []string
+		for _, secret := range secrets {
+			names = append(names, secret.Name)
+		}
+		reason += fmt.Sprintf(", with the additional secrets %v", names)
+	}
+
+	return true, reason
+}
+
+// logNamespacePlan logs, once, whether each namespace is in scope for secret
+// provisioning and service account injection, to debug the selector
+// configuration.
+func (r *imagePullSecretsReconciler) logNamespacePlan(namespaces []*corev1.Namespace) {
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+
+	serviceAccounts := "all service accounts"
+	if r.excludedServiceAccounts.Len() > 0 || r.serviceAccountExcludeSelector != nil {
+		serviceAccounts = "service accounts not excluded by --exclude-service-accounts or --sa-exclude-selector"
+	}
+
+	managed := 0
+	for _, namespace := range namespaces {
+		ok, reason := r.namespacePlan(namespace)
+		if ok {
+			managed++
+			klog.Infof("Namespace plan: %s is managed, secrets are provisioned and %s are injected: %s", namespace.Name, serviceAccounts, reason)
+		} else {
+			klog.Infof("Namespace plan: %s is skipped: %s", namespace.Name, reason)
+		}
+	}
+
+	klog.Infof("Namespace plan: %d of %d namespaces are managed", managed, len(namespaces))
+}
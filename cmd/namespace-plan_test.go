@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+func TestLogNamespacePlan(t *testing.T) {
+	apps := map[string]string{"tier": "apps"}
+	terminating := testNamespace("terminating", apps)
+	terminating.Status.Phase = corev1.NamespaceTerminating
+	paused := testNamespace("paused", apps)
+	paused.Annotations = map[string]string{pauseUntilAnnotation: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}
+	namespaces := []*corev1.Namespace{
+		testNamespace("team", apps),
+		testNamespace("kube-system", apps),
+		terminating,
+		testNamespace("doomed", map[string]string{"tier": "apps", "lifecycle": "pending-deletion"}),
+		testNamespace("unselected", nil),
+		paused,
+	}
+
+	r, _ := newTestReconciler(t)
+	r.excludedNamespaces = sets.New("kube-system")
+	r.deletionSelector = labels.SelectorFromSet(labels.Set{"lifecycle": "pending-deletion"})
+	selectors, err := newSelectorSet([]string{"tier=apps"}, selectorSetAny, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.namespaceSelectors = selectors
+	r.excludedServiceAccounts = sets.New("builder")
+
+	logs := captureLogs(t)
+	r.logNamespacePlan(namespaces)
+	klog.Flush()
+
+	want := []string{
+		"Namespace plan: doomed is skipped: labelled as pending deletion",
+		"Namespace plan: kube-system is skipped: excluded by --exclude-namespaces",
+		"Namespace plan: paused is skipped: paused until " + paused.Annotations[pauseUntilAnnotation],
+		"Namespace plan: team is managed, secrets are provisioned and service accounts not excluded by --exclude-service-accounts or --sa-exclude-selector are injected: uses the default credential",
+		"Namespace plan: terminating is skipped: terminating",
+		"Namespace plan: unselected is skipped: not matching --namespace-selectors or matching --namespace-exclude-selector",
+		"Namespace plan: 1 of 6 namespaces are managed",
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		// Strip the klog header.
+		if _, message, ok := strings.Cut(line, "] "); ok {
+			got = append(got, message)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("plan =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+)
+
+// namespaceSettler defers the reconciliation of newly observed namespaces, so
+// that admission webhooks and operators setting them up finish before the
+// controller writes into them. Unlike the provision delay, it is measured
+// from the first time the controller observes a namespace rather than from
+// its creation.
+type namespaceSettler struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	observed map[string]time.Time
+}
+
+func newNamespaceSettler(delay time.Duration) *namespaceSettler {
+	if delay <= 0 {
+		return nil
+	}
+
+	return &namespaceSettler{
+		delay:    delay,
+		observed: map[string]time.Time{},
+	}
+}
+
+// settled records a namespace that needs no delay, such as one that already
+// existed when the controller started.
+func (s *namespaceSettler) settled(namespace string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observed[namespace] = time.Time{}
+}
+
+// wait returns how long the namespace must still settle, recording it as
+// observed now if it has not been seen before. A nil settler never waits.
+func (s *namespaceSettler) wait(namespace string) time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	observed, ok := s.observed[namespace]
+	if !ok {
+		s.observed[namespace] = time.Now()
+		return s.delay
+	}
+	if observed.IsZero() {
+		return 0
+	}
+
+	wait := s.delay - time.Since(observed)
+	if wait <= 0 {
+		s.observed[namespace] = time.Time{}
+	}
+
+	return wait
+}
+
+// forget drops the record of a deleted namespace, so that a namespace
+// recreated with the same name settles again.
+func (s *namespaceSettler) forget(namespace string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.observed, namespace)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestNamespaceSettler(t *testing.T) {
+	const delay = time.Hour
+
+	if wait := (*namespaceSettler)(nil).wait("team"); wait != 0 {
+		t.Errorf("wait() of a nil settler = %s, want 0", wait)
+	}
+
+	s := newNamespaceSettler(delay)
+	s.settled("existing")
+	if wait := s.wait("existing"); wait != 0 {
+		t.Errorf("wait() of a namespace existing at startup = %s, want 0", wait)
+	}
+
+	if wait := s.wait("team"); wait != delay {
+		t.Errorf("wait() of a newly observed namespace = %s, want %s", wait, delay)
+	}
+	if wait := s.wait("team"); wait <= 0 || wait > delay {
+		t.Errorf("wait() of a settling namespace = %s, want the rest of %s", wait, delay)
+	}
+
+	// A recreated namespace settles again.
+	s.forget("existing")
+	if wait := s.wait("existing"); wait != delay {
+		t.Errorf("wait() of a recreated namespace = %s, want %s", wait, delay)
+	}
+}
+
+func TestNamespaceSettleDelay(t *testing.T) {
+	const settleDelay = 300 * time.Millisecond
+
+	r, kubeClient := newTestReconciler(t)
+	r.settler = newNamespaceSettler(settleDelay)
+	runNamespacesController(t, r, kubeClient, nil)
+
+	// Unlike the provision delay, the settle delay does not depend on the
+	// creation timestamp, which the fake clientset leaves unset.
+	observed := time.Now()
+	if _, err := kubeClient.CoreV1().Namespaces().Create(r.ctx, testNamespace("team", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("secret of namespace team not provisioned after the settle delay: %v", err)
+	}
+	if elapsed := time.Since(observed); elapsed < settleDelay {
+		t.Errorf("secret of namespace team provisioned after %s, before the settle delay of %s", elapsed, settleDelay)
+	}
+}
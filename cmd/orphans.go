@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+const (
+	// orphanScanInterval is the interval between the scans for orphaned
+	// secrets.
+	orphanScanInterval = 5 * time.Minute
+
+	// maxLoggedOrphans is the number of orphaned secrets named in the scan
+	// summary.
+	maxLoggedOrphans = 10
+)
+
+// isOrphaned reports whether the managed secret is in a namespace the
+// controller no longer reconciles, because it left the namespace selector or
+// the namespace list, or is no longer governed. Excluded namespaces are not
+// out of scope: their secrets are deleted by the namespace sync. Without its
+// ConfigMap, the namespace list orphans nothing.
+func (r *imagePullSecretsReconciler) isOrphaned(secret *corev1.Secret) bool {
+	if names, ok := r.namespaceList.names(); ok && !names.Has(secret.Namespace) {
+		return true
+	}
+
+	namespace, err := r.namespaceLister.Get(secret.Namespace)
+	if errors.IsNotFound(err) {
+		// Namespaces outside the namespace selector are not cached.
+		// Without one, the namespace is being deleted.
+		return r.namespaceSelector != nil
+	} else if err != nil {
+		return false
+	}
+
+	if r.namespaceSelector != nil && !r.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+		return true
+	}
+
+	if !r.namespaceSelectors.Matches(labels.Set(namespace.Labels)) {
+		return true
+	}
+
+	return !r.isGoverned(namespace)
+}
+
+// scanOrphans reports the managed secrets left in namespaces out of scope in
+// the orphaned secrets metric and the log, and deletes them when pruneOrphans
+// is set. The secrets that could not be deleted are still reported.
+func (r *imagePullSecretsReconciler) scanOrphans() {
+	secrets, err := r.secretsLister.List(labels.SelectorFromSet(labels.Set{managedByLabel: managedByValue}))
+	if err != nil {
+		klog.Errorf("error listing managed secrets for orphans: %v", err)
+		return
+	}
+
+	var orphans []string
+	for _, secret := range secrets {
+		if !r.isOrphaned(secret) {
+			continue
+		}
+
+		key := secret.Namespace + "/" + secret.Name
+		if !r.pruneOrphans {
+			orphans = append(orphans, key)
+			continue
+		}
+
+		klog.Infof("deleting orphaned secret %s", key)
+		namespace, name := secret.Namespace, secret.Name
+		err := r.write(func(ctx context.Context) error {
+			return r.kubeClient.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorf("error deleting orphaned secret %s: %v", key, err)
+			orphans = append(orphans, key)
+		}
+	}
+
+	metrics.OrphanedSecrets.Set(float64(len(orphans)))
+	if len(orphans) == 0 {
+		return
+	}
+
+	sort.Strings(orphans)
+	total := len(orphans)
+	if total > maxLoggedOrphans {
+		orphans = append(orphans[:maxLoggedOrphans], "...")
+	}
+	if r.pruneOrphans {
+		klog.Warningf("%d orphaned managed secrets could not be deleted: %v", total, orphans)
+	} else {
+		klog.Warningf("Found %d managed secrets in namespaces out of scope, pass --prune-orphans to delete them: %v", total, orphans)
+	}
+}
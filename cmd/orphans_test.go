@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/klog"
+)
+
+func TestScanOrphans(t *testing.T) {
+	tests := []struct {
+		name         string
+		pruneOrphans bool
+		wantOrphans  float64
+		wantWrites   []string
+		wantLog      string
+	}{
+		{name: "report only", wantOrphans: 1, wantLog: "Found 1 managed secrets in namespaces out of scope, pass --prune-orphans to delete them: [legacy/" + testSecretName + "]"},
+		{name: "pruning", pruneOrphans: true, wantWrites: []string{"delete secrets"}, wantLog: "deleting orphaned secret legacy/" + testSecretName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", map[string]string{"tier": "apps"})
+			legacy := testNamespace("legacy", nil)
+			unmanaged := testSecret(legacy, "other-pull", testDockerConfigJSON)
+			unmanaged.Labels = nil
+			r, kubeClient := newTestReconciler(t,
+				team, testSecret(team, testSecretName, testDockerConfigJSON),
+				legacy, testSecret(legacy, testSecretName, testDockerConfigJSON), unmanaged,
+			)
+			selectors, err := newSelectorSet([]string{"tier=apps"}, selectorSetAny, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.namespaceSelectors = selectors
+			r.pruneOrphans = tt.pruneOrphans
+			metrics.OrphanedSecrets.Set(0)
+
+			logs := captureLogs(t)
+			r.scanOrphans()
+			klog.Flush()
+
+			if got := testutil.ToFloat64(metrics.OrphanedSecrets); got != tt.wantOrphans {
+				t.Errorf("orphaned secrets = %v, want %v", got, tt.wantOrphans)
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if exists := secretExists(t, kubeClient, "legacy", testSecretName); exists == tt.pruneOrphans {
+				t.Errorf("orphaned secret exists = %v, want %v", exists, !tt.pruneOrphans)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log does not contain %q:\n%s", tt.wantLog, logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+var preflightRBAC bool
+
+// permission is a cluster-wide permission the controllers need.
+type permission struct {
+	verb     string
+	group    string
+	resource string
+}
+
+func (p permission) String() string {
+	if p.group == "" {
+		return p.resource
+	}
+
+	return p.resource + "." + p.group
+}
+
+// requiredPermissions returns the permissions needed by the image pull secrets
+// controllers with the current flags.
+func requiredPermissions() []permission {
+	permissions := []permission{
+		{"list", "", "namespaces"},
+		{"watch", "", "namespaces"},
+		{"list", "", "serviceaccounts"},
+		{"watch", "", "serviceaccounts"},
+		{"update", "", "serviceaccounts"},
+		{"list", "", "secrets"},
+		{"watch", "", "secrets"},
+		{"create", "", "secrets"},
+		{"update", "", "secrets"},
+		{"delete", "", "secrets"},
+		{"create", "", "events"},
+	}
+
+	if secretUpdateStrategy == "patch" {
+		permissions = append(permissions, permission{"patch", "", "secrets"})
+	}
+
+	if saUpdateStrategy == "force" || saUpdateStrategy == "apply" {
+		permissions = append(permissions, permission{"patch", "", "serviceaccounts"})
+	}
+
+	if heartbeatLease || leaderElect {
+		permissions = append(permissions,
+			permission{"get", "coordination.k8s.io", "leases"},
+			permission{"create", "coordination.k8s.io", "leases"},
+			permission{"update", "coordination.k8s.io", "leases"},
+		)
+	}
+
+	if reactivePullSecret {
+		permissions = append(permissions,
+			permission{"list", "", "events"},
+			permission{"watch", "", "events"},
+			permission{"get", "", "pods"},
+		)
+	}
+
+	if monitorPullResults {
+		permissions = append(permissions,
+			permission{"list", "", "pods"},
+			permission{"watch", "", "pods"},
+		)
+	}
+
+	if namespaceListConfig != "" {
+		permissions = append(permissions,
+			permission{"list", "", "configmaps"},
+			permission{"watch", "", "configmaps"},
+		)
+	}
+
+	if defaultDenyNetworkPolicy {
+		for _, verb := range []string{"list", "watch", "create", "update", "delete"} {
+			permissions = append(permissions, permission{verb, "networking.k8s.io", "networkpolicies"})
+		}
+	}
+
+	if resourceQuotaHard != "" {
+		for _, verb := range []string{"list", "watch", "create", "update", "delete"} {
+			permissions = append(permissions, permission{verb, "", "resourcequotas"})
+		}
+	}
+
+	return permissions
+}
+
+// checkPermissions reviews each permission in all namespaces with a
+// SelfSubjectAccessReview, writes a table of the results to out and returns an
+// error if any permission is missing.
+func checkPermissions(ctx context.Context, client authorizationv1client.SelfSubjectAccessReviewsGetter, permissions []permission, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERB\tRESOURCE\tRESULT")
+
+	missing := 0
+	for _, p := range permissions {
+		review, err := client.SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     p.verb,
+					Group:    p.group,
+					Resource: p.resource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			w.Flush()
+			return fmt.Errorf("reviewing %s %s: %w", p.verb, p, err)
+		}
+
+		result := "ok"
+		if !review.Status.Allowed {
+			missing++
+			result = "MISSING"
+			if review.Status.Reason != "" {
+				result += " (" + review.Status.Reason + ")"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.verb, p, result)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("%d of %d required permissions are missing", missing, len(permissions))
+	}
+
+	return nil
+}
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check the RBAC permissions of the image pull secrets controllers",
+	Long: `Check the RBAC permissions of the image pull secrets controllers.
+
+Every permission the controllers need with their default flags is reviewed
+in all namespaces, and the command exits non-zero if any is missing. Run
+image-pull-secrets with --preflight-rbac to check the permissions needed by
+a particular set of flags.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := buildConfig()
+		if err != nil {
+			return fmt.Errorf("error building kubeconfig: %w", err)
+		}
+		cfg.UserAgent = userAgentFor(cmd)
+
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %w", err)
+		}
+
+		return checkPermissions(cmd.Context(), kubeClient.AuthorizationV1(), requiredPermissions(), os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(preflightCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	permissions := []permission{
+		{"list", "", "namespaces"},
+		{"update", "", "secrets"},
+		{"create", "coordination.k8s.io", "leases"},
+	}
+
+	tests := []struct {
+		name string
+		// denied maps the denied resources to the reason of the denial.
+		denied    map[string]string
+		reviewErr error
+		wantTable string
+		wantErr   string
+	}{
+		{
+			name: "all allowed",
+			wantTable: "VERB    RESOURCE                    RESULT\n" +
+				"list    namespaces                  ok\n" +
+				"update  secrets                     ok\n" +
+				"create  leases.coordination.k8s.io  ok\n",
+		},
+		{
+			name:   "missing",
+			denied: map[string]string{"secrets": "no RBAC policy matched", "leases": ""},
+			wantTable: "VERB    RESOURCE                    RESULT\n" +
+				"list    namespaces                  ok\n" +
+				"update  secrets                     MISSING (no RBAC policy matched)\n" +
+				"create  leases.coordination.k8s.io  MISSING\n",
+			wantErr: "2 of 3 required permissions are missing",
+		},
+		{
+			name:      "review failure",
+			reviewErr: errors.NewForbidden(authorizationv1.Resource("selfsubjectaccessreviews"), "", nil),
+			wantTable: "VERB  RESOURCE  RESULT\n",
+			wantErr:   "reviewing list namespaces: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			kubeClient.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if tt.reviewErr != nil {
+					return true, nil, tt.reviewErr
+				}
+
+				review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+				reason, denied := tt.denied[review.Spec.ResourceAttributes.Resource]
+				review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: !denied, Reason: reason}
+				return true, review, nil
+			})
+
+			var out bytes.Buffer
+			err := checkPermissions(context.Background(), kubeClient.AuthorizationV1(), permissions, &out)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkPermissions = %v, want nil", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+				t.Errorf("checkPermissions = %v, want an error starting with %q", err, tt.wantErr)
+			}
+			if out.String() != tt.wantTable {
+				t.Errorf("table:\n%s\nwant:\n%s", &out, tt.wantTable)
+			}
+		})
+	}
+}
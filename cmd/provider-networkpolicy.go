@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/klog"
+)
+
+// defaultDenyNetworkPolicyName is the name of the provisioned NetworkPolicy.
+const defaultDenyNetworkPolicyName = "aurora-default-deny"
+
+// networkPolicyProvider provisions a NetworkPolicy denying all ingress
+// traffic to the pods of each namespace.
+type networkPolicyProvider struct {
+	*imagePullSecretsReconciler
+
+	networkPolicyLister networkingv1listers.NetworkPolicyLister
+}
+
+// Name implements namespaceResourceProvider.
+func (p *networkPolicyProvider) Name() string {
+	return "networkpolicies"
+}
+
+// Reconcile implements namespaceResourceProvider.
+func (p *networkPolicyProvider) Reconcile(namespace *corev1.Namespace) error {
+	networkPolicy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaultDenyNetworkPolicyName,
+			Namespace: namespace.Name,
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+
+	setNamespaceOwner(networkPolicy, namespace)
+
+	current, err := p.networkPolicyLister.NetworkPolicies(namespace.Name).Get(networkPolicy.Name)
+	if err == nil && isOwnedByPreviousNamespace(current, namespace) {
+		err = errors.NewNotFound(networkingv1.Resource("networkpolicies"), networkPolicy.Name)
+	}
+
+	if errors.IsNotFound(err) {
+		klog.Infof("creating network policy %s/%s", networkPolicy.Namespace, networkPolicy.Name)
+		err = p.write(func(ctx context.Context) error {
+			_, err := p.kubeClient.NetworkingV1().NetworkPolicies(networkPolicy.Namespace).Create(ctx, networkPolicy, metav1.CreateOptions{})
+			return err
+		})
+		if errors.IsAlreadyExists(err) {
+			return requeue.After(cacheLagRequeueDelay, "network policy %s/%s exists but is not cached yet", networkPolicy.Namespace, networkPolicy.Name)
+		} else if err != nil {
+			return fmt.Errorf("creating network policy %s/%s: %w", networkPolicy.Namespace, networkPolicy.Name, err)
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting network policy %s/%s: %w", networkPolicy.Namespace, networkPolicy.Name, err)
+	}
+
+	if current.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+
+	if isOwnedByNamespace(current, namespace) && equality.Semantic.DeepEqual(current.Spec, networkPolicy.Spec) {
+		return nil
+	}
+
+	klog.Infof("updating network policy %s/%s", networkPolicy.Namespace, networkPolicy.Name)
+	updated := current.DeepCopy()
+	updated.Spec = networkPolicy.Spec
+	setNamespaceOwner(updated, namespace)
+
+	err = p.write(func(ctx context.Context) error {
+		_, err := p.kubeClient.NetworkingV1().NetworkPolicies(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating network policy %s/%s: %w", updated.Namespace, updated.Name, err)
+	}
+
+	return nil
+}
+
+// Cleanup implements namespaceResourceProvider.
+func (p *networkPolicyProvider) Cleanup(namespace *corev1.Namespace) error {
+	current, err := p.networkPolicyLister.NetworkPolicies(namespace.Name).Get(defaultDenyNetworkPolicyName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting network policy %s/%s: %w", namespace.Name, defaultDenyNetworkPolicyName, err)
+	}
+
+	if current.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+
+	klog.Infof("deleting network policy %s/%s", current.Namespace, current.Name)
+	err = p.write(func(ctx context.Context) error {
+		return p.kubeClient.NetworkingV1().NetworkPolicies(current.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{})
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting network policy %s/%s: %w", current.Namespace, current.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNetworkPolicyProviderListerLag(t *testing.T) {
+	team := testNamespace("team", nil)
+	live := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      defaultDenyNetworkPolicyName,
+			Namespace: "team",
+			Labels:    map[string]string{managedByLabel: managedByValue},
+		},
+	}
+	setNamespaceOwner(live, team)
+
+	tests := []struct {
+		name string
+		// cached holds the network policy in the cache as well as in the API
+		// server.
+		cached      bool
+		wantRequeue bool
+		wantWrites  []string
+	}{
+		{name: "not cached yet", wantRequeue: true, wantWrites: []string{"create networkpolicies"}},
+		{name: "cached with a drifted spec", cached: true, wantWrites: []string{"update networkpolicies"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, kubeClient := newTestReconciler(t, team, live.DeepCopy())
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if tt.cached {
+				if err := indexer.Add(live.DeepCopy()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			provider := &networkPolicyProvider{imagePullSecretsReconciler: r, networkPolicyLister: networkingv1listers.NewNetworkPolicyLister(indexer)}
+
+			err := provider.Reconcile(team)
+			if tt.wantRequeue {
+				if after, ok := requeue.Delay(err); !ok || after != cacheLagRequeueDelay {
+					t.Errorf("Reconcile() = %v, want a requeue after %s", err, cacheLagRequeueDelay)
+				}
+			} else if err != nil {
+				t.Errorf("Reconcile() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
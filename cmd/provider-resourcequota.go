@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// resourceQuotaName is the name of the provisioned ResourceQuota.
+const resourceQuotaName = "aurora-default-quota"
+
+// resourceQuotaProvider provisions a ResourceQuota with the configured hard
+// limits into each namespace.
+type resourceQuotaProvider struct {
+	*imagePullSecretsReconciler
+
+	resourceQuotaLister corev1listers.ResourceQuotaLister
+	hard                corev1.ResourceList
+}
+
+// Name implements namespaceResourceProvider.
+func (p *resourceQuotaProvider) Name() string {
+	return "resourcequotas"
+}
+
+// Reconcile implements namespaceResourceProvider.
+func (p *resourceQuotaProvider) Reconcile(namespace *corev1.Namespace) error {
+	resourceQuota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      resourceQuotaName,
+			Namespace: namespace.Name,
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+			},
+		},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: p.hard,
+		},
+	}
+
+	setNamespaceOwner(resourceQuota, namespace)
+
+	current, err := p.resourceQuotaLister.ResourceQuotas(namespace.Name).Get(resourceQuota.Name)
+	if err == nil && isOwnedByPreviousNamespace(current, namespace) {
+		err = errors.NewNotFound(corev1.Resource("resourcequotas"), resourceQuota.Name)
+	}
+
+	if errors.IsNotFound(err) {
+		klog.Infof("creating resource quota %s/%s", resourceQuota.Namespace, resourceQuota.Name)
+		err = p.write(func(ctx context.Context) error {
+			_, err := p.kubeClient.CoreV1().ResourceQuotas(resourceQuota.Namespace).Create(ctx, resourceQuota, metav1.CreateOptions{})
+			return err
+		})
+		if errors.IsAlreadyExists(err) {
+			return requeue.After(cacheLagRequeueDelay, "resource quota %s/%s exists but is not cached yet", resourceQuota.Namespace, resourceQuota.Name)
+		} else if err != nil {
+			return fmt.Errorf("creating resource quota %s/%s: %w", resourceQuota.Namespace, resourceQuota.Name, err)
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting resource quota %s/%s: %w", resourceQuota.Namespace, resourceQuota.Name, err)
+	}
+
+	if current.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+
+	if isOwnedByNamespace(current, namespace) && equality.Semantic.DeepEqual(current.Spec.Hard, resourceQuota.Spec.Hard) {
+		return nil
+	}
+
+	klog.Infof("updating resource quota %s/%s", resourceQuota.Namespace, resourceQuota.Name)
+	updated := current.DeepCopy()
+	updated.Spec.Hard = resourceQuota.Spec.Hard
+	setNamespaceOwner(updated, namespace)
+
+	err = p.write(func(ctx context.Context) error {
+		_, err := p.kubeClient.CoreV1().ResourceQuotas(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating resource quota %s/%s: %w", updated.Namespace, updated.Name, err)
+	}
+
+	return nil
+}
+
+// Cleanup implements namespaceResourceProvider.
+func (p *resourceQuotaProvider) Cleanup(namespace *corev1.Namespace) error {
+	current, err := p.resourceQuotaLister.ResourceQuotas(namespace.Name).Get(resourceQuotaName)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting resource quota %s/%s: %w", namespace.Name, resourceQuotaName, err)
+	}
+
+	if current.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+
+	klog.Infof("deleting resource quota %s/%s", current.Namespace, current.Name)
+	err = p.write(func(ctx context.Context) error {
+		return p.kubeClient.CoreV1().ResourceQuotas(current.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{})
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting resource quota %s/%s: %w", current.Namespace, current.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,446 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/eventsink"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// credentialsWaitRequeueDelay is how long a namespace waits before being
+// synced again while the credentials are empty, with
+// --require-nonempty-credentials. A change of the credentials resyncs every
+// namespace right away.
+const credentialsWaitRequeueDelay = 30 * time.Second
+
+// secretsProvider provisions the Aurora image pull secrets. It is always the
+// first provider so that service accounts reference secrets that exist.
+type secretsProvider struct {
+	*imagePullSecretsReconciler
+}
+
+// Name implements namespaceResourceProvider.
+func (p secretsProvider) Name() string {
+	return "secrets"
+}
+
+// Reconcile implements namespaceResourceProvider.
+func (p secretsProvider) Reconcile(namespace *corev1.Namespace) error {
+	return p.reconcileSecrets(namespace)
+}
+
+// Cleanup implements namespaceResourceProvider.
+func (p secretsProvider) Cleanup(namespace *corev1.Namespace) error {
+	return p.deleteSecrets(namespace)
+}
+
+// reconcileSecrets creates or updates the Aurora secrets in the namespace.
+func (r *imagePullSecretsReconciler) reconcileSecrets(namespace *corev1.Namespace) error {
+	// Generate Secrets
+	secrets := r.generateSecrets(namespace)
+
+	for _, secret := range secrets {
+		// An empty credential would produce a secret that cannot be used to
+		// pull, so wait for the credential source to be populated.
+		if r.requireNonemptyCredentials && len(secret.Data[corev1.DockerConfigJsonKey]) == 0 {
+			klog.Infof("waiting for credentials for secret %s/%s", secret.Namespace, secret.Name)
+			return requeue.After(credentialsWaitRequeueDelay, "waiting for credentials for secret %s/%s", secret.Namespace, secret.Name)
+		}
+
+		currentSecret, err := r.secretsLister.Secrets(secret.Namespace).Get(secret.Name)
+		if err == nil && isOwnedByPreviousNamespace(currentSecret, namespace) {
+			klog.V(4).Infof("Ignoring stale secret %s/%s from a previous namespace", secret.Namespace, secret.Name)
+			err = errors.NewNotFound(corev1.Resource("secrets"), secret.Name)
+		}
+
+		if errors.IsNotFound(err) {
+			klog.Infof("creating secret %s/%s", secret.Namespace, secret.Name)
+			err = r.write(func(ctx context.Context) error {
+				_, err := r.kubeClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+				return err
+			})
+			if err == nil {
+				r.hooks.OnSecretCreated(namespace, secret)
+				continue
+			} else if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("creating secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+
+			// The secrets cache lags behind the API server, or the secret
+			// of a previous namespace with the same name outlived it. Either
+			// way the live secret is reconciled below, which takes it over
+			// from the previous namespace, rather than retried until the
+			// cache changes.
+			if currentSecret, err = r.getLiveSecret(secret.Namespace, secret.Name); errors.IsNotFound(err) {
+				return requeue.After(cacheLagRequeueDelay, "secret %s/%s was deleted while being created", secret.Namespace, secret.Name)
+			} else if err != nil {
+				return fmt.Errorf("getting secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+
+			if isOwnedByPreviousNamespace(currentSecret, namespace) {
+				klog.Infof("taking over secret %s/%s from a previous namespace", secret.Namespace, secret.Name)
+			}
+		} else if err != nil {
+			return fmt.Errorf("getting secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+
+		// The secret exists and another process owns its rotation.
+		if r.createOnly {
+			continue
+		}
+
+		managed := currentSecret.Labels[managedByLabel] == managedByValue
+		if !managed && !r.adoptExistingSecrets {
+			klog.Warningf("skipping secret %s/%s: it is not managed by %s", secret.Namespace, secret.Name, managedByValue)
+			metrics.UnmanagedSecretSkipped.WithLabelValues(secret.Namespace, secret.Name).Inc()
+			r.recorder.Eventf(currentSecret, corev1.EventTypeWarning, "UnmanagedSecret", "Secret %s is not managed by %s and was not overwritten", secret.Name, managedByValue)
+			continue
+		}
+
+		// The type of a secret is immutable, and the kubelet ignores image
+		// pull secrets of another type.
+		if currentSecret.Type != secret.Type {
+			if wait := r.updateDebouncer.wait(secret.Namespace, secret.Name); wait > 0 {
+				return requeue.After(wait, "secret %s/%s was updated less than %s ago", secret.Namespace, secret.Name, r.updateDebouncer.interval)
+			}
+			if err := r.recreateSecret(namespace, currentSecret, secret); err != nil {
+				return err
+			}
+			r.updateDebouncer.updated(secret.Namespace, secret.Name)
+			continue
+		}
+
+		// A registry migration leaves secrets pointing at the defunct host,
+		// which breaks every pull. The hosts are compared whatever the
+		// credential hash annotation says, and the update replaces the whole
+		// dockerconfigjson, and so its hosts.
+		currentHosts, desiredHosts := registryHosts(currentSecret.Data[corev1.DockerConfigJsonKey]), registryHosts(secret.Data[corev1.DockerConfigJsonKey])
+		staleHosts := !currentHosts.Equal(desiredHosts)
+		if staleHosts {
+			klog.Infof("secret %s/%s references registry hosts %v instead of %v, replacing them", secret.Namespace, secret.Name, sets.List(currentHosts), sets.List(desiredHosts))
+			r.recorder.Eventf(currentSecret, corev1.EventTypeNormal, "StaleRegistryHosts", "Secret %s references stale registry hosts %v, replacing them with %v", secret.Name, sets.List(currentHosts.Difference(desiredHosts)), sets.List(desiredHosts))
+		}
+
+		owned := isOwnedByNamespace(currentSecret, namespace)
+		copiedMetadata := r.hasCopiedMetadata(currentSecret, secret)
+		if managed && owned && copiedMetadata && !staleHosts && r.hasDesiredCredential(currentSecret, secret) {
+			continue
+		}
+
+		if wait := r.updateDebouncer.wait(secret.Namespace, secret.Name); wait > 0 {
+			return requeue.After(wait, "secret %s/%s was updated less than %s ago", secret.Namespace, secret.Name, r.updateDebouncer.interval)
+		}
+
+		if managed && owned && copiedMetadata && r.patchSecretData {
+			// Only the credential drifted, so patch the data alone rather than
+			// rewriting the whole object.
+			klog.Infof("patching secret %s/%s", secret.Namespace, secret.Name)
+			patch, err := secretDataPatch(secret.Data, secret.Annotations[credentialHashAnnotation])
+			if err != nil {
+				return fmt.Errorf("building the data patch of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+
+			err = r.write(func(ctx context.Context) error {
+				_, err := r.kubeClient.CoreV1().Secrets(secret.Namespace).Patch(ctx, secret.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("patching secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+		} else {
+			klog.Infof("updating secret %s/%s", secret.Namespace, secret.Name)
+			updated := currentSecret.DeepCopy()
+			if updated.Data == nil {
+				updated.Data = map[string][]byte{}
+			}
+			// Keys added by users are left in place.
+			for key, value := range secret.Data {
+				updated.Data[key] = value
+			}
+			if updated.Labels == nil {
+				updated.Labels = map[string]string{}
+			}
+			updated.Labels[managedByLabel] = managedByValue
+			updated.Labels = mirrorKeys(updated.Labels, secret.Labels, r.copyLabels)
+			updated.Annotations = mirrorKeys(updated.Annotations, secret.Annotations, r.copyAnnotations)
+			if hash, ok := secret.Annotations[credentialHashAnnotation]; ok {
+				if updated.Annotations == nil {
+					updated.Annotations = map[string]string{}
+				}
+				updated.Annotations[credentialHashAnnotation] = hash
+			}
+			setNamespaceOwner(updated, namespace)
+
+			err = r.write(func(ctx context.Context) error {
+				_, err := r.kubeClient.CoreV1().Secrets(secret.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("updating secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+		}
+
+		r.updateDebouncer.updated(secret.Namespace, secret.Name)
+		r.notify(eventsink.TypeNormal, "SecretUpdated", secret.Namespace, secret.Name, "Image pull secret updated")
+	}
+
+	// Additional secrets whose selection no longer matches the namespace.
+	if r.removeInapplicableSecrets {
+		return r.deleteManagedSecrets(namespace.Name, sets.List(sets.New(r.managedImagePullSecretNames(namespace)...).Difference(sets.New(r.imagePullSecretNames(namespace)...))))
+	}
+
+	return nil
+}
+
+// getLiveSecret gets the secret from the API server rather than the cache.
+func (r *imagePullSecretsReconciler) getLiveSecret(namespace, name string) (*corev1.Secret, error) {
+	ctx, cancel := r.callContext()
+	defer cancel()
+
+	return r.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// recreateSecret replaces a secret of the wrong type with the desired one. The
+// type cannot be updated, so the secret is deleted and created again; pods
+// started in between cannot pull. The deletion is preconditioned on the
+// current UID and resourceVersion, so that a secret changed in the meantime is
+// left for the next sync. The created hooks are called once the desired secret
+// is created.
+func (r *imagePullSecretsReconciler) recreateSecret(namespace *corev1.Namespace, current, desired *corev1.Secret) error {
+	klog.Warningf("secret %s/%s has type %s instead of %s, recreating it", current.Namespace, current.Name, current.Type, desired.Type)
+	r.recorder.Eventf(current, corev1.EventTypeWarning, "SecretTypeChanged", "Secret %s has type %s instead of %s and is recreated", current.Name, current.Type, desired.Type)
+
+	err := r.write(func(ctx context.Context) error {
+		return r.kubeClient.CoreV1().Secrets(current.Namespace).Delete(ctx, current.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &current.UID, ResourceVersion: &current.ResourceVersion},
+		})
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting secret %s/%s of type %s: %w", current.Namespace, current.Name, current.Type, err)
+	}
+
+	err = r.write(func(ctx context.Context) error {
+		_, err := r.kubeClient.CoreV1().Secrets(desired.Namespace).Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	})
+	if errors.IsAlreadyExists(err) {
+		return requeue.After(cacheLagRequeueDelay, "secret %s/%s was created again by another process", desired.Namespace, desired.Name)
+	} else if err != nil {
+		return fmt.Errorf("creating secret %s/%s: %w", desired.Namespace, desired.Name, err)
+	}
+
+	r.hooks.OnSecretCreated(namespace, desired)
+	r.notify(eventsink.TypeNormal, "SecretRecreated", desired.Namespace, desired.Name, "Image pull secret recreated with type "+string(desired.Type))
+	return nil
+}
+
+// secretDataPatch returns a JSON merge patch setting the given data keys of a
+// secret, and its credential hash annotation unless hash is empty. The values
+// are base64 encoded, as the API expects for the data field.
+func secretDataPatch(data map[string][]byte, hash string) ([]byte, error) {
+	patch := map[string]interface{}{
+		// encoding/json encodes []byte values as base64.
+		"data": data,
+	}
+	if hash != "" {
+		patch["metadata"] = map[string]interface{}{
+			"annotations": map[string]string{credentialHashAnnotation: hash},
+		}
+	}
+
+	return json.Marshal(patch)
+}
+
+// credentialHash returns the hex SHA-256 of a dockerconfigjson, as stamped in
+// the credential hash annotation and reported by the export command.
+func credentialHash(dockerConfigJSON []byte) string {
+	hash := sha256.Sum256(dockerConfigJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+// hasDesiredCredential reports whether the current secret already holds the
+// credential of the desired one. Every managed key is compared, since an edit
+// of the data can leave the credential hash annotation in place. When the
+// desired secret is stamped with the hash, an annotated current secret must
+// also carry the same hash; secrets not annotated yet are annotated on their
+// next update rather than all at once.
+func (r *imagePullSecretsReconciler) hasDesiredCredential(current, desired *corev1.Secret) bool {
+	if !hasManagedData(current, desired.Data) {
+		return false
+	}
+
+	desiredHash, stamped := desired.Annotations[credentialHashAnnotation]
+	currentHash, annotated := current.Annotations[credentialHashAnnotation]
+	return !stamped || !annotated || currentHash == desiredHash
+}
+
+// registryHosts returns the registry hosts of the auths of a dockerconfigjson.
+// Invalid JSON has no hosts.
+func registryHosts(dockerConfigJSON []byte) sets.Set[string] {
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(dockerConfigJSON, &config); err != nil {
+		return sets.New[string]()
+	}
+
+	return sets.KeySet(config.Auths)
+}
+
+// hasManagedData reports whether every managed key of the secret already holds
+// the desired value. Keys the controller does not manage are ignored.
+func hasManagedData(secret *corev1.Secret, data map[string][]byte) bool {
+	for key, value := range data {
+		current, ok := secret.Data[key]
+		if !ok || !bytes.Equal(current, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasCopiedMetadata reports whether the copied namespace labels and
+// annotations of the secret already match the desired secret.
+func (r *imagePullSecretsReconciler) hasCopiedMetadata(current, desired *corev1.Secret) bool {
+	for _, key := range r.copyLabels {
+		if current.Labels[key] != desired.Labels[key] {
+			return false
+		}
+	}
+
+	for _, key := range r.copyAnnotations {
+		if current.Annotations[key] != desired.Annotations[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mirrorKeys sets the given keys of current to their values in desired,
+// deleting the ones desired does not have, and returns the result.
+func mirrorKeys(current, desired map[string]string, keys []string) map[string]string {
+	for _, key := range keys {
+		value, ok := desired[key]
+		if !ok {
+			delete(current, key)
+			continue
+		}
+
+		if current == nil {
+			current = map[string]string{}
+		}
+		current[key] = value
+	}
+
+	return current
+}
+
+// deleteSecrets deletes the managed Aurora secrets from the namespace,
+// including the additional secrets that do not apply to it. Secrets without
+// the managed-by label are left in place.
+func (r *imagePullSecretsReconciler) deleteSecrets(namespace *corev1.Namespace) error {
+	return r.deleteManagedSecrets(namespace.Name, r.managedImagePullSecretNames(namespace))
+}
+
+// deleteManagedSecrets deletes the named secrets of the namespace that carry
+// the managed-by label.
+func (r *imagePullSecretsReconciler) deleteManagedSecrets(namespace string, names []string) error {
+	for _, name := range names {
+		currentSecret, err := r.secretsLister.Secrets(namespace).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("getting secret %s/%s: %w", namespace, name, err)
+		}
+
+		if currentSecret.Labels[managedByLabel] != managedByValue {
+			continue
+		}
+
+		klog.Infof("deleting secret %s/%s", namespace, name)
+		err = r.write(func(ctx context.Context) error {
+			return r.kubeClient.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting secret %s/%s: %w", namespace, name, err)
+		}
+	}
+
+	return nil
+}
+
+// defaultDockerConfigJSON returns the credential used by namespaces that
+// match no registry mapping.
+func (r *imagePullSecretsReconciler) defaultDockerConfigJSON() string {
+	return string(r.credentials.Get())
+}
+
+// generateSecrets generates secrets for Aurora platform: the Aurora secret,
+// followed by the additional secrets that apply to the namespace.
+func (r *imagePullSecretsReconciler) generateSecrets(namespace *corev1.Namespace) []*corev1.Secret {
+	secrets := []*corev1.Secret{}
+
+	dockerConfigJSON, ok := r.registries.dockerConfigJSONFor(namespace)
+	if !ok {
+		dockerConfigJSON = r.defaultDockerConfigJSON()
+	}
+
+	secrets = append(secrets, r.generateSecret(namespace, r.auroraSecretName(namespace), dockerConfigJSON))
+
+	for _, secret := range r.registries.secretsFor(namespace) {
+		secrets = append(secrets, r.generateSecret(namespace, secret.Name, r.registries.Credentials[secret.Credential].DockerConfigJSON))
+	}
+
+	return secrets
+}
+
+// generateSecret generates a managed image pull secret holding the
+// dockerconfigjson.
+func (r *imagePullSecretsReconciler) generateSecret(namespace *corev1.Namespace, name, dockerConfigJSON string) *corev1.Secret {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace.Name,
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: []byte(dockerConfigJSON),
+		},
+	}
+
+	secret.Labels = mirrorKeys(secret.Labels, namespace.Labels, r.copyLabels)
+	secret.Annotations = mirrorKeys(secret.Annotations, namespace.Annotations, r.copyAnnotations)
+
+	if r.stampCredentialHash {
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[credentialHashAnnotation] = credentialHash(secret.Data[corev1.DockerConfigJsonKey])
+	}
+
+	setNamespaceOwner(secret, namespace)
+
+	return secret
+}
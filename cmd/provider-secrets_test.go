@@ -0,0 +1,839 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/hooks"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/namespaces"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/yaml"
+)
+
+// oldHostDockerConfigJSON is a credential for the registry host replaced by
+// testDockerConfigJSON.
+const oldHostDockerConfigJSON = `{"auths":{"old-registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+
+// getSecret returns the secret from the clientset, failing the test if it
+// does not exist.
+func getSecret(t *testing.T, kubeClient *fake.Clientset, namespace, name string) *corev1.Secret {
+	t.Helper()
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return secret
+}
+
+func TestReconcileSecretsStaleRegistryHosts(t *testing.T) {
+	tests := []struct {
+		name string
+		// hashAnnotation stamps the stale secret with the hash of the
+		// desired credential, as left by an edit that kept the annotation.
+		hashAnnotation bool
+		patch          bool
+	}{
+		{name: "update"},
+		{name: "patch", patch: true},
+		{name: "update with an intact hash annotation", hashAnnotation: true},
+		{name: "patch with an intact hash annotation", hashAnnotation: true, patch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			stale := testSecret(team, testSecretName, oldHostDockerConfigJSON)
+			if tt.hashAnnotation {
+				stale.Annotations = map[string]string{credentialHashAnnotation: credentialHash([]byte(testDockerConfigJSON))}
+			}
+			r, kubeClient := newTestReconciler(t, team, stale)
+			r.stampCredentialHash = tt.hashAnnotation
+			r.patchSecretData = tt.patch
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			secret := getSecret(t, kubeClient, "team", testSecretName)
+			if got := string(secret.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+				t.Errorf("dockerconfigjson = %s, want %s", got, testDockerConfigJSON)
+			}
+			if hosts := sets.List(registryHosts(secret.Data[corev1.DockerConfigJsonKey])); !reflect.DeepEqual(hosts, []string{"registry.example.com"}) {
+				t.Errorf("registry hosts = %v, want [registry.example.com]", hosts)
+			}
+		})
+	}
+}
+
+func TestHasDesiredCredential(t *testing.T) {
+	desiredHash := credentialHash([]byte(testDockerConfigJSON))
+	staleHash := credentialHash([]byte(oldHostDockerConfigJSON))
+
+	tests := []struct {
+		name        string
+		stamp       bool
+		data        map[string][]byte
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "same data", data: dockerConfigJSONData(testDockerConfigJSON), want: true},
+		{name: "drifted data", data: dockerConfigJSONData(oldHostDockerConfigJSON)},
+		{name: "missing key", data: map[string][]byte{}},
+		{name: "extra user key", data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfigJSON), "user": []byte("kept")}, want: true},
+		{name: "stamped, same data and hash", stamp: true, data: dockerConfigJSONData(testDockerConfigJSON), annotations: map[string]string{credentialHashAnnotation: desiredHash}, want: true},
+		{name: "stamped, same data not annotated yet", stamp: true, data: dockerConfigJSONData(testDockerConfigJSON), want: true},
+		{name: "stamped, same data and stale hash", stamp: true, data: dockerConfigJSONData(testDockerConfigJSON), annotations: map[string]string{credentialHashAnnotation: staleHash}},
+		{name: "stamped, data edited with the hash left intact", stamp: true, data: dockerConfigJSONData(oldHostDockerConfigJSON), annotations: map[string]string{credentialHashAnnotation: desiredHash}},
+		{name: "stamped, missing key with the hash left intact", stamp: true, data: map[string][]byte{}, annotations: map[string]string{credentialHashAnnotation: desiredHash}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &imagePullSecretsReconciler{stampCredentialHash: tt.stamp}
+			team := testNamespace("team", nil)
+			current := testSecret(team, testSecretName, "")
+			current.Data = tt.data
+			current.Annotations = tt.annotations
+
+			if got := r.hasDesiredCredential(current, r.generateSecret(team, testSecretName, testDockerConfigJSON)); got != tt.want {
+				t.Errorf("hasDesiredCredential() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkHasDesiredCredential measures the drift decision for a compliant
+// secret holding a credential for several registries, against hashing its
+// data to compare it with the annotation.
+func BenchmarkHasDesiredCredential(b *testing.B) {
+	auths := map[string]map[string]string{}
+	for _, host := range []string{"registry.example.com", "mirror.example.com", "quay.example.com", "ghcr.example.com"} {
+		auths[host] = map[string]string{"auth": strings.Repeat("dXNlcjpwYXNz", 64)}
+	}
+	dockerConfigJSON, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		b.Fatal(err)
+	}
+	team := testNamespace("team", nil)
+
+	for _, stamp := range []bool{false, true} {
+		r := &imagePullSecretsReconciler{stampCredentialHash: stamp}
+		desired := r.generateSecret(team, testSecretName, string(dockerConfigJSON))
+		current := desired.DeepCopy()
+
+		b.Run(fmt.Sprintf("stamped=%t", stamp), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if !r.hasDesiredCredential(current, desired) {
+					b.Fatal("compliant secret reported as drifted")
+				}
+			}
+		})
+	}
+
+	b.Run("hashing the live data", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			credentialHash(dockerConfigJSON)
+		}
+	})
+}
+
+// dockerConfigJSONData returns the data of an image pull secret holding the
+// dockerconfigjson.
+func dockerConfigJSONData(dockerConfigJSON string) map[string][]byte {
+	return map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfigJSON)}
+}
+
+func TestReconcileSecretsCredentialHash(t *testing.T) {
+	desiredHash := credentialHash([]byte(testDockerConfigJSON))
+
+	tests := []struct {
+		name        string
+		data        string
+		annotations map[string]string
+		updated     bool
+	}{
+		{name: "compliant", data: testDockerConfigJSON, annotations: map[string]string{credentialHashAnnotation: desiredHash}},
+		{name: "not annotated yet", data: testDockerConfigJSON},
+		{name: "edited with the hash left intact", data: `{"auths":{"registry.example.com":{"auth":"b3RoZXI6b3RoZXI="}}}`, annotations: map[string]string{credentialHashAnnotation: desiredHash}, updated: true},
+		{name: "stale hash", data: testDockerConfigJSON, annotations: map[string]string{credentialHashAnnotation: "0000"}, updated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			current := testSecret(team, testSecretName, tt.data)
+			current.Annotations = tt.annotations
+			r, kubeClient := newTestReconciler(t, team, current)
+			r.stampCredentialHash = true
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			writes := writeActions(kubeClient)
+			if updated := len(writes) > 0; updated != tt.updated {
+				t.Fatalf("writes = %v, want updated = %v", writes, tt.updated)
+			}
+			if !tt.updated {
+				return
+			}
+
+			secret := getSecret(t, kubeClient, "team", testSecretName)
+			if got := string(secret.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+				t.Errorf("dockerconfigjson = %s, want %s", got, testDockerConfigJSON)
+			}
+			if got := secret.Annotations[credentialHashAnnotation]; got != desiredHash {
+				t.Errorf("hash annotation = %s, want %s", got, desiredHash)
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsUnmanaged(t *testing.T) {
+	tests := []struct {
+		name  string
+		adopt bool
+	}{
+		{name: "adopted", adopt: true},
+		{name: "skipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			unmanaged := testSecret(team, testSecretName, oldHostDockerConfigJSON)
+			unmanaged.Labels = map[string]string{"owner": "other-tool"}
+			unmanaged.OwnerReferences = nil
+			r, kubeClient := newTestReconciler(t, team, unmanaged)
+			r.adoptExistingSecrets = tt.adopt
+			recorder := r.recorder.(*record.FakeRecorder)
+			metrics.UnmanagedSecretSkipped.DeleteLabelValues("team", testSecretName)
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			secret := getSecret(t, kubeClient, "team", testSecretName)
+			skipped := testutil.ToFloat64(metrics.UnmanagedSecretSkipped.WithLabelValues("team", testSecretName))
+			if tt.adopt {
+				if got := string(secret.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+					t.Errorf("dockerconfigjson = %s, want %s", got, testDockerConfigJSON)
+				}
+				if secret.Labels[managedByLabel] != managedByValue || secret.Labels["owner"] != "other-tool" {
+					t.Errorf("labels = %v, want the managed-by label added", secret.Labels)
+				}
+				if !isOwnedByNamespace(secret, team) {
+					t.Error("adopted secret not owned by its namespace")
+				}
+				if skipped != 0 {
+					t.Errorf("skipped counter = %v, want 0", skipped)
+				}
+				return
+			}
+
+			if writes := writeActions(kubeClient); len(writes) > 0 {
+				t.Errorf("writes = %v, want none", writes)
+			}
+			if skipped != 1 {
+				t.Errorf("skipped counter = %v, want 1", skipped)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.HasPrefix(event, "Warning UnmanagedSecret ") {
+					t.Errorf("event = %q, want an UnmanagedSecret Warning", event)
+				}
+			default:
+				t.Error("no UnmanagedSecret event recorded")
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsRecreatedNamespace(t *testing.T) {
+	previous := testNamespace("team", nil)
+	team := testNamespace("team", nil)
+	team.UID = "team-new-uid"
+
+	tests := []struct {
+		name string
+		// cached is the secret in the secrets cache, and live the one the
+		// API server holds.
+		cached, live *corev1.Secret
+		wantWrites   []string
+	}{
+		{
+			name:       "previous secret still exists",
+			cached:     testSecret(previous, testSecretName, testDockerConfigJSON),
+			live:       testSecret(previous, testSecretName, testDockerConfigJSON),
+			wantWrites: []string{"create secrets", "update secrets"},
+		},
+		{
+			name:       "previous secret not cached yet",
+			live:       testSecret(previous, testSecretName, testDockerConfigJSON),
+			wantWrites: []string{"create secrets", "update secrets"},
+		},
+		{
+			name:       "previous secret garbage collected",
+			cached:     testSecret(previous, testSecretName, testDockerConfigJSON),
+			wantWrites: []string{"create secrets"},
+		},
+		{
+			name:       "current secret not cached yet",
+			live:       testSecret(team, testSecretName, testDockerConfigJSON),
+			wantWrites: []string{"create secrets"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{team}
+			if tt.live != nil {
+				objects = append(objects, tt.live)
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.cached != nil {
+				if err := indexer.Add(tt.cached); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.secretsLister = corev1listers.NewSecretLister(indexer)
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			secret := getSecret(t, kubeClient, "team", testSecretName)
+			if !isOwnedByNamespace(secret, team) || isOwnedByPreviousNamespace(secret, team) {
+				t.Errorf("owner references = %v, want the recreated namespace alone", secret.OwnerReferences)
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsWrongType(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret func(*corev1.Namespace) *corev1.Secret
+		// debounced records an update of the secret just before the sync.
+		debounced   bool
+		wantWrites  []string
+		wantCreated int
+		wantEvent   string
+	}{
+		{
+			name: "opaque secret",
+			secret: func(namespace *corev1.Namespace) *corev1.Secret {
+				secret := testSecret(namespace, testSecretName, testDockerConfigJSON)
+				secret.Type = corev1.SecretTypeOpaque
+				return secret
+			},
+			wantWrites:  []string{"delete secrets", "create secrets"},
+			wantCreated: 1,
+			wantEvent:   "Warning SecretTypeChanged",
+		},
+		{
+			name: "opaque secret updated recently",
+			secret: func(namespace *corev1.Namespace) *corev1.Secret {
+				secret := testSecret(namespace, testSecretName, testDockerConfigJSON)
+				secret.Type = corev1.SecretTypeOpaque
+				return secret
+			},
+			debounced: true,
+		},
+		{
+			name: "missing data key",
+			secret: func(namespace *corev1.Namespace) *corev1.Secret {
+				secret := testSecret(namespace, testSecretName, testDockerConfigJSON)
+				secret.Data = map[string][]byte{"other": []byte("kept")}
+				return secret
+			},
+			wantWrites: []string{"update secrets"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			r, kubeClient := newTestReconciler(t, team, tt.secret(team))
+			r.updateDebouncer = newUpdateDebouncer(time.Hour)
+			if tt.debounced {
+				r.updateDebouncer.updated("team", testSecretName)
+			}
+			var created []string
+			r.hooks.Add(hooks.Funcs{SecretCreated: func(namespace *corev1.Namespace, secret *corev1.Secret) {
+				// The hook runs once the secret exists again.
+				if got := getSecret(t, kubeClient, secret.Namespace, secret.Name); got.Type != corev1.SecretTypeDockerConfigJson {
+					t.Errorf("hook called with a secret of type %s", got.Type)
+				}
+				created = append(created, secret.Namespace+"/"+secret.Name)
+			}})
+
+			err := r.reconcileSecrets(team)
+			if tt.debounced {
+				if !requeue.IsRequested(err) {
+					t.Fatalf("reconcileSecrets() = %v, want a requeue", err)
+				}
+			} else if err != nil {
+				t.Fatalf("reconcileSecrets() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if len(created) != tt.wantCreated {
+				t.Errorf("created hooks = %v, want %d", created, tt.wantCreated)
+			}
+
+			secret := getSecret(t, kubeClient, "team", testSecretName)
+			if tt.debounced {
+				if secret.Type != corev1.SecretTypeOpaque {
+					t.Errorf("debounced secret type = %s, want %s", secret.Type, corev1.SecretTypeOpaque)
+				}
+				return
+			}
+			if secret.Type != corev1.SecretTypeDockerConfigJson {
+				t.Errorf("type = %s, want %s", secret.Type, corev1.SecretTypeDockerConfigJson)
+			}
+			if got := string(secret.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+				t.Errorf("%s = %s, want %s", corev1.DockerConfigJsonKey, got, testDockerConfigJSON)
+			}
+			if !isOwnedByNamespace(secret, team) || secret.Labels[managedByLabel] != managedByValue {
+				t.Errorf("secret is not managed and owned by the namespace: %v", secret.ObjectMeta)
+			}
+
+			var events []string
+			for len(r.recorder.(*record.FakeRecorder).Events) > 0 {
+				events = append(events, <-r.recorder.(*record.FakeRecorder).Events)
+			}
+			if tt.wantEvent != "" && (len(events) != 1 || !strings.HasPrefix(events[0], tt.wantEvent)) {
+				t.Errorf("events = %v, want %s", events, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsRequireNonemptyCredentials(t *testing.T) {
+	tests := []struct {
+		name             string
+		requireNonempty  bool
+		dockerConfigJSON string
+		// merged merges the credential with an empty one.
+		merged     bool
+		wantErr    bool
+		wantWrites []string
+	}{
+		{name: "required and empty", requireNonempty: true, wantErr: true},
+		{name: "required and merged empty", requireNonempty: true, merged: true, wantErr: true},
+		{name: "required and set", requireNonempty: true, dockerConfigJSON: testDockerConfigJSON, wantWrites: []string{"create secrets"}},
+		{name: "tolerated and empty", wantWrites: []string{"create secrets"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			r, kubeClient := newTestReconciler(t, team)
+			r.requireNonemptyCredentials = tt.requireNonempty
+			var provider credentials.Provider = credentials.Static(tt.dockerConfigJSON)
+			if tt.merged {
+				provider = &credentials.Merged{Providers: []credentials.Provider{provider, credentials.Static("")}}
+			}
+			r.credentials = credentials.NewCache(provider, 0)
+			if _, err := r.credentials.Refresh(r.ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			err := r.reconcileSecrets(team)
+			if tt.wantErr {
+				if delay, ok := requeue.Delay(err); !ok || !requeue.IsRequested(err) || delay != credentialsWaitRequeueDelay {
+					t.Errorf("reconcileSecrets() = %v, want a requeue after %s", err, credentialsWaitRequeueDelay)
+				}
+			} else if err != nil {
+				t.Errorf("reconcileSecrets() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if tt.wantWrites != nil {
+				if data := string(getSecret(t, kubeClient, "team", testSecretName).Data[corev1.DockerConfigJsonKey]); data != tt.dockerConfigJSON {
+					t.Errorf("%s = %q, want %q", corev1.DockerConfigJsonKey, data, tt.dockerConfigJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestDeletedSecretRecreated(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON))
+
+	// The namespaces controller is requeued by the deletes of the secrets it
+	// owns, as runControllers registers it.
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	synced := make(chan struct{}, 10)
+	controller := namespaces.NewController(factory.Core().V1().Namespaces(), func(namespace *corev1.Namespace) error {
+		defer func() { synced <- struct{}{} }()
+		return r.syncNamespace(namespace)
+	})
+	secretInformer := factory.Core().V1().Secrets()
+	secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: controller.HandleObject,
+	})
+	r.secretsLister = secretInformer.Lister()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	go controller.Run(1, stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	// Only the delete requeues the namespace once it was added.
+	<-synced
+	if err := kubeClient.CoreV1().Secrets("team").Delete(context.Background(), testSecretName, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		t.Fatalf("secret not recreated: %v", err)
+	}
+	secret := getSecret(t, kubeClient, "team", testSecretName)
+	if !isOwnedByNamespace(secret, team) || string(secret.Data[corev1.DockerConfigJsonKey]) != testDockerConfigJSON {
+		t.Errorf("recreated secret = %v, want the managed secret of the namespace", secret)
+	}
+}
+
+func TestReconcileSecretsPreservesUserKeys(t *testing.T) {
+	tests := []struct {
+		name             string
+		dockerConfigJSON string
+		patchSecretData  bool
+		wantWrites       []string
+	}{
+		{name: "in sync", dockerConfigJSON: testDockerConfigJSON},
+		{name: "updated", dockerConfigJSON: oldHostDockerConfigJSON, wantWrites: []string{"update secrets"}},
+		{name: "patched", dockerConfigJSON: `{"auths":{"registry.example.com":{"auth":"b2xkOnBhc3M="}}}`, patchSecretData: true, wantWrites: []string{"patch secrets"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			secret := testSecret(team, testSecretName, tt.dockerConfigJSON)
+			secret.Data["notes"] = []byte("added by the team")
+			r, kubeClient := newTestReconciler(t, team, secret)
+			r.patchSecretData = tt.patchSecretData
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			want := map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(testDockerConfigJSON),
+				"notes":                    []byte("added by the team"),
+			}
+			if data := getSecret(t, kubeClient, "team", testSecretName).Data; !reflect.DeepEqual(data, want) {
+				t.Errorf("data = %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsListerLag(t *testing.T) {
+	tests := []struct {
+		name string
+		// live is the secret the API server holds while the secrets cache
+		// is still empty.
+		live        *corev1.Secret
+		wantRequeue bool
+		wantWrites  []string
+	}{
+		{
+			name:       "in sync",
+			live:       testSecret(testNamespace("team", nil), testSecretName, testDockerConfigJSON),
+			wantWrites: []string{"create secrets"},
+		},
+		{
+			name:       "drifted",
+			live:       testSecret(testNamespace("team", nil), testSecretName, oldHostDockerConfigJSON),
+			wantWrites: []string{"create secrets", "update secrets"},
+		},
+		{
+			name:        "deleted after the create",
+			wantRequeue: true,
+			wantWrites:  []string{"create secrets"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			objects := []runtime.Object{team}
+			if tt.live != nil {
+				objects = append(objects, tt.live)
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.secretsLister = corev1listers.NewSecretLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+			if tt.live == nil {
+				kubeClient.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.NewAlreadyExists(corev1.Resource("secrets"), testSecretName)
+				})
+			}
+
+			err := r.reconcileSecrets(team)
+			if tt.wantRequeue {
+				if after, ok := requeue.Delay(err); !ok || after != cacheLagRequeueDelay {
+					t.Errorf("reconcileSecrets() = %v, want a requeue after %s", err, cacheLagRequeueDelay)
+				}
+			} else if err != nil {
+				t.Errorf("reconcileSecrets() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if tt.live == nil {
+				return
+			}
+			if data := string(getSecret(t, kubeClient, "team", testSecretName).Data[corev1.DockerConfigJsonKey]); data != testDockerConfigJSON {
+				t.Errorf("%s = %s, want %s", corev1.DockerConfigJsonKey, data, testDockerConfigJSON)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretRoundTrip(t *testing.T) {
+	r, _ := newTestReconciler(t)
+	secret := r.generateSecret(testNamespace("team", nil), testSecretName, testDockerConfigJSON)
+
+	serialized, err := json.Marshal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded corev1.Secret
+	if err := json.Unmarshal(serialized, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != corev1.SecretTypeDockerConfigJson {
+		t.Errorf("type = %q, want %q", decoded.Type, corev1.SecretTypeDockerConfigJson)
+	}
+	if got := string(decoded.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+		t.Errorf("%s = %s, want %s", corev1.DockerConfigJsonKey, got, testDockerConfigJSON)
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(decoded.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("decoding %s: %v", corev1.DockerConfigJsonKey, err)
+	}
+	if got := config.Auths["registry.example.com"].Auth; got != "dXNlcjpwYXNz" {
+		t.Errorf("auth of registry.example.com = %q, want dXNlcjpwYXNz", got)
+	}
+}
+
+func TestReconcileSecretsCreateOnly(t *testing.T) {
+	team := testNamespace("team", nil)
+	outdated := testSecret(team, testSecretName, oldHostDockerConfigJSON)
+	opaque := testSecret(team, testSecretName, testDockerConfigJSON)
+	opaque.Type = corev1.SecretTypeOpaque
+
+	tests := []struct {
+		name       string
+		existing   *corev1.Secret
+		wantWrites []string
+	}{
+		{name: "missing", wantWrites: []string{"create secrets"}},
+		{name: "outdated credential", existing: outdated},
+		{name: "wrong type", existing: opaque},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{team}
+			if tt.existing != nil {
+				objects = append(objects, tt.existing)
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.createOnly = true
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestGenerateSecretTypeMeta(t *testing.T) {
+	r, _ := newTestReconciler(t)
+	secret := r.generateSecret(testNamespace("team", nil), testSecretName, testDockerConfigJSON)
+
+	rendered, err := yaml.Marshal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(rendered, &typeMeta); err != nil {
+		t.Fatal(err)
+	}
+	if want := (metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}); typeMeta != want {
+		t.Errorf("rendered apiVersion %q and kind %q, want %q and %q", typeMeta.APIVersion, typeMeta.Kind, want.APIVersion, want.Kind)
+	}
+}
+
+func TestReconcileSecretsCopiedMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing are the labels of an existing secret, nil when the
+		// secret is created.
+		existing        map[string]string
+		namespaceLabels map[string]string
+		wantLabels      map[string]string
+		wantWrites      []string
+	}{
+		{
+			name:            "created",
+			namespaceLabels: map[string]string{"cost-center": "cc-1234", "team": "ops"},
+			wantLabels:      map[string]string{managedByLabel: managedByValue, "cost-center": "cc-1234"},
+			wantWrites:      []string{"create secrets"},
+		},
+		{
+			name:            "namespace label changed",
+			existing:        map[string]string{managedByLabel: managedByValue, "cost-center": "cc-1234"},
+			namespaceLabels: map[string]string{"cost-center": "cc-5678"},
+			wantLabels:      map[string]string{managedByLabel: managedByValue, "cost-center": "cc-5678"},
+			wantWrites:      []string{"update secrets"},
+		},
+		{
+			name:       "namespace label removed",
+			existing:   map[string]string{managedByLabel: managedByValue, "cost-center": "cc-1234", "owner": "other-tool"},
+			wantLabels: map[string]string{managedByLabel: managedByValue, "owner": "other-tool"},
+			wantWrites: []string{"update secrets"},
+		},
+		{
+			name:            "in sync",
+			existing:        map[string]string{managedByLabel: managedByValue, "cost-center": "cc-1234"},
+			namespaceLabels: map[string]string{"cost-center": "cc-1234"},
+			wantLabels:      map[string]string{managedByLabel: managedByValue, "cost-center": "cc-1234"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", tt.namespaceLabels)
+			objects := []runtime.Object{team}
+			if tt.existing != nil {
+				existing := testSecret(team, testSecretName, testDockerConfigJSON)
+				existing.Labels = tt.existing
+				objects = append(objects, existing)
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.copyLabels = []string{"cost-center"}
+
+			if err := r.reconcileSecrets(team); err != nil {
+				t.Fatalf("reconcileSecrets() = %v", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			if secret := getSecret(t, kubeClient, "team", testSecretName); !reflect.DeepEqual(secret.Labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", secret.Labels, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestReconcileSecretsPatchSecretData(t *testing.T) {
+	team := testNamespace("team", nil)
+	outdated := testSecret(team, testSecretName, `{"auths":{"registry.example.com":{"auth":"b2xkOm9sZA=="}}}`)
+	r, kubeClient := newTestReconciler(t, team, outdated)
+	r.patchSecretData = true
+	r.stampCredentialHash = true
+
+	if err := r.reconcileSecrets(team); err != nil {
+		t.Fatalf("reconcileSecrets() = %v", err)
+	}
+
+	if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, []string{"patch secrets"}) {
+		t.Fatalf("writes = %v, want [patch secrets]", writes)
+	}
+	var patch k8stesting.PatchAction
+	for _, action := range kubeClient.Actions() {
+		if action, ok := action.(k8stesting.PatchAction); ok {
+			patch = action
+		}
+	}
+	if patch.GetPatchType() != types.MergePatchType {
+		t.Errorf("patch type = %s, want %s", patch.GetPatchType(), types.MergePatchType)
+	}
+
+	// The data is base64 in the patch, as in the secret's JSON, and nothing
+	// but the data and the hash annotation is patched.
+	var body map[string]interface{}
+	if err := json.Unmarshal(patch.GetPatch(), &body); err != nil {
+		t.Fatalf("decoding the patch %s: %v", patch.GetPatch(), err)
+	}
+	want := map[string]interface{}{
+		"data": map[string]interface{}{
+			corev1.DockerConfigJsonKey: base64.StdEncoding.EncodeToString([]byte(testDockerConfigJSON)),
+		},
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{credentialHashAnnotation: credentialHash([]byte(testDockerConfigJSON))},
+		},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("patch = %s, want %v", patch.GetPatch(), want)
+	}
+
+	secret := getSecret(t, kubeClient, "team", testSecretName)
+	if got := string(secret.Data[corev1.DockerConfigJsonKey]); got != testDockerConfigJSON {
+		t.Errorf("dockerconfigjson = %s, want %s", got, testDockerConfigJSON)
+	}
+	if !reflect.DeepEqual(secret.Labels, outdated.Labels) {
+		t.Errorf("labels = %v, want %v", secret.Labels, outdated.Labels)
+	}
+}
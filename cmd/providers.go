@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// cacheLagRequeueDelay is how long a namespace waits before being synced again
+// when a create fails because the informer cache has not caught up yet.
+const cacheLagRequeueDelay = 2 * time.Second
+
+// namespaceResourceProvider reconciles one kind of resource that the
+// controller provisions into every managed namespace. Each provider is
+// independently enabled and runs as part of the namespace reconcile.
+type namespaceResourceProvider interface {
+	// Name identifies the provider in logs and errors.
+	Name() string
+
+	// Reconcile converges the provider's resources in the namespace.
+	Reconcile(namespace *corev1.Namespace) error
+
+	// Cleanup removes the provider's managed resources from a namespace that
+	// is no longer managed. Resources without the managed-by label are kept.
+	Cleanup(namespace *corev1.Namespace) error
+}
+
+// setNamespaceOwner makes the namespace the controller owner of a resource
+// provisioned into it, replacing any reference to a previous namespace. The
+// namespaces controller uses this reference to requeue the namespace when
+// the resource changes or is deleted. If another controller already owns the
+// resource, the reference is added without claiming control.
+func setNamespaceOwner(object metav1.Object, namespace *corev1.Namespace) {
+	ownerReferences := []metav1.OwnerReference{}
+	controlled := false
+	for _, ownerReference := range object.GetOwnerReferences() {
+		if ownerReference.APIVersion == "v1" && ownerReference.Kind == "Namespace" {
+			continue
+		}
+
+		if ptr.Deref(ownerReference.Controller, false) {
+			controlled = true
+		}
+
+		ownerReferences = append(ownerReferences, ownerReference)
+	}
+
+	ownerReference := *metav1.NewControllerRef(namespace, corev1.SchemeGroupVersion.WithKind("Namespace"))
+	ownerReference.BlockOwnerDeletion = nil
+	if controlled {
+		ownerReference.Controller = nil
+	}
+
+	object.SetOwnerReferences(append(ownerReferences, ownerReference))
+}
+
+// isOwnedByNamespace reports whether the resource has an owner reference to
+// this namespace, matched by UID.
+func isOwnedByNamespace(object metav1.Object, namespace *corev1.Namespace) bool {
+	for _, ownerReference := range object.GetOwnerReferences() {
+		if ownerReference.Kind == "Namespace" && ownerReference.UID == namespace.UID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isOwnedByPreviousNamespace reports whether the resource is owned by an
+// earlier namespace with the same name, which happens when a namespace is
+// deleted and recreated before the informer cache observes the deletion of
+// its resources. Such resources are stale and must not be mistaken for the
+// resources of the recreated namespace.
+func isOwnedByPreviousNamespace(object metav1.Object, namespace *corev1.Namespace) bool {
+	for _, ownerReference := range object.GetOwnerReferences() {
+		if ownerReference.Kind == "Namespace" && ownerReference.Name == namespace.Name && ownerReference.UID != namespace.UID {
+			return true
+		}
+	}
+
+	return false
+}
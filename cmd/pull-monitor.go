@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// pullMonitorCooldown is how long a pod is not reported again after one of
+// its pull failures was reported.
+const pullMonitorCooldown = 30 * time.Minute
+
+// pullMonitor reports pods failing to pull their images even though they
+// reference the managed secret, which indicates the credential is wrong or
+// insufficient. It never writes to the cluster.
+type pullMonitor struct {
+	// secretName returns the name of the managed secret in a namespace.
+	secretName    func(namespace string) string
+	secretsLister corev1listers.SecretLister
+
+	// recent holds the pods reported within the cooldown.
+	recent *utilcache.LRUExpireCache
+}
+
+func newPullMonitor(secretName func(namespace string) string, secretsLister corev1listers.SecretLister) *pullMonitor {
+	return &pullMonitor{
+		secretName:    secretName,
+		secretsLister: secretsLister,
+		recent:        utilcache.NewLRUExpireCache(4096),
+	}
+}
+
+// trimPod is an informer transform that drops the fields of the pod the
+// monitor does not read, reducing the memory held by the pods cache.
+func trimPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+
+	trimmed := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: pod.Spec.ServiceAccountName,
+			ImagePullSecrets:   pod.Spec.ImagePullSecrets,
+		},
+	}
+
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil {
+			trimmed.Status.ContainerStatuses = append(trimmed.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:  status.Name,
+				Image: status.Image,
+				State: corev1.ContainerState{Waiting: status.State.Waiting},
+			})
+		}
+	}
+
+	return trimmed, nil
+}
+
+// backingOffImage returns the image of the first container of the pod backing
+// off from repeated pull failures.
+func backingOffImage(pod *corev1.Pod) (string, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "ImagePullBackOff" {
+			return status.Image, true
+		}
+	}
+
+	return "", false
+}
+
+// handlePod reports the pod if it keeps failing to pull an image while
+// referencing the managed secret.
+func (m *pullMonitor) handlePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	secretName := m.secretName(pod.Namespace)
+	image, ok := backingOffImage(pod)
+	if !ok || !hasLocalObjectReference(pod.Spec.ImagePullSecrets, secretName) {
+		return
+	}
+
+	secret, err := m.secretsLister.Secrets(pod.Namespace).Get(secretName)
+	if err != nil || secret.Labels[managedByLabel] != managedByValue {
+		return
+	}
+
+	key := pod.Namespace + "/" + pod.Name
+	if _, ok := m.recent.Get(key); ok {
+		return
+	}
+	m.recent.Add(key, struct{}{}, pullMonitorCooldown)
+
+	klog.Warningf("Pod %s cannot pull image %s despite using the managed secret %s: the credential may be wrong or insufficient", key, image, secretName)
+	metrics.PullFailuresWithManagedSecret.WithLabelValues(pod.Namespace).Inc()
+}
+
+// hasLocalObjectReference reports whether the references include name.
+func hasLocalObjectReference(references []corev1.LocalObjectReference, name string) bool {
+	for _, reference := range references {
+		if reference.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
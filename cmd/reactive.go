@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/namespaces"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/serviceaccounts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// reactiveCooldown is how long a pod is ignored after its namespace was
+// reprovisioned in reaction to one of its pull failures.
+const reactiveCooldown = 5 * time.Minute
+
+// reactiveProvisioner reprovisions the namespace and service account of pods
+// failing to pull their images, complementing the proactive reconciles of
+// namespaces their selectors or events missed.
+type reactiveProvisioner struct {
+	ctx        context.Context
+	kubeClient kubernetes.Interface
+
+	namespaces      *namespaces.Controller
+	serviceAccounts *serviceaccounts.Controller
+
+	// recent holds the pods reacted to within the cooldown.
+	recent *utilcache.LRUExpireCache
+}
+
+func newReactiveProvisioner(ctx context.Context, kubeClient kubernetes.Interface, namespaces *namespaces.Controller, serviceAccounts *serviceaccounts.Controller) *reactiveProvisioner {
+	return &reactiveProvisioner{
+		ctx:             ctx,
+		kubeClient:      kubeClient,
+		namespaces:      namespaces,
+		serviceAccounts: serviceAccounts,
+		recent:          utilcache.NewLRUExpireCache(4096),
+	}
+}
+
+// isImagePullFailure reports whether the event reports a pod failing to pull
+// an image.
+func isImagePullFailure(event *corev1.Event) bool {
+	if event.Type != corev1.EventTypeWarning || event.InvolvedObject.Kind != "Pod" {
+		return false
+	}
+
+	switch event.Reason {
+	case "Failed", "BackOff":
+		return strings.Contains(event.Message, "ErrImagePull") ||
+			strings.Contains(event.Message, "ImagePullBackOff") ||
+			strings.Contains(event.Message, "pulling image")
+	default:
+		return false
+	}
+}
+
+// handleEvent enqueues the namespace and service account of the pod that
+// failed to pull an image, at most once per cooldown for each pod.
+func (p *reactiveProvisioner) handleEvent(obj interface{}) {
+	event, ok := obj.(*corev1.Event)
+	if !ok || !isImagePullFailure(event) {
+		return
+	}
+
+	pod := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+	if _, ok := p.recent.Get(pod); ok {
+		return
+	}
+	p.recent.Add(pod, struct{}{}, reactiveCooldown)
+
+	klog.Infof("Pod %s failed to pull an image, reprovisioning namespace %s", pod, event.InvolvedObject.Namespace)
+	p.namespaces.EnqueueKey(event.InvolvedObject.Namespace)
+
+	if p.serviceAccounts == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, 10*time.Second)
+	defer cancel()
+
+	current, err := p.kubeClient.CoreV1().Pods(event.InvolvedObject.Namespace).Get(ctx, event.InvolvedObject.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(4).Infof("Could not get pod %s to find its service account: %v", pod, err)
+		return
+	}
+
+	serviceAccount := current.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+
+	p.serviceAccounts.EnqueueKey(current.Namespace + "/" + serviceAccount)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"k8s.io/klog"
+)
+
+// errReadOnly is returned by write in read-only mode, instead of performing
+// the write.
+var errReadOnly = errors.New("read-only mode, the change was not made")
+
+// observeDrift records the outcome of a sync in read-only mode: a sync that
+// stopped at a write has drifted, and is reported as noncompliant rather than
+// as a failure, so that it waits for the next resync instead of retrying. It
+// returns err unchanged outside of read-only mode.
+func (r *imagePullSecretsReconciler) observeDrift(compliance *convergence.Compliance, key string, err error) error {
+	if !r.readOnly {
+		return err
+	}
+
+	if errors.Is(err, errReadOnly) {
+		klog.Infof("read-only: %s has drifted from the desired state and was left unchanged", key)
+		compliance.Observe(key, false)
+		return nil
+	}
+
+	if err == nil {
+		compliance.Observe(key, true)
+	}
+
+	return err
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestReadOnly(t *testing.T) {
+	missing := testNamespace("missing", nil)
+	drifted := testNamespace("drifted", nil)
+	compliant := testNamespace("compliant", nil)
+	serviceAccounts := []*corev1.ServiceAccount{
+		testServiceAccount("missing", "default"),
+		testServiceAccount("drifted", "default"),
+		testServiceAccount("compliant", "default", testSecretName),
+	}
+	r, kubeClient := newTestReconciler(t,
+		missing, drifted, compliant,
+		testSecret(drifted, testSecretName, oldHostDockerConfigJSON),
+		testSecret(compliant, testSecretName, testDockerConfigJSON),
+		serviceAccounts[0], serviceAccounts[1], serviceAccounts[2],
+	)
+	r.readOnly = true
+	r.namespacesCompliance = convergence.NewCompliance("ReadOnlyNamespaces")
+	r.serviceAccountsCompliance = convergence.NewCompliance("ReadOnlyServiceAccounts")
+
+	for _, namespace := range []*corev1.Namespace{missing, drifted, compliant} {
+		if err := r.syncNamespaceAndNotify(namespace); err != nil {
+			t.Errorf("namespace %s sync = %v, want nil", namespace.Name, err)
+		}
+	}
+	for _, serviceAccount := range serviceAccounts {
+		if err := r.syncServiceAccountAndNotify(serviceAccount); err != nil {
+			t.Errorf("service account %s/%s sync = %v, want nil", serviceAccount.Namespace, serviceAccount.Name, err)
+		}
+	}
+
+	if writes := writeActions(kubeClient); len(writes) != 0 {
+		t.Errorf("writes = %v, want none in read-only mode", writes)
+	}
+
+	tests := []struct {
+		controller          string
+		compliant, drifting float64
+	}{
+		{controller: "ReadOnlyNamespaces", compliant: 1, drifting: 2},
+		// The service accounts of the missing and drifted namespaces miss
+		// the reference.
+		{controller: "ReadOnlyServiceAccounts", compliant: 1, drifting: 2},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(metrics.CompliantObjects.WithLabelValues(tt.controller)); got != tt.compliant {
+			t.Errorf("%s compliant objects = %v, want %v", tt.controller, got, tt.compliant)
+		}
+		if got := testutil.ToFloat64(metrics.NoncompliantObjects.WithLabelValues(tt.controller)); got != tt.drifting {
+			t.Errorf("%s noncompliant objects = %v, want %v", tt.controller, got, tt.drifting)
+		}
+	}
+}
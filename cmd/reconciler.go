@@ -0,0 +1,950 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/hooks"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/eventsink"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+const (
+	// managedByLabel marks the secrets created and maintained by the controller.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "aurora-controller"
+
+	// credentialHashAnnotation holds the SHA-256 of the dockerconfigjson of
+	// a managed secret, to detect credential drift without comparing data.
+	credentialHashAnnotation = "aurora.gccloudone/credential-hash"
+
+	// pullSecretNameAnnotation overrides the name of the Aurora secret in a
+	// namespace, with secretNameOverride.
+	pullSecretNameAnnotation = "aurora.gccloudone/pull-secret-name"
+
+	// injectedLabel marks the service accounts the controller injected an
+	// image pull secret into, so that they can be selected for a cleanup.
+	injectedLabel = "aurora.gccloudone/pull-secret-injected"
+	injectedValue = "true"
+
+	// pauseUntilAnnotation pauses the reconciliation of a namespace, and of
+	// its service accounts, until an RFC 3339 timestamp.
+	pauseUntilAnnotation = "aurora.gccloudone/pause-until"
+)
+
+// secretWaitRequeueDelay is how long a service account waits before being
+// synced again when its image pull secrets are not provisioned yet, with
+// waitForSecret.
+const secretWaitRequeueDelay = 5 * time.Second
+
+// imagePullSecretsReconciler holds the clients and listers shared by the
+// namespace and service account sync callbacks.
+type imagePullSecretsReconciler struct {
+	// ctx is cancelled when the controller shuts down.
+	ctx context.Context
+
+	// podNamespace is the namespace the controller runs in, from the
+	// POD_NAMESPACE downward API variable. It is empty when unknown.
+	podNamespace string
+
+	kubeClient      kubernetes.Interface
+	namespaceLister corev1listers.NamespaceLister
+	secretsLister   corev1listers.SecretLister
+	registries      *registryConfig
+	recorder        record.EventRecorder
+	events          *eventsink.Sink
+
+	// providers reconcile the per-namespace resources, in order.
+	providers []namespaceResourceProvider
+
+	// credentials holds the default credential for namespaces that match no
+	// registry mapping.
+	credentials *credentials.Cache
+
+	// apiCallTimeout bounds each individual API call.
+	apiCallTimeout time.Duration
+
+	// writeLimiter throttles every write issued by the controllers.
+	// A nil limiter does not throttle.
+	writeLimiter *rate.Limiter
+
+	// writeGuard caps the number of writes per window. A nil guard does
+	// not cap.
+	writeGuard *massChangeGuard
+
+	// hooks run the side effects of the reconciles, such as metrics and
+	// notifications.
+	hooks hooks.Hooks
+
+	// emergencyStop skips every write while it is engaged. A nil stop never
+	// engages.
+	emergencyStop *emergencyStop
+
+	// leadership turns every write into errNotLeader on a standby replica.
+	// A nil leadership always leads.
+	leadership *leadership
+
+	// adoptExistingSecrets allows the controller to take over secrets that
+	// already exist but do not carry the managed-by label.
+	adoptExistingSecrets bool
+
+	// copyLabels and copyAnnotations are the namespace label and annotation
+	// keys mirrored onto the secrets. They are removed from the secrets when
+	// the namespace no longer has them.
+	copyLabels      []string
+	copyAnnotations []string
+
+	// createOnly creates missing secrets but never updates existing ones.
+	createOnly bool
+
+	// patchSecretData patches the data of secrets whose credential alone
+	// drifted instead of updating the whole object.
+	patchSecretData bool
+
+	// stampCredentialHash annotates the secrets with the hash of their
+	// credential and compares the hashes instead of the data.
+	stampCredentialHash bool
+
+	// updateDebouncer spaces out the updates of each secret.
+	updateDebouncer *updateDebouncer
+
+	// requireNonemptyCredentials requeues instead of provisioning a secret
+	// with an empty dockerconfigjson.
+	requireNonemptyCredentials bool
+
+	// excludedNamespaces are never provisioned. Managed secrets and service
+	// account references already present in them are removed.
+	excludedNamespaces sets.Set[string]
+
+	// forceServiceAccountUpdates patches service accounts without a
+	// resourceVersion precondition instead of updating them.
+	forceServiceAccountUpdates bool
+
+	// applyServiceAccounts sets the image pull secrets of service accounts
+	// with server-side applies instead of updating them, forcing the
+	// ownership of the list when forceApply is set.
+	applyServiceAccounts bool
+	forceApply           bool
+
+	// requiredOwnerKind and requiredOwnerSelector restrict provisioning to
+	// namespaces with an owner reference of the kind or with labels matching
+	// the selector. When both are nil every namespace is governed.
+	requiredOwnerKind     *schema.GroupKind
+	requiredOwnerSelector labels.Selector
+
+	// excludedServiceAccounts are never injected. Entries are either a
+	// namespace/name key or a name matching in every namespace.
+	excludedServiceAccounts sets.Set[string]
+
+	// serviceAccountExcludeSelector matches the service accounts that are
+	// never injected. A nil selector excludes nothing.
+	serviceAccountExcludeSelector labels.Selector
+
+	// namespaceSelector and serviceAccountSelector match the namespaces and
+	// service accounts to reconcile. They are pushed down to the informers,
+	// and checked again here for the objects an informer cannot filter, such
+	// as the service accounts of namespaces outside the namespace selector. A
+	// nil selector matches everything.
+	namespaceSelector      labels.Selector
+	serviceAccountSelector labels.Selector
+
+	// namespaceSelectors further restricts the namespaces, as the service
+	// accounts in them, during reconcile. A nil set matches everything.
+	namespaceSelectors *selectorSet
+
+	// readOnly turns every write into errReadOnly, so that the controllers
+	// only observe drift, recorded by the compliance of each controller.
+	readOnly                  bool
+	namespacesCompliance      *convergence.Compliance
+	serviceAccountsCompliance *convergence.Compliance
+
+	// namespacesStatus and serviceAccountsStatus record the outcome of the
+	// last sync of each object for the status API. They are nil when it is
+	// disabled.
+	namespacesStatus      *convergence.Status
+	serviceAccountsStatus *convergence.Status
+
+	// reference is the service account whose image pull secrets are
+	// mirrored instead of provisioning the Aurora secret. It is nil unless
+	// --reference-sa is set.
+	reference *referenceServiceAccount
+
+	// secretNameOverride honours the pull secret name annotation of the
+	// namespaces.
+	secretNameOverride bool
+
+	// removeInapplicableSecrets deletes the additional secrets that no longer
+	// apply to a namespace, and removes them from its service accounts.
+	removeInapplicableSecrets bool
+
+	// provisionDelay defers the provisioning of namespaces, and the injection
+	// of their service accounts, until they have existed that long, so that
+	// short-lived namespaces are never provisioned.
+	provisionDelay time.Duration
+
+	// settler defers the reconciliation of newly observed namespaces, and of
+	// their service accounts, until they have settled.
+	settler *namespaceSettler
+
+	// pruneOrphans deletes the managed secrets left in namespaces out of
+	// scope instead of only reporting them.
+	pruneOrphans bool
+
+	// fieldManager is the field manager of every service account write, so
+	// that the fields the controller owns can be told apart in
+	// managedFields.
+	fieldManager string
+
+	// deletionSelector matches the namespaces labelled as pending deletion,
+	// which are not reconciled. A nil selector matches none.
+	deletionSelector labels.Selector
+
+	// namespaceList is the ConfigMap listing the namespaces to reconcile.
+	// A nil list reconciles every namespace.
+	namespaceList *namespaceList
+
+	// serviceAccountLister is only set with unified reconciles: each
+	// namespace sync then injects the service accounts of the namespace
+	// right after provisioning its secrets.
+	serviceAccountLister corev1listers.ServiceAccountLister
+
+	// waitForSecret only injects the image pull secrets cached in the
+	// namespace of the service account, and requeues it for the others, so
+	// that no reference ever dangles.
+	waitForSecret bool
+}
+
+// syncServiceAccount adds the Aurora image pull secret to the service account.
+// With unified reconciles, the secrets that do not exist yet are left to the
+// sync of the namespace.
+func (r *imagePullSecretsReconciler) syncServiceAccount(serviceAccount *corev1.ServiceAccount) error {
+	return r.reconcileServiceAccount(serviceAccount, r.serviceAccountLister != nil)
+}
+
+// reconcileServiceAccount adds the image pull secrets of its namespace to the
+// service account. With deferUnprovisioned, the secrets that are not cached
+// yet are not added. With waitForSecret, they are not added either, and the
+// service account is requeued for them.
+func (r *imagePullSecretsReconciler) reconcileServiceAccount(serviceAccount *corev1.ServiceAccount, deferUnprovisioned bool) error {
+	if r.excludedNamespaces.Has(serviceAccount.Namespace) {
+		return r.removeImagePullSecret(serviceAccount)
+	}
+
+	if r.isExcludedServiceAccount(serviceAccount) {
+		klog.V(4).Infof("Skipping excluded service account %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+		return nil
+	}
+
+	if r.serviceAccountSelector != nil && !r.serviceAccountSelector.Matches(labels.Set(serviceAccount.Labels)) {
+		klog.V(4).Infof("Skipping service account %s/%s not matching the selector", serviceAccount.Namespace, serviceAccount.Name)
+		return nil
+	}
+
+	if !r.namespaceList.includes(serviceAccount.Namespace) {
+		klog.V(4).Infof("Skipping service account %s/%s in a namespace not in the namespace list", serviceAccount.Namespace, serviceAccount.Name)
+		return nil
+	}
+
+	// Namespaces outside the namespace selector are not cached. A namespace
+	// not cached yet is only skipped when its labels or age decide whether
+	// it is provisioned, or which secrets apply to it.
+	namespace, err := r.namespaceLister.Get(serviceAccount.Namespace)
+	if errors.IsNotFound(err) {
+		if r.requiredOwnerKind != nil || r.requiredOwnerSelector != nil || r.namespaceSelector != nil || r.provisionDelay > 0 || r.deletionSelector != nil || len(r.registries.secretNames()) > 0 || r.secretNameOverride {
+			return nil
+		}
+	} else if err != nil {
+		return fmt.Errorf("getting namespace %s: %w", serviceAccount.Namespace, err)
+	} else {
+		if r.namespaceSelector != nil && !r.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+			klog.V(4).Infof("Skipping service account %s/%s in a namespace not matching the selector", serviceAccount.Namespace, serviceAccount.Name)
+			return nil
+		}
+
+		if !r.namespaceSelectors.Matches(labels.Set(namespace.Labels)) {
+			klog.V(4).Infof("Skipping service account %s/%s in a namespace not matching the namespace selectors", serviceAccount.Namespace, serviceAccount.Name)
+			return nil
+		}
+
+		if !r.isGoverned(namespace) {
+			klog.V(4).Infof("Skipping service account %s/%s in ungoverned namespace", serviceAccount.Namespace, serviceAccount.Name)
+			return nil
+		}
+
+		if r.isPendingDeletion(namespace) {
+			klog.V(4).Infof("Skipping service account %s/%s in a namespace pending deletion", serviceAccount.Namespace, serviceAccount.Name)
+			return nil
+		}
+
+		if wait := pauseWait(namespace); wait > 0 {
+			return requeue.After(wait, "namespace %s is paused", namespace.Name)
+		}
+
+		if wait := r.provisionWait(namespace); wait > 0 {
+			return requeue.After(wait, "namespace %s is younger than the provision delay", namespace.Name)
+		}
+
+		if wait := r.settler.wait(namespace.Name); wait > 0 {
+			return requeue.After(wait, "namespace %s has not settled yet", namespace.Name)
+		}
+	}
+
+	if r.serviceAccountExcludeSelector != nil && r.serviceAccountExcludeSelector.Matches(labels.Set(serviceAccount.Labels)) {
+		klog.V(4).Infof("Skipping excluded service account %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+		return nil
+	}
+
+	missing, inapplicable := r.imagePullSecretChanges(serviceAccount, namespace)
+	var deferred error
+	if deferUnprovisioned || r.waitForSecret {
+		provisioned := r.provisionedSecrets(serviceAccount.Namespace, missing)
+		if len(provisioned) < len(missing) && !deferUnprovisioned {
+			deferred = requeue.After(secretWaitRequeueDelay, "image pull secrets of %s/%s are not provisioned yet", serviceAccount.Namespace, serviceAccount.Name)
+		}
+		missing = provisioned
+	}
+	if len(missing) == 0 && len(inapplicable) == 0 {
+		return deferred
+	}
+
+	if len(missing) > 0 {
+		klog.Infof("Adding image pull secrets %v to %s/%s", missing, serviceAccount.Namespace, serviceAccount.Name)
+	}
+	if len(inapplicable) > 0 {
+		klog.Infof("Removing image pull secrets %v that no longer apply from %s/%s", inapplicable, serviceAccount.Namespace, serviceAccount.Name)
+	}
+
+	if r.forceServiceAccountUpdates {
+		if err := r.patchImagePullSecrets(serviceAccount, missing, inapplicable, true); err != nil {
+			return err
+		}
+		r.injected(serviceAccount, missing)
+		return deferred
+	}
+
+	updated := serviceAccount.DeepCopy()
+	// Rebuild the copy's list so that the cached object is never modified,
+	// and leave every other field, such as automountServiceAccountToken and
+	// secrets, as it is.
+	updated.ImagePullSecrets = withoutLocalObjectReferences(serviceAccount.ImagePullSecrets, sets.New(inapplicable...))
+	for _, name := range missing {
+		updated.ImagePullSecrets = append(updated.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	updated.Labels[injectedLabel] = injectedValue
+
+	if r.applyServiceAccounts {
+		err = r.applyImagePullSecrets(serviceAccount, updated.ImagePullSecrets, true)
+	} else {
+		err = r.updateServiceAccount(updated)
+	}
+	if err != nil {
+		return err
+	}
+	r.injected(serviceAccount, missing)
+
+	return deferred
+}
+
+// imagePullSecretNames returns the names of the image pull secrets injected
+// into the service accounts of the namespace: the Aurora secret and the
+// additional secrets that apply to the namespace, or the secrets mirrored
+// from the reference service account. A nil namespace, not cached yet, gets
+// the Aurora secret alone.
+func (r *imagePullSecretsReconciler) imagePullSecretNames(namespace *corev1.Namespace) []string {
+	if r.reference != nil {
+		return r.reference.secretNames()
+	}
+
+	names := []string{r.auroraSecretName(namespace)}
+	if namespace != nil {
+		for _, secret := range r.registries.secretsFor(namespace) {
+			names = append(names, secret.Name)
+		}
+	}
+
+	return names
+}
+
+// managedImagePullSecretNames returns the names of every image pull secret
+// the controller manages in the namespace, whether or not it applies to it.
+// A nil namespace gets the names managed in namespaces without a pull secret
+// name override.
+func (r *imagePullSecretsReconciler) managedImagePullSecretNames(namespace *corev1.Namespace) []string {
+	if r.reference != nil {
+		return r.reference.secretNames()
+	}
+
+	names := append([]string{os.Getenv("AURORA_SECRET_NAME")}, r.registries.secretNames()...)
+	if name := r.auroraSecretName(namespace); name != names[0] {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// auroraSecretNameIn returns the name of the Aurora secret in the named
+// namespace, as auroraSecretName does for a cached namespace.
+func (r *imagePullSecretsReconciler) auroraSecretNameIn(name string) string {
+	namespace, _ := r.namespaceLister.Get(name)
+	return r.auroraSecretName(namespace)
+}
+
+// auroraSecretName returns the name of the Aurora secret in the namespace:
+// the name of its pull secret name annotation with secretNameOverride, or else
+// AURORA_SECRET_NAME. Names that are invalid, or taken by an additional
+// secret, are ignored.
+func (r *imagePullSecretsReconciler) auroraSecretName(namespace *corev1.Namespace) string {
+	name := os.Getenv("AURORA_SECRET_NAME")
+	if !r.secretNameOverride || namespace == nil {
+		return name
+	}
+
+	override, ok := namespace.Annotations[pullSecretNameAnnotation]
+	if !ok || override == name {
+		return name
+	}
+
+	if errs := validation.IsDNS1123Subdomain(override); len(errs) > 0 {
+		klog.Warningf("ignoring the %s annotation of namespace %s: %s", pullSecretNameAnnotation, namespace.Name, strings.Join(errs, ", "))
+		return name
+	}
+	if sets.New(r.registries.secretNames()...).Has(override) {
+		klog.Warningf("ignoring the %s annotation of namespace %s: %s is an additional secret", pullSecretNameAnnotation, namespace.Name, override)
+		return name
+	}
+
+	return override
+}
+
+// imagePullSecretChanges returns the image pull secrets of the namespace the
+// service account does not reference yet and, with removeInapplicableSecrets,
+// the managed ones it references that no longer apply to the namespace.
+func (r *imagePullSecretsReconciler) imagePullSecretChanges(serviceAccount *corev1.ServiceAccount, namespace *corev1.Namespace) ([]string, []string) {
+	names := r.imagePullSecretNames(namespace)
+	missing := missingImagePullSecrets(serviceAccount, names)
+
+	// The applicable secrets of a namespace that is not cached are unknown.
+	if !r.removeInapplicableSecrets || namespace == nil {
+		return missing, nil
+	}
+
+	var inapplicable []string
+	for _, name := range sets.List(sets.New(r.managedImagePullSecretNames(namespace)...).Difference(sets.New(names...))) {
+		if hasLocalObjectReference(serviceAccount.ImagePullSecrets, name) {
+			inapplicable = append(inapplicable, name)
+		}
+	}
+
+	return missing, inapplicable
+}
+
+// missingImagePullSecrets returns the names the service account does not
+// reference yet, in order.
+func missingImagePullSecrets(serviceAccount *corev1.ServiceAccount, names []string) []string {
+	var missing []string
+	for _, name := range names {
+		if !hasLocalObjectReference(serviceAccount.ImagePullSecrets, name) {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
+
+// withoutLocalObjectReferences returns the references whose name is not one
+// of the names, in order.
+func withoutLocalObjectReferences(references []corev1.LocalObjectReference, names sets.Set[string]) []corev1.LocalObjectReference {
+	var kept []corev1.LocalObjectReference
+	for _, reference := range references {
+		if !names.Has(reference.Name) {
+			kept = append(kept, reference)
+		}
+	}
+
+	return kept
+}
+
+// serviceAccountInSync reports whether syncServiceAccount would leave the
+// service account unchanged because it already references the Aurora image
+// pull secrets in a provisioned namespace.
+func (r *imagePullSecretsReconciler) serviceAccountInSync(serviceAccount *corev1.ServiceAccount) bool {
+	if r.excludedNamespaces.Has(serviceAccount.Namespace) {
+		return false
+	}
+
+	if r.isExcludedServiceAccount(serviceAccount) {
+		return true
+	}
+
+	namespace, err := r.namespaceLister.Get(serviceAccount.Namespace)
+	if err != nil {
+		return false
+	}
+
+	missing, inapplicable := r.imagePullSecretChanges(serviceAccount, namespace)
+	return len(missing) == 0 && len(inapplicable) == 0
+}
+
+// isExcludedServiceAccount reports whether the service account is excluded by
+// name or namespace/name.
+func (r *imagePullSecretsReconciler) isExcludedServiceAccount(serviceAccount *corev1.ServiceAccount) bool {
+	return r.excludedServiceAccounts.Has(serviceAccount.Name) ||
+		r.excludedServiceAccounts.Has(serviceAccount.Namespace+"/"+serviceAccount.Name)
+}
+
+// removeImagePullSecret removes every managed image pull secret from the
+// service account, leaving every other reference in place.
+func (r *imagePullSecretsReconciler) removeImagePullSecret(serviceAccount *corev1.ServiceAccount) error {
+	// An uncached namespace only leaves its override in place.
+	namespace, _ := r.namespaceLister.Get(serviceAccount.Namespace)
+	names := sets.New(r.managedImagePullSecretNames(namespace)...)
+
+	imagePullSecrets := withoutLocalObjectReferences(serviceAccount.ImagePullSecrets, names)
+	if len(imagePullSecrets) == len(serviceAccount.ImagePullSecrets) {
+		return nil
+	}
+
+	klog.Infof("Removing image pull secrets from %s/%s", serviceAccount.Namespace, serviceAccount.Name)
+
+	if r.forceServiceAccountUpdates {
+		return r.patchImagePullSecrets(serviceAccount, nil, sets.List(names), false)
+	}
+
+	if r.applyServiceAccounts {
+		return r.applyImagePullSecrets(serviceAccount, imagePullSecrets, false)
+	}
+
+	updated := serviceAccount.DeepCopy()
+	updated.ImagePullSecrets = imagePullSecrets
+	delete(updated.Labels, injectedLabel)
+
+	return r.updateServiceAccount(updated)
+}
+
+// updateServiceAccount updates the service account with its resourceVersion,
+// so that the update conflicts if it changed since it was cached.
+func (r *imagePullSecretsReconciler) updateServiceAccount(serviceAccount *corev1.ServiceAccount) error {
+	err := r.write(func(ctx context.Context) error {
+		_, err := r.kubeClient.CoreV1().ServiceAccounts(serviceAccount.Namespace).Update(ctx, serviceAccount, metav1.UpdateOptions{FieldManager: r.fieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err)
+	}
+
+	return nil
+}
+
+// patchImagePullSecrets adds and removes the named image pull secrets of the
+// service account with a JSON patch. The patch has no resourceVersion
+// precondition, so it does not conflict with unrelated changes, and it only
+// touches the managed entries of imagePullSecrets. A strategic merge patch
+// would not do: imagePullSecrets has no merge key on service accounts, so it
+// would replace the whole list. The injected label is set or removed in the
+// same patch.
+func (r *imagePullSecretsReconciler) patchImagePullSecrets(serviceAccount *corev1.ServiceAccount, add, remove []string, injected bool) error {
+	patch, err := imagePullSecretsPatch(serviceAccount, add, remove, injected)
+	if err != nil {
+		return fmt.Errorf("building the image pull secrets patch of service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err)
+	} else if patch == nil {
+		return nil
+	}
+
+	err = r.write(func(ctx context.Context) error {
+		_, err := r.kubeClient.CoreV1().ServiceAccounts(serviceAccount.Namespace).Patch(ctx, serviceAccount.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: r.fieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("patching service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err)
+	}
+
+	return nil
+}
+
+// imagePullSecretsPatch returns the JSON patch removing the image pull secret
+// references of the service account named in remove and then adding those
+// named in add, or nil if there is nothing to change. Each removal is guarded
+// by a test of the entry's name, so that the patch fails rather than removing
+// another reference if the list changed since the service account was cached.
+// The injected label is added when injected is set and removed otherwise.
+func imagePullSecretsPatch(serviceAccount *corev1.ServiceAccount, add, remove []string, injected bool) ([]byte, error) {
+	var operations []map[string]interface{}
+
+	// Remove from the end so that the indices of the remaining entries do
+	// not shift.
+	targets := sets.New(remove...)
+	for i := len(serviceAccount.ImagePullSecrets) - 1; i >= 0; i-- {
+		name := serviceAccount.ImagePullSecrets[i].Name
+		if targets.Has(name) {
+			path := fmt.Sprintf("/imagePullSecrets/%d", i)
+			operations = append(operations,
+				map[string]interface{}{"op": "test", "path": path + "/name", "value": name},
+				map[string]interface{}{"op": "remove", "path": path},
+			)
+		}
+	}
+
+	switch {
+	case len(add) == 0:
+	case len(serviceAccount.ImagePullSecrets) == 0:
+		// The list is omitted when empty, so it cannot be appended to.
+		references := []corev1.LocalObjectReference{}
+		for _, name := range add {
+			references = append(references, corev1.LocalObjectReference{Name: name})
+		}
+		operations = append(operations, map[string]interface{}{
+			"op": "add", "path": "/imagePullSecrets", "value": references,
+		})
+	default:
+		for _, name := range add {
+			operations = append(operations, map[string]interface{}{
+				"op": "add", "path": "/imagePullSecrets/-", "value": corev1.LocalObjectReference{Name: name},
+			})
+		}
+	}
+
+	if operations == nil {
+		return nil, nil
+	}
+
+	// "/" is escaped as "~1" in JSON pointers.
+	labelPath := "/metadata/labels/" + strings.ReplaceAll(injectedLabel, "/", "~1")
+	_, labelled := serviceAccount.Labels[injectedLabel]
+	switch {
+	case injected && serviceAccount.Labels == nil:
+		operations = append(operations, map[string]interface{}{
+			"op": "add", "path": "/metadata/labels", "value": map[string]string{injectedLabel: injectedValue},
+		})
+	case injected:
+		operations = append(operations, map[string]interface{}{"op": "add", "path": labelPath, "value": injectedValue})
+	case labelled:
+		operations = append(operations, map[string]interface{}{"op": "remove", "path": labelPath})
+	}
+
+	return json.Marshal(operations)
+}
+
+// syncNamespace reconciles every enabled resource provider in the namespace.
+func (r *imagePullSecretsReconciler) syncNamespace(namespace *corev1.Namespace) error {
+	if r.excludedNamespaces.Has(namespace.Name) {
+		var errs []error
+		for _, provider := range r.providers {
+			if err := provider.Cleanup(namespace); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			}
+		}
+
+		return aggregate(errs)
+	}
+
+	// Nothing can be created in a namespace that is being deleted, and the
+	// resulting Forbidden errors would requeue until it is gone.
+	if namespace.DeletionTimestamp != nil || namespace.Status.Phase == corev1.NamespaceTerminating {
+		if namespace.Name == r.podNamespace {
+			klog.Warningf("the controller's own namespace %s is being deleted, skipping provisioning", namespace.Name)
+		} else {
+			klog.V(4).Infof("Skipping terminating namespace %s", namespace.Name)
+		}
+
+		return nil
+	}
+
+	// Some tooling labels namespaces some time before deleting them.
+	if r.isPendingDeletion(namespace) {
+		klog.V(4).Infof("Skipping namespace %s labelled as pending deletion", namespace.Name)
+		return nil
+	}
+
+	if r.namespaceSelector != nil && !r.namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+		klog.V(4).Infof("Skipping namespace %s not matching the selector", namespace.Name)
+		return nil
+	}
+
+	if !r.namespaceSelectors.Matches(labels.Set(namespace.Labels)) {
+		klog.V(4).Infof("Skipping namespace %s not matching the namespace selectors", namespace.Name)
+		return nil
+	}
+
+	if !r.namespaceList.includes(namespace.Name) {
+		klog.V(4).Infof("Skipping namespace %s not in the namespace list", namespace.Name)
+		return nil
+	}
+
+	if !r.isGoverned(namespace) {
+		klog.V(4).Infof("Skipping ungoverned namespace %s", namespace.Name)
+		return nil
+	}
+
+	if wait := pauseWait(namespace); wait > 0 {
+		klog.V(4).Infof("Skipping namespace %s paused for %s", namespace.Name, wait.Round(time.Second))
+		return requeue.After(wait, "namespace %s is paused", namespace.Name)
+	}
+
+	if wait := r.provisionWait(namespace); wait > 0 {
+		return requeue.After(wait, "namespace %s is younger than the provision delay", namespace.Name)
+	}
+
+	if wait := r.settler.wait(namespace.Name); wait > 0 {
+		return requeue.After(wait, "namespace %s has not settled yet", namespace.Name)
+	}
+
+	var errs []error
+	for _, provider := range r.providers {
+		if err := provider.Reconcile(namespace); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		}
+	}
+
+	// The secrets exist now, even if they are not cached yet, so the
+	// service accounts can be injected in the same pass.
+	if len(errs) == 0 && r.serviceAccountLister != nil {
+		if err := r.injectServiceAccounts(namespace); err != nil {
+			errs = append(errs, fmt.Errorf("service accounts: %w", err))
+		}
+	}
+
+	return aggregate(errs)
+}
+
+// injectServiceAccounts reconciles every cached service account of the
+// namespace, once its secrets have been provisioned.
+func (r *imagePullSecretsReconciler) injectServiceAccounts(namespace *corev1.Namespace) error {
+	serviceAccounts, err := r.serviceAccountLister.ServiceAccounts(namespace.Name).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("listing service accounts of namespace %s: %w", namespace.Name, err)
+	}
+
+	var errs []error
+	for _, serviceAccount := range serviceAccounts {
+		if err := r.reconcileServiceAccount(serviceAccount, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return aggregate(errs)
+}
+
+// aggregate returns the errors as one error, or nil if there are none. A
+// single error is returned as is, so that the API errors helpers, which do
+// not look into aggregates, still tell its kind.
+func aggregate(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// provisionedSecrets returns the names of the secrets that exist in the
+// namespace, according to the secrets cache.
+func (r *imagePullSecretsReconciler) provisionedSecrets(namespace string, names []string) []string {
+	var provisioned []string
+	for _, name := range names {
+		if _, err := r.secretsLister.Secrets(namespace).Get(name); err == nil {
+			provisioned = append(provisioned, name)
+		} else {
+			klog.V(4).Infof("Leaving secret %s to the sync of namespace %s, it is not provisioned yet", name, namespace)
+		}
+	}
+
+	return provisioned
+}
+
+// isPendingDeletion reports whether the namespace is labelled as pending
+// deletion.
+func (r *imagePullSecretsReconciler) isPendingDeletion(namespace *corev1.Namespace) bool {
+	return r.deletionSelector != nil && r.deletionSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// isGoverned reports whether the namespace has the required owner reference
+// kind or matches the required owner selector. Either is sufficient.
+func (r *imagePullSecretsReconciler) isGoverned(namespace *corev1.Namespace) bool {
+	if r.requiredOwnerKind == nil && r.requiredOwnerSelector == nil {
+		return true
+	}
+
+	if r.requiredOwnerSelector != nil && r.requiredOwnerSelector.Matches(labels.Set(namespace.Labels)) {
+		return true
+	}
+
+	if r.requiredOwnerKind != nil {
+		for _, owner := range namespace.OwnerReferences {
+			gv, err := schema.ParseGroupVersion(owner.APIVersion)
+			if err != nil {
+				continue
+			}
+
+			if owner.Kind == r.requiredOwnerKind.Kind && gv.Group == r.requiredOwnerKind.Group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// pauseWait returns how long the reconciliation of the namespace is still
+// paused by its pause-until annotation. An invalid timestamp is ignored.
+func pauseWait(namespace *corev1.Namespace) time.Duration {
+	value, ok := namespace.Annotations[pauseUntilAnnotation]
+	if !ok {
+		return 0
+	}
+
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Warningf("ignoring invalid %s annotation %q on namespace %s: %v", pauseUntilAnnotation, value, namespace.Name, err)
+		return 0
+	}
+
+	return time.Until(until)
+}
+
+// provisionWait returns how long the namespace must still exist before it is
+// provisioned.
+func (r *imagePullSecretsReconciler) provisionWait(namespace *corev1.Namespace) time.Duration {
+	if r.provisionDelay <= 0 {
+		return 0
+	}
+
+	return r.provisionDelay - time.Since(namespace.CreationTimestamp.Time)
+}
+
+// notify sends an event to the event sink, if one is configured.
+func (r *imagePullSecretsReconciler) notify(eventType, reason, namespace, name, message string) {
+	r.events.Send(eventsink.Event{
+		Type:      eventType,
+		Reason:    reason,
+		Namespace: namespace,
+		Name:      name,
+		Message:   message,
+	})
+}
+
+// injected runs the hooks of a service account the image pull secrets were
+// added to. Service accounts only cleaned of inapplicable secrets have none.
+func (r *imagePullSecretsReconciler) injected(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+	if len(imagePullSecrets) > 0 {
+		r.hooks.OnSAInjected(serviceAccount, imagePullSecrets)
+	}
+}
+
+// syncServiceAccountAndNotify runs syncServiceAccount and reports its
+// failures to the hooks.
+func (r *imagePullSecretsReconciler) syncServiceAccountAndNotify(serviceAccount *corev1.ServiceAccount) error {
+	key := serviceAccount.Namespace + "/" + serviceAccount.Name
+	err := r.syncServiceAccount(serviceAccount)
+	recordStatus(r.serviceAccountsStatus, key, err)
+	err = r.observeDrift(r.serviceAccountsCompliance, key, err)
+	if err != nil && !requeue.IsRequested(err) {
+		r.hooks.OnError("ServiceAccount", serviceAccount.Namespace, serviceAccount.Name, err)
+	}
+
+	return err
+}
+
+// syncNamespaceAndNotify runs syncNamespace and reports its failures to the
+// hooks.
+func (r *imagePullSecretsReconciler) syncNamespaceAndNotify(namespace *corev1.Namespace) error {
+	err := r.syncNamespace(namespace)
+	recordStatus(r.namespacesStatus, namespace.Name, err)
+	err = r.observeDrift(r.namespacesCompliance, namespace.Name, err)
+	if err != nil && !requeue.IsRequested(err) {
+		r.hooks.OnError("Namespace", namespace.Name, "", err)
+	}
+
+	return err
+}
+
+// namespaceDeleted releases the state kept for a deleted namespace.
+func (r *imagePullSecretsReconciler) namespaceDeleted(name string) {
+	klog.V(4).Infof("Releasing the state of deleted namespace %s", name)
+	metrics.DeleteNamespace(name)
+	r.updateDebouncer.forget(name)
+	r.settler.forget(name)
+	r.namespacesCompliance.ForgetNamespace(name)
+	r.serviceAccountsCompliance.ForgetNamespace(name)
+	r.namespacesStatus.ForgetNamespace(name)
+	r.serviceAccountsStatus.ForgetNamespace(name)
+}
+
+// write waits for the write rate limit to allow another mutation and then
+// runs fn with a context bounded by the API call timeout, so that a hung call
+// fails and requeues instead of pinning a worker. In read-only mode it returns
+// errReadOnly without running fn, on a standby replica errNotLeader, and
+// while the emergency stop is engaged a requeue error: every write of the
+// controllers goes through it.
+func (r *imagePullSecretsReconciler) write(fn func(ctx context.Context) error) error {
+	return r.writeFrom(r.ctx, fn)
+}
+
+// writeFrom is write bounded by parent rather than by the context of the
+// reconciler, for the writes made once it is cancelled, such as those of the
+// cleanup on shutdown.
+func (r *imagePullSecretsReconciler) writeFrom(parent context.Context, fn func(ctx context.Context) error) error {
+	if r.readOnly {
+		return errReadOnly
+	}
+
+	if !r.leadership.isLeading() {
+		return errNotLeader
+	}
+
+	if err := r.emergencyStop.check(); err != nil {
+		return err
+	}
+
+	if err := r.writeGuard.allow(); err != nil {
+		return err
+	}
+
+	if r.writeLimiter != nil {
+		if err := r.writeLimiter.Wait(parent); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := r.callContextFrom(parent)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// callContext returns a context for a single API call, bounded by the API
+// call timeout when one is configured.
+func (r *imagePullSecretsReconciler) callContext() (context.Context, context.CancelFunc) {
+	return r.callContextFrom(r.ctx)
+}
+
+// callContextFrom is callContext derived from parent.
+func (r *imagePullSecretsReconciler) callContextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	if r.apiCallTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithTimeout(parent, r.apiCallTimeout)
+}
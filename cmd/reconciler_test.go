@@ -0,0 +1,1157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/namespaces"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/serviceaccounts"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// testSecretName is the AURORA_SECRET_NAME of the test reconcilers.
+	testSecretName = "aurora-pull"
+
+	// testDockerConfigJSON is the default credential of the test
+	// reconcilers.
+	testDockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+)
+
+// newTestReconciler returns a reconciler provisioning the Aurora secret with
+// testDockerConfigJSON, over a fake clientset holding the objects. Its caches
+// are synced, and stopped when the test ends.
+func newTestReconciler(t *testing.T, objects ...runtime.Object) (*imagePullSecretsReconciler, *fake.Clientset) {
+	t.Helper()
+	t.Setenv("AURORA_SECRET_NAME", testSecretName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	kubeClient := fake.NewSimpleClientset(objects...)
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	namespaceInformer := factory.Core().V1().Namespaces()
+	secretInformer := factory.Core().V1().Secrets()
+	serviceAccountInformer := factory.Core().V1().ServiceAccounts()
+	namespaceInformer.Informer()
+	secretInformer.Informer()
+	serviceAccountInformer.Informer()
+	factory.Start(ctx.Done())
+	for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			t.Fatalf("cache of %v not synced", informer)
+		}
+	}
+
+	credentialsCache := credentials.NewCache(credentials.Static(testDockerConfigJSON), 0)
+	if _, err := credentialsCache.Refresh(ctx); err != nil {
+		t.Fatalf("refreshing credentials: %v", err)
+	}
+
+	r := &imagePullSecretsReconciler{
+		ctx:                  ctx,
+		kubeClient:           kubeClient,
+		namespaceLister:      namespaceInformer.Lister(),
+		secretsLister:        secretInformer.Lister(),
+		recorder:             record.NewFakeRecorder(100),
+		credentials:          credentialsCache,
+		adoptExistingSecrets: true,
+	}
+	r.providers = []namespaceResourceProvider{secretsProvider{r}}
+
+	return r, kubeClient
+}
+
+// runNamespacesController runs a namespaces controller syncing with the
+// reconciler, as runControllers does, over its own informer of the clientset.
+// configure, if set, is called before the controller is run. It returns once
+// the informer is synced and watching, so that the changes the test makes
+// next are observed. The controller is stopped when the test ends.
+func runNamespacesController(t *testing.T, r *imagePullSecretsReconciler, kubeClient *fake.Clientset, configure func(*namespaces.Controller)) *namespaces.Controller {
+	t.Helper()
+
+	// The fake clientset does not replay the changes made between the list
+	// and the watch of an informer.
+	watching := make(chan struct{})
+	var once sync.Once
+	kubeClient.PrependWatchReactor("namespaces", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := kubeClient.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() { close(watching) })
+		return true, w, err
+	})
+
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	controller := namespaces.NewController(factory.Core().V1().Namespaces(), r.syncNamespaceAndNotify)
+	if configure != nil {
+		configure(controller)
+	}
+	factory.Start(r.ctx.Done())
+	go func() {
+		if err := controller.Run(1, r.ctx.Done()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	factory.WaitForCacheSync(r.ctx.Done())
+	select {
+	case <-watching:
+	case <-r.ctx.Done():
+	}
+
+	return controller
+}
+
+// testNamespace returns a namespace with a UID derived from its name.
+func testNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name + "-uid"), Labels: labels},
+	}
+}
+
+// testSecret returns a managed image pull secret owned by the namespace.
+func testSecret(namespace *corev1.Namespace, name, dockerConfigJSON string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace.Name,
+			Labels:    map[string]string{managedByLabel: managedByValue},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfigJSON)},
+	}
+	setNamespaceOwner(secret, namespace)
+
+	return secret
+}
+
+// testServiceAccount returns a service account referencing the image pull
+// secrets.
+func testServiceAccount(namespace, name string, imagePullSecrets ...string) *corev1.ServiceAccount {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	for _, imagePullSecret := range imagePullSecrets {
+		serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: imagePullSecret})
+	}
+
+	return serviceAccount
+}
+
+// writeActions returns the verbs and resources of the writes the clientset
+// received, such as "create secrets".
+func writeActions(kubeClient *fake.Clientset) []string {
+	var writes []string
+	for _, action := range kubeClient.Actions() {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+			continue
+		}
+		writes = append(writes, action.GetVerb()+" "+action.GetResource().Resource)
+	}
+
+	return writes
+}
+
+func TestSyncNamespacePauseUntil(t *testing.T) {
+	tests := []struct {
+		name       string
+		pauseUntil string
+		paused     bool
+	}{
+		{name: "not paused"},
+		{name: "pause in the past", pauseUntil: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		{name: "pause in the future", pauseUntil: time.Now().Add(time.Hour).Format(time.RFC3339), paused: true},
+		{name: "invalid timestamp", pauseUntil: "tomorrow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			if tt.pauseUntil != "" {
+				team.Annotations = map[string]string{pauseUntilAnnotation: tt.pauseUntil}
+			}
+			r, kubeClient := newTestReconciler(t, team, testServiceAccount("team", "default"))
+
+			err := r.syncNamespace(team)
+			saErr := r.syncServiceAccount(testServiceAccount("team", "default"))
+
+			var wantWrites []string
+			if !tt.paused {
+				wantWrites = []string{"create secrets", "update serviceaccounts"}
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, wantWrites)
+			}
+
+			for kind, err := range map[string]error{"namespace": err, "service account": saErr} {
+				if !tt.paused {
+					if err != nil {
+						t.Errorf("%s sync = %v, want nil", kind, err)
+					}
+					continue
+				}
+
+				after, ok := requeue.Delay(err)
+				if !requeue.IsRequested(err) || !ok || after < 59*time.Minute || after > time.Hour {
+					t.Errorf("%s sync = %v, want a requeue after the pause", kind, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   rate.Limit
+		writes  int
+		minimum time.Duration
+	}{
+		{name: "unlimited", writes: 10},
+		{name: "20 writes per second", limit: 20, writes: 6, minimum: 250 * time.Millisecond},
+		{name: "5 writes per second", limit: 5, writes: 3, minimum: 400 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for i := 0; i < tt.writes; i++ {
+				objects = append(objects, testNamespace(fmt.Sprintf("team-%d", i), nil))
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			if tt.limit > 0 {
+				r.writeLimiter = rate.NewLimiter(tt.limit, 1)
+			}
+
+			start := time.Now()
+			for _, object := range objects {
+				if err := r.reconcileSecrets(object.(*corev1.Namespace)); err != nil {
+					t.Fatalf("reconcileSecrets() = %v", err)
+				}
+			}
+			elapsed := time.Since(start)
+
+			if writes := len(writeActions(kubeClient)); writes != tt.writes {
+				t.Errorf("writes = %d, want %d", writes, tt.writes)
+			}
+			// The first write spends the burst, and every later one waits
+			// for a token.
+			if elapsed < tt.minimum || elapsed > tt.minimum+time.Second {
+				t.Errorf("%d writes took %s, want %s", tt.writes, elapsed, tt.minimum)
+			}
+		})
+	}
+}
+
+func TestWriteRateLimitCancelled(t *testing.T) {
+	r, kubeClient := newTestReconciler(t, testNamespace("team", nil))
+	r.writeLimiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	r.writeLimiter.Allow()
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.ctx = ctx
+	cancel()
+
+	if err := r.reconcileSecrets(testNamespace("team", nil)); err == nil {
+		t.Error("reconcileSecrets() = nil, want the limiter to fail on the cancelled context")
+	}
+	if writes := writeActions(kubeClient); len(writes) != 0 {
+		t.Errorf("writes = %v, want none", writes)
+	}
+}
+
+func TestAPICallTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		timeout time.Duration
+		sync    func(r *imagePullSecretsReconciler) error
+		// want is the hanging call.
+		want string
+	}{
+		{
+			name:    "secret create",
+			objects: []runtime.Object{testNamespace("team", nil)},
+			timeout: 50 * time.Millisecond,
+			want:    "POST /api/v1/namespaces/team/secrets",
+			sync: func(r *imagePullSecretsReconciler) error {
+				return r.reconcileSecrets(testNamespace("team", nil))
+			},
+		},
+		{
+			name: "service account update",
+			objects: []runtime.Object{
+				testNamespace("team", nil),
+				testSecret(testNamespace("team", nil), testSecretName, testDockerConfigJSON),
+				testServiceAccount("team", "default"),
+			},
+			timeout: 50 * time.Millisecond,
+			want:    "PUT /api/v1/namespaces/team/serviceaccounts/default",
+			sync: func(r *imagePullSecretsReconciler) error {
+				return r.syncServiceAccount(testServiceAccount("team", "default"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t, tt.objects...)
+
+			// The API server answers no request until the test ends, or
+			// the client gives up.
+			var mu sync.Mutex
+			var calls []string
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mu.Lock()
+				calls = append(calls, req.Method+" "+req.URL.Path)
+				mu.Unlock()
+				select {
+				case <-req.Context().Done():
+				case <-release:
+				}
+			}))
+			t.Cleanup(server.Close)
+			t.Cleanup(func() { close(release) })
+			r.kubeClient = kubernetes.NewForConfigOrDie(&rest.Config{Host: server.URL})
+			r.apiCallTimeout = tt.timeout
+
+			start := time.Now()
+			err := tt.sync(r)
+			if elapsed := time.Since(start); elapsed > 10*tt.timeout {
+				t.Errorf("sync took %s with a %s call timeout", elapsed, tt.timeout)
+			}
+			if !requeue.IsTransient(err) {
+				t.Errorf("sync = %v, want a transient timeout", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if want := []string{tt.want}; !reflect.DeepEqual(calls, want) {
+				t.Errorf("calls = %v, want %v", calls, want)
+			}
+		})
+	}
+}
+
+func TestSyncServiceAccountUpdateStrategy(t *testing.T) {
+	tests := []struct {
+		name  string
+		force bool
+		// concurrentEdit adds a reference to the live service account after
+		// it was cached.
+		concurrentEdit bool
+		wantConflict   bool
+		wantWrites     []string
+		want           []string
+	}{
+		{name: "optimistic", wantWrites: []string{"update serviceaccounts"}, want: []string{"keep", testSecretName}},
+		{name: "optimistic after a concurrent edit", concurrentEdit: true, wantConflict: true, wantWrites: []string{"update serviceaccounts"}, want: []string{"keep", "concurrent"}},
+		{name: "force", force: true, wantWrites: []string{"patch serviceaccounts"}, want: []string{"keep", testSecretName}},
+		{name: "force after a concurrent edit", force: true, concurrentEdit: true, wantWrites: []string{"patch serviceaccounts"}, want: []string{"keep", "concurrent", testSecretName}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			cached := testServiceAccount("team", "default", "keep")
+			cached.ResourceVersion = "1"
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), cached)
+			r.forceServiceAccountUpdates = tt.force
+
+			if tt.concurrentEdit {
+				live := testServiceAccount("team", "default", "keep", "concurrent")
+				live.ResourceVersion = "2"
+				if err := kubeClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("serviceaccounts"), live, "team"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Like the API server, reject updates of a stale resourceVersion.
+			kubeClient.PrependReactor("update", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				updated := action.(k8stesting.UpdateAction).GetObject().(*corev1.ServiceAccount)
+				live, err := kubeClient.Tracker().Get(corev1.SchemeGroupVersion.WithResource("serviceaccounts"), updated.Namespace, updated.Name)
+				if err != nil {
+					return true, nil, err
+				}
+				if live.(*corev1.ServiceAccount).ResourceVersion != updated.ResourceVersion {
+					return true, nil, errors.NewConflict(corev1.Resource("serviceaccounts"), updated.Name, fmt.Errorf("the object has been modified"))
+				}
+				return false, nil, nil
+			})
+
+			err := r.syncServiceAccount(cached)
+			if conflict := errors.IsConflict(err); conflict != tt.wantConflict {
+				t.Errorf("syncServiceAccount() = %v, want a conflict: %v", err, tt.wantConflict)
+			} else if !tt.wantConflict && err != nil {
+				t.Errorf("syncServiceAccount() = %v, want nil", err)
+			}
+
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(context.Background(), "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
+				got = append(got, imagePullSecret.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("image pull secrets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipCompliantResyncs(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t,
+		team,
+		testSecret(team, testSecretName, testDockerConfigJSON),
+		testServiceAccount("team", "compliant", testSecretName),
+		testServiceAccount("team", "missing"),
+	)
+
+	// The informer resyncs every second, its minimum, and the sync leaves
+	// the service accounts unchanged.
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second)
+	var mu sync.Mutex
+	syncs := map[string]int{}
+	controller := serviceaccounts.NewController(factory.Core().V1().ServiceAccounts(), func(serviceAccount *corev1.ServiceAccount) error {
+		mu.Lock()
+		defer mu.Unlock()
+		syncs[serviceAccount.Name]++
+		return nil
+	})
+	controller.SetInSyncFunc(r.serviceAccountInSync)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	go controller.Run(1, stopCh)
+
+	// The service account missing the secret is synced when it is added and
+	// on each of the two resyncs.
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return syncs["missing"] >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("service account missing the secret not synced on resync: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if syncs["compliant"] != 1 {
+		t.Errorf("compliant service account synced %d times, want once when it was added", syncs["compliant"])
+	}
+}
+
+func TestSyncErrorsWrapped(t *testing.T) {
+	tests := []struct {
+		name     string
+		verb     string
+		resource string
+		err      error
+		is       func(error) bool
+		// sync runs the sync reaching the failing call.
+		sync        func(r *imagePullSecretsReconciler) error
+		wantMessage string
+	}{
+		{
+			name: "secret create forbidden", verb: "create", resource: "secrets",
+			err:         errors.NewForbidden(corev1.Resource("secrets"), testSecretName, fmt.Errorf("denied")),
+			is:          errors.IsForbidden,
+			sync:        func(r *imagePullSecretsReconciler) error { return r.syncNamespace(testNamespace("team", nil)) },
+			wantMessage: "secrets: creating secret team/" + testSecretName + ": ",
+		},
+		{
+			name: "service account update conflict", verb: "update", resource: "serviceaccounts",
+			err: errors.NewConflict(corev1.Resource("serviceaccounts"), "default", fmt.Errorf("modified")),
+			is:  errors.IsConflict,
+			sync: func(r *imagePullSecretsReconciler) error {
+				return r.syncServiceAccount(testServiceAccount("team", "default"))
+			},
+			wantMessage: "updating service account team/default: ",
+		},
+		{
+			name: "service account update not found", verb: "update", resource: "serviceaccounts",
+			err: errors.NewNotFound(corev1.Resource("serviceaccounts"), "default"),
+			is:  errors.IsNotFound,
+			sync: func(r *imagePullSecretsReconciler) error {
+				return r.syncServiceAccount(testServiceAccount("team", "default"))
+			},
+			wantMessage: "updating service account team/default: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			objects := []runtime.Object{team, testServiceAccount("team", "default")}
+			if tt.resource == "serviceaccounts" {
+				objects = append(objects, testSecret(team, testSecretName, testDockerConfigJSON))
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			kubeClient.PrependReactor(tt.verb, tt.resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.err
+			})
+
+			err := tt.sync(r)
+			if !tt.is(err) {
+				t.Errorf("sync = %v, want an error of the same kind as %v", err, tt.err)
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantMessage) {
+				t.Errorf("sync = %v, want a message starting with %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSyncNamespaceRetryAfter(t *testing.T) {
+	defer func(delay time.Duration) { requeue.TransientErrorDelay = delay }(requeue.TransientErrorDelay)
+	requeue.TransientErrorDelay = time.Hour
+
+	r, kubeClient := newTestReconciler(t, testNamespace("team", nil))
+	kubeClient.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewTooManyRequests("the server has received too many requests", 7)
+	})
+
+	err := r.syncNamespace(testNamespace("team", nil))
+	if after, ok := requeue.Delay(err); !ok || after != 7*time.Second {
+		t.Errorf("sync = %v, requeue delay = %s, %v, want the Retry-After of 7s", err, after, ok)
+	}
+	if requeue.IsRequested(err) {
+		t.Errorf("sync = %v, want a failure rather than a requeue request", err)
+	}
+}
+
+func TestNamespacesControllerOnly(t *testing.T) {
+	r, kubeClient := newTestReconciler(t)
+
+	// Only the namespaces controller runs, as in poll mode.
+	runNamespacesController(t, r, kubeClient, nil)
+
+	if _, err := kubeClient.CoreV1().Namespaces().Create(r.ctx, testNamespace("team", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		t.Errorf("secret team/%s not provisioned: %v", testSecretName, err)
+	}
+}
+
+func TestSyncNamespaceBackoffReset(t *testing.T) {
+	r, kubeClient := newTestReconciler(t, testNamespace("team", nil))
+
+	// The secret creates fail six times, succeed once and fail again. The
+	// created secret is not stored, so that every sync creates it.
+	var mu sync.Mutex
+	var attempts []time.Time
+	kubeClient.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 7 {
+			return true, action.(k8stesting.CreateAction).GetObject(), nil
+		}
+		return true, nil, errors.NewForbidden(corev1.Resource("secrets"), testSecretName, fmt.Errorf("denied"))
+	})
+	countAttempts := func(n int) func(context.Context) (bool, error) {
+		return func(context.Context) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(attempts) >= n, nil
+		}
+	}
+
+	controller := runNamespacesController(t, r, kubeClient, nil)
+
+	if err := wait.PollUntilContextTimeout(r.ctx, time.Millisecond, 10*time.Second, true, countAttempts(7)); err != nil {
+		t.Fatalf("namespace not synced successfully: %v", err)
+	}
+	controller.EnqueueKey("team")
+	if err := wait.PollUntilContextTimeout(r.ctx, time.Millisecond, 10*time.Second, true, countAttempts(9)); err != nil {
+		t.Fatalf("failure after the success not retried: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if backedOff, retried := attempts[6].Sub(attempts[5]), attempts[8].Sub(attempts[7]); retried >= backedOff {
+		t.Errorf("retry after the success took %s, want less than the %s of the sixth failure", retried, backedOff)
+	}
+}
+
+func TestExcludeNamespaceAfterProvisioning(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newTestReconciler(t, team,
+		testSecret(team, testSecretName, testDockerConfigJSON),
+		testServiceAccount("team", "default", "registry-credentials", testSecretName),
+	)
+	r.excludedNamespaces = sets.New("team")
+
+	if err := r.syncNamespace(team); err != nil {
+		t.Fatalf("syncNamespace = %v", err)
+	}
+	if _, err := kubeClient.CoreV1().Secrets("team").Get(r.ctx, testSecretName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("get secret team/%s = %v, want it deleted", testSecretName, err)
+	}
+
+	serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.syncServiceAccount(serviceAccount); err != nil {
+		t.Fatalf("syncServiceAccount = %v", err)
+	}
+	serviceAccount, err = kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []corev1.LocalObjectReference{{Name: "registry-credentials"}}; !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+		t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+	}
+}
+
+func TestSyncServiceAccountExcludeSelector(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []corev1.LocalObjectReference
+	}{
+		{name: "matching", labels: map[string]string{"aurora.gccloudone/no-pull-secret": "true"}},
+		{name: "not matching", labels: map[string]string{"team": "ops"}, want: []corev1.LocalObjectReference{{Name: testSecretName}}},
+		{name: "unlabelled", want: []corev1.LocalObjectReference{{Name: testSecretName}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			serviceAccount := testServiceAccount("team", "builder")
+			serviceAccount.Labels = tt.labels
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), serviceAccount)
+			r.serviceAccountExcludeSelector = labels.SelectorFromSet(labels.Set{"aurora.gccloudone/no-pull-secret": "true"})
+
+			if err := r.syncServiceAccount(serviceAccount); err != nil {
+				t.Fatalf("syncServiceAccount = %v", err)
+			}
+
+			got, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "builder", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.ImagePullSecrets, tt.want) {
+				t.Errorf("image pull secrets = %v, want %v", got.ImagePullSecrets, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncNamespaceTerminating(t *testing.T) {
+	tests := []struct {
+		name         string
+		podNamespace string
+	}{
+		{name: "another namespace", podNamespace: "aurora-system"},
+		{name: "the controller's own namespace", podNamespace: "team"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			team.Status.Phase = corev1.NamespaceTerminating
+			r, kubeClient := newTestReconciler(t, team)
+			r.podNamespace = tt.podNamespace
+
+			if err := r.syncNamespace(team); err != nil {
+				t.Errorf("syncNamespace = %v, want nil", err)
+			}
+			if writes := writeActions(kubeClient); len(writes) != 0 {
+				t.Errorf("writes = %v, want none", writes)
+			}
+		})
+	}
+}
+
+func TestSyncNamespaceRequiredOwner(t *testing.T) {
+	tenantOwner := metav1.OwnerReference{APIVersion: "tenancy.example.com/v1", Kind: "Tenant", Name: "team", UID: "tenant-uid"}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		owners []metav1.OwnerReference
+		// governed is whether the namespace is provisioned.
+		governed bool
+	}{
+		{name: "owned by the required kind", owners: []metav1.OwnerReference{tenantOwner}, governed: true},
+		{name: "owned by the required kind of another group", owners: []metav1.OwnerReference{{APIVersion: "other.example.com/v1", Kind: "Tenant", Name: "team", UID: "other-uid"}}},
+		{name: "owned by another kind", owners: []metav1.OwnerReference{{APIVersion: "tenancy.example.com/v1", Kind: "Project", Name: "team", UID: "project-uid"}}},
+		{name: "with the required owner label", labels: map[string]string{"tenancy.example.com/owner": "tenant-operator"}, governed: true},
+		{name: "with another owner label", labels: map[string]string{"tenancy.example.com/owner": "someone"}},
+		{name: "ad-hoc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", tt.labels)
+			team.OwnerReferences = tt.owners
+			r, kubeClient := newTestReconciler(t, team)
+			r.requiredOwnerKind = &schema.GroupKind{Group: "tenancy.example.com", Kind: "Tenant"}
+			r.requiredOwnerSelector = labels.SelectorFromSet(labels.Set{"tenancy.example.com/owner": "tenant-operator"})
+
+			if err := r.syncNamespace(team); err != nil {
+				t.Fatalf("syncNamespace = %v", err)
+			}
+
+			var want []string
+			if tt.governed {
+				want = []string{"create secrets"}
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, want) {
+				t.Errorf("writes = %v, want %v", writes, want)
+			}
+		})
+	}
+}
+
+func TestSyncServiceAccountExcluded(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		account   string
+		injected  bool
+	}{
+		{name: "the controller's own service account", namespace: "aurora-system", account: "aurora-controller"},
+		{name: "same name in another namespace", namespace: "team", account: "aurora-controller", injected: true},
+		{name: "excluded in every namespace", namespace: "team", account: "builder"},
+		{name: "not excluded", namespace: "team", account: "default", injected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := testNamespace(tt.namespace, nil)
+			serviceAccount := testServiceAccount(tt.namespace, tt.account)
+			r, kubeClient := newTestReconciler(t, namespace, testSecret(namespace, testSecretName, testDockerConfigJSON), serviceAccount)
+			// As for --exclude-service-accounts=builder with the
+			// POD_NAMESPACE and POD_SERVICE_ACCOUNT of the controller.
+			r.excludedServiceAccounts = sets.New("builder", "aurora-system/aurora-controller")
+
+			if err := r.syncServiceAccount(serviceAccount); err != nil {
+				t.Fatalf("syncServiceAccount = %v", err)
+			}
+
+			var want []string
+			if tt.injected {
+				want = []string{"update serviceaccounts"}
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, want) {
+				t.Errorf("writes = %v, want %v", writes, want)
+			}
+		})
+	}
+}
+
+func TestNamespaceDeletedMetrics(t *testing.T) {
+	r, kubeClient := newTestReconciler(t, testNamespace("team", nil), testNamespace("other", nil))
+	metrics.FieldManagerConflicts.Reset()
+	metrics.FieldManagerConflicts.WithLabelValues("team").Inc()
+	metrics.FieldManagerConflicts.WithLabelValues("other").Inc()
+
+	runNamespacesController(t, r, kubeClient, func(controller *namespaces.Controller) {
+		controller.SetDeletedFunc(r.namespaceDeleted)
+	})
+
+	if err := kubeClient.CoreV1().Namespaces().Delete(r.ctx, "team", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		return testutil.CollectAndCount(metrics.FieldManagerConflicts) == 1, nil
+	})
+	if err != nil {
+		t.Errorf("metrics of the deleted namespace not removed: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.FieldManagerConflicts.WithLabelValues("other")); got != 1 {
+		t.Errorf("conflicts of namespace other = %v, want 1", got)
+	}
+}
+
+func TestSyncServiceAccountPreservesFields(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		t.Run(fmt.Sprintf("force=%t", force), func(t *testing.T) {
+			team := testNamespace("team", nil)
+			automount := false
+			cached := testServiceAccount("team", "builder", "keep")
+			cached.AutomountServiceAccountToken = &automount
+			cached.Secrets = []corev1.ObjectReference{{Name: "builder-token"}}
+			cached.Labels = map[string]string{"app": "builder"}
+			cached.Annotations = map[string]string{"owner": "ci"}
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), cached)
+			r.forceServiceAccountUpdates = force
+
+			if err := r.syncServiceAccount(cached); err != nil {
+				t.Fatalf("syncServiceAccount() = %v", err)
+			}
+
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(context.Background(), "builder", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serviceAccount.AutomountServiceAccountToken; got == nil || *got {
+				t.Errorf("automountServiceAccountToken = %v, want false", got)
+			}
+			if want := []corev1.ObjectReference{{Name: "builder-token"}}; !reflect.DeepEqual(serviceAccount.Secrets, want) {
+				t.Errorf("secrets = %v, want %v", serviceAccount.Secrets, want)
+			}
+			if want := map[string]string{"app": "builder", injectedLabel: injectedValue}; !reflect.DeepEqual(serviceAccount.Labels, want) {
+				t.Errorf("labels = %v, want %v", serviceAccount.Labels, want)
+			}
+			if want := map[string]string{"owner": "ci"}; !reflect.DeepEqual(serviceAccount.Annotations, want) {
+				t.Errorf("annotations = %v, want %v", serviceAccount.Annotations, want)
+			}
+			if want := []corev1.LocalObjectReference{{Name: "keep"}, {Name: testSecretName}}; !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+				t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+			}
+			if len(cached.ImagePullSecrets) != 1 {
+				t.Errorf("the cached service account was modified: %v", cached.ImagePullSecrets)
+			}
+		})
+	}
+}
+
+func TestImagePullSecretsPatch(t *testing.T) {
+	labelPath := "/metadata/labels/aurora.gccloudone~1pull-secret-injected"
+
+	tests := []struct {
+		name     string
+		existing []string
+		labelled bool
+		add      []string
+		remove   []string
+		injected bool
+		want     string
+	}{
+		{name: "nothing to change", existing: []string{"keep"}, remove: []string{"other"}, injected: true},
+		{
+			name:     "add to an empty list",
+			add:      []string{testSecretName},
+			injected: true,
+			want:     `[{"op":"add","path":"/imagePullSecrets","value":[{"name":"aurora-pull"}]},{"op":"add","path":"/metadata/labels","value":{"aurora.gccloudone/pull-secret-injected":"true"}}]`,
+		},
+		{
+			name:     "append",
+			existing: []string{"keep"},
+			labelled: true,
+			add:      []string{testSecretName},
+			injected: true,
+			want:     `[{"op":"add","path":"/imagePullSecrets/-","value":{"name":"aurora-pull"}},{"op":"add","path":"` + labelPath + `","value":"true"}]`,
+		},
+		{
+			name:     "remove from the end",
+			existing: []string{"stale", "keep", "old"},
+			labelled: true,
+			remove:   []string{"stale", "old"},
+			want:     `[{"op":"test","path":"/imagePullSecrets/2/name","value":"old"},{"op":"remove","path":"/imagePullSecrets/2"},{"op":"test","path":"/imagePullSecrets/0/name","value":"stale"},{"op":"remove","path":"/imagePullSecrets/0"},{"op":"remove","path":"` + labelPath + `"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceAccount := testServiceAccount("team", "default", tt.existing...)
+			if tt.labelled {
+				serviceAccount.Labels = map[string]string{"app": "web", injectedLabel: injectedValue}
+			}
+
+			patch, err := imagePullSecretsPatch(serviceAccount, tt.add, tt.remove, tt.injected)
+			if err != nil {
+				t.Fatalf("imagePullSecretsPatch() = %v", err)
+			}
+			if string(patch) != tt.want {
+				t.Errorf("imagePullSecretsPatch() = %s, want %s", patch, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionDelayShortLivedNamespace(t *testing.T) {
+	const provisionDelay = 500 * time.Millisecond
+
+	r, kubeClient := newTestReconciler(t)
+	r.provisionDelay = provisionDelay
+	runNamespacesController(t, r, kubeClient, nil)
+
+	// The fake clientset does not set the creation timestamp.
+	created := time.Now()
+	for _, name := range []string{"ephemeral", "team"} {
+		namespace := testNamespace(name, nil)
+		namespace.CreationTimestamp = metav1.Now()
+		if _, err := kubeClient.CoreV1().Namespaces().Create(r.ctx, namespace, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(provisionDelay / 5)
+	if err := kubeClient.CoreV1().Namespaces().Delete(r.ctx, "ephemeral", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := kubeClient.CoreV1().Secrets("team").Get(ctx, testSecretName, metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("secret of namespace team not provisioned after the delay: %v", err)
+	}
+	if elapsed := time.Since(created); elapsed < provisionDelay {
+		t.Errorf("secret of namespace team provisioned after %s, before the provision delay of %s", elapsed, provisionDelay)
+	}
+
+	// The deleted namespace is requeued at the same time as team.
+	time.Sleep(provisionDelay / 5)
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "create" && action.GetResource().Resource == "secrets" && action.GetNamespace() == "ephemeral" {
+			t.Errorf("secret created in namespace ephemeral, deleted before the provision delay elapsed")
+		}
+	}
+}
+
+func TestSecretNameOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		disabled bool
+		want     string
+	}{
+		{name: "without the override", want: testSecretName},
+		{name: "with the override", override: "team-registry", want: "team-registry"},
+		{name: "override not allowed", override: "team-registry", disabled: true, want: testSecretName},
+		{name: "invalid override", override: "Team_Registry", want: testSecretName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			if tt.override != "" {
+				team.Annotations = map[string]string{pullSecretNameAnnotation: tt.override}
+			}
+			serviceAccount := testServiceAccount("team", "default", "keep")
+			r, kubeClient := newTestReconciler(t, team, serviceAccount)
+			r.secretNameOverride = !tt.disabled
+
+			if err := r.syncNamespace(team); err != nil {
+				t.Fatalf("syncNamespace() = %v", err)
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, []string{"create secrets"}) {
+				t.Errorf("writes = %v, want [create secrets]", writes)
+			}
+			getSecret(t, kubeClient, "team", tt.want)
+
+			if err := r.syncServiceAccount(serviceAccount); err != nil {
+				t.Fatalf("syncServiceAccount() = %v", err)
+			}
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []corev1.LocalObjectReference{{Name: "keep"}, {Name: tt.want}}; !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+				t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+			}
+		})
+	}
+}
+
+func TestSyncServiceAccountInjectedLabel(t *testing.T) {
+	tests := []struct {
+		name       string
+		force      bool
+		wantWrites []string
+	}{
+		{name: "optimistic", wantWrites: []string{"update serviceaccounts"}},
+		{name: "force", force: true, wantWrites: []string{"patch serviceaccounts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			cached := testServiceAccount("team", "default")
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), cached)
+			r.forceServiceAccountUpdates = tt.force
+
+			if err := r.syncServiceAccount(cached); err != nil {
+				t.Fatalf("syncServiceAccount() = %v", err)
+			}
+
+			// The label is written along with the reference.
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serviceAccount.Labels[injectedLabel]; got != injectedValue {
+				t.Errorf("injected label = %q, want %q", got, injectedValue)
+			}
+			if want := []corev1.LocalObjectReference{{Name: testSecretName}}; !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+				t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+			}
+		})
+	}
+}
+
+func TestSyncServiceAccountWaitForSecret(t *testing.T) {
+	tests := []struct {
+		name          string
+		waitForSecret bool
+		provisioned   bool
+		wantWrites    []string
+		wantRequeue   bool
+		wantRefs      []corev1.LocalObjectReference
+	}{
+		{name: "not waiting", wantWrites: []string{"update serviceaccounts"}, wantRefs: []corev1.LocalObjectReference{{Name: testSecretName}}},
+		{name: "waiting for the secret", waitForSecret: true, wantRequeue: true},
+		{name: "secret provisioned", waitForSecret: true, provisioned: true, wantWrites: []string{"update serviceaccounts"}, wantRefs: []corev1.LocalObjectReference{{Name: testSecretName}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			cached := testServiceAccount("team", "default")
+			objects := []runtime.Object{team, cached}
+			if tt.provisioned {
+				objects = append(objects, testSecret(team, testSecretName, testDockerConfigJSON))
+			}
+			r, kubeClient := newTestReconciler(t, objects...)
+			r.waitForSecret = tt.waitForSecret
+
+			err := r.syncServiceAccount(cached)
+			if tt.wantRequeue {
+				if delay, ok := requeue.Delay(err); !ok || delay != secretWaitRequeueDelay {
+					t.Errorf("syncServiceAccount() = %v, want a requeue after %v", err, secretWaitRequeueDelay)
+				}
+			} else if err != nil {
+				t.Fatalf("syncServiceAccount() = %v", err)
+			}
+
+			// Without the secret, the reference is not injected.
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+			serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(serviceAccount.ImagePullSecrets, tt.wantRefs) {
+				t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestSyncNamespacePendingDeletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		wantWrites []string
+	}{
+		{name: "pending deletion", labels: map[string]string{"example.com/pending-deletion": "true"}},
+		{name: "label with another value", labels: map[string]string{"example.com/pending-deletion": "false"}, wantWrites: []string{"create secrets", "update serviceaccounts"}},
+		{name: "unlabelled", wantWrites: []string{"create secrets", "update serviceaccounts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", tt.labels)
+			serviceAccount := testServiceAccount("team", "default")
+			r, kubeClient := newTestReconciler(t, team, serviceAccount)
+			selector, err := labels.Parse("example.com/pending-deletion=true")
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.deletionSelector = selector
+
+			if err := r.syncNamespace(team); err != nil {
+				t.Errorf("syncNamespace = %v, want nil", err)
+			}
+			if err := r.syncServiceAccount(serviceAccount); err != nil {
+				t.Errorf("syncServiceAccount = %v, want nil", err)
+			}
+			if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %v, want %v", writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestUnifiedReconcile(t *testing.T) {
+	team := testNamespace("team", nil)
+	defaultServiceAccount := testServiceAccount("team", "default")
+	r, kubeClient := newTestReconciler(t, team, defaultServiceAccount, testServiceAccount("team", "builder", "keep"))
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	r.serviceAccountLister = factory.Core().V1().ServiceAccounts().Lister()
+	factory.Start(r.ctx.Done())
+	factory.WaitForCacheSync(r.ctx.Done())
+
+	// The service accounts controller does not reference a secret that
+	// does not exist yet.
+	if err := r.syncServiceAccount(defaultServiceAccount); err != nil {
+		t.Fatalf("syncServiceAccount() = %v", err)
+	}
+	if writes := writeActions(kubeClient); len(writes) > 0 {
+		t.Fatalf("writes before the namespace sync = %v, want none", writes)
+	}
+
+	// The namespace sync provisions the secret and injects it in one pass.
+	if err := r.syncNamespace(team); err != nil {
+		t.Fatalf("syncNamespace() = %v", err)
+	}
+	if want := []string{"create secrets", "update serviceaccounts", "update serviceaccounts"}; !reflect.DeepEqual(writeActions(kubeClient), want) {
+		t.Errorf("writes = %v, want %v", writeActions(kubeClient), want)
+	}
+	for name, want := range map[string][]corev1.LocalObjectReference{
+		"default": {{Name: testSecretName}},
+		"builder": {{Name: "keep"}, {Name: testSecretName}},
+	} {
+		serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+			t.Errorf("image pull secrets of %s = %v, want %v", name, serviceAccount.ImagePullSecrets, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// referenceServiceAccount is a canonical service account whose image pull
+// secrets are mirrored, with the secrets they reference, to every managed
+// namespace. It lets the controller distribute credentials without knowing
+// their content.
+type referenceServiceAccount struct {
+	namespace string
+	name      string
+
+	// serviceAccountLister and secretLister cache the service accounts and
+	// secrets of the reference namespace only.
+	serviceAccountLister corev1listers.ServiceAccountLister
+	secretLister         corev1listers.SecretLister
+}
+
+// secretNames returns the names of the image pull secrets of the reference
+// service account, or none if it does not exist.
+func (s *referenceServiceAccount) secretNames() []string {
+	serviceAccount, err := s.serviceAccountLister.ServiceAccounts(s.namespace).Get(s.name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf("error getting reference service account %s/%s: %v", s.namespace, s.name, err)
+		}
+		return nil
+	}
+
+	names := []string{}
+	for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
+		names = append(names, imagePullSecret.Name)
+	}
+
+	return names
+}
+
+// referenceSecretsProvider copies the secrets referenced by the reference
+// service account to every managed namespace. It replaces the secrets
+// provider when a reference service account is set.
+type referenceSecretsProvider struct {
+	*imagePullSecretsReconciler
+}
+
+// Name implements namespaceResourceProvider.
+func (p referenceSecretsProvider) Name() string {
+	return "reference-secrets"
+}
+
+// Reconcile implements namespaceResourceProvider.
+func (p referenceSecretsProvider) Reconcile(namespace *corev1.Namespace) error {
+	// The reference namespace holds the originals.
+	if namespace.Name == p.reference.namespace {
+		return nil
+	}
+
+	for _, name := range p.reference.secretNames() {
+		source, err := p.reference.secretLister.Secrets(p.reference.namespace).Get(name)
+		if errors.IsNotFound(err) {
+			klog.Warningf("secret %s/%s referenced by the reference service account does not exist", p.reference.namespace, name)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("getting reference secret %s/%s: %w", p.reference.namespace, name, err)
+		}
+
+		if err := p.reconcileCopy(namespace, source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileCopy creates or updates the copy of the source secret in the
+// namespace.
+func (p referenceSecretsProvider) reconcileCopy(namespace *corev1.Namespace, source *corev1.Secret) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      source.Name,
+			Namespace: namespace.Name,
+			Labels: map[string]string{
+				managedByLabel: managedByValue,
+			},
+		},
+		Type: source.Type,
+		Data: source.Data,
+	}
+	setNamespaceOwner(secret, namespace)
+
+	current, err := p.secretsLister.Secrets(secret.Namespace).Get(secret.Name)
+	if errors.IsNotFound(err) {
+		klog.Infof("copying secret %s/%s to %s", source.Namespace, source.Name, secret.Namespace)
+		err := p.write(func(ctx context.Context) error {
+			_, err := p.kubeClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+			return err
+		})
+		if errors.IsAlreadyExists(err) {
+			return requeue.After(cacheLagRequeueDelay, "secret %s/%s exists but is not cached yet", secret.Namespace, secret.Name)
+		} else if err != nil {
+			return fmt.Errorf("creating secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("getting secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	if current.Labels[managedByLabel] != managedByValue && !p.adoptExistingSecrets {
+		klog.Warningf("skipping secret %s/%s: it is not managed by %s", secret.Namespace, secret.Name, managedByValue)
+		return nil
+	}
+
+	if current.Type != secret.Type {
+		// The type of a secret is immutable.
+		klog.Warningf("skipping secret %s/%s: its type %s differs from the type %s of the reference secret", secret.Namespace, secret.Name, current.Type, secret.Type)
+		return nil
+	}
+
+	if current.Labels[managedByLabel] == managedByValue && isOwnedByNamespace(current, namespace) && reflect.DeepEqual(current.Data, secret.Data) {
+		return nil
+	}
+
+	klog.Infof("updating secret %s/%s from %s/%s", secret.Namespace, secret.Name, source.Namespace, source.Name)
+	updated := current.DeepCopy()
+	updated.Data = secret.Data
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	updated.Labels[managedByLabel] = managedByValue
+	setNamespaceOwner(updated, namespace)
+
+	err = p.write(func(ctx context.Context) error {
+		_, err := p.kubeClient.CoreV1().Secrets(updated.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating secret %s/%s: %w", updated.Namespace, updated.Name, err)
+	}
+
+	return nil
+}
+
+// Cleanup implements namespaceResourceProvider.
+func (p referenceSecretsProvider) Cleanup(namespace *corev1.Namespace) error {
+	if namespace.Name == p.reference.namespace {
+		return nil
+	}
+
+	for _, name := range p.reference.secretNames() {
+		current, err := p.secretsLister.Secrets(namespace.Name).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("getting secret %s/%s: %w", namespace.Name, name, err)
+		}
+
+		if current.Labels[managedByLabel] != managedByValue {
+			continue
+		}
+
+		klog.Infof("deleting secret %s/%s", namespace.Name, name)
+		err = p.write(func(ctx context.Context) error {
+			return p.kubeClient.CoreV1().Secrets(namespace.Name).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("deleting secret %s/%s: %w", namespace.Name, name, err)
+		}
+	}
+
+	return nil
+}
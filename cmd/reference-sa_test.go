@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const otherDockerConfigJSON = `{"auths":{"mirror.example.com":{"auth":"bWlycm9yOm1pcnJvcg=="}}}`
+
+// newReferenceTestReconciler returns a test reconciler mirroring the image
+// pull secrets of the central/builder reference service account, which
+// references registry-a, registry-b and a missing secret.
+func newReferenceTestReconciler(t *testing.T, objects ...runtime.Object) (*imagePullSecretsReconciler, *fake.Clientset) {
+	t.Helper()
+
+	central := testNamespace("central", nil)
+	objects = append(objects,
+		central,
+		testServiceAccount("central", "builder", "registry-a", "registry-b", "missing"),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-a", Namespace: "central"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       dockerConfigJSONData(testDockerConfigJSON),
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry-b", Namespace: "central"},
+			Type:       corev1.SecretTypeDockercfg,
+			Data:       map[string][]byte{corev1.DockerConfigKey: []byte(`{"mirror.example.com":{"auth":"bWlycm9yOm1pcnJvcg=="}}`)},
+		},
+	)
+	r, kubeClient := newTestReconciler(t, objects...)
+
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace("central"))
+	r.reference = &referenceServiceAccount{
+		namespace:            "central",
+		name:                 "builder",
+		serviceAccountLister: factory.Core().V1().ServiceAccounts().Lister(),
+		secretLister:         factory.Core().V1().Secrets().Lister(),
+	}
+	factory.Start(r.ctx.Done())
+	for informer, synced := range factory.WaitForCacheSync(r.ctx.Done()) {
+		if !synced {
+			t.Fatalf("cache of %v not synced", informer)
+		}
+	}
+	r.providers = []namespaceResourceProvider{referenceSecretsProvider{r}}
+
+	return r, kubeClient
+}
+
+func TestReferenceSecretsProviderReconcile(t *testing.T) {
+	team := testNamespace("team", nil)
+	stale := testSecret(team, "registry-a", otherDockerConfigJSON)
+	stale.Labels["team"] = "ops"
+	r, kubeClient := newReferenceTestReconciler(t, team, stale)
+
+	if err := r.syncNamespace(team); err != nil {
+		t.Fatalf("syncNamespace() = %v", err)
+	}
+
+	if writes := writeActions(kubeClient); !reflect.DeepEqual(writes, []string{"update secrets", "create secrets"}) {
+		t.Errorf("writes = %v, want [update secrets create secrets]", writes)
+	}
+	for _, name := range []string{"registry-a", "registry-b"} {
+		source := getSecret(t, kubeClient, "central", name)
+		secret := getSecret(t, kubeClient, "team", name)
+		if secret.Type != source.Type || !reflect.DeepEqual(secret.Data, source.Data) {
+			t.Errorf("secret team/%s = %s %q, want %s %q", name, secret.Type, secret.Data, source.Type, source.Data)
+		}
+		if secret.Labels[managedByLabel] != managedByValue || !isOwnedByNamespace(secret, team) {
+			t.Errorf("secret team/%s is not managed and owned by the namespace: %v, %v", name, secret.Labels, secret.OwnerReferences)
+		}
+	}
+	if got := getSecret(t, kubeClient, "team", "registry-a").Labels["team"]; got != "ops" {
+		t.Errorf("label team of the updated copy = %q, want it kept", got)
+	}
+	if _, err := kubeClient.CoreV1().Secrets("team").Get(r.ctx, "missing", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("get secret team/missing = %v, want not found", err)
+	}
+
+	// The originals are left alone.
+	kubeClient.ClearActions()
+	if err := r.syncNamespace(testNamespace("central", nil)); err != nil {
+		t.Fatalf("syncNamespace(central) = %v", err)
+	}
+	if writes := writeActions(kubeClient); len(writes) > 0 {
+		t.Errorf("writes in the reference namespace = %v, want none", writes)
+	}
+}
+
+func TestReferenceSecretsProviderCleanup(t *testing.T) {
+	team := testNamespace("team", nil)
+	unmanaged := testSecret(team, "registry-b", otherDockerConfigJSON)
+	unmanaged.Labels = nil
+	r, kubeClient := newReferenceTestReconciler(t, team,
+		testSecret(team, "registry-a", testDockerConfigJSON), unmanaged,
+		testServiceAccount("team", "default", "keep", "registry-a", "registry-b"),
+	)
+	r.excludedNamespaces = sets.New("team")
+
+	if err := r.syncNamespace(team); err != nil {
+		t.Fatalf("syncNamespace() = %v", err)
+	}
+
+	if _, err := kubeClient.CoreV1().Secrets("team").Get(r.ctx, "registry-a", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("get secret team/registry-a = %v, want it deleted", err)
+	}
+	getSecret(t, kubeClient, "team", "registry-b")
+}
+
+func TestSyncServiceAccountReference(t *testing.T) {
+	team := testNamespace("team", nil)
+	r, kubeClient := newReferenceTestReconciler(t, team, testServiceAccount("team", "default", "keep"))
+
+	if err := r.syncNamespace(team); err != nil {
+		t.Fatalf("syncNamespace() = %v", err)
+	}
+	err := wait.PollUntilContextTimeout(r.ctx, 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+		secrets, err := r.secretsLister.Secrets("team").List(labels.Everything())
+		return len(secrets) == 2, err
+	})
+	if err != nil {
+		t.Fatalf("copies of the reference secrets not cached: %v", err)
+	}
+
+	serviceAccount, err := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reconcileServiceAccount(serviceAccount, true); err != nil {
+		t.Fatalf("reconcileServiceAccount() = %v", err)
+	}
+
+	serviceAccount, err = kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The secrets of the reference service account replace the Aurora
+	// secret, and the missing one is not referenced.
+	want := []corev1.LocalObjectReference{{Name: "keep"}, {Name: "registry-a"}, {Name: "registry-b"}}
+	if !reflect.DeepEqual(serviceAccount.ImagePullSecrets, want) {
+		t.Errorf("image pull secrets = %v, want %v", serviceAccount.ImagePullSecrets, want)
+	}
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// registryConfig maps namespaces to named credential sets so that different
+// tenants can pull from different registries.
+type registryConfig struct {
+	// Default is the name of the credential set used when no mapping matches.
+	// When empty, the controller's default credential is used as the fallback.
+	Default string `json:"default,omitempty"`
+
+	// Credentials are the named credential sets available to the mappings.
+	Credentials map[string]registryCredential `json:"credentials"`
+
+	// Mappings are evaluated in order; the first match wins.
+	Mappings []registryMapping `json:"mappings,omitempty"`
+
+	// Secrets are additional named image pull secrets. Unlike mappings, every
+	// secret whose selection matches a namespace is provisioned in it.
+	Secrets []registrySecret `json:"secrets,omitempty"`
+}
+
+// registryCredential is a single named credential set.
+type registryCredential struct {
+	DockerConfigJSON string `json:"dockerConfigJson"`
+}
+
+// registryMapping selects the namespaces that use a credential set, either
+// by name or by label selector.
+type registryMapping struct {
+	Credential        string                `json:"credential"`
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	selector labels.Selector
+}
+
+// registrySecret is an additional image pull secret holding a credential set,
+// provisioned in the namespaces its mapping selects, next to the Aurora
+// secret.
+type registrySecret struct {
+	Name string `json:"name"`
+	registryMapping
+}
+
+// loadRegistryConfig reads and validates the registry configuration file.
+func loadRegistryConfig(path string) (*registryConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading registry config %s: %w", path, err)
+	}
+
+	config := &registryConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parsing registry config %s: %w", path, err)
+	}
+
+	if config.Default != "" {
+		if _, ok := config.Credentials[config.Default]; !ok {
+			return nil, fmt.Errorf("default credential %q is not defined", config.Default)
+		}
+	}
+
+	for i := range config.Mappings {
+		mapping := &config.Mappings[i]
+		if _, ok := config.Credentials[mapping.Credential]; !ok {
+			return nil, fmt.Errorf("mapping %d references undefined credential %q", i, mapping.Credential)
+		}
+
+		if mapping.NamespaceSelector != nil {
+			if mapping.selector, err = metav1.LabelSelectorAsSelector(mapping.NamespaceSelector); err != nil {
+				return nil, fmt.Errorf("mapping %d has an invalid namespace selector: %w", i, err)
+			}
+		}
+	}
+
+	names := sets.New(os.Getenv("AURORA_SECRET_NAME"))
+	for i := range config.Secrets {
+		secret := &config.Secrets[i]
+		if secret.Name == "" {
+			return nil, fmt.Errorf("secret %d has no name", i)
+		}
+		if names.Has(secret.Name) {
+			return nil, fmt.Errorf("secret %d has the name %q of another secret", i, secret.Name)
+		}
+		names.Insert(secret.Name)
+
+		if _, ok := config.Credentials[secret.Credential]; !ok {
+			return nil, fmt.Errorf("secret %q references undefined credential %q", secret.Name, secret.Credential)
+		}
+
+		if secret.NamespaceSelector != nil {
+			if secret.selector, err = metav1.LabelSelectorAsSelector(secret.NamespaceSelector); err != nil {
+				return nil, fmt.Errorf("secret %q has an invalid namespace selector: %w", secret.Name, err)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// matches reports whether the mapping applies to the namespace.
+func (m *registryMapping) matches(namespace *corev1.Namespace) bool {
+	for _, name := range m.Namespaces {
+		if name == namespace.Name {
+			return true
+		}
+	}
+
+	return m.selector != nil && m.selector.Matches(labels.Set(namespace.Labels))
+}
+
+// credentialFor returns the name of the credential set used by the
+// namespace, from the first matching mapping or the default credential set.
+// It returns false when neither applies.
+func (c *registryConfig) credentialFor(namespace *corev1.Namespace) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	for i := range c.Mappings {
+		if c.Mappings[i].matches(namespace) {
+			return c.Mappings[i].Credential, true
+		}
+	}
+
+	if c.Default != "" {
+		return c.Default, true
+	}
+
+	return "", false
+}
+
+// dockerConfigJSONFor returns the dockerconfigjson for the namespace from the
+// first matching mapping or the default credential set. It returns false when
+// neither applies and the controller's default credential should be used.
+func (c *registryConfig) dockerConfigJSONFor(namespace *corev1.Namespace) (string, bool) {
+	credential, ok := c.credentialFor(namespace)
+	if !ok {
+		return "", false
+	}
+
+	return c.Credentials[credential].DockerConfigJSON, true
+}
+
+// secretsFor returns the additional secrets that apply to the namespace, in
+// the order of the configuration. Selections may overlap, in which case the
+// namespace gets every matching secret.
+func (c *registryConfig) secretsFor(namespace *corev1.Namespace) []registrySecret {
+	if c == nil {
+		return nil
+	}
+
+	var secrets []registrySecret
+	for i := range c.Secrets {
+		if c.Secrets[i].matches(namespace) {
+			secrets = append(secrets, c.Secrets[i])
+		}
+	}
+
+	return secrets
+}
+
+// secretNames returns the names of every additional secret, whether or not it
+// applies to a namespace.
+func (c *registryConfig) secretNames() []string {
+	if c == nil {
+		return nil
+	}
+
+	var names []string
+	for _, secret := range c.Secrets {
+		names = append(names, secret.Name)
+	}
+
+	return names
+}
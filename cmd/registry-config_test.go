@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testRegistryConfig maps the team namespace and the namespaces labelled
+// tier=gold to their own registries, with a default for every other one, and
+// provisions an additional secret in the gold namespaces.
+const testRegistryConfig = `
+default: shared
+credentials:
+  shared:
+    dockerConfigJson: '{"auths":{"shared.example.com":{"auth":"c2hhcmVk"}}}'
+  team:
+    dockerConfigJson: '{"auths":{"team.example.com":{"auth":"dGVhbQ=="}}}'
+  gold:
+    dockerConfigJson: '{"auths":{"gold.example.com":{"auth":"Z29sZA=="}}}'
+mappings:
+- credential: team
+  namespaces: [team]
+- credential: gold
+  namespaceSelector:
+    matchLabels:
+      tier: gold
+secrets:
+- name: gold-pull
+  credential: gold
+  namespaceSelector:
+    matchLabels:
+      tier: gold
+`
+
+// writeRegistryConfig writes the registry config to a file of the test and
+// returns its path.
+func writeRegistryConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "registries.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestGenerateSecretsRegistryConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		namespace *corev1.Namespace
+		// want maps the generated secret names to their registry hosts.
+		want map[string]string
+	}{
+		{
+			name:      "mapped by name",
+			config:    testRegistryConfig,
+			namespace: testNamespace("team", nil),
+			want:      map[string]string{testSecretName: "team.example.com"},
+		},
+		{
+			name:      "mapped by selector",
+			config:    testRegistryConfig,
+			namespace: testNamespace("payments", map[string]string{"tier": "gold"}),
+			want:      map[string]string{testSecretName: "gold.example.com", "gold-pull": "gold.example.com"},
+		},
+		{
+			name:      "first mapping wins",
+			config:    testRegistryConfig,
+			namespace: testNamespace("team", map[string]string{"tier": "gold"}),
+			want:      map[string]string{testSecretName: "team.example.com", "gold-pull": "gold.example.com"},
+		},
+		{
+			name:      "default credential set",
+			config:    testRegistryConfig,
+			namespace: testNamespace("other", nil),
+			want:      map[string]string{testSecretName: "shared.example.com"},
+		},
+		{
+			name:      "controller credential without a default",
+			config:    strings.Replace(testRegistryConfig, "default: shared", "", 1),
+			namespace: testNamespace("other", nil),
+			want:      map[string]string{testSecretName: "registry.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestReconciler(t)
+			registries, err := loadRegistryConfig(writeRegistryConfig(t, tt.config))
+			if err != nil {
+				t.Fatalf("loadRegistryConfig() = %v", err)
+			}
+			r.registries = registries
+
+			got := map[string]string{}
+			for _, secret := range r.generateSecrets(tt.namespace) {
+				hosts := registryHosts(secret.Data[corev1.DockerConfigJsonKey])
+				got[secret.Name] = strings.Join(hosts.UnsortedList(), ",")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("secrets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRegistryConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "undefined default", config: "default: missing\ncredentials: {}", wantErr: `default credential "missing" is not defined`},
+		{name: "undefined mapping credential", config: "credentials: {}\nmappings:\n- credential: missing", wantErr: `mapping 0 references undefined credential "missing"`},
+		{name: "unknown field", config: "credential: {}", wantErr: "parsing registry config"},
+		{name: "unnamed secret", config: "credentials: {a: {}}\nsecrets:\n- credential: a", wantErr: "secret 0 has no name"},
+		{name: "secret named like the Aurora secret", config: "credentials: {a: {}}\nsecrets:\n- name: " + testSecretName + "\n  credential: a", wantErr: "has the name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AURORA_SECRET_NAME", testSecretName)
+
+			_, err := loadRegistryConfig(writeRegistryConfig(t, tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadRegistryConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// overlappingRegistryConfig provisions additional secrets whose selections
+// overlap: the gold and eu namespaces, and the team namespace or the gold
+// namespaces.
+const overlappingRegistryConfig = `
+credentials:
+  gold:
+    dockerConfigJson: '{"auths":{"gold.example.com":{"auth":"Z29sZA=="}}}'
+  eu:
+    dockerConfigJson: '{"auths":{"eu.example.com":{"auth":"ZXU="}}}'
+  team:
+    dockerConfigJson: '{"auths":{"team.example.com":{"auth":"dGVhbQ=="}}}'
+secrets:
+- name: gold-pull
+  credential: gold
+  namespaceSelector:
+    matchLabels:
+      tier: gold
+- name: eu-pull
+  credential: eu
+  namespaceSelector:
+    matchExpressions:
+    - {key: region, operator: In, values: [eu-west, eu-central]}
+- name: team-pull
+  credential: team
+  namespaces: [team]
+  namespaceSelector:
+    matchLabels:
+      tier: gold
+`
+
+func TestRegistryConfigSecretsFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		want      []string
+	}{
+		{name: "no selection", namespace: testNamespace("other", map[string]string{"tier": "silver"})},
+		{name: "one selection", namespace: testNamespace("payments", map[string]string{"region": "eu-west"}), want: []string{"eu-pull"}},
+		{name: "overlapping selections", namespace: testNamespace("payments", map[string]string{"tier": "gold"}), want: []string{"gold-pull", "team-pull"}},
+		{name: "every selection", namespace: testNamespace("payments", map[string]string{"tier": "gold", "region": "eu-central"}), want: []string{"gold-pull", "eu-pull", "team-pull"}},
+		{name: "selected by name and by selector", namespace: testNamespace("team", map[string]string{"tier": "gold"}), want: []string{"gold-pull", "team-pull"}},
+	}
+
+	t.Setenv("AURORA_SECRET_NAME", testSecretName)
+	registries, err := loadRegistryConfig(writeRegistryConfig(t, overlappingRegistryConfig))
+	if err != nil {
+		t.Fatalf("loadRegistryConfig() = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, secret := range registries.secretsFor(tt.namespace) {
+				got = append(got, secret.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("secretsFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncServiceAccountRegistrySecrets(t *testing.T) {
+	tests := []struct {
+		name                      string
+		removeInapplicableSecrets bool
+		want                      []string
+	}{
+		{name: "adding", want: []string{"keep", "eu-pull", testSecretName, "gold-pull", "team-pull"}},
+		{name: "adding and removing", removeInapplicableSecrets: true, want: []string{"keep", testSecretName, "gold-pull", "team-pull"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The namespace moved from the eu region to the gold tier.
+			payments := testNamespace("payments", map[string]string{"tier": "gold"})
+			serviceAccount := testServiceAccount("payments", "default", "keep", "eu-pull")
+			r, kubeClient := newTestReconciler(t, payments, serviceAccount)
+			registries, err := loadRegistryConfig(writeRegistryConfig(t, overlappingRegistryConfig))
+			if err != nil {
+				t.Fatalf("loadRegistryConfig() = %v", err)
+			}
+			r.registries = registries
+			r.removeInapplicableSecrets = tt.removeInapplicableSecrets
+
+			if err := r.syncServiceAccount(serviceAccount); err != nil {
+				t.Fatalf("syncServiceAccount() = %v", err)
+			}
+
+			serviceAccount, err = kubeClient.CoreV1().ServiceAccounts("payments").Get(r.ctx, "default", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, imagePullSecret := range serviceAccount.ImagePullSecrets {
+				got = append(got, imagePullSecret.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("image pull secrets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"time"
+
+	"k8s.io/klog"
+)
+
+// revalidatePeriodically calls enqueueAll every interval until stopCh is
+// closed, so that every service account is reconciled against the current
+// configuration even without events, including the compliant ones resyncs
+// may skip. The first call waits for a full interval: the initial sweep
+// already covers startup.
+func revalidatePeriodically(interval time.Duration, stopCh <-chan struct{}, enqueueAll func() int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			klog.Infof("Revalidation enqueued %d service accounts", enqueueAll())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/serviceaccounts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRevalidatePeriodically(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	kubeClient := fake.NewSimpleClientset(testServiceAccount("team", "default", testSecretName), testServiceAccount("ops", "builder"))
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+
+	var mu sync.Mutex
+	syncs := map[string]int{}
+	controller := serviceaccounts.NewController(factory.Core().V1().ServiceAccounts(), func(serviceAccount *corev1.ServiceAccount) error {
+		mu.Lock()
+		defer mu.Unlock()
+		syncs[serviceAccount.Namespace+"/"+serviceAccount.Name]++
+		return nil
+	})
+	factory.Start(ctx.Done())
+	go func() {
+		if err := controller.Run(1, ctx.Done()); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// waitForSyncs waits for every service account to be synced at least
+	// count times.
+	waitForSyncs := func(t *testing.T, count int) {
+		t.Helper()
+		err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true, func(context.Context) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return syncs["team/default"] >= count && syncs["ops/builder"] >= count, nil
+		})
+		if err != nil {
+			t.Fatalf("service accounts not synced %d times: %v", count, err)
+		}
+	}
+	waitForSyncs(t, 1)
+
+	// Without any event, every service account is reconciled again at each
+	// interval, the compliant ones included.
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		revalidatePeriodically(50*time.Millisecond, stopCh, controller.EnqueueAll)
+		close(stopped)
+	}()
+	waitForSyncs(t, 3)
+
+	close(stopCh)
+	<-stopped
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	before := map[string]int{"team/default": syncs["team/default"], "ops/builder": syncs["ops/builder"]}
+	mu.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for key, count := range before {
+		if syncs[key] != count {
+			t.Errorf("%s synced %d times after the revalidation stopped, want %d", key, syncs[key], count)
+		}
+	}
+}
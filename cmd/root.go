@@ -1,11 +1,22 @@
 package cmd
 
 import (
+	"fmt"
+	"runtime"
+	"strings"
+
 	"github.com/spf13/cobra"
 )
 
 var apiserver string
 var kubeconfig string
+var userAgent string
+
+// controllerVersion is set at build time with -ldflags "-X .../cmd.controllerVersion=...".
+var controllerVersion = "dev"
+
+// controllerCommit is set at build time with -ldflags "-X .../cmd.controllerCommit=...".
+var controllerCommit = "unknown"
 
 var rootCmd = &cobra.Command{
 	Use:   "aurora-controller",
@@ -16,6 +27,18 @@ var rootCmd = &cobra.Command{
 func init() {
 	rootCmd.PersistentFlags().StringVar(&apiserver, "apiserver", "", "URL to the Kubernetes API server")
 	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Path to the Kubeconfig file")
+	rootCmd.PersistentFlags().Var(featureGates, "feature-gates", "A set of key=value pairs that describe feature gates for experimental features. Options are:\n"+strings.Join(featureGates.KnownFeatures(), "\n"))
+	rootCmd.PersistentFlags().StringVar(&userAgent, "user-agent", "", "User-Agent sent to the Kubernetes API server, defaulting to aurora-controller/<version> with the platform and command")
+}
+
+// userAgentFor returns the User-Agent used by the command's API clients, so
+// that its traffic can be matched by FlowSchemas and found in audit logs.
+func userAgentFor(cmd *cobra.Command) string {
+	if userAgent != "" {
+		return userAgent
+	}
+
+	return fmt.Sprintf("aurora-controller/%s (%s/%s) %s", controllerVersion, runtime.GOOS, runtime.GOARCH, cmd.Name())
 }
 
 // Execute executes the root command.
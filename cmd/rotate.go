@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+var (
+	rotateDockerConfigJSONPath string
+	rotateSourceSecretRef      string
+	rotateSourceSecretKey      string
+	rotateSecretName           string
+	rotateBatchSize            int
+	rotateBatchPause           time.Duration
+)
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the managed image pull secret in every namespace",
+	Long: `Rotate the managed image pull secret in every namespace.
+
+The new dockerconfigjson is written to the source secret read by the
+controller with --credential-source=secret, and then to the managed secret of
+every namespace, optionally in batches with a pause between them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if rotateDockerConfigJSONPath == "" {
+			return fmt.Errorf("--dockerconfigjson-file is required")
+		}
+		if rotateSecretName == "" {
+			return fmt.Errorf("--secret-name or AURORA_SECRET_NAME is required")
+		}
+
+		newData, err := os.ReadFile(rotateDockerConfigJSONPath)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(newData) {
+			return fmt.Errorf("%s does not contain valid JSON", rotateDockerConfigJSONPath)
+		}
+
+		cfg, err := buildConfig()
+		if err != nil {
+			return fmt.Errorf("error building kubeconfig: %w", err)
+		}
+		cfg.UserAgent = userAgentFor(cmd)
+
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building kubernetes clientset: %w", err)
+		}
+
+		ctx := cmd.Context()
+
+		// Update the source first, so that the controller does not revert
+		// the rotated secrets on its next resync.
+		var oldData []byte
+		if rotateSourceSecretRef != "" {
+			if oldData, err = updateSourceSecret(ctx, kubeClient, newData); err != nil {
+				return err
+			}
+		}
+
+		return rotateNamespaces(ctx, kubeClient, oldData, newData)
+	},
+}
+
+// updateSourceSecret writes the new credential to the source secret and returns
+// the credential it replaced.
+func updateSourceSecret(ctx context.Context, kubeClient kubernetes.Interface, data []byte) ([]byte, error) {
+	namespace, name, ok := strings.Cut(rotateSourceSecretRef, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("--source-secret-ref must be namespace/name")
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting source secret %s: %w", rotateSourceSecretRef, err)
+	}
+
+	oldData := secret.Data[rotateSourceSecretKey]
+
+	updated := secret.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+	updated.Data[rotateSourceSecretKey] = data
+
+	if _, err := kubeClient.CoreV1().Secrets(namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return nil, fmt.Errorf("updating source secret %s: %w", rotateSourceSecretRef, err)
+	}
+
+	klog.Infof("Updated source secret %s", rotateSourceSecretRef)
+	return oldData, nil
+}
+
+// rotateNamespaces writes the new credential to the managed secret of every
+// namespace. When oldData is set, secrets holding another credential, such as
+// one from a registry mapping, are left untouched.
+func rotateNamespaces(ctx context.Context, kubeClient kubernetes.Interface, oldData, newData []byte) error {
+	namespaceList, err := kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing namespaces: %w", err)
+	}
+
+	total := len(namespaceList.Items)
+	updated, skipped, failed := 0, 0, 0
+
+	for i, namespace := range namespaceList.Items {
+		if rotateBatchSize > 0 && i > 0 && i%rotateBatchSize == 0 && rotateBatchPause > 0 {
+			klog.Infof("Pausing %s after %d/%d namespaces", rotateBatchPause, i, total)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(rotateBatchPause):
+			}
+		}
+
+		changed, err := rotateSecret(ctx, kubeClient, namespace.Name, oldData, newData)
+		switch {
+		case err != nil:
+			failed++
+			klog.Errorf("error rotating secret %s/%s: %v", namespace.Name, rotateSecretName, err)
+		case changed:
+			updated++
+		default:
+			skipped++
+		}
+
+		klog.Infof("Rotated %d/%d namespaces (%d skipped, %d failed)", updated, total, skipped, failed)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to rotate %d of %d namespaces", failed, total)
+	}
+
+	return nil
+}
+
+// rotateSecret writes the new credential to the namespace's managed secret and
+// reports whether it was changed.
+func rotateSecret(ctx context.Context, kubeClient kubernetes.Interface, namespace string, oldData, newData []byte) (bool, error) {
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, rotateSecretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if secret.Labels[managedByLabel] != managedByValue {
+		return false, nil
+	}
+
+	current := string(secret.Data[corev1.DockerConfigJsonKey])
+	if current == string(newData) {
+		return false, nil
+	}
+	if oldData != nil && current != string(oldData) {
+		klog.V(4).Infof("Skipping secret %s/%s: it does not hold the previous default credential", namespace, rotateSecretName)
+		return false, nil
+	}
+
+	updated := secret.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+	updated.Data[corev1.DockerConfigJsonKey] = newData
+
+	if _, err := kubeClient.CoreV1().Secrets(namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func init() {
+	rotateCmd.Flags().StringVar(&rotateDockerConfigJSONPath, "dockerconfigjson-file", "", "Path to the new dockerconfigjson")
+	rotateCmd.Flags().StringVar(&rotateSourceSecretRef, "source-secret-ref", "", "Source secret, as namespace/name, to update before the namespaces")
+	rotateCmd.Flags().StringVar(&rotateSourceSecretKey, "source-secret-key", corev1.DockerConfigJsonKey, "Key of the source secret holding the dockerconfigjson")
+	rotateCmd.Flags().StringVar(&rotateSecretName, "secret-name", os.Getenv("AURORA_SECRET_NAME"), "Name of the managed secret in each namespace")
+	rotateCmd.Flags().IntVar(&rotateBatchSize, "batch-size", 0, "Number of namespaces rotated between pauses; 0 rotates all at once")
+	rotateCmd.Flags().DurationVar(&rotateBatchPause, "batch-pause", 10*time.Second, "Pause between batches")
+
+	rootCmd.AddCommand(rotateCmd)
+}
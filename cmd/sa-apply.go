@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// defaultFieldManager is the default field manager of the service
+	// account writes of the controller.
+	defaultFieldManager = "aurora-controller"
+
+	// fieldManagerConflictRequeueDelay spaces out the applies of a service
+	// account whose imagePullSecrets are owned by another field manager.
+	fieldManagerConflictRequeueDelay = 5 * time.Minute
+)
+
+// applyImagePullSecrets sets the image pull secrets of the service account to
+// the references with a server-side apply. The apply configuration holds
+// imagePullSecrets and the injected label only, so that the controller owns
+// no other field, such as those set by GitOps tools. imagePullSecrets is an
+// atomic list on service accounts, so the apply owns the whole list and conflicts when
+// another field manager owns it. Without references the list is omitted,
+// which removes it when the controller is its only owner. Unless forceApply is
+// set, a conflict is left for a human to resolve: it is logged, recorded as a
+// Warning event and counted, and the service account is only retried after
+// fieldManagerConflictRequeueDelay. The injected label is part of the apply
+// when injected is set, and is otherwise removed with the list.
+func (r *imagePullSecretsReconciler) applyImagePullSecrets(serviceAccount *corev1.ServiceAccount, references []corev1.LocalObjectReference, injected bool) error {
+	configuration := corev1apply.ServiceAccount(serviceAccount.Name, serviceAccount.Namespace)
+	for _, reference := range references {
+		configuration.WithImagePullSecrets(corev1apply.LocalObjectReference().WithName(reference.Name))
+	}
+	if injected {
+		configuration.WithLabels(map[string]string{injectedLabel: injectedValue})
+	}
+
+	err := r.write(func(ctx context.Context) error {
+		_, err := r.kubeClient.CoreV1().ServiceAccounts(serviceAccount.Namespace).Apply(ctx, configuration, metav1.ApplyOptions{
+			FieldManager: r.fieldManager,
+			Force:        r.forceApply,
+		})
+		return err
+	})
+	if errors.IsConflict(err) {
+		klog.Warningf("not applying the image pull secrets of %s/%s, they are owned by another field manager: %v", serviceAccount.Namespace, serviceAccount.Name, err)
+		metrics.FieldManagerConflicts.WithLabelValues(serviceAccount.Namespace).Inc()
+		r.recorder.Eventf(serviceAccount, corev1.EventTypeWarning, "FieldManagerConflict", "imagePullSecrets are owned by another field manager and were not applied, resolve the conflict or pass --force-apply: %v", err)
+		return requeue.After(fieldManagerConflictRequeueDelay, "image pull secrets of %s/%s are owned by another field manager", serviceAccount.Namespace, serviceAccount.Name)
+	} else if err != nil {
+		return fmt.Errorf("applying service account %s/%s: %w", serviceAccount.Namespace, serviceAccount.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// conflictingClient is a clientset whose server-side applies of service
+// accounts conflict with another field manager owning imagePullSecrets
+// unless they are forced. The fake clientset supports neither applies nor
+// field managers.
+type conflictingClient struct {
+	*fake.Clientset
+
+	// applies records the options of each apply.
+	applies *[]metav1.ApplyOptions
+}
+
+var _ kubernetes.Interface = conflictingClient{}
+
+func (c conflictingClient) CoreV1() corev1client.CoreV1Interface {
+	return conflictingCoreV1{c.Clientset.CoreV1(), c}
+}
+
+type conflictingCoreV1 struct {
+	corev1client.CoreV1Interface
+	client conflictingClient
+}
+
+func (c conflictingCoreV1) ServiceAccounts(namespace string) corev1client.ServiceAccountInterface {
+	return conflictingServiceAccounts{c.CoreV1Interface.ServiceAccounts(namespace), c.client}
+}
+
+type conflictingServiceAccounts struct {
+	corev1client.ServiceAccountInterface
+	client conflictingClient
+}
+
+// Apply conflicts unless forced, and otherwise takes over imagePullSecrets
+// and merges the labels of the configuration.
+func (s conflictingServiceAccounts) Apply(ctx context.Context, configuration *corev1apply.ServiceAccountApplyConfiguration, options metav1.ApplyOptions) (*corev1.ServiceAccount, error) {
+	*s.client.applies = append(*s.client.applies, options)
+	if !options.Force {
+		return nil, errors.NewApplyConflict([]metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "gitops-agent"`,
+			Field:   ".imagePullSecrets",
+		}}, `Apply failed with 1 conflict: conflict with "gitops-agent": .imagePullSecrets`)
+	}
+
+	serviceAccount, err := s.Get(ctx, *configuration.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	serviceAccount.ImagePullSecrets = nil
+	for _, reference := range configuration.ImagePullSecrets {
+		serviceAccount.ImagePullSecrets = append(serviceAccount.ImagePullSecrets, corev1.LocalObjectReference{Name: *reference.Name})
+	}
+	for key, value := range configuration.Labels {
+		if serviceAccount.Labels == nil {
+			serviceAccount.Labels = map[string]string{}
+		}
+		serviceAccount.Labels[key] = value
+	}
+
+	return s.Update(ctx, serviceAccount, metav1.UpdateOptions{FieldManager: options.FieldManager})
+}
+
+func TestApplyImagePullSecretsFieldManagerConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		force bool
+	}{
+		{name: "backing off"},
+		{name: "forcing", force: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			force := tt.force
+			team := testNamespace("team", nil)
+			serviceAccount := testServiceAccount("team", "default", "gitops-managed")
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON), serviceAccount)
+			var applies []metav1.ApplyOptions
+			r.kubeClient = conflictingClient{kubeClient, &applies}
+			r.applyServiceAccounts = true
+			r.forceApply = force
+			r.fieldManager = defaultFieldManager
+			recorder := record.NewFakeRecorder(10)
+			r.recorder = recorder
+			metrics.FieldManagerConflicts.Reset()
+
+			err := r.syncServiceAccount(serviceAccount)
+
+			if want := []metav1.ApplyOptions{{FieldManager: defaultFieldManager, Force: force}}; !reflect.DeepEqual(applies, want) {
+				t.Errorf("applies = %+v, want %+v", applies, want)
+			}
+			updated, getErr := kubeClient.CoreV1().ServiceAccounts("team").Get(r.ctx, "default", metav1.GetOptions{})
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			var got []string
+			for _, imagePullSecret := range updated.ImagePullSecrets {
+				got = append(got, imagePullSecret.Name)
+			}
+			conflicts := testutil.ToFloat64(metrics.FieldManagerConflicts.WithLabelValues("team"))
+
+			if force {
+				if err != nil {
+					t.Errorf("syncServiceAccount() = %v, want nil", err)
+				}
+				if want := []string{"gitops-managed", testSecretName}; !reflect.DeepEqual(got, want) {
+					t.Errorf("image pull secrets = %v, want %v", got, want)
+				}
+				if conflicts != 0 {
+					t.Errorf("conflicts = %v, want 0", conflicts)
+				}
+				return
+			}
+
+			if delay, ok := requeue.Delay(err); !ok || delay != fieldManagerConflictRequeueDelay {
+				t.Errorf("syncServiceAccount() = %v, want a requeue after %s", err, fieldManagerConflictRequeueDelay)
+			}
+			if want := []string{"gitops-managed"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("image pull secrets = %v, want %v", got, want)
+			}
+			if conflicts != 1 {
+				t.Errorf("conflicts = %v, want 1", conflicts)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.HasPrefix(event, "Warning FieldManagerConflict ") {
+					t.Errorf("event = %q, want a FieldManagerConflict warning", event)
+				}
+			default:
+				t.Error("no event recorded for the conflict")
+			}
+		})
+	}
+}
+
+func TestApplyImagePullSecretsConfiguration(t *testing.T) {
+	tests := []struct {
+		name       string
+		references []corev1.LocalObjectReference
+		injected   bool
+		want       string
+	}{
+		{
+			name:       "injecting",
+			references: []corev1.LocalObjectReference{{Name: "keep"}, {Name: testSecretName}},
+			injected:   true,
+			want:       `{"kind":"ServiceAccount","apiVersion":"v1","metadata":{"name":"default","namespace":"team","labels":{"aurora.gccloudone/pull-secret-injected":"true"}},"imagePullSecrets":[{"name":"keep"},{"name":"aurora-pull"}]}`,
+		},
+		{
+			name: "removing",
+			want: `{"kind":"ServiceAccount","apiVersion":"v1","metadata":{"name":"default","namespace":"team"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every other field of the service account is left to its
+			// other field managers.
+			automount := false
+			serviceAccount := testServiceAccount("team", "default", "keep")
+			serviceAccount.AutomountServiceAccountToken = &automount
+			serviceAccount.Secrets = []corev1.ObjectReference{{Name: "default-token"}}
+			serviceAccount.Labels = map[string]string{"app.kubernetes.io/managed-by": "argocd"}
+			serviceAccount.Annotations = map[string]string{"argocd.argoproj.io/tracking-id": "team:/ServiceAccount:team/default"}
+			r, kubeClient := newTestReconciler(t, serviceAccount)
+
+			var patches []k8stesting.PatchAction
+			kubeClient.PrependReactor("patch", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patches = append(patches, action.(k8stesting.PatchAction))
+				return true, serviceAccount, nil
+			})
+
+			if err := r.applyImagePullSecrets(serviceAccount, tt.references, tt.injected); err != nil {
+				t.Fatalf("applyImagePullSecrets() = %v", err)
+			}
+
+			if len(patches) != 1 {
+				t.Fatalf("patches = %d, want 1", len(patches))
+			}
+			if got := patches[0].GetPatchType(); got != types.ApplyPatchType {
+				t.Errorf("patch type = %s, want %s", got, types.ApplyPatchType)
+			}
+			if got := string(patches[0].GetPatch()); got != tt.want {
+				t.Errorf("apply configuration = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Modes combining the selectors of a selector set.
+const (
+	selectorSetAny = "any"
+	selectorSetAll = "all"
+)
+
+// selectorSet matches labels against several label selectors, combined with
+// OR or AND, and then against exclusion selectors, any of which rejects them.
+// Unlike a single label selector, it can express conditions such as
+// "(team=platform OR tier=prod) AND NOT sandbox".
+type selectorSet struct {
+	selectors  []labels.Selector
+	matchAll   bool
+	exclusions []labels.Selector
+}
+
+// newSelectorSet parses the selectors and exclusions, combining the selectors
+// in the mode, any or all. It returns nil when both are empty.
+func newSelectorSet(selectors []string, mode string, exclusions []string) (*selectorSet, error) {
+	if mode != selectorSetAny && mode != selectorSetAll {
+		return nil, fmt.Errorf("unknown selector mode %q, expected %s or %s", mode, selectorSetAny, selectorSetAll)
+	}
+
+	if len(selectors) == 0 && len(exclusions) == 0 {
+		return nil, nil
+	}
+
+	s := &selectorSet{matchAll: mode == selectorSetAll}
+	for _, selector := range selectors {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("parsing selector %q: %w", selector, err)
+		}
+		s.selectors = append(s.selectors, parsed)
+	}
+	for _, exclusion := range exclusions {
+		parsed, err := labels.Parse(exclusion)
+		if err != nil {
+			return nil, fmt.Errorf("parsing exclusion %q: %w", exclusion, err)
+		}
+		s.exclusions = append(s.exclusions, parsed)
+	}
+
+	return s, nil
+}
+
+// Matches reports whether the labels match the selectors, any or all of them
+// depending on the mode, and no exclusion. Without selectors, only the
+// exclusions apply. A nil set matches everything.
+func (s *selectorSet) Matches(set labels.Labels) bool {
+	if s == nil {
+		return true
+	}
+
+	for _, exclusion := range s.exclusions {
+		if exclusion.Matches(set) {
+			return false
+		}
+	}
+
+	if len(s.selectors) == 0 {
+		return true
+	}
+
+	for _, selector := range s.selectors {
+		if selector.Matches(set) != s.matchAll {
+			// With OR, the first match decides; with AND, the first miss.
+			return !s.matchAll
+		}
+	}
+
+	return s.matchAll
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestSelectorSet(t *testing.T) {
+	namespaces := map[string]labels.Set{
+		"platform":         {"team": "platform"},
+		"prod":             {"tier": "prod"},
+		"platform-prod":    {"team": "platform", "tier": "prod"},
+		"platform-sandbox": {"team": "platform", "sandbox": "true"},
+		"other":            {"team": "other"},
+		"unlabelled":       nil,
+	}
+
+	tests := []struct {
+		name       string
+		selectors  []string
+		mode       string
+		exclusions []string
+		want       []string
+	}{
+		{name: "no selectors", mode: selectorSetAny, want: []string{"other", "platform", "platform-prod", "platform-sandbox", "prod", "unlabelled"}},
+		{name: "any", selectors: []string{"team=platform", "tier=prod"}, mode: selectorSetAny, want: []string{"platform", "platform-prod", "platform-sandbox", "prod"}},
+		{name: "all", selectors: []string{"team=platform", "tier=prod"}, mode: selectorSetAll, want: []string{"platform-prod"}},
+		{name: "any with exclusions", selectors: []string{"team=platform", "tier=prod"}, mode: selectorSetAny, exclusions: []string{"sandbox"}, want: []string{"platform", "platform-prod", "prod"}},
+		{name: "all with exclusions", selectors: []string{"team=platform"}, mode: selectorSetAll, exclusions: []string{"sandbox", "tier=prod"}, want: []string{"platform"}},
+		{name: "exclusions only", mode: selectorSetAll, exclusions: []string{"team"}, want: []string{"prod", "unlabelled"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSelectorSet(tt.selectors, tt.mode, tt.exclusions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, name := range []string{"other", "platform", "platform-prod", "platform-sandbox", "prod", "unlabelled"} {
+				if s.Matches(namespaces[name]) {
+					got = append(got, name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matching namespaces = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSelectorSetInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		selectors  []string
+		mode       string
+		exclusions []string
+	}{
+		{name: "unknown mode", selectors: []string{"team=platform"}, mode: "none"},
+		{name: "invalid selector", selectors: []string{"team=platform", "team in platform"}, mode: selectorSetAny},
+		{name: "invalid exclusion", mode: selectorSetAll, exclusions: []string{"sandbox in (true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSelectorSet(tt.selectors, tt.mode, tt.exclusions); err == nil {
+				t.Error("newSelectorSet() = nil error, want an error")
+			}
+		})
+	}
+}
+
+func TestSyncNamespaceSelectorSet(t *testing.T) {
+	platform := testNamespace("platform", map[string]string{"team": "platform"})
+	sandbox := testNamespace("sandbox", map[string]string{"team": "platform", "sandbox": "true"})
+	other := testNamespace("other", map[string]string{"team": "other"})
+	r, kubeClient := newTestReconciler(t, platform, sandbox, other)
+	selectors, err := newSelectorSet([]string{"team=platform", "tier=prod"}, selectorSetAny, []string{"sandbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.namespaceSelectors = selectors
+
+	for _, namespace := range []string{"platform", "sandbox", "other"} {
+		cached, err := r.namespaceLister.Get(namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.syncNamespace(cached); err != nil {
+			t.Fatalf("syncNamespace(%s) = %v", namespace, err)
+		}
+	}
+
+	for namespace, want := range map[string]bool{"platform": true, "sandbox": false, "other": false} {
+		if got := secretExists(t, kubeClient, namespace, testSecretName); got != want {
+			t.Errorf("secret provisioned in %s = %v, want %v", namespace, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// negatedOperators maps each label selector operator to its complement.
+var negatedOperators = map[selection.Operator]selection.Operator{
+	selection.Exists:       selection.DoesNotExist,
+	selection.DoesNotExist: selection.Exists,
+	selection.Equals:       selection.NotEquals,
+	selection.DoubleEquals: selection.NotEquals,
+	selection.NotEquals:    selection.Equals,
+	selection.In:           selection.NotIn,
+	selection.NotIn:        selection.In,
+}
+
+// negateSelector returns a selector matching exactly the objects that the
+// given selector does not match. This is only possible for selectors with a
+// single requirement, since the complement of several requirements is a
+// disjunction which label selectors cannot express.
+func negateSelector(selector labels.Selector) (labels.Selector, bool) {
+	requirements, selectable := selector.Requirements()
+	if !selectable || len(requirements) != 1 {
+		return nil, false
+	}
+
+	operator, ok := negatedOperators[requirements[0].Operator()]
+	if !ok {
+		return nil, false
+	}
+
+	requirement, err := labels.NewRequirement(requirements[0].Key(), operator, requirements[0].Values().List())
+	if err != nil {
+		return nil, false
+	}
+
+	return labels.NewSelector().Add(*requirement), true
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestNegateSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+		ok       bool
+	}{
+		{selector: "aurora.gccloudone/no-pull-secret", want: "!aurora.gccloudone/no-pull-secret", ok: true},
+		{selector: "!aurora.gccloudone/no-pull-secret", want: "aurora.gccloudone/no-pull-secret", ok: true},
+		{selector: "tier=system", want: "tier!=system", ok: true},
+		{selector: "tier!=system", want: "tier=system", ok: true},
+		{selector: "tier in (system,platform)", want: "tier notin (platform,system)", ok: true},
+		{selector: "tier notin (system)", want: "tier in (system)", ok: true},
+		{selector: "tier=system,team=ops"},
+		{selector: "replicas>1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := negateSelector(selector)
+			if ok != tt.ok {
+				t.Fatalf("negateSelector(%q) ok = %v, want %v", tt.selector, ok, tt.ok)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("negateSelector(%q) = %q, want %q", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
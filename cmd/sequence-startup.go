@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"k8s.io/klog"
+)
+
+// waitForNamespacesSweep blocks until the initial sweep of the namespaces
+// completes, so that the service accounts controller only starts once their
+// secrets are provisioned. It returns false when stopCh is closed first.
+func waitForNamespacesSweep(sweep *convergence.Sweep, stopCh <-chan struct{}) bool {
+	klog.Info("Waiting for the initial sweep of the namespaces before starting the service accounts")
+	select {
+	case <-sweep.Completed():
+	case <-stopCh:
+		return false
+	}
+
+	klog.Info("Initial sweep of the namespaces completed, starting the service accounts")
+	return true
+}
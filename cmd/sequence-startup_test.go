@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/namespaces"
+)
+
+func TestWaitForNamespacesSweep(t *testing.T) {
+	r, kubeClient := newTestReconciler(t, testNamespace("team", nil), testNamespace("ops", nil))
+	sweep := convergence.NewSweep("Namespaces")
+	controller := runNamespacesController(t, r, kubeClient, func(c *namespaces.Controller) {
+		c.SetSweep(sweep)
+	})
+
+	started := make(chan bool, 1)
+	go func() {
+		started <- waitForNamespacesSweep(sweep, r.ctx.Done())
+	}()
+
+	// The service accounts wait for the initial sweep, not only for the
+	// namespace events.
+	select {
+	case <-started:
+		t.Fatal("service accounts started before the initial sweep")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	controller.EnqueueAll()
+	select {
+	case ok := <-started:
+		if !ok {
+			t.Fatal("waitForNamespacesSweep() = false, want true")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("service accounts not started after the initial sweep")
+	}
+
+	// Once they start, the secret of every namespace is provisioned, so that
+	// no reference dangles.
+	for _, namespace := range []string{"team", "ops"} {
+		if !secretExists(t, kubeClient, namespace, testSecretName) {
+			t.Errorf("secret of %s not provisioned when the service accounts start", namespace)
+		}
+	}
+}
+
+func TestWaitForNamespacesSweepStopped(t *testing.T) {
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	if waitForNamespacesSweep(convergence.NewSweep("Namespaces"), stopCh) {
+		t.Error("waitForNamespacesSweep() = true without a sweep, want false once stopped")
+	}
+}
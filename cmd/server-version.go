@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog"
+)
+
+// checkServerVersion logs a warning when the API server is older than the
+// minimum supported version. It returns an error only when the versions
+// cannot be determined or parsed.
+func checkServerVersion(client discovery.ServerVersionInterface, minimum string) error {
+	minimumVersion, err := version.ParseGeneric(minimum)
+	if err != nil {
+		return fmt.Errorf("parsing minimum server version %q: %w", minimum, err)
+	}
+
+	info, err := client.ServerVersion()
+	if err != nil {
+		return fmt.Errorf("getting server version: %w", err)
+	}
+
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("parsing server version %q: %w", info.GitVersion, err)
+	}
+
+	if serverVersion.LessThan(minimumVersion) {
+		klog.Warningf("Kubernetes server version %s is older than the minimum supported version %s", serverVersion, minimumVersion)
+		return nil
+	}
+
+	klog.Infof("Kubernetes server version %s", serverVersion)
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/klog"
+)
+
+// captureLogs redirects the klog output to the returned buffer until the
+// test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	if err := flags.Set("logtostderr", "false"); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	klog.SetOutput(&logs)
+	t.Cleanup(func() {
+		klog.Flush()
+		if err := flags.Set("logtostderr", "true"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return &logs
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverVersion string
+		minimum       string
+		wantWarning   bool
+		wantErr       string
+	}{
+		{name: "newer", serverVersion: "v1.29.3", minimum: "1.24"},
+		{name: "same", serverVersion: "v1.24.0", minimum: "1.24"},
+		{name: "provider suffix", serverVersion: "v1.27.9-gke.1092000", minimum: "1.24"},
+		{name: "older", serverVersion: "v1.22.17", minimum: "1.24", wantWarning: true},
+		{name: "invalid minimum", serverVersion: "v1.29.3", minimum: "latest", wantErr: `parsing minimum server version "latest"`},
+		{name: "invalid server version", serverVersion: "unknown", minimum: "1.24", wantErr: `parsing server version "unknown"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			discovery := &fakediscovery.FakeDiscovery{
+				Fake:               &k8stesting.Fake{},
+				FakedServerVersion: &version.Info{GitVersion: tt.serverVersion},
+			}
+
+			err := checkServerVersion(discovery, tt.minimum)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("checkServerVersion = %v, want an error starting with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkServerVersion = %v", err)
+			}
+
+			klog.Flush()
+			if warned := strings.Contains(logs.String(), "older than the minimum supported version"); warned != tt.wantWarning {
+				t.Errorf("warned = %v, want %v, logs:\n%s", warned, tt.wantWarning, logs)
+			}
+		})
+	}
+}
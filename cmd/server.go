@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/signals"
+	"k8s.io/klog"
+)
+
+// serveMetrics serves the metrics endpoint on addr until stopCh is closed.
+func serveMetrics(addr string, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	serve("metrics", addr, mux, stopCh)
+}
+
+// serveHealth serves the liveness and readiness probes on addr until stopCh is
+// closed. /readyz succeeds once ready returns true. With enableShutdown, a
+// POST to /quit shuts the controllers down as SIGTERM would. The status API is
+// served from the statuses when they are set.
+func serveHealth(addr string, ready func() bool, enableShutdown bool, namespacesStatus, serviceAccountsStatus *convergence.Status, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			http.Error(w, "informer caches are not synced", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok"))
+	})
+
+	if enableShutdown {
+		mux.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			klog.Infof("Shutdown requested by %s", r.RemoteAddr)
+			w.WriteHeader(http.StatusAccepted)
+			signals.RequestShutdown()
+		})
+	}
+
+	if namespacesStatus != nil {
+		registerStatusAPI(mux, namespacesStatus, serviceAccountsStatus)
+	}
+
+	serve("health", addr, mux, stopCh)
+}
+
+// serve serves handler on addr until stopCh is closed.
+func serve(name, addr string, handler http.Handler, stopCh <-chan struct{}) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-stopCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("error shutting down %s server: %v", name, err)
+		}
+	}()
+
+	klog.Infof("Serving %s on %s", name, addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.Fatalf("error serving %s: %v", name, err)
+	}
+}
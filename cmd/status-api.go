@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"k8s.io/klog"
+)
+
+// namespaceStatus is the reconcile status of a namespace served by the status
+// API. A namespace is compliant when its last sync, and the last sync of each
+// of its service accounts, succeeded.
+type namespaceStatus struct {
+	Name      string              `json:"name"`
+	Compliant bool                `json:"compliant"`
+	Sync      *convergence.Result `json:"sync,omitempty"`
+
+	// ServiceAccounts counts the service accounts of the namespace by the
+	// outcome of their last sync, and NoncompliantServiceAccounts names
+	// the ones that did not succeed.
+	ServiceAccounts             map[string]int `json:"serviceAccounts"`
+	NoncompliantServiceAccounts []string       `json:"noncompliantServiceAccounts,omitempty"`
+}
+
+// recordStatus records the outcome of a sync of the key in the status. A
+// read-only sync that stopped at a write is recorded as drifted.
+func recordStatus(status *convergence.Status, key string, err error) {
+	outcome := convergence.Outcome(err)
+	if errors.Is(err, errReadOnly) {
+		outcome = convergence.OutcomeDrifted
+	}
+
+	status.Record(key, outcome, err)
+}
+
+// namespaceStatuses returns the status of every namespace with a recorded
+// sync, or with a service account with one, sorted by name.
+func namespaceStatuses(namespaces, serviceAccounts *convergence.Status) []namespaceStatus {
+	statuses := map[string]*namespaceStatus{}
+	get := func(name string) *namespaceStatus {
+		status, ok := statuses[name]
+		if !ok {
+			status = &namespaceStatus{Name: name, ServiceAccounts: map[string]int{}}
+			statuses[name] = status
+		}
+		return status
+	}
+
+	for name, result := range namespaces.Results() {
+		result := result
+		get(name).Sync = &result
+	}
+	for key, result := range serviceAccounts.Results() {
+		namespace, name, _ := strings.Cut(key, "/")
+		status := get(namespace)
+		status.ServiceAccounts[result.Outcome]++
+		if result.Outcome != convergence.OutcomeSucceeded {
+			status.NoncompliantServiceAccounts = append(status.NoncompliantServiceAccounts, name)
+		}
+	}
+
+	list := make([]namespaceStatus, 0, len(statuses))
+	for _, status := range statuses {
+		status.Compliant = status.Sync != nil && status.Sync.Outcome == convergence.OutcomeSucceeded &&
+			len(status.NoncompliantServiceAccounts) == 0
+		sort.Strings(status.NoncompliantServiceAccounts)
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// registerStatusAPI registers the read-only status API on the mux. It serves
+// the live state of the controllers from memory and never calls the API
+// server:
+//
+//	GET /status/namespaces         every namespace
+//	GET /status/namespaces/{name}  a single namespace, or 404
+func registerStatusAPI(mux *http.ServeMux, namespaces, serviceAccounts *convergence.Status) {
+	mux.HandleFunc("GET /status/namespaces", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"namespaces": namespaceStatuses(namespaces, serviceAccounts)})
+	})
+	mux.HandleFunc("GET /status/namespaces/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		for _, status := range namespaceStatuses(namespaces, serviceAccounts) {
+			if status.Name == name {
+				writeJSON(w, status)
+				return
+			}
+		}
+
+		http.Error(w, "no status recorded for namespace "+name, http.StatusNotFound)
+	})
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("error writing status response: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+)
+
+func TestStatusAPI(t *testing.T) {
+	namespaces, serviceAccounts := convergence.NewStatus(), convergence.NewStatus()
+	recordStatus(namespaces, "team", nil)
+	recordStatus(serviceAccounts, "team/default", nil)
+	recordStatus(serviceAccounts, "team/builder", errors.New("forbidden"))
+	recordStatus(namespaces, "paused", requeue.After(time.Hour, "namespace paused is paused"))
+	recordStatus(namespaces, "audited", fmt.Errorf("creating secret audited/%s: %w", testSecretName, errReadOnly))
+	recordStatus(namespaces, "ops", nil)
+	recordStatus(serviceAccounts, "ops/default", nil)
+	// Service accounts synced before their namespace.
+	recordStatus(serviceAccounts, "new/default", nil)
+
+	mux := http.NewServeMux()
+	registerStatusAPI(mux, namespaces, serviceAccounts)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	get := func(t *testing.T, path string, wantCode int, v interface{}) {
+		t.Helper()
+
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != wantCode {
+			t.Fatalf("GET %s = %d, want %d", path, response.StatusCode, wantCode)
+		}
+		if v == nil {
+			return
+		}
+		if got := response.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("GET %s content type = %q, want application/json", path, got)
+		}
+		if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+			t.Fatalf("decoding GET %s: %v", path, err)
+		}
+	}
+	// summary drops the sync times and errors, which are checked apart.
+	summary := func(status namespaceStatus) namespaceStatus {
+		if status.Sync != nil {
+			if status.Sync.Time.IsZero() {
+				t.Errorf("namespace %s has no sync time", status.Name)
+			}
+			status.Sync = &convergence.Result{Outcome: status.Sync.Outcome}
+		}
+		return status
+	}
+
+	var list struct {
+		Namespaces []namespaceStatus `json:"namespaces"`
+	}
+	get(t, "/status/namespaces", http.StatusOK, &list)
+	want := []namespaceStatus{
+		{Name: "audited", Sync: &convergence.Result{Outcome: convergence.OutcomeDrifted}, ServiceAccounts: map[string]int{}},
+		{Name: "new", ServiceAccounts: map[string]int{convergence.OutcomeSucceeded: 1}},
+		{Name: "ops", Compliant: true, Sync: &convergence.Result{Outcome: convergence.OutcomeSucceeded}, ServiceAccounts: map[string]int{convergence.OutcomeSucceeded: 1}},
+		{Name: "paused", Sync: &convergence.Result{Outcome: convergence.OutcomeDeferred}, ServiceAccounts: map[string]int{}},
+		{
+			Name:                        "team",
+			Sync:                        &convergence.Result{Outcome: convergence.OutcomeSucceeded},
+			ServiceAccounts:             map[string]int{convergence.OutcomeSucceeded: 1, convergence.OutcomeFailed: 1},
+			NoncompliantServiceAccounts: []string{"builder"},
+		},
+	}
+	var got []namespaceStatus
+	for _, status := range list.Namespaces {
+		got = append(got, summary(status))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /status/namespaces = %+v, want %+v", got, want)
+	}
+
+	var team namespaceStatus
+	get(t, "/status/namespaces/team", http.StatusOK, &team)
+	if !reflect.DeepEqual(summary(team), want[4]) {
+		t.Errorf("GET /status/namespaces/team = %+v, want %+v", team, want[4])
+	}
+
+	var audited namespaceStatus
+	get(t, "/status/namespaces/audited", http.StatusOK, &audited)
+	if audited.Sync == nil || audited.Sync.Error == "" {
+		t.Errorf("GET /status/namespaces/audited has no sync error: %+v", audited.Sync)
+	}
+
+	get(t, "/status/namespaces/missing", http.StatusNotFound, nil)
+
+	// The API is read-only.
+	response, err := http.Post(server.URL+"/status/namespaces", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status/namespaces = %d, want %d", response.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// updateDebouncer spaces out the updates of each secret by a minimum interval,
+// so that a flapping credential source does not rewrite every secret on each
+// flap. Only successful updates are recorded, so failures are retried as usual.
+type updateDebouncer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newUpdateDebouncer(interval time.Duration) *updateDebouncer {
+	if interval <= 0 {
+		return nil
+	}
+
+	return &updateDebouncer{
+		interval: interval,
+		last:     map[string]time.Time{},
+	}
+}
+
+// wait returns how long to wait before the secret may be updated again. A nil
+// debouncer never waits.
+func (d *updateDebouncer) wait(namespace, name string) time.Duration {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last, ok := d.last[namespace+"/"+name]
+	if !ok {
+		return 0
+	}
+
+	return d.interval - time.Since(last)
+}
+
+// updated records a successful update of the secret.
+func (d *updateDebouncer) updated(namespace, name string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.last[namespace+"/"+name] = time.Now()
+}
+
+// forget drops the records of the secrets of a deleted namespace.
+func (d *updateDebouncer) forget(namespace string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.last {
+		if strings.HasPrefix(key, namespace+"/") {
+			delete(d.last, key)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/credentials"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestUpdateDebounceFlappingSource(t *testing.T) {
+	const flapped = `{"auths":{"registry.example.com":{"auth":"ZmxhcDpwYXNz"}}}`
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// failFirst makes the first update fail.
+		failFirst  bool
+		wantWrites int
+	}{
+		{name: "no debounce", wantWrites: 4},
+		{name: "debounced", interval: time.Hour, wantWrites: 1},
+		{name: "failed update not debounced", interval: time.Hour, failFirst: true, wantWrites: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			team := testNamespace("team", nil)
+			r, kubeClient := newTestReconciler(t, team, testSecret(team, testSecretName, testDockerConfigJSON))
+			r.updateDebouncer = newUpdateDebouncer(tt.interval)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			r.secretsLister = corev1listers.NewSecretLister(indexer)
+			if tt.failFirst {
+				failed := false
+				kubeClient.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if failed {
+						return false, nil, nil
+					}
+					failed = true
+					return true, nil, errors.NewServiceUnavailable("unavailable")
+				})
+			}
+
+			// The source flaps between two credentials, and each flap is
+			// reconciled against the live secret.
+			for i, dockerConfigJSON := range []string{flapped, testDockerConfigJSON, flapped, testDockerConfigJSON} {
+				r.credentials = credentials.NewCache(credentials.Static(dockerConfigJSON), 0)
+				if _, err := r.credentials.Refresh(r.ctx); err != nil {
+					t.Fatal(err)
+				}
+				if err := indexer.Update(getSecret(t, kubeClient, "team", testSecretName)); err != nil {
+					t.Fatal(err)
+				}
+
+				err := r.reconcileSecrets(team)
+				switch {
+				case tt.failFirst && i == 0:
+					if err == nil || requeue.IsRequested(err) {
+						t.Errorf("flap %d: reconcileSecrets() = %v, want the update failure", i, err)
+					}
+				case err != nil && !requeue.IsRequested(err):
+					t.Errorf("flap %d: reconcileSecrets() = %v, want nil or a requeue", i, err)
+				}
+			}
+
+			writes := writeActions(kubeClient)
+			if len(writes) != tt.wantWrites {
+				t.Errorf("writes = %v, want %d", writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestUpdateDebouncer(t *testing.T) {
+	if d := newUpdateDebouncer(0); d != nil || d.wait("team", testSecretName) != 0 {
+		t.Fatalf("newUpdateDebouncer(0) = %v, want a nil debouncer that never waits", d)
+	}
+
+	d := newUpdateDebouncer(time.Hour)
+	d.updated("team", testSecretName)
+	d.updated("other", testSecretName)
+	if wait := d.wait("team", testSecretName); wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("wait after an update = %s, want about an hour", wait)
+	}
+	if wait := d.wait("team", "other-pull"); wait != 0 {
+		t.Errorf("wait of another secret = %s, want 0", wait)
+	}
+
+	d.forget("team")
+	if wait := d.wait("team", testSecretName); wait != 0 {
+		t.Errorf("wait after the namespace was forgotten = %s, want 0", wait)
+	}
+	if wait := d.wait("other", testSecretName); wait == 0 {
+		t.Error("forgetting a namespace dropped the records of another")
+	}
+}
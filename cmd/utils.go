@@ -2,11 +2,29 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubectl/pkg/scheme"
 )
 
+// newInformerFactory returns a shared informer factory resyncing its
+// informers every resync, 0 disabling resyncs, whose lists and watches are
+// narrowed by tweak unless it is nil.
+func newInformerFactory(kubeClient kubernetes.Interface, resync time.Duration, tweak func(*metav1.ListOptions)) kubeinformers.SharedInformerFactory {
+	if tweak == nil {
+		return kubeinformers.NewSharedInformerFactory(kubeClient, resync)
+	}
+
+	return kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resync, kubeinformers.WithTweakListOptions(tweak))
+}
+
 // addTypeInformationToObject adds TypeMeta information to a runtime.Object based upon the loaded scheme.Scheme
 // inspired by: https://github.com/kubernetes/cli-runtime/blob/v0.19.2/pkg/printers/typesetter.go#L41
 //
@@ -30,3 +48,25 @@ func addTypeInformationToObject(obj runtime.Object) error {
 
 	return nil
 }
+
+// parseResourceList parses a comma-separated list of name=quantity pairs,
+// such as pods=100,requests.cpu=10, into a ResourceList.
+func parseResourceList(value string) (corev1.ResourceList, error) {
+	resources := corev1.ResourceList{}
+
+	for _, pair := range strings.Split(value, ",") {
+		name, quantity, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=quantity but got %q", pair)
+		}
+
+		parsed, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity for %s: %w", name, err)
+		}
+
+		resources[corev1.ResourceName(name)] = parsed
+	}
+
+	return resources, nil
+}
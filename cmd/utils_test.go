@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNewInformerFactory(t *testing.T) {
+	selectTeam := func(options *metav1.ListOptions) { options.LabelSelector = "team=true" }
+
+	tests := []struct {
+		name   string
+		resync time.Duration
+		tweak  func(*metav1.ListOptions)
+		cached int
+	}{
+		// The shared informers resync at most every second.
+		{name: "resync", resync: time.Second, cached: 2},
+		{name: "resync disabled", cached: 2},
+		{name: "tweaked", resync: time.Second, tweak: selectTeam, cached: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			kubeClient := fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"team": "true"}}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "system"}},
+			)
+			factory := newInformerFactory(kubeClient, tt.resync, tt.tweak)
+			informer := factory.Core().V1().Namespaces().Informer()
+
+			// No namespace changes, so every update is a resync.
+			var resyncs atomic.Int32
+			if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+				UpdateFunc: func(old, new interface{}) { resyncs.Add(1) },
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			factory.Start(ctx.Done())
+			for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+				if !synced {
+					t.Fatalf("cache of %v not synced", informer)
+				}
+			}
+
+			if cached := len(informer.GetStore().List()); cached != tt.cached {
+				t.Errorf("cached %d namespaces, want %d", cached, tt.cached)
+			}
+
+			time.Sleep(2500 * time.Millisecond)
+			if got := resyncs.Load(); (got > 0) != (tt.resync > 0) {
+				t.Errorf("resyncs = %d with a resync period of %s", got, tt.resync)
+			}
+			if tt.resync > 0 {
+				// Each resync delivers every cached namespace.
+				if got, max := int(resyncs.Load()), 3*tt.cached; got > max {
+					t.Errorf("resyncs = %d in 2.5s, want at most %d every %s", got, max, tt.resync)
+				}
+			}
+		})
+	}
+}
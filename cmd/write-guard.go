@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"k8s.io/klog"
+)
+
+// massChangeGuard halts every write once more than max writes were issued
+// within one window, typically the namespace resync period of a full sweep,
+// protecting the cluster from a misconfiguration, such as a selector typo,
+// that makes the controller mutate everything. Once tripped, it stays tripped
+// until the controller is restarted, and the syncs stopped at a write are
+// requeued once per window rather than failing.
+type massChangeGuard struct {
+	max    int
+	window time.Duration
+
+	// confirmed only warns when the cap is exceeded.
+	confirmed bool
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+	tripped     bool
+	warned      bool
+}
+
+// allow counts a write and returns a requeue error if writes are halted. A
+// nil guard allows every write.
+func (g *massChangeGuard) allow() error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.tripped {
+		return g.halted()
+	}
+
+	now := time.Now()
+	if now.Sub(g.windowStart) >= g.window {
+		g.windowStart = now
+		g.count = 0
+		g.warned = false
+	}
+
+	g.count++
+	if g.count <= g.max {
+		return nil
+	}
+
+	if g.confirmed {
+		if !g.warned {
+			klog.Warningf("more than %d writes within %s, proceeding because of --confirm-mass-change", g.max, g.window)
+			g.warned = true
+		}
+
+		return nil
+	}
+
+	g.tripped = true
+	metrics.MassChangeGuardTripped.Set(1)
+	klog.Errorf("MASS CHANGE GUARD TRIPPED: more than %d writes within %s. All writes are halted to protect the cluster from a misconfiguration. Check the selectors and credential sources, then restart with --confirm-mass-change if the change is intended.", g.max, g.window)
+
+	return g.halted()
+}
+
+// halted returns the requeue error of a write stopped by the tripped guard.
+func (g *massChangeGuard) halted() error {
+	return requeue.After(g.window, "writes are halted: more than %d writes within %s, restart with --confirm-mass-change to proceed", g.max, g.window)
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/hooks"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestMassChangeGuard(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirmed bool
+		writes    int
+		allowed   int
+	}{
+		{name: "below the cap", writes: 3, allowed: 3},
+		{name: "cap exceeded", writes: 6, allowed: 3},
+		{name: "cap exceeded with confirmation", confirmed: true, writes: 6, allowed: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.MassChangeGuardTripped.Set(0)
+			g := &massChangeGuard{max: 3, window: time.Hour, confirmed: tt.confirmed}
+
+			allowed := 0
+			for i := 0; i < tt.writes; i++ {
+				err := g.allow()
+				if err == nil {
+					allowed++
+					continue
+				}
+
+				if after, ok := requeue.Delay(err); !requeue.IsRequested(err) || !ok || after != time.Hour {
+					t.Fatalf("write %d: allow() = %v, want a requeue after the window", i, err)
+				}
+			}
+
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d writes, want %d", allowed, tt.allowed)
+			}
+			wantTripped := 0.0
+			if tt.allowed < tt.writes {
+				wantTripped = 1
+			}
+			if got := testutil.ToFloat64(metrics.MassChangeGuardTripped); got != wantTripped {
+				t.Errorf("tripped gauge = %v, want %v", got, wantTripped)
+			}
+		})
+	}
+}
+
+func TestMassChangeGuardWindow(t *testing.T) {
+	g := &massChangeGuard{max: 2, window: 50 * time.Millisecond}
+	for i := 0; i < 2; i++ {
+		if err := g.allow(); err != nil {
+			t.Fatalf("allow() = %v", err)
+		}
+	}
+
+	// The count starts over with each window.
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := g.allow(); err != nil {
+			t.Fatalf("allow() in the next window = %v", err)
+		}
+	}
+
+	if err := g.allow(); err == nil {
+		t.Fatal("allow() past the cap = nil")
+	}
+	// Once tripped, the guard halts writes in every later window.
+	time.Sleep(60 * time.Millisecond)
+	if err := g.allow(); err == nil {
+		t.Fatal("allow() once tripped = nil")
+	}
+}
+
+func TestMassChangeGuardTripsSweep(t *testing.T) {
+	var objects []runtime.Object
+	var namespaces []*corev1.Namespace
+	for i := 0; i < 5; i++ {
+		namespace := testNamespace(fmt.Sprintf("team-%d", i), nil)
+		namespaces = append(namespaces, namespace)
+		objects = append(objects, namespace)
+	}
+	r, kubeClient := newTestReconciler(t, objects...)
+	r.writeGuard = &massChangeGuard{max: 3, window: time.Hour}
+
+	var hookErrors []string
+	r.hooks.Add(hooks.Funcs{Error: func(kind, namespace, name string, err error) {
+		hookErrors = append(hookErrors, namespace)
+	}})
+
+	deferred := 0
+	for _, namespace := range namespaces {
+		if err := r.syncNamespaceAndNotify(namespace); requeue.IsRequested(err) {
+			deferred++
+		} else if err != nil {
+			t.Errorf("sync of namespace %s = %v, want nil or a requeue", namespace.Name, err)
+		}
+	}
+
+	if writes := writeActions(kubeClient); len(writes) != 3 {
+		t.Errorf("writes = %v, want 3", writes)
+	}
+	if deferred != 2 {
+		t.Errorf("%d syncs deferred, want 2", deferred)
+	}
+	if len(hookErrors) > 0 {
+		t.Errorf("error hooks called for %v, want none", hookErrors)
+	}
+}
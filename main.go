@@ -1,9 +1,13 @@
 package main
 
 import (
+	"os"
+
 	"github.com/gccloudone-aurora/aurora-controller/cmd"
 )
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
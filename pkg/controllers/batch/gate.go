@@ -0,0 +1,97 @@
+// Package batch paces the initial sweep of a controller, so that a cold start
+// against a large cluster does not process every key at once.
+package batch
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Gate lets the keys of the initial sweep through in batches, pausing between
+// consecutive batches, and every later key through at once. It is safe for
+// concurrent use, and a nil Gate never pauses.
+type Gate struct {
+	name  string
+	size  int
+	delay time.Duration
+
+	mu        sync.Mutex
+	total     int
+	processed int
+	// resume is when the batch of the last key let through may start.
+	resume time.Time
+}
+
+// NewGate returns a Gate letting batches of size keys through, pausing for
+// delay between them. It returns nil if size is not positive.
+func NewGate(name string, size int, delay time.Duration) *Gate {
+	if size <= 0 {
+		return nil
+	}
+
+	return &Gate{
+		name:  name,
+		size:  size,
+		delay: delay,
+	}
+}
+
+// Start begins the initial sweep of total keys.
+func (g *Gate) Start(total int) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.total = total
+	g.processed = 0
+	g.resume = time.Time{}
+	if total > 0 {
+		klog.Infof("Initial sweep of %s: processing %d keys in batches of %d", g.name, total, g.size)
+	}
+}
+
+// Wait is called before each key is processed. It pauses once a batch of the
+// initial sweep has been let through, until the delay has passed. Each key of
+// the next batch takes its place in it before pausing, so the workers pause
+// together without holding the lock, and the keys of a batch are let through
+// in the order Wait was called.
+func (g *Gate) Wait() {
+	if g == nil {
+		return
+	}
+
+	time.Sleep(g.reserve())
+}
+
+// reserve lets the key through in the current batch, or starts the next one,
+// and returns how long the key must wait for its batch.
+func (g *Gate) reserve() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.processed >= g.total {
+		return 0
+	}
+
+	// The key completes the previous batch.
+	if g.processed > 0 && g.processed%g.size == 0 {
+		klog.Infof("Initial sweep of %s: batch %d let through, %d/%d keys, pausing for %s", g.name, g.processed/g.size, g.processed, g.total, g.delay)
+		start := time.Now()
+		if g.resume.After(start) {
+			start = g.resume
+		}
+		g.resume = start.Add(g.delay)
+	}
+
+	g.processed++
+	if g.processed == g.total {
+		klog.Infof("Initial sweep of %s: all %d keys let through, back to steady state", g.name, g.total)
+	}
+
+	return time.Until(g.resume)
+}
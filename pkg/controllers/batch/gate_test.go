@@ -0,0 +1,111 @@
+package batch
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGateBatches(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		size    int
+		total   int
+		workers int
+		pauses  int
+	}{
+		{name: "single batch", size: 10, total: 10, workers: 1},
+		{name: "partial last batch", size: 4, total: 10, workers: 1, pauses: 2},
+		{name: "large sweep", size: 100, total: 1000, workers: 8, pauses: 9},
+		{name: "more workers than keys per batch", size: 2, total: 7, workers: 5, pauses: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGate(tt.name, tt.size, delay)
+			g.Start(tt.total)
+
+			var (
+				mu      sync.Mutex
+				through []time.Time
+			)
+			keys := make(chan int, tt.total)
+			for key := 0; key < tt.total; key++ {
+				keys <- key
+			}
+			close(keys)
+
+			start := time.Now()
+			var workers sync.WaitGroup
+			for i := 0; i < tt.workers; i++ {
+				workers.Add(1)
+				go func() {
+					defer workers.Done()
+					for range keys {
+						g.Wait()
+						mu.Lock()
+						through = append(through, time.Now())
+						mu.Unlock()
+					}
+				}()
+			}
+			workers.Wait()
+
+			if len(through) != tt.total {
+				t.Fatalf("let through %d keys, want %d", len(through), tt.total)
+			}
+			// The n-th key is let through once the pauses of the batches
+			// before its own have passed.
+			for n, at := range through {
+				batch := n / tt.size
+				if elapsed := at.Sub(start); elapsed < time.Duration(batch)*delay {
+					t.Errorf("key %d of batch %d let through after %s, want at least %s", n, batch, elapsed, time.Duration(batch)*delay)
+				}
+			}
+			if elapsed, want := time.Since(start), time.Duration(tt.pauses)*delay; elapsed < want || elapsed > want+time.Second {
+				t.Errorf("sweep took %s, want %s", elapsed, want)
+			}
+
+			// Keys after the sweep are let through at once.
+			before := time.Now()
+			g.Wait()
+			if waited := time.Since(before); waited >= delay {
+				t.Errorf("key after the sweep waited %s", waited)
+			}
+		})
+	}
+}
+
+func TestGatePauseDoesNotBlock(t *testing.T) {
+	g := NewGate("test", 2, time.Hour)
+	g.Start(3)
+	g.Wait()
+	g.Wait()
+
+	// The last key of the sweep pauses for the next batch.
+	go g.Wait()
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Wait()
+		g.Start(0)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a key after the sweep waited for the pause of the last batch")
+	}
+}
+
+func TestNilGate(t *testing.T) {
+	g := NewGate("test", 0, time.Hour)
+	if g != nil {
+		t.Fatalf("NewGate() with a size of 0 = %v, want nil", g)
+	}
+	g.Start(10)
+	g.Wait()
+}
@@ -0,0 +1,90 @@
+// Package cachemiss tells the keys of deleted objects apart from the keys
+// missing from an informer cache that has not caught up yet.
+package cachemiss
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// Tracker records the deletes observed by an informer. A key missing from
+// the cache whose delete was observed is gone, and needs nothing more. Any
+// other missing key, such as one enqueued by name for an object the informer
+// has not delivered yet, is retried a few times before being considered gone.
+// It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	retries int
+	delay   time.Duration
+	deleted sets.Set[string]
+	misses  map[string]int
+}
+
+// NewTracker returns a Tracker that never retries.
+func NewTracker() *Tracker {
+	return &Tracker{
+		deleted: sets.New[string](),
+		misses:  map[string]int{},
+	}
+}
+
+// SetRetries retries the keys missing from the cache, but not observed
+// deleted, up to retries times, delay apart.
+func (t *Tracker) SetRetries(retries int, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.retries = retries
+	t.delay = delay
+}
+
+// Deleted records that the informer observed the delete of the key. The key
+// must be processed afterwards, so that the record is released.
+func (t *Tracker) Deleted(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deleted.Insert(key)
+	delete(t.misses, key)
+}
+
+// Found releases the records of a key found in the cache.
+func (t *Tracker) Found(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.deleted.Delete(key)
+	delete(t.misses, key)
+}
+
+// Missing is called when the key is not in the cache. It returns a requeue
+// error while the cache may still be catching up, or nil once the object is
+// considered gone.
+func (t *Tracker) Missing(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.deleted.Has(key) {
+		t.deleted.Delete(key)
+		klog.V(4).Infof("'%s' in work queue was deleted", key)
+		return nil
+	}
+
+	if t.misses[key] < t.retries {
+		t.misses[key]++
+		return requeue.After(t.delay, "'%s' is not in the cache yet, retry %d of %d", key, t.misses[key], t.retries)
+	}
+
+	if t.retries > 0 {
+		klog.V(2).Infof("'%s' in work queue is still not in the cache after %d retries, assuming it no longer exists", key, t.retries)
+		delete(t.misses, key)
+	} else {
+		klog.V(4).Infof("'%s' in work queue no longer exists", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package cachemiss
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+)
+
+func TestTrackerMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		// deleted records the delete of the key before it is processed.
+		deleted bool
+		// found finds the key in the cache after the first miss.
+		found bool
+		// want is whether each call to Missing asks for a requeue.
+		want []bool
+	}{
+		{name: "deleted", retries: 2, deleted: true, want: []bool{false}},
+		{name: "not cached yet", retries: 2, want: []bool{true, true, false, true}},
+		{name: "no retries", want: []bool{false, false}},
+		{name: "found after a miss", retries: 1, found: true, want: []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker()
+			tracker.SetRetries(tt.retries, time.Second)
+			if tt.deleted {
+				tracker.Deleted("team")
+			}
+
+			for i, want := range tt.want {
+				err := tracker.Missing("team")
+				if requeued := requeue.IsRequested(err); requeued != want {
+					t.Errorf("miss %d: Missing() = %v, want a requeue: %v", i, err, want)
+				}
+				if after, _ := requeue.Delay(err); err != nil && after != time.Second {
+					t.Errorf("miss %d: requeued after %s, want 1s", i, after)
+				}
+				if tt.found && i == 0 {
+					tracker.Found("team")
+				}
+			}
+		})
+	}
+}
+
+func TestTrackerDeletedOnce(t *testing.T) {
+	tracker := NewTracker()
+	tracker.SetRetries(1, time.Second)
+	tracker.Deleted("team")
+
+	if err := tracker.Missing("team"); err != nil {
+		t.Fatalf("Missing() after the delete = %v, want nil", err)
+	}
+	// The record is released once processed, so a later miss of a new
+	// object with the same key is retried.
+	if err := tracker.Missing("team"); !requeue.IsRequested(err) {
+		t.Errorf("Missing() after the delete was processed = %v, want a requeue", err)
+	}
+}
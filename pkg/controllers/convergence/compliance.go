@@ -0,0 +1,73 @@
+package convergence
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+)
+
+// Compliance holds whether the last observation of each key found it in the
+// desired state. It is safe for concurrent use, and a nil Compliance records
+// nothing.
+type Compliance struct {
+	name string
+
+	mu        sync.Mutex
+	compliant map[string]bool
+}
+
+// NewCompliance returns a Compliance reporting to the compliant and
+// noncompliant objects metrics of the named controller.
+func NewCompliance(name string) *Compliance {
+	metrics.CompliantObjects.WithLabelValues(name).Set(0)
+	metrics.NoncompliantObjects.WithLabelValues(name).Set(0)
+
+	return &Compliance{
+		name:      name,
+		compliant: map[string]bool{},
+	}
+}
+
+// Observe records whether the key is in the desired state.
+func (c *Compliance) Observe(key string, compliant bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.compliant[key] = compliant
+	c.update()
+}
+
+// ForgetNamespace drops the keys of a deleted namespace: the namespace itself
+// and the namespace/name keys of the objects it held.
+func (c *Compliance) ForgetNamespace(namespace string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.compliant {
+		if key == namespace || strings.HasPrefix(key, namespace+"/") {
+			delete(c.compliant, key)
+		}
+	}
+	c.update()
+}
+
+func (c *Compliance) update() {
+	compliant := 0
+	for _, ok := range c.compliant {
+		if ok {
+			compliant++
+		}
+	}
+
+	metrics.CompliantObjects.WithLabelValues(c.name).Set(float64(compliant))
+	metrics.NoncompliantObjects.WithLabelValues(c.name).Set(float64(len(c.compliant) - compliant))
+}
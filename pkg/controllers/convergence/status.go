@@ -0,0 +1,98 @@
+package convergence
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+)
+
+// OutcomeDrifted is the outcome of a read-only sync that stopped at a write.
+const OutcomeDrifted = "drifted"
+
+// Outcome classifies the error returned by a sync as one of the sweep
+// outcomes.
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSucceeded
+	case requeue.IsRequested(err):
+		return OutcomeDeferred
+	default:
+		return OutcomeFailed
+	}
+}
+
+// Result is the outcome of the last sync of a key.
+type Result struct {
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"lastSync"`
+}
+
+// Status holds the result of the last sync of each key, so that the live
+// state of a controller can be queried. It is safe for concurrent use, and a
+// nil Status records nothing.
+type Status struct {
+	mu      sync.Mutex
+	results map[string]Result
+}
+
+// NewStatus returns an empty Status.
+func NewStatus() *Status {
+	return &Status{results: map[string]Result{}}
+}
+
+// Record records the outcome of a sync of the key, and the error it returned,
+// if any.
+func (s *Status) Record(key, outcome string, err error) {
+	if s == nil {
+		return
+	}
+
+	result := Result{Outcome: outcome, Time: time.Now()}
+	if err != nil {
+		result.Error = redact.Error(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[key] = result
+}
+
+// Results returns a copy of the result of every key.
+func (s *Status) Results() map[string]Result {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make(map[string]Result, len(s.results))
+	for key, result := range s.results {
+		results[key] = result
+	}
+
+	return results
+}
+
+// ForgetNamespace drops the keys of a deleted namespace: the namespace itself
+// and the namespace/name keys of the objects it held.
+func (s *Status) ForgetNamespace(namespace string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.results {
+		if key == namespace || strings.HasPrefix(key, namespace+"/") {
+			delete(s.results, key)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package convergence
+
+import (
+	"sync"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// Sweep outcomes.
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeDeferred  = "deferred"
+	OutcomeFailed    = "failed"
+)
+
+// maxLoggedFailingKeys is the number of failing keys named in the sweep
+// summary.
+const maxLoggedFailingKeys = 10
+
+// Sweep holds the keys whose last sync failed, and the outcomes of the first
+// sync of each key of the latest full sweep, so that a persistent subset of
+// failures can be told apart from a broken controller. A sync that asked to
+// be requeued is deferred rather than failed. It is safe for concurrent use,
+// and a nil Sweep records nothing.
+type Sweep struct {
+	name string
+
+	mu       sync.Mutex
+	failing  sets.Set[string]
+	pending  sets.Set[string]
+	outcomes map[string]int
+
+	// completed is closed once the sweep in progress completes. A superseded
+	// sweep hands it over to the sweep replacing it.
+	completed chan struct{}
+}
+
+// NewSweep returns a Sweep reporting to the failing objects and last sweep
+// objects metrics of the named controller.
+func NewSweep(name string) *Sweep {
+	metrics.FailingObjects.WithLabelValues(name).Set(0)
+
+	return &Sweep{
+		name:      name,
+		failing:   sets.New[string](),
+		pending:   sets.New[string](),
+		completed: make(chan struct{}),
+	}
+}
+
+// Start begins a sweep of the keys, replacing the sweep in progress, if any.
+func (s *Sweep) Start(keys []string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending.Len() > 0 {
+		klog.V(4).Infof("%s sweep superseded with %d keys left", s.name, s.pending.Len())
+	} else {
+		select {
+		case <-s.completed:
+			s.completed = make(chan struct{})
+		default:
+		}
+	}
+
+	s.pending = sets.New(keys...)
+	s.outcomes = map[string]int{}
+	if s.pending.Len() == 0 {
+		s.complete()
+	}
+}
+
+// Done records the outcome of a sync of the key.
+func (s *Sweep) Done(key string, err error) {
+	if s == nil {
+		return
+	}
+
+	outcome := Outcome(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if outcome == OutcomeFailed {
+		s.failing.Insert(key)
+	} else {
+		s.failing.Delete(key)
+	}
+	metrics.FailingObjects.WithLabelValues(s.name).Set(float64(s.failing.Len()))
+
+	if !s.pending.Has(key) {
+		return
+	}
+
+	s.pending.Delete(key)
+	s.outcomes[outcome]++
+	if s.pending.Len() == 0 {
+		s.complete()
+	}
+}
+
+// Completed returns a channel closed once the sweep in progress, or the
+// first sweep when none was started yet, has completed: every one of its keys
+// was synced once, whatever the outcome.
+func (s *Sweep) Completed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.completed
+}
+
+// complete reports the outcomes of the sweep. It must be called with mu held.
+func (s *Sweep) complete() {
+	select {
+	case <-s.completed:
+	default:
+		close(s.completed)
+	}
+
+	for _, outcome := range []string{OutcomeSucceeded, OutcomeDeferred, OutcomeFailed} {
+		metrics.LastSweepObjects.WithLabelValues(s.name, outcome).Set(float64(s.outcomes[outcome]))
+	}
+
+	message := "%s sweep completed: %d succeeded, %d deferred, %d failed"
+	args := []interface{}{s.name, s.outcomes[OutcomeSucceeded], s.outcomes[OutcomeDeferred], s.outcomes[OutcomeFailed]}
+	if s.outcomes[OutcomeFailed] > 0 {
+		// Only name a few keys, everything may be failing.
+		failing := sets.List(s.failing)
+		if len(failing) > maxLoggedFailingKeys {
+			failing = append(failing[:maxLoggedFailingKeys], "...")
+		}
+		klog.Warningf(message+", failing keys: %v", append(args, failing)...)
+		return
+	}
+
+	klog.Infof(message, args...)
+}
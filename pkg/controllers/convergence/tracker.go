@@ -0,0 +1,71 @@
+// Package convergence tracks the objects a controller has not managed to sync.
+package convergence
+
+import (
+	"sync"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+)
+
+// Tracker holds the keys whose last sync failed. As in a Sweep, a sync that
+// asked to be requeued is deferred rather than failed. It is safe for
+// concurrent use, and a nil Tracker tracks nothing.
+type Tracker struct {
+	name string
+
+	mu      sync.Mutex
+	failing map[string]struct{}
+}
+
+// NewTracker returns a Tracker reporting to the unconverged objects metric of
+// the named controller.
+func NewTracker(name string) *Tracker {
+	metrics.UnconvergedObjects.WithLabelValues(name).Set(0)
+
+	return &Tracker{
+		name:    name,
+		failing: map[string]struct{}{},
+	}
+}
+
+// Failed records that the last sync of the key did not converge.
+func (t *Tracker) Failed(key string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failing[key] = struct{}{}
+	metrics.UnconvergedObjects.WithLabelValues(t.name).Set(float64(len(t.failing)))
+}
+
+// Synced records that the key converged, or was deferred on purpose.
+func (t *Tracker) Synced(key string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.failing[key]; !ok {
+		return
+	}
+
+	delete(t.failing, key)
+	metrics.UnconvergedObjects.WithLabelValues(t.name).Set(float64(len(t.failing)))
+}
+
+// Len returns the number of keys that have not converged.
+func (t *Tracker) Len() int {
+	if t == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.failing)
+}
@@ -0,0 +1,312 @@
+// Package fairqueue provides a workqueue that shares its workers fairly
+// between namespaces and can serve priority keys first.
+package fairqueue
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Queue is a workqueue.Interface handing out namespace/name keys round-robin
+// across namespaces, so that a namespace with thousands of waiting keys does
+// not delay the others until it has been processed to completion. Keys within
+// a namespace keep their FIFO order. Like the client-go queue, a key is never
+// handed to two workers at once and is deduplicated while it waits.
+//
+// Keys that are not strings, or have no namespace, share one group.
+//
+// Keys for which the priority func returns true wait in a separate FIFO that
+// is always served before the groups.
+type Queue struct {
+	cond *sync.Cond
+
+	// groupOf returns the group of a key, its namespace in a fair queue.
+	groupOf func(item interface{}) string
+
+	// priority reports whether a key is served first. A nil func gives no
+	// key priority.
+	priority func(item interface{}) bool
+
+	// prioritized holds the waiting priority keys in FIFO order.
+	prioritized []interface{}
+
+	// waiting holds the waiting keys of each namespace, in FIFO order, and
+	// namespaces holds the namespaces with waiting keys, in turn order.
+	waiting    map[string][]interface{}
+	namespaces []string
+	length     int
+
+	dirty      map[interface{}]struct{}
+	processing map[interface{}]struct{}
+
+	shuttingDown bool
+	drain        bool
+
+	metrics queueMetrics
+}
+
+var _ workqueue.Interface = &Queue{}
+
+// New returns an empty Queue reporting its depth, adds, queue duration and
+// work duration to the provider under the given name. A nil provider reports
+// nothing.
+func New(name string, provider workqueue.MetricsProvider) *Queue {
+	return newQueue(name, provider, namespaceOf)
+}
+
+// NewFIFO returns an empty Queue handing out keys in FIFO order, without
+// taking turns between namespaces, for use with SetPriorityFunc.
+func NewFIFO(name string, provider workqueue.MetricsProvider) *Queue {
+	return newQueue(name, provider, func(interface{}) string { return "" })
+}
+
+func newQueue(name string, provider workqueue.MetricsProvider, groupOf func(item interface{}) string) *Queue {
+	q := &Queue{
+		cond:       sync.NewCond(&sync.Mutex{}),
+		groupOf:    groupOf,
+		waiting:    map[string][]interface{}{},
+		dirty:      map[interface{}]struct{}{},
+		processing: map[interface{}]struct{}{},
+	}
+
+	if provider != nil {
+		q.metrics = queueMetrics{
+			depth:        provider.NewDepthMetric(name),
+			adds:         provider.NewAddsMetric(name),
+			latency:      provider.NewLatencyMetric(name),
+			workDuration: provider.NewWorkDurationMetric(name),
+			addTimes:     map[interface{}]time.Time{},
+			processing:   map[interface{}]time.Time{},
+		}
+	}
+
+	return q
+}
+
+// SetPriorityFunc serves the keys for which priority returns true before any
+// other key. It is evaluated when a key is queued, and must be called before
+// the first key is added.
+func (q *Queue) SetPriorityFunc(priority func(item interface{}) bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.priority = priority
+}
+
+// Add marks item as needing processing.
+func (q *Queue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.dirty[item]; ok {
+		return
+	}
+
+	q.metrics.add(item)
+
+	q.dirty[item] = struct{}{}
+	if _, ok := q.processing[item]; ok {
+		return
+	}
+
+	q.push(item)
+	q.cond.Signal()
+}
+
+// Len returns the number of waiting items.
+func (q *Queue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	return q.length
+}
+
+// Get blocks until it can return an item to be processed, taking it from the
+// namespace whose turn it is. Done must be called with the item once it has
+// been processed.
+func (q *Queue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	for q.length == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.length == 0 {
+		return nil, true
+	}
+
+	item := q.pop()
+	q.metrics.get(item)
+
+	q.processing[item] = struct{}{}
+	delete(q.dirty, item)
+
+	return item, false
+}
+
+// Done marks item as done processing, queueing it again if it was added while
+// being processed.
+func (q *Queue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.metrics.done(item)
+
+	delete(q.processing, item)
+	if _, ok := q.dirty[item]; ok {
+		q.push(item)
+		q.cond.Signal()
+	} else if len(q.processing) == 0 {
+		q.cond.Signal()
+	}
+}
+
+// ShutDown makes the queue ignore new items and instructs the workers to exit.
+func (q *Queue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = false
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+// ShutDownWithDrain makes the queue ignore new items and waits for the items
+// being processed to be Done before instructing the workers to exit.
+func (q *Queue) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = true
+	q.shuttingDown = true
+	q.cond.Broadcast()
+
+	for len(q.processing) != 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+// ShuttingDown reports whether the queue is shutting down.
+func (q *Queue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	return q.shuttingDown
+}
+
+// push appends the item to the priority keys or to its namespace, giving the
+// namespace a turn if it had none.
+func (q *Queue) push(item interface{}) {
+	if q.priority != nil && q.priority(item) {
+		q.prioritized = append(q.prioritized, item)
+		q.length++
+		return
+	}
+
+	namespace := q.groupOf(item)
+	if len(q.waiting[namespace]) == 0 {
+		q.namespaces = append(q.namespaces, namespace)
+	}
+
+	q.waiting[namespace] = append(q.waiting[namespace], item)
+	q.length++
+}
+
+// pop takes the first priority item, or else the first item of the namespace
+// whose turn it is, moving the namespace to the back of the turn order if it
+// has more items waiting.
+func (q *Queue) pop() interface{} {
+	if len(q.prioritized) > 0 {
+		item := q.prioritized[0]
+		q.prioritized[0] = nil
+		q.prioritized = q.prioritized[1:]
+		q.length--
+		return item
+	}
+
+	namespace := q.namespaces[0]
+	q.namespaces = q.namespaces[1:]
+
+	items := q.waiting[namespace]
+	item := items[0]
+	items[0] = nil
+
+	if len(items) > 1 {
+		q.waiting[namespace] = items[1:]
+		q.namespaces = append(q.namespaces, namespace)
+	} else {
+		delete(q.waiting, namespace)
+	}
+
+	q.length--
+	return item
+}
+
+// namespaceOf returns the namespace of a namespace/name key.
+func namespaceOf(item interface{}) string {
+	key, ok := item.(string)
+	if !ok {
+		return ""
+	}
+
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return ""
+	}
+
+	return namespace
+}
+
+// queueMetrics reports a subset of the client-go workqueue metrics. Its zero
+// value reports nothing.
+type queueMetrics struct {
+	depth        workqueue.GaugeMetric
+	adds         workqueue.CounterMetric
+	latency      workqueue.HistogramMetric
+	workDuration workqueue.HistogramMetric
+
+	addTimes   map[interface{}]time.Time
+	processing map[interface{}]time.Time
+}
+
+func (m *queueMetrics) add(item interface{}) {
+	if m.depth == nil {
+		return
+	}
+
+	m.adds.Inc()
+	m.depth.Inc()
+	if _, ok := m.addTimes[item]; !ok {
+		m.addTimes[item] = time.Now()
+	}
+}
+
+func (m *queueMetrics) get(item interface{}) {
+	if m.depth == nil {
+		return
+	}
+
+	m.depth.Dec()
+	m.processing[item] = time.Now()
+	if startTime, ok := m.addTimes[item]; ok {
+		m.latency.Observe(time.Since(startTime).Seconds())
+		delete(m.addTimes, item)
+	}
+}
+
+func (m *queueMetrics) done(item interface{}) {
+	if m.depth == nil {
+		return
+	}
+
+	if startTime, ok := m.processing[item]; ok {
+		m.workDuration.Observe(time.Since(startTime).Seconds())
+		delete(m.processing, item)
+	}
+}
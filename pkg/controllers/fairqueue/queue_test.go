@@ -0,0 +1,142 @@
+package fairqueue
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// drain gets every waiting item, marking each done, and returns them in the
+// order they were handed out.
+func drain(q *Queue) []interface{} {
+	var items []interface{}
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		items = append(items, item)
+		q.Done(item)
+	}
+
+	return items
+}
+
+func TestQueueFairness(t *testing.T) {
+	tests := []struct {
+		name string
+		// sizes is the number of keys of each namespace, added namespace
+		// by namespace.
+		sizes []int
+	}{
+		{name: "one busy namespace first", sizes: []int{1000, 2, 5}},
+		{name: "one busy namespace last", sizes: []int{3, 1, 500}},
+		{name: "even namespaces", sizes: []int{10, 10, 10, 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New("test", nil)
+			for namespace, size := range tt.sizes {
+				for i := 0; i < size; i++ {
+					q.Add(fmt.Sprintf("ns-%d/sa-%04d", namespace, i))
+				}
+			}
+
+			items := drain(q)
+
+			// Each namespace gets one key per turn, in the order its keys
+			// were added: its i-th key comes out in turn i, once every
+			// namespace that still has keys had as many.
+			next := make([]int, len(tt.sizes))
+			position := 0
+			for turn := 0; position < len(items); turn++ {
+				for namespace, size := range tt.sizes {
+					if next[namespace] >= size {
+						continue
+					}
+					if want := fmt.Sprintf("ns-%d/sa-%04d", namespace, next[namespace]); items[position] != want {
+						t.Fatalf("item %d in turn %d = %v, want %s", position, turn, items[position], want)
+					}
+					next[namespace]++
+					position++
+				}
+			}
+		})
+	}
+}
+
+func TestQueueDeduplicates(t *testing.T) {
+	q := New("test", nil)
+	q.Add("team/default")
+	q.Add("team/default")
+	if got := q.Len(); got != 1 {
+		t.Fatalf("Len() after adding a key twice = %d, want 1", got)
+	}
+
+	// A key added while it is processed waits until it is done.
+	item, _ := q.Get()
+	q.Add("team/default")
+	q.Add("other/default")
+	if got := q.Len(); got != 1 {
+		t.Errorf("Len() with the key processing = %d, want 1", got)
+	}
+	if got, _ := q.Get(); got != "other/default" {
+		t.Errorf("Get() with the key processing = %v, want other/default", got)
+	}
+	q.Done("other/default")
+	q.Done(item)
+
+	if got := drain(q); !reflect.DeepEqual(got, []interface{}{"team/default"}) {
+		t.Errorf("items after the key is done = %v, want [team/default]", got)
+	}
+}
+
+func TestQueueShutDown(t *testing.T) {
+	q := New("test", nil)
+	q.Add("team/default")
+	q.ShutDown()
+	q.Add("other/default")
+
+	if item, shutdown := q.Get(); item != "team/default" || shutdown {
+		t.Errorf("Get() = %v, %v, want the waiting key", item, shutdown)
+	}
+	if _, shutdown := q.Get(); !shutdown {
+		t.Error("Get() of an empty queue shutting down did not report the shutdown")
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	isPriority := func(item interface{}) bool {
+		key, _ := item.(string)
+		return strings.HasPrefix(key, "prod")
+	}
+
+	tests := []struct {
+		name  string
+		queue *Queue
+		want  []interface{}
+	}{
+		{
+			name:  "fair",
+			queue: New("test", nil),
+			want:  []interface{}{"prod/default", "prod/builder", "prod-eu/default", "dev/default", "test/default", "dev/builder"},
+		},
+		{
+			name:  "fifo",
+			queue: NewFIFO("test", nil),
+			want:  []interface{}{"prod/default", "prod/builder", "prod-eu/default", "dev/default", "dev/builder", "test/default"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.queue.SetPriorityFunc(isPriority)
+			for _, key := range []string{"dev/default", "prod/default", "dev/builder", "prod/builder", "test/default", "prod-eu/default"} {
+				tt.queue.Add(key)
+			}
+
+			if got := drain(tt.queue); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
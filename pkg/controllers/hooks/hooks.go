@@ -0,0 +1,88 @@
+// Package hooks runs side effects, such as metrics and notifications, after
+// the reconcile steps of the controllers, separately from the reconcile
+// logic itself.
+package hooks
+
+import corev1 "k8s.io/api/core/v1"
+
+// Hook is notified of the outcome of the reconciles. Its methods are called
+// synchronously from the controller workers, and must return quickly.
+type Hook interface {
+	// OnSecretCreated is called after the secret was created in the
+	// namespace, or recreated because its type was wrong.
+	OnSecretCreated(namespace *corev1.Namespace, secret *corev1.Secret)
+
+	// OnSAInjected is called after the image pull secrets were added to the
+	// service account, which is the object before the change.
+	OnSAInjected(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string)
+
+	// OnError is called when the sync of an object failed, rather than asked
+	// to be requeued. The name is empty for a namespace.
+	OnError(kind, namespace, name string, err error)
+}
+
+// Hooks calls each of its hooks in the order they were added.
+type Hooks []Hook
+
+// Add appends a hook.
+func (h *Hooks) Add(hook Hook) {
+	*h = append(*h, hook)
+}
+
+// OnSecretCreated calls OnSecretCreated of each hook, after the secret was
+// created or recreated. It blocks the worker until every hook returned.
+func (h Hooks) OnSecretCreated(namespace *corev1.Namespace, secret *corev1.Secret) {
+	for _, hook := range h {
+		hook.OnSecretCreated(namespace, secret)
+	}
+}
+
+// OnSAInjected calls OnSAInjected of each hook, after image pull secrets were
+// added to the service account. It blocks the worker until every hook
+// returned.
+func (h Hooks) OnSAInjected(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+	for _, hook := range h {
+		hook.OnSAInjected(serviceAccount, imagePullSecrets)
+	}
+}
+
+// OnError calls OnError of each hook, after the sync of an object failed
+// rather than asked to be requeued. It blocks the worker until every hook
+// returned.
+func (h Hooks) OnError(kind, namespace, name string, err error) {
+	for _, hook := range h {
+		hook.OnError(kind, namespace, name, err)
+	}
+}
+
+// Funcs is an adapter implementing Hook with functions. A nil function ignores
+// its calls.
+type Funcs struct {
+	SecretCreated func(namespace *corev1.Namespace, secret *corev1.Secret)
+	SAInjected    func(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string)
+	Error         func(kind, namespace, name string, err error)
+}
+
+// OnSecretCreated calls SecretCreated, after the secret was created or
+// recreated. The function runs on the worker and must not block.
+func (f Funcs) OnSecretCreated(namespace *corev1.Namespace, secret *corev1.Secret) {
+	if f.SecretCreated != nil {
+		f.SecretCreated(namespace, secret)
+	}
+}
+
+// OnSAInjected calls SAInjected, after image pull secrets were added to the
+// service account. The function runs on the worker and must not block.
+func (f Funcs) OnSAInjected(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+	if f.SAInjected != nil {
+		f.SAInjected(serviceAccount, imagePullSecrets)
+	}
+}
+
+// OnError calls Error, after the sync of an object failed rather than asked to
+// be requeued. The function runs on the worker and must not block.
+func (f Funcs) OnError(kind, namespace, name string, err error) {
+	if f.Error != nil {
+		f.Error(kind, namespace, name, err)
+	}
+}
@@ -0,0 +1,81 @@
+package hooks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recorder returns a hook recording its calls, prefixed with hook, to calls.
+func recorder(hook string, calls *[]string) Funcs {
+	return Funcs{
+		SecretCreated: func(namespace *corev1.Namespace, secret *corev1.Secret) {
+			*calls = append(*calls, hook+" created "+namespace.Name+"/"+secret.Name)
+		},
+		SAInjected: func(serviceAccount *corev1.ServiceAccount, imagePullSecrets []string) {
+			*calls = append(*calls, hook+" injected "+serviceAccount.Namespace+"/"+serviceAccount.Name)
+		},
+		Error: func(kind, namespace, name string, err error) {
+			*calls = append(*calls, hook+" error "+kind+" "+namespace+": "+err.Error())
+		},
+	}
+}
+
+func TestHooks(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "aurora-pull"}}
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "default"}}
+
+	tests := []struct {
+		name  string
+		hooks func(calls *[]string) Hooks
+		want  []string
+	}{
+		{
+			name:  "no hooks",
+			hooks: func(*[]string) Hooks { return nil },
+		},
+		{
+			name: "hooks in order",
+			hooks: func(calls *[]string) Hooks {
+				var h Hooks
+				h.Add(recorder("first", calls))
+				h.Add(recorder("second", calls))
+				return h
+			},
+			want: []string{
+				"first created team/aurora-pull", "second created team/aurora-pull",
+				"first injected team/default", "second injected team/default",
+				"first error Namespace team: forbidden", "second error Namespace team: forbidden",
+			},
+		},
+		{
+			name: "nil functions",
+			hooks: func(calls *[]string) Hooks {
+				var h Hooks
+				h.Add(Funcs{})
+				h.Add(Funcs{Error: recorder("errors", calls).Error})
+				return h
+			},
+			want: []string{"errors error Namespace team: forbidden"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			h := tt.hooks(&calls)
+
+			h.OnSecretCreated(namespace, secret)
+			h.OnSAInjected(serviceAccount, []string{"aurora-pull"})
+			h.OnError("Namespace", "team", "", errors.New("forbidden"))
+
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %q, want %q", calls, tt.want)
+			}
+		})
+	}
+}
@@ -21,9 +21,17 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/batch"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/cachemiss"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/fairqueue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/logsampler"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	corev1informers "k8s.io/client-go/informers/core/v1"
@@ -49,6 +57,29 @@ type Controller struct {
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+
+	// deleted is called with the name of each Namespace found deleted when
+	// its key is processed. A nil func is not called.
+	deleted func(name string)
+
+	// convergence tracks the keys whose last sync did not succeed. A nil
+	// tracker tracks nothing.
+	convergence *convergence.Tracker
+
+	// sweep records the outcomes of the full sweeps started by EnqueueAll.
+	// A nil sweep records nothing.
+	sweep *convergence.Sweep
+
+	// startup paces the initial sweep. A nil gate does not pace.
+	startup *batch.Gate
+
+	// successLogs samples the log message of each successful sync. Errors
+	// are always reported. A nil sampler logs every sync.
+	successLogs *logsampler.Sampler
+
+	// cacheMisses tells the keys of deleted Namespaces apart from the keys
+	// missing from a cache that has not caught up yet.
+	cacheMisses *cachemiss.Tracker
 }
 
 // NewController func for event handlers
@@ -61,6 +92,7 @@ func NewController(
 		namespaceSynced: namespaceInformer.Informer().HasSynced,
 		sync:            sync,
 		workqueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Namespaces"),
+		cacheMisses:     cachemiss.NewTracker(),
 	}
 
 	// Configure event handlers
@@ -71,6 +103,17 @@ func NewController(
 		UpdateFunc: func(old, new interface{}) {
 			controller.EnqueueNamespace(new)
 		},
+		// Deleted namespaces are processed once more so that the state
+		// kept for them is released.
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				utilruntime.HandleError(err)
+				return
+			}
+			controller.cacheMisses.Deleted(key)
+			controller.workqueue.Add(key)
+		},
 	})
 
 	return controller
@@ -93,6 +136,8 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
+	c.startup.Start(c.workqueue.Len())
+
 	klog.Info("starting workers")
 	// Launch two workers to process Namespace resources
 	for i := 0; i < threadiness; i++ {
@@ -116,6 +161,11 @@ func (c *Controller) runWorker() {
 
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
+//
+// The workqueue never hands the same key to two workers at once: a key added
+// while it is being processed is held back until Done is called and is then
+// processed again. Every event for a key, whichever informer it came from,
+// is therefore serialized as long as Done is called exactly once per Get.
 func (c *Controller) processNextWorkItem() bool {
 	obj, shutdown := c.workqueue.Get()
 
@@ -123,6 +173,8 @@ func (c *Controller) processNextWorkItem() bool {
 		return false
 	}
 
+	c.startup.Wait()
+
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
 		// We call Done here so the workqueue knows we have finished
@@ -149,15 +201,41 @@ func (c *Controller) processNextWorkItem() bool {
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// Namespace resource to be synced.
-		if err := c.syncHandler(key); err != nil {
+		err := c.syncHandler(key)
+		c.sweep.Done(key, err)
+		if err != nil {
+			// A sync that asked to be requeued, such as one of a paused
+			// namespace, is deferred on purpose rather than failing to
+			// converge.
+			if requeue.IsRequested(err) {
+				c.convergence.Synced(key)
+			} else {
+				c.convergence.Failed(key)
+			}
+
+			// The sync asked to be retried later, or failed with a
+			// transient error that deserves a longer delay.
+			if after, ok := requeue.Delay(err); ok {
+				c.workqueue.Forget(obj)
+				c.workqueue.AddAfter(key, after)
+				if requeue.IsRequested(err) {
+					klog.V(4).Infof("Requeuing '%s': %s", key, redact.Error(err))
+					return nil
+				}
+				return fmt.Errorf("error syncing '%s': %s, requeuing after %s", key, redact.Error(err), after)
+			}
+
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, redact.Error(err))
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
+		c.convergence.Synced(key)
+		if c.successLogs.Sample() {
+			klog.Infof("Successfully synced '%s'", key)
+		}
 		return nil
 	}(obj)
 
@@ -177,14 +255,20 @@ func (c *Controller) syncHandler(key string) error {
 	namespace, err := c.namespaceLister.Get(key)
 	if err != nil {
 		// The Namespace resource may no longer exist, in which case we stop
-		// processing.
+		// processing, or not be cached yet.
 		if errors.IsNotFound(err) {
-			utilruntime.HandleError(fmt.Errorf("namespace '%s' in work queue no longer exists", key))
+			if err := c.cacheMisses.Missing(key); err != nil {
+				return err
+			}
+			if c.deleted != nil {
+				c.deleted(key)
+			}
 			return nil
 		}
 
 		return err
 	}
+	c.cacheMisses.Found(key)
 
 	return c.sync(namespace)
 }
@@ -202,11 +286,104 @@ func (c *Controller) EnqueueNamespace(obj interface{}) {
 	c.workqueue.Add(key)
 }
 
+// UsePriorityQueue replaces the workqueue with one that processes the
+// Namespaces for which priority returns true before the others, reporting its
+// metrics to the provider. It must be called before the informer is started.
+func (c *Controller) UsePriorityQueue(priority func(name string) bool, provider workqueue.MetricsProvider) {
+	queue := fairqueue.NewFIFO("Namespaces", provider)
+	queue.SetPriorityFunc(func(item interface{}) bool {
+		key, ok := item.(string)
+		return ok && priority(key)
+	})
+
+	c.workqueue = workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{
+		Name: "Namespaces",
+		DelayingQueue: workqueue.NewDelayingQueueWithConfig(workqueue.DelayingQueueConfig{
+			Name:  "Namespaces",
+			Queue: queue,
+		}),
+	})
+}
+
+// SetDeletedFunc registers a func called with the name of each Namespace
+// found deleted, to release the state kept for it. It must be called before
+// Run.
+func (c *Controller) SetDeletedFunc(deleted func(name string)) {
+	c.deleted = deleted
+}
+
+// SetConvergenceTracker records the keys whose last sync did not succeed in
+// the tracker. It must be called before Run.
+func (c *Controller) SetConvergenceTracker(tracker *convergence.Tracker) {
+	c.convergence = tracker
+}
+
+// SetSweep records the outcomes of the full sweeps started by EnqueueAll in
+// the sweep. It must be called before Run.
+func (c *Controller) SetSweep(sweep *convergence.Sweep) {
+	c.sweep = sweep
+}
+
+// SetStartupGate paces the processing of the keys queued when the workers
+// start, the initial sweep, with the gate. It must be called before Run.
+func (c *Controller) SetStartupGate(gate *batch.Gate) {
+	c.startup = gate
+}
+
+// SetSuccessLogSampler samples the log messages of successful syncs. It must
+// be called before Run.
+func (c *Controller) SetSuccessLogSampler(sampler *logsampler.Sampler) {
+	c.successLogs = sampler
+}
+
+// SetCacheMissRetries retries the keys missing from the cache that were not
+// observed deleted, such as the ones enqueued by name before the informer
+// delivered the Namespace, up to retries times, delay apart.
+func (c *Controller) SetCacheMissRetries(retries int, delay time.Duration) {
+	c.cacheMisses.SetRetries(retries, delay)
+}
+
+// EnqueueKey puts the name key of a Namespace onto the work
+// queue, for callers that do not hold the object.
+func (c *Controller) EnqueueKey(key string) {
+	c.workqueue.Add(key)
+}
+
+// EnqueueAll puts every Namespace resource in the informer cache onto the
+// work queue and returns how many were enqueued. It is used for the initial
+// sweep and to force a full resync when the desired state changes outside of
+// the cluster, such as a credential rotation. Keys that are already waiting
+// in the queue are deduplicated by the workqueue. Each call starts a new
+// sweep.
+func (c *Controller) EnqueueAll() int {
+	namespaces, err := c.namespaceLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return 0
+	}
+
+	keys := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		keys = append(keys, namespace.Name)
+	}
+	c.sweep.Start(keys)
+
+	for _, namespace := range namespaces {
+		c.EnqueueNamespace(namespace)
+	}
+
+	return len(namespaces)
+}
+
 // HandleObject will take any resource implementing metav1.Object and attempt
 // to find the Namespace resource that 'owns' it. It does this by looking at the
 // objects metadata.ownerReferences field for an appropriate OwnerReference.
 // It then enqueues that Namespace resource to be processed. If the object does not
 // have an appropriate OwnerReference, it will simply be skipped.
+//
+// HandleObject accepts the cache.DeletedFinalStateUnknown tombstones that
+// informers deliver when a delete was missed, so it is safe to register it
+// directly as a DeleteFunc.
 func (c *Controller) HandleObject(obj interface{}) {
 	var object metav1.Object
 	var ok bool
@@ -221,22 +398,30 @@ func (c *Controller) HandleObject(obj interface{}) {
 			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
 			return
 		}
-		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
+		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", cache.MetaObjectToName(object))
 	}
-	klog.V(4).Infof("Processing object: %s", object.GetName())
-	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
+	klog.V(4).Infof("Processing object: %s", cache.MetaObjectToName(object))
+	// The namespace is not always the controller of the object: when another
+	// controller owns it, the namespace reference is added alongside.
+	for _, ownerRef := range object.GetOwnerReferences() {
 		// If this object is not owned by a Namespace, we should not do anything more
 		// with it.
 		if ownerRef.Kind != "Namespace" {
-			return
+			continue
 		}
 
 		namespace, err := c.namespaceLister.Get(ownerRef.Name)
 		if err != nil {
-			klog.V(4).Infof("ignoring orphaned object '%s' of namespace '%s'", object.GetSelfLink(), ownerRef.Name)
+			klog.V(4).Infof("ignoring orphaned object '%s' of namespace '%s'", cache.MetaObjectToName(object), ownerRef.Name)
 			return
 		}
 
+		// An object owned by an earlier namespace with the same name still
+		// means the current namespace needs to be reconciled.
+		if namespace.UID != ownerRef.UID {
+			klog.V(4).Infof("object '%s' belongs to a previous namespace '%s'", cache.MetaObjectToName(object), ownerRef.Name)
+		}
+
 		c.EnqueueNamespace(namespace)
 		return
 	}
@@ -0,0 +1,534 @@
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/batch"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/logsampler"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// newTestController returns a controller syncing the namespaces with sync,
+// whose cache holds the namespaces without running the informer.
+func newTestController(t *testing.T, sync namespaceSyncCallback, namespaces ...*corev1.Namespace) *Controller {
+	t.Helper()
+
+	namespaceInformer := kubeinformers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().Namespaces()
+	for _, namespace := range namespaces {
+		if err := namespaceInformer.Informer().GetIndexer().Add(namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewController(namespaceInformer, sync)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	return c
+}
+
+func TestProcessNextWorkItemConvergence(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unconverged int
+	}{
+		{name: "synced"},
+		{name: "failed", err: errors.New("forbidden"), unconverged: 1},
+		{name: "requeue requested", err: requeue.After(time.Hour, "namespace is paused")},
+		{name: "aggregated requeue requests", err: utilerrors.NewAggregate([]error{
+			requeue.After(time.Minute, "namespace is younger than the provision delay"),
+			requeue.After(time.Hour, "namespace is paused"),
+		})},
+		{name: "requeue request and failure", err: utilerrors.NewAggregate([]error{
+			requeue.After(time.Hour, "namespace is paused"),
+			errors.New("forbidden"),
+		}), unconverged: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := convergence.NewTracker("Namespaces")
+			c := newTestController(t, func(*corev1.Namespace) error { return tt.err },
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+			c.SetConvergenceTracker(tracker)
+
+			c.EnqueueKey("team")
+			if !c.processNextWorkItem() {
+				t.Fatal("processNextWorkItem() = false")
+			}
+
+			if got := tracker.Len(); got != tt.unconverged {
+				t.Errorf("unconverged = %d, want %d", got, tt.unconverged)
+			}
+		})
+	}
+}
+
+func TestProcessNextWorkItemClearsDeferredFailure(t *testing.T) {
+	tracker := convergence.NewTracker("Namespaces")
+	errs := []error{errors.New("forbidden"), requeue.After(time.Hour, "namespace is paused")}
+	c := newTestController(t, func(*corev1.Namespace) error {
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+	c.SetConvergenceTracker(tracker)
+
+	c.EnqueueKey("team")
+	c.processNextWorkItem()
+	if got := tracker.Len(); got != 1 {
+		t.Fatalf("unconverged after a failure = %d, want 1", got)
+	}
+
+	// The failed key is retried with the rate limiter.
+	c.processNextWorkItem()
+	if got := tracker.Len(); got != 0 {
+		t.Errorf("unconverged once paused = %d, want 0", got)
+	}
+}
+
+func TestProcessNextWorkItemStartupGate(t *testing.T) {
+	const (
+		total = 250
+		size  = 100
+		delay = 20 * time.Millisecond
+	)
+
+	var namespaces []*corev1.Namespace
+	for i := 0; i < total; i++ {
+		namespaces = append(namespaces, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("team-%03d", i)}})
+	}
+	var synced []string
+	var syncedAt []time.Time
+	c := newTestController(t, func(namespace *corev1.Namespace) error {
+		synced = append(synced, namespace.Name)
+		syncedAt = append(syncedAt, time.Now())
+		return nil
+	}, namespaces...)
+	c.SetStartupGate(batch.NewGate("Namespaces", size, delay))
+
+	for _, namespace := range namespaces {
+		c.EnqueueKey(namespace.Name)
+	}
+	c.startup.Start(c.workqueue.Len())
+	for i := 0; i < total; i++ {
+		c.processNextWorkItem()
+	}
+
+	if len(synced) != total {
+		t.Fatalf("synced %d namespaces, want %d", len(synced), total)
+	}
+	for i, name := range synced {
+		if want := namespaces[i].Name; name != want {
+			t.Fatalf("namespace %d synced = %s, want %s", i, name, want)
+		}
+	}
+	// Each batch starts after the pause following the previous one.
+	for i := size; i < total; i += size {
+		if gap := syncedAt[i].Sub(syncedAt[i-1]); gap < delay {
+			t.Errorf("batch %d started %s after the previous one, want at least %s", i/size+1, gap, delay)
+		}
+		if gap := syncedAt[i-1].Sub(syncedAt[i-size]); gap >= delay {
+			t.Errorf("batch %d took %s, want no pause within it", i/size, gap)
+		}
+	}
+}
+
+func TestHandleObject(t *testing.T) {
+	team := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", UID: "team-uid"}}
+	previous := team.DeepCopy()
+	previous.UID = "previous-uid"
+	other := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team", UID: "sa-uid"}}
+
+	secret := func(owner metav1.Object, kind string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:            "aurora-pull",
+			Namespace:       "team",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, corev1.SchemeGroupVersion.WithKind(kind))},
+		}}
+	}
+
+	// The namespace reference does not claim control of a secret another
+	// controller owns.
+	coOwned := secret(other, "ServiceAccount")
+	coOwned.OwnerReferences = append(coOwned.OwnerReferences, metav1.OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: "team", UID: "team-uid"})
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		want []string
+	}{
+		{name: "owned object", obj: secret(team, "Namespace"), want: []string{"team"}},
+		{name: "tombstone", obj: cache.DeletedFinalStateUnknown{Key: "team/aurora-pull", Obj: secret(team, "Namespace")}, want: []string{"team"}},
+		{name: "owned by a previous namespace", obj: secret(previous, "Namespace"), want: []string{"team"}},
+		{name: "not owned by a namespace", obj: secret(other, "ServiceAccount")},
+		{name: "namespace owner alongside another controller", obj: coOwned, want: []string{"team"}},
+		{name: "orphaned", obj: secret(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}}, "Namespace")},
+		{name: "unowned", obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team"}}},
+		{name: "invalid object", obj: "team"},
+		{name: "invalid tombstone", obj: cache.DeletedFinalStateUnknown{Key: "team/aurora-pull", Obj: "team"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, func(*corev1.Namespace) error { return nil }, team)
+
+			c.HandleObject(tt.obj)
+
+			var got []string
+			for c.workqueue.Len() > 0 {
+				key, _ := c.workqueue.Get()
+				got = append(got, key.(string))
+				c.workqueue.Done(key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessNextWorkItemTransientError(t *testing.T) {
+	defer func(delay time.Duration) { requeue.TransientErrorDelay = delay }(requeue.TransientErrorDelay)
+	requeue.TransientErrorDelay = time.Hour
+
+	tests := []struct {
+		name string
+		err  error
+		// rateLimited reports whether the key is retried with the rate
+		// limiter rather than after the transient error delay.
+		rateLimited bool
+	}{
+		{name: "429", err: apierrors.NewTooManyRequests("slow down", 0)},
+		{name: "503", err: apierrors.NewServiceUnavailable("unavailable")},
+		{name: "generic error", err: errors.New("invalid credential"), rateLimited: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, func(*corev1.Namespace) error { return tt.err },
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+
+			c.EnqueueKey("team")
+			c.processNextWorkItem()
+
+			if requeues := c.workqueue.NumRequeues("team"); (requeues > 0) != tt.rateLimited {
+				t.Errorf("rate limited requeues = %d, want rate limited: %v", requeues, tt.rateLimited)
+			}
+		})
+	}
+}
+
+func TestProcessNextWorkItemDeletedNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		// observed records the delete as the informer would.
+		observed bool
+		retries  int
+		// wantRequeue is whether the key is retried in case the cache lags.
+		wantRequeue bool
+	}{
+		{name: "delete observed", observed: true, retries: 3},
+		{name: "delete not observed", retries: 3, wantRequeue: true},
+		{name: "delete not observed without retries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled []error
+			defer func(handlers []func(error)) { utilruntime.ErrorHandlers = handlers }(utilruntime.ErrorHandlers)
+			utilruntime.ErrorHandlers = []func(error){func(err error) { handled = append(handled, err) }}
+
+			synced := false
+			var deleted []string
+			c := newTestController(t, func(*corev1.Namespace) error {
+				synced = true
+				return nil
+			})
+			c.SetCacheMissRetries(tt.retries, time.Hour)
+			c.SetDeletedFunc(func(name string) { deleted = append(deleted, name) })
+
+			// The namespace is queued, then deleted before a worker gets to
+			// it.
+			c.EnqueueKey("team")
+			if tt.observed {
+				c.cacheMisses.Deleted("team")
+			}
+			c.processNextWorkItem()
+
+			if synced {
+				t.Error("the deleted namespace was synced")
+			}
+			if len(handled) != 0 {
+				t.Errorf("errors reported = %v, want none", handled)
+			}
+			if requeues := c.workqueue.NumRequeues("team"); requeues != 0 {
+				t.Errorf("rate limited requeues = %d, want none", requeues)
+			}
+			if tt.wantRequeue {
+				if len(deleted) != 0 {
+					t.Errorf("deleted = %v before the retries ran out", deleted)
+				}
+			} else if !reflect.DeepEqual(deleted, []string{"team"}) {
+				t.Errorf("deleted = %v, want [team]", deleted)
+			}
+		})
+	}
+}
+
+// delayRecorder records the delays the keys are added to the queue after.
+type delayRecorder struct {
+	workqueue.RateLimitingInterface
+	delays map[interface{}]time.Duration
+}
+
+func (q *delayRecorder) AddAfter(item interface{}, duration time.Duration) {
+	q.delays[item] = duration
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func TestProcessNextWorkItemRetryAfter(t *testing.T) {
+	defer func(delay time.Duration) { requeue.TransientErrorDelay = delay }(requeue.TransientErrorDelay)
+	requeue.TransientErrorDelay = time.Hour
+
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{name: "429 with Retry-After", err: apierrors.NewTooManyRequests("the server has received too many requests", 7), want: 7 * time.Second},
+		{name: "server timeout", err: apierrors.NewServerTimeout(corev1.Resource("secrets"), "create", 3), want: 3 * time.Second},
+		{name: "429 without Retry-After", err: apierrors.NewTooManyRequests("the server has received too many requests", 0), want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fake.NewSimpleClientset()
+			kubeClient.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, tt.err
+			})
+			sync := func(namespace *corev1.Namespace) error {
+				secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "aurora-pull"}}
+				if _, err := kubeClient.CoreV1().Secrets(namespace.Name).Create(context.Background(), secret, metav1.CreateOptions{}); err != nil {
+					return fmt.Errorf("creating secret %s/%s: %w", namespace.Name, secret.Name, err)
+				}
+				return nil
+			}
+
+			c := newTestController(t, sync, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+			queue := &delayRecorder{RateLimitingInterface: c.workqueue, delays: map[interface{}]time.Duration{}}
+			c.workqueue = queue
+
+			c.EnqueueKey("team")
+			c.processNextWorkItem()
+
+			if got, ok := queue.delays["team"]; !ok || got != tt.want {
+				t.Errorf("requeue delay = %s, %v, want %s", got, ok, tt.want)
+			}
+			if requeues := c.workqueue.NumRequeues("team"); requeues != 0 {
+				t.Errorf("rate limited requeues = %d, want none", requeues)
+			}
+		})
+	}
+}
+
+// delayLimiter records the delays its rate limiter returns.
+type delayLimiter struct {
+	workqueue.RateLimiter
+	delays []time.Duration
+}
+
+func (l *delayLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+	l.delays = append(l.delays, delay)
+	return delay
+}
+
+func TestProcessNextWorkItemBackoffReset(t *testing.T) {
+	errs := []error{errors.New("forbidden"), errors.New("forbidden"), nil, errors.New("forbidden")}
+	c := newTestController(t, func(*corev1.Namespace) error {
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+	limiter := &delayLimiter{RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Minute)}
+	c.workqueue.ShutDown()
+	c.workqueue = workqueue.NewRateLimitingQueue(limiter)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	// Fail twice, succeed, then fail again: the failure after the success
+	// is retried with the base delay.
+	c.EnqueueKey("team")
+	c.processNextWorkItem()
+	c.processNextWorkItem()
+	c.processNextWorkItem()
+	c.EnqueueKey("team")
+	c.processNextWorkItem()
+
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond, time.Millisecond}; !reflect.DeepEqual(limiter.delays, want) {
+		t.Errorf("retry delays = %v, want %v", limiter.delays, want)
+	}
+	if requeues := c.workqueue.NumRequeues("team"); requeues != 1 {
+		t.Errorf("rate limited requeues = %d, want 1", requeues)
+	}
+}
+
+func TestProcessNextWorkItemSerializesKey(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, syncs := 0, 0, 0
+	c := newTestController(t, func(*corev1.Namespace) error {
+		mu.Lock()
+		running++
+		syncs++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+
+	// Four workers, and the key enqueued again and again as if by events
+	// of different informers.
+	var workers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for c.processNextWorkItem() {
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		c.EnqueueKey("team")
+		time.Sleep(100 * time.Microsecond)
+	}
+	c.workqueue.ShutDownWithDrain()
+	workers.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("%d concurrent syncs of the same key, want 1", maxRunning)
+	}
+	if syncs == 0 {
+		t.Error("the key was never synced")
+	}
+}
+
+func TestProcessNextWorkItemSampledLogsKeepErrors(t *testing.T) {
+	var handled []error
+	defer func(handlers []func(error)) { utilruntime.ErrorHandlers = handlers }(utilruntime.ErrorHandlers)
+	utilruntime.ErrorHandlers = []func(error){func(err error) { handled = append(handled, err) }}
+
+	c := newTestController(t, func(*corev1.Namespace) error { return errors.New("forbidden") },
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team"}})
+	// Sampling suppresses every successful sync log.
+	c.SetSuccessLogSampler(logsampler.New(0))
+
+	c.EnqueueKey("team")
+	c.processNextWorkItem()
+
+	if len(handled) != 1 {
+		t.Errorf("errors reported = %v, want the sync error", handled)
+	}
+}
+
+func TestUsePriorityQueue(t *testing.T) {
+	var synced []string
+	var namespaces []*corev1.Namespace
+	names := []string{"dev", "prod", "test", "prod-eu", "staging"}
+	for _, name := range names {
+		namespaces = append(namespaces, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	c := newTestController(t, func(namespace *corev1.Namespace) error {
+		synced = append(synced, namespace.Name)
+		return nil
+	}, namespaces...)
+	c.UsePriorityQueue(func(name string) bool { return name == "prod" || name == "prod-eu" }, nil)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	for _, name := range names {
+		c.EnqueueKey(name)
+	}
+	for range names {
+		c.processNextWorkItem()
+	}
+
+	if want := []string{"prod", "prod-eu", "dev", "test", "staging"}; !reflect.DeepEqual(synced, want) {
+		t.Errorf("synced = %v, want %v", synced, want)
+	}
+}
+
+func TestEnqueueAllSweepOutcomes(t *testing.T) {
+	errs := map[string]error{
+		"forbidden-a": apierrors.NewForbidden(corev1.Resource("secrets"), "aurora-pull", errors.New("denied")),
+		"forbidden-b": apierrors.NewForbidden(corev1.Resource("secrets"), "aurora-pull", errors.New("denied")),
+		"paused":      requeue.After(time.Hour, "namespace is paused"),
+	}
+	var namespaces []*corev1.Namespace
+	for _, name := range []string{"forbidden-a", "forbidden-b", "paused", "team-a", "team-b", "team-c"} {
+		namespaces = append(namespaces, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	c := newTestController(t, func(namespace *corev1.Namespace) error {
+		return errs[namespace.Name]
+	}, namespaces...)
+	// Only retry the failures when the test requeues them.
+	c.workqueue = workqueue.NewRateLimitingQueue(workqueue.NewItemFastSlowRateLimiter(time.Hour, time.Hour, 0))
+	t.Cleanup(c.workqueue.ShutDown)
+	metrics.FailingObjects.Reset()
+	metrics.LastSweepObjects.Reset()
+	c.SetSweep(convergence.NewSweep("Namespaces"))
+
+	if got := c.EnqueueAll(); got != len(namespaces) {
+		t.Fatalf("EnqueueAll() = %d, want %d", got, len(namespaces))
+	}
+	for range namespaces {
+		c.processNextWorkItem()
+	}
+
+	want := map[string]float64{convergence.OutcomeSucceeded: 3, convergence.OutcomeDeferred: 1, convergence.OutcomeFailed: 2}
+	for outcome, count := range want {
+		if got := testutil.ToFloat64(metrics.LastSweepObjects.WithLabelValues("Namespaces", outcome)); got != count {
+			t.Errorf("last sweep objects %s = %v, want %v", outcome, got, count)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.FailingObjects.WithLabelValues("Namespaces")); got != 2 {
+		t.Errorf("failing objects = %v, want 2", got)
+	}
+
+	// A retry outside of a sweep updates the failing objects, not the last
+	// sweep.
+	delete(errs, "forbidden-a")
+	c.EnqueueKey("forbidden-a")
+	c.processNextWorkItem()
+	if got := testutil.ToFloat64(metrics.FailingObjects.WithLabelValues("Namespaces")); got != 1 {
+		t.Errorf("failing objects after a successful retry = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.LastSweepObjects.WithLabelValues("Namespaces", convergence.OutcomeFailed)); got != 2 {
+		t.Errorf("last sweep objects failed after a retry = %v, want 2", got)
+	}
+}
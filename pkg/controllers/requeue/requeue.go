@@ -0,0 +1,104 @@
+// Package requeue lets sync callbacks ask for an object to be synced again
+// after a delay, without the failure being reported or rate limited.
+package requeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Error requests that the object is synced again after a delay.
+type Error struct {
+	After  time.Duration
+	Reason string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("requeue after %s: %s", e.After, e.Reason)
+}
+
+// After returns an Error requeuing the object after the delay.
+func After(after time.Duration, format string, args ...interface{}) error {
+	return &Error{After: after, Reason: fmt.Sprintf(format, args...)}
+}
+
+// TransientErrorDelay is how long to wait before retrying an object whose sync
+// failed with a transient API error, such as 429 Too Many Requests, 503 or a
+// timeout, to let the API server recover, unless the server suggested a delay.
+// Zero retries transient errors without a suggested delay with the rate
+// limiter, like any other error.
+var TransientErrorDelay time.Duration
+
+// Delay returns the delay requested by err, or else the delay suggested by
+// the API server, such as the Retry-After of a 429 from API priority and
+// fairness or of a server timeout, or else TransientErrorDelay when err is a
+// transient API error. An aggregate of errors is delayed only when all of its
+// errors are, and then waits for the longest delay.
+func Delay(err error) (time.Duration, bool) {
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		var longest time.Duration
+		for _, err := range aggregate.Errors() {
+			after, ok := Delay(err)
+			if !ok {
+				return 0, false
+			}
+
+			if after > longest {
+				longest = after
+			}
+		}
+
+		return longest, len(aggregate.Errors()) > 0
+	}
+
+	var requeueErr *Error
+	if errors.As(err, &requeueErr) {
+		return requeueErr.After, true
+	}
+
+	// The server knows best when it will admit the request again.
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if TransientErrorDelay > 0 && IsTransient(err) {
+		return TransientErrorDelay, true
+	}
+
+	return 0, false
+}
+
+// IsRequested reports whether err only holds requeue requests, as opposed
+// to failures.
+func IsRequested(err error) bool {
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		for _, err := range aggregate.Errors() {
+			if !IsRequested(err) {
+				return false
+			}
+		}
+
+		return len(aggregate.Errors()) > 0
+	}
+
+	var requeueErr *Error
+	return errors.As(err, &requeueErr)
+}
+
+// IsTransient reports whether err is an API error expected to go away once the
+// API server recovers.
+func IsTransient(err error) bool {
+	return apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
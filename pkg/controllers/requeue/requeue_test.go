@@ -0,0 +1,93 @@
+package requeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestDelay(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+
+	tests := []struct {
+		name           string
+		err            error
+		transientDelay time.Duration
+		want           time.Duration
+		delayed        bool
+		transient      bool
+	}{
+		{name: "generic error", err: errors.New("invalid credential"), transientDelay: 30 * time.Second},
+		{name: "conflict", err: apierrors.NewConflict(secrets, "aurora-pull", errors.New("modified")), transientDelay: 30 * time.Second},
+		{name: "requeue request", err: After(time.Minute, "paused"), want: time.Minute, delayed: true},
+		{name: "wrapped requeue request", err: fmt.Errorf("syncing: %w", After(time.Minute, "paused")), want: time.Minute, delayed: true},
+		{name: "429", err: apierrors.NewTooManyRequests("slow down", 0), transientDelay: 30 * time.Second, want: 30 * time.Second, delayed: true, transient: true},
+		{name: "429 with Retry-After", err: apierrors.NewTooManyRequests("slow down", 5), transientDelay: 30 * time.Second, want: 5 * time.Second, delayed: true, transient: true},
+		{name: "429 without a transient delay", err: apierrors.NewTooManyRequests("slow down", 0), transient: true},
+		{name: "503", err: apierrors.NewServiceUnavailable("unavailable"), transientDelay: 30 * time.Second, want: 30 * time.Second, delayed: true, transient: true},
+		{name: "server timeout", err: apierrors.NewServerTimeout(secrets, "create", 2), transientDelay: 30 * time.Second, want: 2 * time.Second, delayed: true, transient: true},
+		{name: "call timeout", err: fmt.Errorf("creating secret: %w", context.DeadlineExceeded), transientDelay: 30 * time.Second, want: 30 * time.Second, delayed: true, transient: true},
+		{
+			name: "aggregate of delays",
+			err: utilerrors.NewAggregate([]error{
+				After(time.Minute, "paused"),
+				apierrors.NewTooManyRequests("slow down", 0),
+			}),
+			transientDelay: 30 * time.Second,
+			want:           time.Minute,
+			delayed:        true,
+		},
+		{
+			name: "aggregate with a generic error",
+			err: utilerrors.NewAggregate([]error{
+				apierrors.NewTooManyRequests("slow down", 0),
+				errors.New("invalid credential"),
+			}),
+			transientDelay: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(delay time.Duration) { TransientErrorDelay = delay }(TransientErrorDelay)
+			TransientErrorDelay = tt.transientDelay
+
+			if got, delayed := Delay(tt.err); got != tt.want || delayed != tt.delayed {
+				t.Errorf("Delay() = %s, %v, want %s, %v", got, delayed, tt.want, tt.delayed)
+			}
+			if transient := IsTransient(tt.err); transient != tt.transient {
+				t.Errorf("IsTransient() = %v, want %v", transient, tt.transient)
+			}
+		})
+	}
+}
+
+func TestIsRequested(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "generic error", err: errors.New("invalid credential")},
+		{name: "transient error", err: apierrors.NewTooManyRequests("slow down", 5)},
+		{name: "requeue request", err: After(time.Minute, "paused"), want: true},
+		{name: "wrapped requeue request", err: fmt.Errorf("syncing: %w", After(time.Minute, "paused")), want: true},
+		{name: "aggregate of requeue requests", err: utilerrors.NewAggregate([]error{After(time.Minute, "paused"), After(time.Hour, "settling")}), want: true},
+		{name: "aggregate with a failure", err: utilerrors.NewAggregate([]error{After(time.Minute, "paused"), errors.New("forbidden")})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRequested(tt.err); got != tt.want {
+				t.Errorf("IsRequested(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
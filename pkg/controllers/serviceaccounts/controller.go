@@ -22,9 +22,17 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/batch"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/cachemiss"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/convergence"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/fairqueue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/logsampler"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	corev1informers "k8s.io/client-go/informers/core/v1"
@@ -50,6 +58,29 @@ type Controller struct {
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+
+	// queue is the queue backing the workqueue when it was replaced by a
+	// fairqueue. It is nil for the default workqueue.
+	queue *fairqueue.Queue
+
+	// inSync reports whether a ServiceAccount needs no sync. It is used to
+	// skip periodic resyncs of compliant objects. A nil func skips nothing.
+	inSync func(*corev1.ServiceAccount) bool
+
+	// convergence tracks the keys whose last sync did not succeed. A nil
+	// tracker tracks nothing.
+	convergence *convergence.Tracker
+
+	// startup paces the initial sweep. A nil gate does not pace.
+	startup *batch.Gate
+
+	// successLogs samples the log message of each successful sync. Errors
+	// are always reported. A nil sampler logs every sync.
+	successLogs *logsampler.Sampler
+
+	// cacheMisses tells the keys of deleted ServiceAccounts apart from the keys
+	// missing from a cache that has not caught up yet.
+	cacheMisses *cachemiss.Tracker
 }
 
 // NewController func for event handlers
@@ -62,6 +93,7 @@ func NewController(
 		serviceAccountSynced: serviceAccountInformer.Informer().HasSynced,
 		sync:                 sync,
 		workqueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ServiceAccounts"),
+		cacheMisses:          cachemiss.NewTracker(),
 	}
 
 	// Configure event handlers
@@ -70,8 +102,29 @@ func NewController(
 	serviceAccountInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: controller.EnqueueServiceAccount,
 		UpdateFunc: func(old, new interface{}) {
+			newServiceAccount := new.(*corev1.ServiceAccount)
+			oldServiceAccount := old.(*corev1.ServiceAccount)
+
+			// Periodic resyncs deliver unchanged objects; compliant ones
+			// would only be synced to a no-op.
+			if newServiceAccount.ResourceVersion == oldServiceAccount.ResourceVersion &&
+				controller.inSync != nil && controller.inSync(newServiceAccount) {
+				return
+			}
+
 			controller.EnqueueServiceAccount(new)
 		},
+		// Deleted service accounts are processed once more so that their
+		// key, queued before the delete, is known to be gone.
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				utilruntime.HandleError(err)
+				return
+			}
+			controller.cacheMisses.Deleted(key)
+			controller.workqueue.Add(key)
+		},
 	})
 
 	return controller
@@ -94,6 +147,8 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
+	c.startup.Start(c.workqueue.Len())
+
 	klog.Info("starting workers")
 	// Launch two workers to process ServiceAccount resources
 	for i := 0; i < threadiness; i++ {
@@ -117,6 +172,11 @@ func (c *Controller) runWorker() {
 
 // processNextWorkItem will read a single work item off the workqueue and
 // attempt to process it, by calling the syncHandler.
+//
+// The workqueue never hands the same key to two workers at once: a key added
+// while it is being processed is held back until Done is called and is then
+// processed again. Every event for a key, whichever informer it came from,
+// is therefore serialized as long as Done is called exactly once per Get.
 func (c *Controller) processNextWorkItem() bool {
 	obj, shutdown := c.workqueue.Get()
 
@@ -124,6 +184,8 @@ func (c *Controller) processNextWorkItem() bool {
 		return false
 	}
 
+	c.startup.Wait()
+
 	// We wrap this block in a func so we can defer c.workqueue.Done.
 	err := func(obj interface{}) error {
 		// We call Done here so the workqueue knows we have finished
@@ -151,14 +213,38 @@ func (c *Controller) processNextWorkItem() bool {
 		// Run the syncHandler, passing it the serviceaccount/name string of the
 		// ServiceAccount resource to be synced.
 		if err := c.syncHandler(key); err != nil {
+			// A sync that asked to be requeued, such as one of a paused
+			// namespace, is deferred on purpose rather than failing to
+			// converge.
+			if requeue.IsRequested(err) {
+				c.convergence.Synced(key)
+			} else {
+				c.convergence.Failed(key)
+			}
+
+			// The sync asked to be retried later, or failed with a
+			// transient error that deserves a longer delay.
+			if after, ok := requeue.Delay(err); ok {
+				c.workqueue.Forget(obj)
+				c.workqueue.AddAfter(key, after)
+				if requeue.IsRequested(err) {
+					klog.V(4).Infof("Requeuing '%s': %s", key, redact.Error(err))
+					return nil
+				}
+				return fmt.Errorf("error syncing '%s': %s, requeuing after %s", key, redact.Error(err), after)
+			}
+
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+			return fmt.Errorf("error syncing '%s': %s, requeuing", key, redact.Error(err))
 		}
 		// Finally, if no error occurs we Forget this item so it does not
 		// get queued again until another change happens.
 		c.workqueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
+		c.convergence.Synced(key)
+		if c.successLogs.Sample() {
+			klog.Infof("Successfully synced '%s'", key)
+		}
 		return nil
 	}(obj)
 
@@ -180,14 +266,14 @@ func (c *Controller) syncHandler(key string) error {
 	serviceAccount, err := c.serviceAccountLister.ServiceAccounts(components[0]).Get(components[1])
 	if err != nil {
 		// The ServiceAccount resource may no longer exist, in which case we stop
-		// processing.
+		// processing, or not be cached yet.
 		if errors.IsNotFound(err) {
-			utilruntime.HandleError(fmt.Errorf("service account '%s' in work queue no longer exists", key))
-			return nil
+			return c.cacheMisses.Missing(key)
 		}
 
 		return err
 	}
+	c.cacheMisses.Found(key)
 
 	return c.sync(serviceAccount)
 }
@@ -205,11 +291,121 @@ func (c *Controller) EnqueueServiceAccount(obj interface{}) {
 	c.workqueue.Add(key)
 }
 
+// UseNamespaceFairQueue replaces the workqueue with one that takes turns
+// between namespaces, reporting its metrics to the provider. It must be called
+// before the informer is started.
+func (c *Controller) UseNamespaceFairQueue(provider workqueue.MetricsProvider) {
+	c.useQueue(fairqueue.New("ServiceAccounts", provider))
+}
+
+// UsePriorityQueue processes the ServiceAccounts whose namespace/name key
+// priority returns true for before the others. It keeps the namespace fair
+// queue if one is used, and otherwise replaces the workqueue with a FIFO one
+// reporting its metrics to the provider. It must be called after
+// UseNamespaceFairQueue and before the informer is started.
+func (c *Controller) UsePriorityQueue(priority func(key string) bool, provider workqueue.MetricsProvider) {
+	if c.queue == nil {
+		c.useQueue(fairqueue.NewFIFO("ServiceAccounts", provider))
+	}
+
+	c.queue.SetPriorityFunc(func(item interface{}) bool {
+		key, ok := item.(string)
+		return ok && priority(key)
+	})
+}
+
+// useQueue replaces the workqueue with one backed by queue.
+func (c *Controller) useQueue(queue *fairqueue.Queue) {
+	c.queue = queue
+	c.workqueue = workqueue.NewRateLimitingQueueWithConfig(workqueue.DefaultControllerRateLimiter(), workqueue.RateLimitingQueueConfig{
+		Name: "ServiceAccounts",
+		DelayingQueue: workqueue.NewDelayingQueueWithConfig(workqueue.DelayingQueueConfig{
+			Name:  "ServiceAccounts",
+			Queue: queue,
+		}),
+	})
+}
+
+// SetInSyncFunc skips the periodic resyncs of the ServiceAccounts for which
+// inSync returns true. Real changes are always enqueued. It must be called
+// before the informer is started.
+func (c *Controller) SetInSyncFunc(inSync func(*corev1.ServiceAccount) bool) {
+	c.inSync = inSync
+}
+
+// SetConvergenceTracker records the keys whose last sync did not succeed in
+// the tracker. It must be called before Run.
+func (c *Controller) SetConvergenceTracker(tracker *convergence.Tracker) {
+	c.convergence = tracker
+}
+
+// SetStartupGate paces the processing of the keys queued when the workers
+// start, the initial sweep, with the gate. It must be called before Run.
+func (c *Controller) SetStartupGate(gate *batch.Gate) {
+	c.startup = gate
+}
+
+// SetSuccessLogSampler samples the log messages of successful syncs. It must
+// be called before Run.
+func (c *Controller) SetSuccessLogSampler(sampler *logsampler.Sampler) {
+	c.successLogs = sampler
+}
+
+// SetCacheMissRetries retries the keys missing from the cache that were not
+// observed deleted, such as the ones enqueued by name before the informer
+// delivered the ServiceAccount, up to retries times, delay apart.
+func (c *Controller) SetCacheMissRetries(retries int, delay time.Duration) {
+	c.cacheMisses.SetRetries(retries, delay)
+}
+
+// EnqueueKey puts the namespace/name key of a ServiceAccount onto the work
+// queue, for callers that do not hold the object.
+func (c *Controller) EnqueueKey(key string) {
+	c.workqueue.Add(key)
+}
+
+// EnqueueAll puts every ServiceAccount resource in the informer cache onto
+// the work queue and returns how many were enqueued. Keys that are already
+// waiting in the queue are deduplicated by the workqueue.
+func (c *Controller) EnqueueAll() int {
+	serviceAccounts, err := c.serviceAccountLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return 0
+	}
+
+	for _, serviceAccount := range serviceAccounts {
+		c.EnqueueServiceAccount(serviceAccount)
+	}
+
+	return len(serviceAccounts)
+}
+
+// EnqueueNamespace puts every ServiceAccount resource of the namespace in the
+// informer cache onto the work queue and returns how many were enqueued.
+func (c *Controller) EnqueueNamespace(namespace string) int {
+	serviceAccounts, err := c.serviceAccountLister.ServiceAccounts(namespace).List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return 0
+	}
+
+	for _, serviceAccount := range serviceAccounts {
+		c.EnqueueServiceAccount(serviceAccount)
+	}
+
+	return len(serviceAccounts)
+}
+
 // HandleObject will take any resource implementing metav1.Object and attempt
 // to find the ServiceAccount resource that 'owns' it. It does this by looking at the
 // objects metadata.ownerReferences field for an appropriate OwnerReference.
 // It then enqueues that ServiceAccount resource to be processed. If the object does not
 // have an appropriate OwnerReference, it will simply be skipped.
+//
+// HandleObject accepts the cache.DeletedFinalStateUnknown tombstones that
+// informers deliver when a delete was missed, so it is safe to register it
+// directly as a DeleteFunc.
 func (c *Controller) HandleObject(obj interface{}) {
 	var object metav1.Object
 	var ok bool
@@ -224,9 +420,9 @@ func (c *Controller) HandleObject(obj interface{}) {
 			utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
 			return
 		}
-		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", object.GetName())
+		klog.V(4).Infof("Recovered deleted object '%s' from tombstone", cache.MetaObjectToName(object))
 	}
-	klog.V(4).Infof("Processing object: %s", object.GetName())
+	klog.V(4).Infof("Processing object: %s", cache.MetaObjectToName(object))
 	if ownerRef := metav1.GetControllerOf(object); ownerRef != nil {
 		// If this object is not owned by a ServiceAccount, we should not do anything more
 		// with it.
@@ -236,7 +432,7 @@ func (c *Controller) HandleObject(obj interface{}) {
 
 		serviceaccount, err := c.serviceAccountLister.ServiceAccounts(object.GetNamespace()).Get(ownerRef.Name)
 		if err != nil {
-			klog.V(4).Infof("ignoring orphaned object '%s' of serviceaccount '%s'", object.GetSelfLink(), ownerRef.Name)
+			klog.V(4).Infof("ignoring orphaned object '%s' of serviceaccount '%s'", cache.MetaObjectToName(object), ownerRef.Name)
 			return
 		}
 
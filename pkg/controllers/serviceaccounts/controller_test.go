@@ -0,0 +1,171 @@
+package serviceaccounts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// newTestController returns a controller syncing the service accounts with
+// sync, whose cache holds the service accounts without running the informer.
+func newTestController(t *testing.T, sync serviceAccountSyncCallback, serviceAccounts ...*corev1.ServiceAccount) *Controller {
+	t.Helper()
+
+	serviceAccountInformer := kubeinformers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().ServiceAccounts()
+	for _, serviceAccount := range serviceAccounts {
+		if err := serviceAccountInformer.Informer().GetIndexer().Add(serviceAccount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewController(serviceAccountInformer, sync)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	return c
+}
+
+func TestHandleObject(t *testing.T) {
+	builder := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "team", UID: "builder-uid"}}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", UID: "team-uid"}}
+
+	secret := func(namespace string, owner metav1.Object, kind string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:            "builder-token",
+			Namespace:       namespace,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, corev1.SchemeGroupVersion.WithKind(kind))},
+		}}
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		want []string
+	}{
+		{name: "owned object", obj: secret("team", builder, "ServiceAccount"), want: []string{"team/builder"}},
+		{name: "tombstone", obj: cache.DeletedFinalStateUnknown{Key: "team/builder-token", Obj: secret("team", builder, "ServiceAccount")}, want: []string{"team/builder"}},
+		{name: "not owned by a service account", obj: secret("team", namespace, "Namespace")},
+		{name: "owner in another namespace", obj: secret("other", builder, "ServiceAccount")},
+		{name: "unowned", obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "team"}}},
+		{name: "invalid object", obj: "team/builder"},
+		{name: "invalid tombstone", obj: cache.DeletedFinalStateUnknown{Key: "team/builder-token", Obj: "team/builder"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestController(t, func(*corev1.ServiceAccount) error { return nil }, builder)
+
+			c.HandleObject(tt.obj)
+
+			var got []string
+			for c.workqueue.Len() > 0 {
+				key, _ := c.workqueue.Get()
+				got = append(got, key.(string))
+				c.workqueue.Done(key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enqueued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceAccountCreatedAfterSync(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team"}})
+	// The fake clientset does not replay the changes made between the list
+	// and the watch of an informer.
+	watching := make(chan struct{})
+	var once sync.Once
+	kubeClient.PrependWatchReactor("serviceaccounts", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := kubeClient.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() { close(watching) })
+		return true, w, err
+	})
+	factory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+
+	synced := make(chan string, 10)
+	c := NewController(factory.Core().V1().ServiceAccounts(), func(serviceAccount *corev1.ServiceAccount) error {
+		synced <- serviceAccount.Namespace + "/" + serviceAccount.Name
+		return nil
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	go func() {
+		if err := c.Run(1, stopCh); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	wait := func(want string) {
+		t.Helper()
+		select {
+		case got := <-synced:
+			if got != want {
+				t.Fatalf("synced %s, want %s", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s not synced", want)
+		}
+	}
+	wait("team/default")
+	<-watching
+
+	if _, err := kubeClient.CoreV1().ServiceAccounts("team").Create(context.Background(), &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "team"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	wait("team/builder")
+}
+
+// delayLimiter records the delays its rate limiter returns.
+type delayLimiter struct {
+	workqueue.RateLimiter
+	delays []time.Duration
+}
+
+func (l *delayLimiter) When(item interface{}) time.Duration {
+	delay := l.RateLimiter.When(item)
+	l.delays = append(l.delays, delay)
+	return delay
+}
+
+func TestProcessNextWorkItemBackoffReset(t *testing.T) {
+	errs := []error{errors.New("forbidden"), errors.New("forbidden"), nil, errors.New("forbidden")}
+	c := newTestController(t, func(*corev1.ServiceAccount) error {
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team"}})
+	limiter := &delayLimiter{RateLimiter: workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Minute)}
+	c.workqueue.ShutDown()
+	c.workqueue = workqueue.NewRateLimitingQueue(limiter)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	// Fail twice, succeed, then fail again: the failure after the success
+	// is retried with the base delay.
+	c.EnqueueKey("team/default")
+	c.processNextWorkItem()
+	c.processNextWorkItem()
+	c.processNextWorkItem()
+	c.EnqueueKey("team/default")
+	c.processNextWorkItem()
+
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond, time.Millisecond}; !reflect.DeepEqual(limiter.delays, want) {
+		t.Errorf("retry delays = %v, want %v", limiter.delays, want)
+	}
+	if requeues := c.workqueue.NumRequeues("team/default"); requeues != 1 {
+		t.Errorf("rate limited requeues = %d, want 1", requeues)
+	}
+}
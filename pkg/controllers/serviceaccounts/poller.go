@@ -0,0 +1,100 @@
+package serviceaccounts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/pager"
+	"k8s.io/klog"
+)
+
+// defaultPageSize is the number of ServiceAccounts requested per list page.
+const defaultPageSize = 500
+
+// Poller periodically lists every ServiceAccount and runs the sync callback
+// for each of them. It replaces the watch-based Controller where caching every
+// ServiceAccount is too expensive, at the cost of reacting only once per
+// interval.
+type Poller struct {
+	kubeClient    kubernetes.Interface
+	interval      time.Duration
+	labelSelector string
+
+	// Sync callback will run for each object
+	sync serviceAccountSyncCallback
+}
+
+// NewPoller returns a Poller listing the ServiceAccounts matching the label
+// selector every interval. An empty selector matches every ServiceAccount.
+func NewPoller(
+	kubeClient kubernetes.Interface,
+	interval time.Duration,
+	labelSelector string,
+	sync serviceAccountSyncCallback,
+) *Poller {
+	return &Poller{
+		kubeClient:    kubeClient,
+		interval:      interval,
+		labelSelector: labelSelector,
+		sync:          sync,
+	}
+}
+
+// Run polls immediately and then every interval until stopCh is closed.
+func (p *Poller) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	klog.Infof("polling service accounts every %s", p.interval)
+
+	ctx := wait.ContextForChannel(stopCh)
+	wait.Until(func() { p.poll(ctx) }, p.interval, stopCh)
+}
+
+// poll lists the ServiceAccounts page by page and syncs each of them, and
+// returns how many were synced, deferred and failed. A sync that asked to be
+// requeued, such as one waiting for its secret, is deferred rather than
+// failed. Both are retried on the next poll.
+func (p *Poller) poll(ctx context.Context) (synced, deferred, failed int) {
+	listPager := pager.New(pager.SimplePageFunc(func(options metav1.ListOptions) (runtime.Object, error) {
+		return p.kubeClient.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(ctx, options)
+	}))
+	listPager.PageSize = defaultPageSize
+
+	err := listPager.EachListItem(ctx, metav1.ListOptions{LabelSelector: p.labelSelector}, func(obj runtime.Object) error {
+		serviceAccount, ok := obj.(*corev1.ServiceAccount)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("expected ServiceAccount in list but got %#v", obj))
+			return nil
+		}
+
+		if err := p.sync(serviceAccount); err != nil {
+			if requeue.IsRequested(err) {
+				deferred++
+				klog.V(4).Infof("Deferring '%s/%s' to the next poll: %s", serviceAccount.Namespace, serviceAccount.Name, redact.Error(err))
+				return nil
+			}
+
+			failed++
+			utilruntime.HandleError(fmt.Errorf("error syncing '%s/%s': %s, retrying on the next poll", serviceAccount.Namespace, serviceAccount.Name, redact.Error(err)))
+			return nil
+		}
+
+		synced++
+		return nil
+	})
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error listing service accounts: %s", err.Error()))
+	}
+
+	klog.Infof("Polled service accounts: %d synced, %d deferred, %d failed", synced, deferred, failed)
+	return synced, deferred, failed
+}
@@ -0,0 +1,52 @@
+package serviceaccounts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/controllers/requeue"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPollerPoll(t *testing.T) {
+	serviceAccount := func(namespace, name string, labels map[string]string) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+	kubeClient := fake.NewSimpleClientset(
+		serviceAccount("team", "default", nil),
+		serviceAccount("team", "builder", nil),
+		serviceAccount("paused", "default", nil),
+		serviceAccount("broken", "default", nil),
+		serviceAccount("team", "excluded", map[string]string{"aurora.example.com/exclude": "true"}),
+	)
+
+	var polled []string
+	sync := func(serviceAccount *corev1.ServiceAccount) error {
+		polled = append(polled, serviceAccount.Namespace+"/"+serviceAccount.Name)
+
+		switch serviceAccount.Namespace {
+		case "paused":
+			return requeue.After(time.Minute, "namespace %s is paused", serviceAccount.Namespace)
+		case "broken":
+			return errors.New("forbidden")
+		}
+		return nil
+	}
+
+	p := NewPoller(kubeClient, time.Minute, "aurora.example.com/exclude!=true", sync)
+	synced, deferred, failed := p.poll(context.Background())
+
+	sort.Strings(polled)
+	if want := []string{"broken/default", "paused/default", "team/builder", "team/default"}; !reflect.DeepEqual(polled, want) {
+		t.Errorf("polled %v, want %v", polled, want)
+	}
+	if synced != 2 || deferred != 1 || failed != 1 {
+		t.Errorf("poll() = %d synced, %d deferred, %d failed, want 2, 1 and 1", synced, deferred, failed)
+	}
+}
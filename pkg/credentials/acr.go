@@ -0,0 +1,278 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// acrUsername is the username ACR expects alongside a refresh token.
+	acrUsername = "00000000-0000-0000-0000-000000000000"
+
+	// acrResource is the audience of the AAD token exchanged with ACR.
+	acrResource = "https://management.azure.com/"
+
+	// acrDefaultTokenLifetime is assumed when the refresh token expiry
+	// cannot be read.
+	acrDefaultTokenLifetime = 3 * time.Hour
+
+	defaultIMDSEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+	defaultAuthorityHost = "https://login.microsoftonline.com/"
+)
+
+// AzureIdentity selects how the ACR provider obtains its AAD token.
+type AzureIdentity string
+
+const (
+	// AzureWorkloadIdentity exchanges the projected service account token
+	// of Azure Workload Identity for an AAD token.
+	AzureWorkloadIdentity AzureIdentity = "workload"
+
+	// AzureManagedIdentity requests an AAD token from the instance metadata
+	// service of the node's managed identity.
+	AzureManagedIdentity AzureIdentity = "managed"
+)
+
+// ACR is a Provider exchanging an AAD token for an Azure Container Registry
+// refresh token.
+type ACR struct {
+	// Registry is the login server, such as example.azurecr.io.
+	Registry string
+
+	Identity AzureIdentity
+	TenantID string
+
+	// ClientID selects a user-assigned managed identity, or the application
+	// of a workload identity. It is optional for system-assigned identities.
+	ClientID string
+
+	// FederatedTokenFile is the workload identity token file.
+	FederatedTokenFile string
+
+	// The endpoints default to the public Azure cloud when empty.
+	AuthorityHost string
+	IMDSEndpoint  string
+
+	// ExchangeEndpoint is the token exchange endpoint of the registry,
+	// https://<Registry>/oauth2/exchange when empty.
+	ExchangeEndpoint string
+
+	HTTPClient *http.Client
+}
+
+// NewACRFromEnvironment returns an ACR provider for the registry using the
+// environment variables injected by Azure Workload Identity, when present.
+func NewACRFromEnvironment(registry string, identity AzureIdentity) *ACR {
+	return &ACR{
+		Registry:           registry,
+		Identity:           identity,
+		TenantID:           os.Getenv("AZURE_TENANT_ID"),
+		ClientID:           os.Getenv("AZURE_CLIENT_ID"),
+		FederatedTokenFile: os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		AuthorityHost:      os.Getenv("AZURE_AUTHORITY_HOST"),
+		HTTPClient:         &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetDockerConfigJSON implements Provider.
+func (a *ACR) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	aadToken, err := a.aadToken(ctx)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("getting AAD token: %w", err)
+	}
+
+	refreshToken, err := a.exchange(ctx, aadToken)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("exchanging AAD token with %s: %w", a.Registry, err)
+	}
+
+	expiry, ok := jwtExpiry(refreshToken)
+	if !ok {
+		expiry = time.Now().Add(acrDefaultTokenLifetime)
+	}
+
+	data, err := dockerConfigJSON(a.Registry, acrUsername, refreshToken)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return data, expiry, nil
+}
+
+// aadToken returns an AAD access token for the configured identity.
+func (a *ACR) aadToken(ctx context.Context) (string, error) {
+	var req *http.Request
+	var err error
+
+	switch a.Identity {
+	case AzureWorkloadIdentity:
+		assertion, err := os.ReadFile(a.FederatedTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading federated token: %w", err)
+		}
+
+		authorityHost := a.AuthorityHost
+		if authorityHost == "" {
+			authorityHost = defaultAuthorityHost
+		}
+
+		form := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {a.ClientID},
+			"scope":                 {acrResource + ".default"},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}
+
+		endpoint := strings.TrimSuffix(authorityHost, "/") + "/" + a.TenantID + "/oauth2/v2.0/token"
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case AzureManagedIdentity:
+		endpoint := a.IMDSEndpoint
+		if endpoint == "" {
+			endpoint = defaultIMDSEndpoint
+		}
+
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {acrResource},
+		}
+		if a.ClientID != "" {
+			query.Set("client_id", a.ClientID)
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata", "true")
+	default:
+		return "", fmt.Errorf("unknown Azure identity %q", a.Identity)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.do(req, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("%s %s returned no access_token", req.Method, req.URL.Host)
+	}
+
+	return token.AccessToken, nil
+}
+
+// exchange trades the AAD token for an ACR refresh token.
+func (a *ACR) exchange(ctx context.Context, aadToken string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {a.Registry},
+		"access_token": {aadToken},
+	}
+	if a.TenantID != "" {
+		form.Set("tenant", a.TenantID)
+	}
+
+	endpoint := a.ExchangeEndpoint
+	if endpoint == "" {
+		endpoint = "https://" + a.Registry + "/oauth2/exchange"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := a.do(req, &token); err != nil {
+		return "", err
+	}
+	if token.RefreshToken == "" {
+		return "", fmt.Errorf("%s %s returned no refresh_token", req.Method, req.URL.Host)
+	}
+
+	return token.RefreshToken, nil
+}
+
+// do sends the request and decodes a successful JSON response into out.
+func (a *ACR) do(req *http.Request, out interface{}) error {
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned %s", req.Method, req.URL.Host, resp.Status)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// jwtExpiry returns the exp claim of a JWT without verifying it.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Exp, 0), true
+}
+
+// dockerConfigJSON builds a dockerconfigjson with a single registry entry.
+func dockerConfigJSON(registry, username, password string) ([]byte, error) {
+	type authEntry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+
+	return json.Marshal(struct {
+		Auths map[string]authEntry `json:"auths"`
+	}{
+		Auths: map[string]authEntry{
+			registry: {
+				Username: username,
+				Password: password,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	})
+}
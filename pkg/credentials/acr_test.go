@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestACR(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	refreshJWT := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiry.Unix()))) + ".sig"
+
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		identity     AzureIdentity
+		clientID     string
+		accessToken  string
+		refreshToken string
+		// exchangeStatus is the status of the token exchange, 200 when zero.
+		exchangeStatus int
+		wantExpiry     time.Time
+		wantErr        string
+	}{
+		{name: "workload identity", identity: AzureWorkloadIdentity, clientID: "app-id", accessToken: "aad-token", refreshToken: refreshJWT, wantExpiry: expiry},
+		{name: "managed identity", identity: AzureManagedIdentity, clientID: "identity-id", accessToken: "aad-token", refreshToken: refreshJWT, wantExpiry: expiry},
+		{name: "system-assigned managed identity", identity: AzureManagedIdentity, accessToken: "aad-token", refreshToken: refreshJWT, wantExpiry: expiry},
+		{name: "opaque refresh token", identity: AzureManagedIdentity, accessToken: "aad-token", refreshToken: "opaque"},
+		{name: "empty access token", identity: AzureManagedIdentity, refreshToken: refreshJWT, wantErr: "returned no access_token"},
+		{name: "empty refresh token", identity: AzureWorkloadIdentity, accessToken: "aad-token", wantErr: "returned no refresh_token"},
+		{name: "exchange refused", identity: AzureManagedIdentity, accessToken: "aad-token", refreshToken: refreshJWT, exchangeStatus: http.StatusUnauthorized, wantErr: "401 Unauthorized"},
+		{name: "unknown identity", identity: "certificate", wantErr: `unknown Azure identity "certificate"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			mux := http.NewServeMux()
+			writeToken := func(w http.ResponseWriter, field, value string) {
+				_ = json.NewEncoder(w).Encode(map[string]string{field: value})
+			}
+			mux.HandleFunc("/tenant-id/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, "aad")
+				if got := r.PostFormValue("client_assertion"); got != "federated-token" {
+					t.Errorf("client_assertion = %q, want the federated token", got)
+				}
+				if got := r.PostFormValue("client_id"); got != tt.clientID {
+					t.Errorf("client_id = %q, want %q", got, tt.clientID)
+				}
+				writeToken(w, "access_token", tt.accessToken)
+			})
+			mux.HandleFunc("/metadata/identity/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, "imds")
+				if r.Header.Get("Metadata") != "true" {
+					t.Error("IMDS request without the Metadata header")
+				}
+				if got := r.URL.Query().Get("client_id"); got != tt.clientID {
+					t.Errorf("client_id = %q, want %q", got, tt.clientID)
+				}
+				writeToken(w, "access_token", tt.accessToken)
+			})
+			mux.HandleFunc("/oauth2/exchange", func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, "exchange")
+				for field, want := range map[string]string{"grant_type": "access_token", "service": "example.azurecr.io", "access_token": tt.accessToken, "tenant": "tenant-id"} {
+					if got := r.PostFormValue(field); got != want {
+						t.Errorf("exchange %s = %q, want %q", field, got, want)
+					}
+				}
+				if tt.exchangeStatus != 0 {
+					w.WriteHeader(tt.exchangeStatus)
+					return
+				}
+				writeToken(w, "refresh_token", tt.refreshToken)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			a := &ACR{
+				Registry:           "example.azurecr.io",
+				Identity:           tt.identity,
+				TenantID:           "tenant-id",
+				ClientID:           tt.clientID,
+				FederatedTokenFile: tokenFile,
+				AuthorityHost:      server.URL,
+				IMDSEndpoint:       server.URL + "/metadata/identity/oauth2/token",
+				ExchangeEndpoint:   server.URL + "/oauth2/exchange",
+				HTTPClient:         server.Client(),
+			}
+
+			data, gotExpiry, err := a.GetDockerConfigJSON(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetDockerConfigJSON() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDockerConfigJSON() = %v", err)
+			}
+			if len(requests) != 2 || requests[1] != "exchange" {
+				t.Errorf("requests = %v, want an AAD token and then the exchange", requests)
+			}
+
+			var config struct {
+				Auths map[string]struct {
+					Username string `json:"username"`
+					Password string `json:"password"`
+					Auth     string `json:"auth"`
+				} `json:"auths"`
+			}
+			if err := json.Unmarshal(data, &config); err != nil {
+				t.Fatal(err)
+			}
+			auth := config.Auths["example.azurecr.io"]
+			if auth.Username != acrUsername || auth.Password != tt.refreshToken {
+				t.Errorf("auth = %s/%s, want %s and the refresh token", auth.Username, auth.Password, acrUsername)
+			}
+			if decoded, _ := base64.StdEncoding.DecodeString(auth.Auth); string(decoded) != acrUsername+":"+tt.refreshToken {
+				t.Errorf("auth = %q, want the encoded username and refresh token", decoded)
+			}
+
+			if tt.wantExpiry.IsZero() {
+				if lifetime := time.Until(gotExpiry); lifetime <= acrDefaultTokenLifetime-time.Minute || lifetime > acrDefaultTokenLifetime {
+					t.Errorf("expiry in %s, want the default lifetime of %s", lifetime, acrDefaultTokenLifetime)
+				}
+			} else if !gotExpiry.Equal(tt.wantExpiry) {
+				t.Errorf("expiry = %s, want %s", gotExpiry, tt.wantExpiry)
+			}
+		})
+	}
+}
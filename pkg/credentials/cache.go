@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+	"k8s.io/klog"
+)
+
+const (
+	// refreshBeforeExpiry is how long before expiry a credential is renewed.
+	refreshBeforeExpiry = 5 * time.Minute
+
+	// retryInterval is how long to wait before retrying a failed refresh.
+	retryInterval = 30 * time.Second
+)
+
+// Cache holds the most recent credential of a Provider and refreshes it
+// before it expires, so that reconciles never call the provider directly.
+type Cache struct {
+	provider Provider
+
+	// staticRefreshInterval is how often a credential without an expiry is
+	// re-read, or zero to only re-read it when a Watcher reports a change.
+	staticRefreshInterval time.Duration
+
+	mu     sync.RWMutex
+	data   []byte
+	expiry time.Time
+}
+
+// NewCache returns a Cache for the provider.
+func NewCache(provider Provider, staticRefreshInterval time.Duration) *Cache {
+	return &Cache{
+		provider:              provider,
+		staticRefreshInterval: staticRefreshInterval,
+	}
+}
+
+// Get returns the most recently fetched credential.
+func (c *Cache) Get() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.data
+}
+
+// Refresh fetches the credential from the provider and reports whether it
+// changed.
+func (c *Cache) Refresh(ctx context.Context) (bool, error) {
+	data, expiry, err := c.provider.GetDockerConfigJSON(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := !bytes.Equal(c.data, data)
+	c.data = data
+	c.expiry = expiry
+
+	return changed, nil
+}
+
+// nextRefresh returns how long to wait before the next scheduled refresh,
+// or zero if no refresh is scheduled.
+func (c *Cache) nextRefresh() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.expiry.IsZero() {
+		return c.staticRefreshInterval
+	}
+
+	wait := time.Until(c.expiry) - refreshBeforeExpiry
+	if wait < time.Second {
+		wait = time.Second
+	}
+
+	return wait
+}
+
+// Run refreshes the credential before it expires, on the static refresh
+// interval, and whenever the provider's Watcher reports a change, calling
+// onChange after every refresh that changed the credential. It blocks until
+// ctx is cancelled.
+func (c *Cache) Run(ctx context.Context, onChange func()) {
+	watchEvents := make(chan struct{}, 1)
+	if watcher, ok := c.provider.(Watcher); ok {
+		go func() {
+			err := watcher.Watch(ctx.Done(), func() {
+				select {
+				case watchEvents <- struct{}{}:
+				default:
+				}
+			})
+			if err != nil {
+				klog.Errorf("error watching credentials: %s", redact.Error(err))
+			}
+		}()
+	}
+
+	wait := c.nextRefresh()
+	for {
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-timerC:
+		case <-watchEvents:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+
+		changed, err := c.Refresh(ctx)
+		if err != nil {
+			klog.Errorf("error refreshing credentials, retrying in %s: %s", retryInterval, redact.Error(err))
+			wait = retryInterval
+			continue
+		}
+
+		if changed {
+			klog.Info("Credentials changed, resyncing all namespaces")
+			onChange()
+		}
+
+		wait = c.nextRefresh()
+	}
+}
@@ -0,0 +1,98 @@
+package credentials
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotating is a test double Provider returning each credential in turn, the
+// last one forever, with the expiry returned by expiry.
+type rotating struct {
+	mu          sync.Mutex
+	credentials []string
+	expiry      func() time.Time
+	calls       int
+}
+
+// GetDockerConfigJSON implements Provider.
+func (r *rotating) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	credential := r.credentials[min(r.calls, len(r.credentials)-1)]
+	r.calls++
+
+	return []byte(credential), r.expiry(), nil
+}
+
+func TestCacheRefresh(t *testing.T) {
+	provider := &rotating{credentials: []string{"first", "first", "second"}, expiry: func() time.Time { return time.Time{} }}
+	cache := NewCache(provider, 0)
+
+	for i, want := range []bool{true, false, true} {
+		changed, err := cache.Refresh(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != want {
+			t.Errorf("refresh %d changed = %v, want %v", i+1, changed, want)
+		}
+	}
+	if got := string(cache.Get()); got != "second" {
+		t.Errorf("credential = %s, want second", got)
+	}
+}
+
+func TestCacheNextRefresh(t *testing.T) {
+	tests := []struct {
+		name                  string
+		expiry                time.Time
+		staticRefreshInterval time.Duration
+		want                  time.Duration
+	}{
+		{name: "static", staticRefreshInterval: time.Hour, want: time.Hour},
+		{name: "static without refresh"},
+		{name: "expiring", expiry: time.Now().Add(time.Hour), staticRefreshInterval: time.Minute, want: time.Hour - refreshBeforeExpiry},
+		{name: "expiring soon", expiry: time.Now().Add(refreshBeforeExpiry), want: time.Second},
+		{name: "expired", expiry: time.Now().Add(-time.Hour), want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(&rotating{credentials: []string{"credential"}, expiry: func() time.Time { return tt.expiry }}, tt.staticRefreshInterval)
+			if _, err := cache.Refresh(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// The expiring waits are computed from the current time.
+			if got := cache.nextRefresh(); got > tt.want || got < tt.want-time.Minute {
+				t.Errorf("nextRefresh = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheRunRefreshesBeforeExpiry(t *testing.T) {
+	// Every credential is due for renewal as soon as it is returned.
+	provider := &rotating{credentials: []string{"first", "second"}, expiry: func() time.Time { return time.Now().Add(refreshBeforeExpiry) }}
+	cache := NewCache(provider, 0)
+	if _, err := cache.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go cache.Run(ctx, func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the expiring credential was not refreshed")
+	}
+	if got := string(cache.Get()); got != "second" {
+		t.Errorf("credential = %s, want second", got)
+	}
+}
@@ -0,0 +1,69 @@
+package credentials
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gccloudone-aurora/aurora-controller/pkg/redact"
+	"k8s.io/klog"
+)
+
+// failoverRetryInterval is how often the primary is retried while the fallback
+// is in use.
+const failoverRetryInterval = time.Minute
+
+// Failover is a Provider using the Fallback credential while the Primary cannot
+// be fetched, and switching back as soon as it recovers.
+type Failover struct {
+	Primary  Provider
+	Fallback Provider
+
+	mu            sync.Mutex
+	usingFallback bool
+}
+
+// GetDockerConfigJSON implements Provider. While the fallback is in use, the
+// returned expiry makes the Cache retry the primary every minute.
+func (f *Failover) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	data, expiry, err := f.Primary.GetDockerConfigJSON(ctx)
+	if err == nil {
+		f.setUsingFallback(false, nil)
+		return data, expiry, nil
+	}
+
+	data, expiry, fallbackErr := f.Fallback.GetDockerConfigJSON(ctx)
+	if fallbackErr != nil {
+		klog.Errorf("error fetching the fallback credential: %s", redact.Error(fallbackErr))
+		return nil, time.Time{}, err
+	}
+
+	f.setUsingFallback(true, err)
+
+	retry := time.Now().Add(refreshBeforeExpiry + failoverRetryInterval)
+	if expiry.IsZero() || retry.Before(expiry) {
+		expiry = retry
+	}
+
+	return data, expiry, nil
+}
+
+// setUsingFallback logs the transitions between the primary and the fallback.
+func (f *Failover) setUsingFallback(usingFallback bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case usingFallback && !f.usingFallback:
+		klog.Warningf("error fetching the primary credential, using the fallback credential: %s", redact.Error(err))
+	case !usingFallback && f.usingFallback:
+		klog.Info("Primary credential recovered, no longer using the fallback credential")
+	}
+
+	f.usingFallback = usingFallback
+}
+
+// Watch implements Watcher by watching the primary and the fallback.
+func (f *Failover) Watch(stopCh <-chan struct{}, onChange func()) error {
+	return watchProviders([]Provider{f.Primary, f.Fallback}, stopCh, onChange)
+}
@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailover(t *testing.T) {
+	const (
+		primaryDockerConfigJSON  = `{"auths":{"registry.example.com":{"auth":"cHJpbWFyeTpwYXNz"}}}`
+		fallbackDockerConfigJSON = `{"auths":{"mirror.example.com":{"auth":"ZmFsbGJhY2s6cGFzcw=="}}}`
+	)
+	primaryExpiry := time.Now().Add(12 * time.Hour)
+	tokenEndpointDown := errors.New("token endpoint unavailable")
+
+	primary := &expiring{data: primaryDockerConfigJSON, expiry: primaryExpiry}
+	fallback := &expiring{data: fallbackDockerConfigJSON}
+	f := &Failover{Primary: primary, Fallback: fallback}
+
+	steps := []struct {
+		name        string
+		primaryErr  error
+		fallbackErr error
+		want        string
+		wantErr     error
+		// wantRetry is whether the expiry schedules a retry of the
+		// primary rather than being its own.
+		wantRetry     bool
+		usingFallback bool
+	}{
+		{name: "primary", want: primaryDockerConfigJSON},
+		{name: "primary fails", primaryErr: tokenEndpointDown, want: fallbackDockerConfigJSON, wantRetry: true, usingFallback: true},
+		{name: "primary still failing", primaryErr: tokenEndpointDown, want: fallbackDockerConfigJSON, wantRetry: true, usingFallback: true},
+		{name: "fallback fails too", primaryErr: tokenEndpointDown, fallbackErr: errors.New("file not found"), wantErr: tokenEndpointDown, usingFallback: true},
+		{name: "primary recovers", want: primaryDockerConfigJSON},
+	}
+
+	for _, step := range steps {
+		primary.err, fallback.err = step.primaryErr, step.fallbackErr
+
+		data, expiry, err := f.GetDockerConfigJSON(context.Background())
+		if step.wantErr != nil {
+			if !errors.Is(err, step.wantErr) {
+				t.Errorf("%s: GetDockerConfigJSON = %v, want %v", step.name, err, step.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: GetDockerConfigJSON = %v", step.name, err)
+		} else {
+			if string(data) != step.want {
+				t.Errorf("%s: credential = %s, want %s", step.name, data, step.want)
+			}
+			if step.wantRetry {
+				// The Cache renews refreshBeforeExpiry before the expiry.
+				if retry := time.Until(expiry) - refreshBeforeExpiry; retry <= 0 || retry > failoverRetryInterval {
+					t.Errorf("%s: primary retried in %s, want within %s", step.name, retry, failoverRetryInterval)
+				}
+			} else if !expiry.Equal(primaryExpiry) {
+				t.Errorf("%s: expiry = %s, want the primary's %s", step.name, expiry, primaryExpiry)
+			}
+		}
+		if f.usingFallback != step.usingFallback {
+			t.Errorf("%s: using fallback = %v, want %v", step.name, f.usingFallback, step.usingFallback)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog"
+)
+
+// File is a Provider reading the credential from a file, such as one mounted
+// from a Secret.
+type File struct {
+	Path string
+}
+
+// GetDockerConfigJSON implements Provider.
+func (f *File) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading %s: %w", f.Path, err)
+	}
+
+	return data, time.Time{}, nil
+}
+
+// Watch implements Watcher.
+//
+// Kubernetes updates mounted Secrets by writing a new timestamped directory
+// and atomically swapping the ..data symlink, so the file itself is never
+// written in place and a watch on it would be lost after the first update.
+// The parent directory is watched instead and every event in it is reported.
+func (f *File) Watch(stopCh <-chan struct{}, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(f.Path)); err != nil {
+		return fmt.Errorf("watching %s: %w", filepath.Dir(f.Path), err)
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			klog.V(4).Infof("Observed %s on %s", event.Op, event.Name)
+			onChange()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			klog.Errorf("error watching %s: %v", f.Path, err)
+		}
+	}
+}
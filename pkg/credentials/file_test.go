@@ -0,0 +1,83 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mountSecret lays out the credential as the kubelet mounts a Secret key, a
+// symlink to the ..data symlink to a timestamped directory, or swaps ..data
+// to a new directory when the mount already exists.
+func mountSecret(t *testing.T, dir, version, dockerConfigJSON string) {
+	t.Helper()
+
+	if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, ".dockerconfigjson"), []byte(dockerConfigJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(version, filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, ".dockerconfigjson")); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join("..data", ".dockerconfigjson"), filepath.Join(dir, ".dockerconfigjson")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileSymlinkSwap(t *testing.T) {
+	const (
+		before = `{"auths":{"registry.example.com":{"auth":"b2xkOnBhc3M="}}}`
+		after  = `{"auths":{"registry.example.com":{"auth":"bmV3OnBhc3M="}}}`
+	)
+
+	dir := t.TempDir()
+	mountSecret(t, dir, "..2026_10_14_10_00_01", before)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewCache(&File{Path: filepath.Join(dir, ".dockerconfigjson")}, 0)
+	if _, err := cache.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(cache.Get()); got != before {
+		t.Fatalf("credential = %s, want %s", got, before)
+	}
+
+	changed := make(chan struct{}, 1)
+	go cache.Run(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// Swap the mount until the watch, started asynchronously, observes it.
+	for i := 2; ; i++ {
+		if i > 50 {
+			t.Fatal("the credential update was not observed")
+		}
+		mountSecret(t, dir, fmt.Sprintf("..2026_10_14_10_00_%02d", i), after)
+
+		select {
+		case <-changed:
+		case <-time.After(100 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	if got := string(cache.Get()); got != after {
+		t.Errorf("credential = %s, want %s", got, after)
+	}
+}
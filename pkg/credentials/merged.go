@@ -0,0 +1,119 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ConflictPolicy decides how Merged handles a registry present in the
+// credentials of more than one provider.
+type ConflictPolicy string
+
+const (
+	// ConflictLastWins keeps the entry of the last provider.
+	ConflictLastWins ConflictPolicy = "last-wins"
+
+	// ConflictError fails the merge.
+	ConflictError ConflictPolicy = "error"
+)
+
+// Merged is a Provider combining the auths of several providers into a single
+// dockerconfigjson. Providers returning an empty credential are skipped, and
+// the merged credential is empty when no provider contributed an auth. It
+// expires with the first provider credential to expire.
+type Merged struct {
+	Providers []Provider
+	Conflicts ConflictPolicy
+}
+
+// GetDockerConfigJSON implements Provider.
+func (m *Merged) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	auths := map[string]json.RawMessage{}
+	owners := map[string]int{}
+	var expiry time.Time
+
+	for i, provider := range m.Providers {
+		data, providerExpiry, err := provider.GetDockerConfigJSON(ctx)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("credential source %d: %w", i+1, err)
+		}
+
+		if !providerExpiry.IsZero() && (expiry.IsZero() || providerExpiry.Before(expiry)) {
+			expiry = providerExpiry
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		var config struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, time.Time{}, fmt.Errorf("credential source %d: parsing dockerconfigjson: %w", i+1, err)
+		}
+
+		for registry, auth := range config.Auths {
+			if owner, ok := owners[registry]; ok && m.Conflicts == ConflictError {
+				return nil, time.Time{}, fmt.Errorf("registry %s is configured by credential sources %d and %d", registry, owner+1, i+1)
+			}
+
+			auths[registry] = auth
+			owners[registry] = i
+		}
+	}
+
+	// An empty auths would pass for a credential.
+	if len(auths) == 0 {
+		return nil, expiry, nil
+	}
+
+	// Map keys are marshalled in sorted order, so the result is stable.
+	data, err := json.Marshal(struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}{auths})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return data, expiry, nil
+}
+
+// Watch implements Watcher by watching every provider that is a Watcher.
+func (m *Merged) Watch(stopCh <-chan struct{}, onChange func()) error {
+	return watchProviders(m.Providers, stopCh, onChange)
+}
+
+// watchProviders watches every provider that is a Watcher until stopCh is
+// closed.
+func watchProviders(providers []Provider, stopCh <-chan struct{}, onChange func()) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for _, provider := range providers {
+		watcher, ok := provider.(Watcher)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := watcher.Watch(stopCh, onChange); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
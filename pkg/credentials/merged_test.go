@@ -0,0 +1,106 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expiring is a Provider returning a credential expiring at a fixed time.
+type expiring struct {
+	data   string
+	expiry time.Time
+	err    error
+}
+
+// GetDockerConfigJSON implements Provider.
+func (e expiring) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	return []byte(e.data), e.expiry, e.err
+}
+
+func TestMerged(t *testing.T) {
+	const (
+		mirror  = `{"auths":{"mirror.example.com":{"auth":"bWlycm9yOnB1bGw="}}}`
+		private = `{"auths":{"registry.example.com":{"auth":"cHJpdmF0ZTpwdWxs"}}}`
+		rotated = `{"auths":{"mirror.example.com":{"auth":"cm90YXRlZDpwdWxs"}}}`
+	)
+	soon, later := time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)
+
+	tests := []struct {
+		name       string
+		providers  []Provider
+		conflicts  ConflictPolicy
+		want       string
+		wantExpiry time.Time
+		wantErr    string
+	}{
+		{
+			name:      "two providers",
+			providers: []Provider{Static(mirror), Static(private)},
+			want:      `{"auths":{"mirror.example.com":{"auth":"bWlycm9yOnB1bGw="},"registry.example.com":{"auth":"cHJpdmF0ZTpwdWxs"}}}`,
+		},
+		{
+			name:      "conflict last wins",
+			providers: []Provider{Static(mirror), Static(rotated)},
+			conflicts: ConflictLastWins,
+			want:      rotated,
+		},
+		{
+			name:      "conflict error",
+			providers: []Provider{Static(mirror), Static(rotated)},
+			conflicts: ConflictError,
+			wantErr:   "registry mirror.example.com is configured by credential sources 1 and 2",
+		},
+		{
+			name:      "empty provider skipped",
+			providers: []Provider{Static(""), Static(private)},
+			want:      private,
+		},
+		{
+			name:      "every provider empty",
+			providers: []Provider{Static(""), Static(`{"auths":{}}`)},
+			want:      "",
+		},
+		{
+			name:       "first expiry",
+			providers:  []Provider{expiring{data: mirror, expiry: later}, expiring{data: private, expiry: soon}, Static("")},
+			want:       `{"auths":{"mirror.example.com":{"auth":"bWlycm9yOnB1bGw="},"registry.example.com":{"auth":"cHJpdmF0ZTpwdWxs"}}}`,
+			wantExpiry: soon,
+		},
+		{
+			name:      "provider error",
+			providers: []Provider{Static(mirror), expiring{err: errors.New("token exchange failed")}},
+			wantErr:   "credential source 2: token exchange failed",
+		},
+		{
+			name:      "malformed credential",
+			providers: []Provider{Static(`{"auths":`)},
+			wantErr:   "credential source 1: parsing dockerconfigjson",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Merged{Providers: tt.providers, Conflicts: tt.conflicts}
+
+			data, expiry, err := m.GetDockerConfigJSON(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GetDockerConfigJSON() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDockerConfigJSON() = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("GetDockerConfigJSON() = %s, want %s", data, tt.want)
+			}
+			if !expiry.Equal(tt.wantExpiry) {
+				t.Errorf("expiry = %s, want %s", expiry, tt.wantExpiry)
+			}
+		})
+	}
+}
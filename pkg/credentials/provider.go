@@ -0,0 +1,31 @@
+// Package credentials provides the sources of the dockerconfigjson
+// credentials provisioned by the controllers.
+package credentials
+
+import (
+	"context"
+	"time"
+)
+
+// Provider is a source of dockerconfigjson credentials.
+type Provider interface {
+	// GetDockerConfigJSON returns the current credential and the time at
+	// which it expires. A zero expiry means the credential does not expire.
+	GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error)
+}
+
+// Watcher is implemented by providers that can detect changes to their
+// credential without being polled.
+type Watcher interface {
+	// Watch calls onChange whenever the credential may have changed. It
+	// blocks until stopCh is closed.
+	Watch(stopCh <-chan struct{}, onChange func()) error
+}
+
+// Static is a Provider returning a fixed credential.
+type Static []byte
+
+// GetDockerConfigJSON implements Provider.
+func (s Static) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	return s, time.Time{}, nil
+}
@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Secret is a Provider reading the credential from a key of a source Secret.
+type Secret struct {
+	KubeClient kubernetes.Interface
+	Namespace  string
+	Name       string
+	Key        string
+
+	// Informer, when set, caches the source Secret: once it has synced, the
+	// credential is read from its lister rather than from the API server,
+	// and Watch reports the changes of the Secret. It is started by the
+	// caller.
+	Informer coreinformers.SecretInformer
+}
+
+// GetDockerConfigJSON implements Provider.
+func (s *Secret) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	secret, err := s.get(ctx)
+	if errors.IsNotFound(err) {
+		// Distinguish a missing namespace, which usually means the source
+		// was misconfigured or its namespace was deleted.
+		if _, nsErr := s.KubeClient.CoreV1().Namespaces().Get(ctx, s.Namespace, metav1.GetOptions{}); errors.IsNotFound(nsErr) {
+			return nil, time.Time{}, fmt.Errorf("namespace %s of source secret %s does not exist", s.Namespace, s.Name)
+		}
+
+		return nil, time.Time{}, fmt.Errorf("source secret %s/%s does not exist", s.Namespace, s.Name)
+	} else if err != nil {
+		return nil, time.Time{}, fmt.Errorf("getting source secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	data, ok := secret.Data[s.Key]
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("source secret %s/%s has no key %s", s.Namespace, s.Name, s.Key)
+	}
+
+	return data, time.Time{}, nil
+}
+
+// get returns the source Secret from the cache once it has synced, or else
+// from the API server.
+func (s *Secret) get(ctx context.Context) (*corev1.Secret, error) {
+	if s.Informer != nil && s.Informer.Informer().HasSynced() {
+		return s.Informer.Lister().Secrets(s.Namespace).Get(s.Name)
+	}
+
+	return s.KubeClient.CoreV1().Secrets(s.Namespace).Get(ctx, s.Name, metav1.GetOptions{})
+}
+
+// Watch implements Watcher, calling onChange whenever the cached source
+// Secret is added or deleted, or its credential updated, but not on resyncs. Without an
+// Informer, it returns right away and the Secret is only re-read by polling.
+func (s *Secret) Watch(stopCh <-chan struct{}, onChange func()) error {
+	if s.Informer == nil {
+		return nil
+	}
+
+	isSource := func(obj interface{}) bool {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		secret, ok := obj.(*corev1.Secret)
+		return ok && secret.Namespace == s.Namespace && secret.Name == s.Name
+	}
+
+	registration, err := s.Informer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: isSource,
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				onChange()
+			},
+			UpdateFunc: func(old, new interface{}) {
+				if !bytes.Equal(old.(*corev1.Secret).Data[s.Key], new.(*corev1.Secret).Data[s.Key]) {
+					onChange()
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				onChange()
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("watching source secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	<-stopCh
+	return s.Informer.Informer().RemoveEventHandler(registration)
+}
+
+// Bootstrap creates the source Secret holding the dockerconfigjson under Key
+// if it does not exist yet, and reports whether it did. An existing Secret is
+// never modified, even if it lacks the key or holds another credential.
+func (s *Secret) Bootstrap(ctx context.Context, dockerConfigJSON []byte) (bool, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.Name,
+			Namespace: s.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			s.Key: dockerConfigJSON,
+		},
+	}
+	if s.Key == corev1.DockerConfigJsonKey {
+		secret.Type = corev1.SecretTypeDockerConfigJson
+	}
+
+	_, err := s.KubeClient.CoreV1().Secrets(s.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("creating source secret %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,161 @@
+package credentials
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSecret(t *testing.T) {
+	const dockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "aurora-system"}}
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-source", Namespace: "aurora-system"},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfigJSON)},
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		key     string
+		want    string
+		wantErr string
+	}{
+		{name: "source secret", objects: []runtime.Object{namespace, source}, key: corev1.DockerConfigJsonKey, want: dockerConfigJSON},
+		{name: "missing key", objects: []runtime.Object{namespace, source}, key: "config.json", wantErr: "source secret aurora-system/registry-source has no key config.json"},
+		{name: "missing source secret", objects: []runtime.Object{namespace}, key: corev1.DockerConfigJsonKey, wantErr: "source secret aurora-system/registry-source does not exist"},
+		{name: "missing source namespace", key: corev1.DockerConfigJsonKey, wantErr: "namespace aurora-system of source secret registry-source does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Secret{
+				KubeClient: fake.NewSimpleClientset(tt.objects...),
+				Namespace:  "aurora-system",
+				Name:       "registry-source",
+				Key:        tt.key,
+			}
+
+			got, _, err := s.GetDockerConfigJSON(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetDockerConfigJSON = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDockerConfigJSON = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetDockerConfigJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretInformer(t *testing.T) {
+	const (
+		dockerConfigJSON        = `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+		rotatedDockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"dXNlcjpyb3RhdGVk"}}}`
+	)
+
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-source", Namespace: "aurora-system"},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfigJSON)},
+	}
+	kubeClient := fake.NewSimpleClientset(source)
+
+	// The fake clientset does not replay the changes made between the list
+	// and the watch of an informer.
+	watching := make(chan struct{})
+	var once sync.Once
+	kubeClient.PrependWatchReactor("secrets", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := kubeClient.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		once.Do(func() { close(watching) })
+		return true, w, err
+	})
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	factory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, 0, kubeinformers.WithNamespace("aurora-system"))
+	s := &Secret{
+		KubeClient: kubeClient,
+		Namespace:  "aurora-system",
+		Name:       "registry-source",
+		Key:        corev1.DockerConfigJsonKey,
+		Informer:   factory.Core().V1().Secrets(),
+	}
+	s.Informer.Informer()
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	<-watching
+
+	changes := make(chan struct{}, 10)
+	go func() {
+		if err := s.Watch(stopCh, func() { changes <- struct{}{} }); err != nil {
+			t.Error(err)
+		}
+	}()
+	waitForChange := func(t *testing.T) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(10 * time.Second):
+			t.Fatal("source secret change not reported")
+		}
+	}
+	// The cached source secret is reported as added when the watch starts.
+	waitForChange(t)
+
+	// Reads hit the cache, not the API server.
+	kubeClient.ClearActions()
+	for i := 0; i < 3; i++ {
+		got, _, err := s.GetDockerConfigJSON(context.Background())
+		if err != nil {
+			t.Fatalf("GetDockerConfigJSON = %v", err)
+		}
+		if string(got) != dockerConfigJSON {
+			t.Errorf("GetDockerConfigJSON = %s, want %s", got, dockerConfigJSON)
+		}
+	}
+	if actions := kubeClient.Actions(); len(actions) != 0 {
+		t.Errorf("GetDockerConfigJSON called the API server: %v", actions)
+	}
+
+	// An update leaving the credential unchanged is not a change, but a
+	// rotated credential is, and is read from the cache.
+	updated := source.DeepCopy()
+	updated.Labels = map[string]string{"rotated": "false"}
+	if _, err := kubeClient.CoreV1().Secrets("aurora-system").Update(context.Background(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	updated = updated.DeepCopy()
+	updated.Data[corev1.DockerConfigJsonKey] = []byte(rotatedDockerConfigJSON)
+	if _, err := kubeClient.CoreV1().Secrets("aurora-system").Update(context.Background(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t)
+	select {
+	case <-changes:
+		t.Error("source secret update reported more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	got, _, err := s.GetDockerConfigJSON(context.Background())
+	if err != nil {
+		t.Fatalf("GetDockerConfigJSON = %v", err)
+	}
+	if string(got) != rotatedDockerConfigJSON {
+		t.Errorf("GetDockerConfigJSON after the rotation = %s, want %s", got, rotatedDockerConfigJSON)
+	}
+}
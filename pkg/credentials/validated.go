@@ -0,0 +1,61 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Validated is a Provider checking that the credential of another provider is
+// a plaintext dockerconfigjson. The API server base64 encodes secret data
+// itself, so a credential that was base64 encoded beforehand ends up encoded
+// twice in the secrets and cannot be used by the kubelet. Such a credential is
+// rejected with guidance, or decoded with DecodeBase64. Empty credentials are
+// passed through.
+type Validated struct {
+	Provider     Provider
+	DecodeBase64 bool
+}
+
+// GetDockerConfigJSON implements Provider.
+func (v *Validated) GetDockerConfigJSON(ctx context.Context) ([]byte, time.Time, error) {
+	data, expiry, err := v.Provider.GetDockerConfigJSON(ctx)
+	if err != nil || len(data) == 0 || json.Valid(data) {
+		return data, expiry, err
+	}
+
+	decoded, ok := decodeBase64JSON(data)
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("credential is not a valid dockerconfigjson")
+	}
+	if !v.DecodeBase64 {
+		return nil, time.Time{}, fmt.Errorf("credential is a base64 encoded dockerconfigjson, which would be encoded twice in the secrets: provide the plaintext JSON instead")
+	}
+
+	klog.V(4).Info("Decoding base64 encoded credential")
+	return decoded, expiry, nil
+}
+
+// Watch implements Watcher by watching the provider, if it is a Watcher.
+func (v *Validated) Watch(stopCh <-chan struct{}, onChange func()) error {
+	return watchProviders([]Provider{v.Provider}, stopCh, onChange)
+}
+
+// decodeBase64JSON decodes data as base64, padded or not, and reports whether
+// it held valid JSON.
+func decodeBase64JSON(data []byte) ([]byte, bool) {
+	data = bytes.TrimSpace(data)
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding} {
+		decoded, err := encoding.DecodeString(string(data))
+		if err == nil && json.Valid(decoded) {
+			return decoded, true
+		}
+	}
+
+	return nil, false
+}
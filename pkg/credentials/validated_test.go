@@ -0,0 +1,52 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestValidated(t *testing.T) {
+	const dockerConfigJSON = `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`
+	encoded := base64.StdEncoding.EncodeToString([]byte(dockerConfigJSON))
+
+	tests := []struct {
+		name         string
+		credential   string
+		decodeBase64 bool
+		want         string
+		wantErr      string
+	}{
+		{name: "plaintext", credential: dockerConfigJSON, want: dockerConfigJSON},
+		{name: "plaintext with decoding", credential: dockerConfigJSON, decodeBase64: true, want: dockerConfigJSON},
+		{name: "empty", credential: ""},
+		{name: "base64", credential: encoded, wantErr: "provide the plaintext JSON instead"},
+		{name: "base64 decoded", credential: encoded, decodeBase64: true, want: dockerConfigJSON},
+		{name: "unpadded base64 with a newline decoded", credential: strings.TrimRight(encoded, "=") + "\n", decodeBase64: true, want: dockerConfigJSON},
+		{name: "malformed", credential: `{"auths":`, decodeBase64: true, wantErr: "not a valid dockerconfigjson"},
+		{name: "base64 of malformed JSON", credential: base64.StdEncoding.EncodeToString([]byte(`{"auths":`)), decodeBase64: true, wantErr: "not a valid dockerconfigjson"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Validated{Provider: Static(tt.credential), DecodeBase64: tt.decodeBase64}
+
+			data, _, err := v.GetDockerConfigJSON(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GetDockerConfigJSON() = %v, want an error containing %q", err, tt.wantErr)
+				} else if strings.Contains(err.Error(), "dXNlcjpwYXNz") {
+					t.Errorf("error %q contains the credential", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDockerConfigJSON() = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("GetDockerConfigJSON() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package eventsink pushes reconcile notifications to an HTTP endpoint.
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+// Event is a notification posted as JSON to the sink.
+type Event struct {
+	// Reason is a CamelCase identifier such as SecretCreated.
+	Reason    string    `json:"reason"`
+	Type      string    `json:"type"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name,omitempty"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// Event types, matching the Kubernetes event types.
+const (
+	TypeNormal  = "Normal"
+	TypeWarning = "Warning"
+)
+
+// Sink posts events to a URL from a bounded buffer, so that a slow or
+// unavailable endpoint never blocks reconciles. Events sent while the buffer is
+// full are dropped. A nil Sink drops every event.
+type Sink struct {
+	url     string
+	client  *http.Client
+	events  chan Event
+	backoff wait.Backoff
+}
+
+// New returns a Sink posting to url and buffering up to size events.
+func New(url string, size int) *Sink {
+	return &Sink{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		events:  make(chan Event, size),
+		backoff: wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 5},
+	}
+}
+
+// Send queues the event without blocking.
+func (s *Sink) Send(event Event) {
+	if s == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		klog.Warningf("event sink buffer is full, dropping %s event for %s/%s", event.Reason, event.Namespace, event.Name)
+	}
+}
+
+// Run posts the queued events until stopCh is closed. Each event is retried
+// with exponential backoff before it is dropped.
+func (s *Sink) Run(stopCh <-chan struct{}) {
+	ctx := wait.ContextForChannel(stopCh)
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event := <-s.events:
+			if err := s.post(ctx, event); err != nil {
+				klog.Errorf("error posting %s event for %s/%s to the event sink: %v", event.Reason, event.Namespace, event.Name, err)
+			}
+		}
+	}
+}
+
+// post delivers the event, retrying failures.
+func (s *Sink) post(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	err = wait.ExponentialBackoffWithContext(ctx, s.backoff, func(ctx context.Context) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			lastErr = fmt.Errorf("unexpected status %s", resp.Status)
+			return false, nil
+		}
+
+		return true, nil
+	})
+	if wait.Interrupted(err) && lastErr != nil {
+		return lastErr
+	}
+
+	return err
+}
@@ -0,0 +1,174 @@
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// mockSink is an HTTP sink failing the first failures posts and recording
+// the events it accepts.
+type mockSink struct {
+	mu       sync.Mutex
+	failures int
+	posts    int
+	events   []Event
+}
+
+// roundTripperFunc is an http.RoundTripper calling itself.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (m *mockSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.posts++
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	if m.posts <= m.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var event Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.events = append(m.events, event)
+}
+
+// newTestSink returns a Sink posting to the mock, retrying without delay.
+func newTestSink(t *testing.T, mock *mockSink, size int) *Sink {
+	t.Helper()
+
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	s := New(server.URL, size)
+	s.backoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+	return s
+}
+
+func TestSinkPost(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		wantPosts int
+	}{
+		{name: "delivered", wantPosts: 1},
+		{name: "retried", failures: 2, wantPosts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockSink{failures: tt.failures}
+			s := newTestSink(t, mock, 10)
+
+			sent := Event{Reason: "SecretCreated", Type: TypeNormal, Namespace: "team", Name: "aurora-pull", Message: "Image pull secret created", Time: time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)}
+			if err := s.post(context.Background(), sent); err != nil {
+				t.Fatalf("post = %v", err)
+			}
+
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			if mock.posts != tt.wantPosts {
+				t.Errorf("posts = %d, want %d", mock.posts, tt.wantPosts)
+			}
+			if len(mock.events) != 1 || mock.events[0] != sent {
+				t.Errorf("events = %+v, want %+v", mock.events, sent)
+			}
+		})
+	}
+}
+
+func TestSinkRun(t *testing.T) {
+	mock := &mockSink{}
+	s := newTestSink(t, mock, 10)
+	// Signal the responses once the client has them, so that stopping the
+	// sink does not cancel the post in flight.
+	delivered := make(chan struct{}, 1)
+	s.client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		delivered <- struct{}{}
+		return resp, err
+	})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.Run(stopCh)
+
+	s.Send(Event{Reason: "SecretCreated", Type: TypeNormal, Namespace: "team", Name: "aurora-pull"})
+
+	select {
+	case <-delivered:
+	case <-time.After(10 * time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if len(mock.events) != 1 {
+		t.Fatalf("events = %+v, want the sent event", mock.events)
+	}
+	if mock.events[0].Time.IsZero() {
+		t.Error("event time not set by Send")
+	}
+}
+
+func TestSinkGivesUp(t *testing.T) {
+	mock := &mockSink{failures: 10}
+	s := newTestSink(t, mock, 10)
+
+	err := s.post(context.Background(), Event{Reason: "SyncFailed", Type: TypeWarning, Namespace: "team"})
+	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable") {
+		t.Errorf("post = %v, want the last status", err)
+	}
+	if mock.posts != 3 {
+		t.Errorf("posts = %d, want the 3 steps of the backoff", mock.posts)
+	}
+}
+
+func TestSinkBufferFull(t *testing.T) {
+	mock := &mockSink{}
+	s := newTestSink(t, mock, 1)
+
+	// Without Run, the buffer fills up and later events are dropped rather
+	// than blocking the caller.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Send(Event{Reason: "SecretCreated", Namespace: "team"})
+		s.Send(Event{Reason: "SecretCreated", Namespace: "other"})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Send blocked on a full buffer")
+	}
+
+	if len(s.events) != 1 {
+		t.Fatalf("%d buffered events, want 1", len(s.events))
+	}
+	if event := <-s.events; event.Namespace != "team" {
+		t.Errorf("buffered event of namespace %s, want the first one", event.Namespace)
+	}
+}
+
+func TestNilSink(t *testing.T) {
+	var s *Sink
+	s.Send(Event{Reason: "SecretCreated"})
+}
@@ -0,0 +1,134 @@
+// Package featuregate implements Kubernetes-style feature gates, set with a
+// single --feature-gates=Key=true,Other=false flag.
+package featuregate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature is the name of a gated feature.
+type Feature string
+
+// Stage is the maturity of a feature.
+type Stage string
+
+const (
+	// Alpha features are experimental and disabled by default.
+	Alpha Stage = "ALPHA"
+
+	// Beta features are well tested and usually enabled by default.
+	Beta Stage = "BETA"
+
+	// GA features are stable; their gates are kept for a release so that
+	// existing flags keep working.
+	GA Stage = "GA"
+)
+
+// Spec describes a feature.
+type Spec struct {
+	Default bool
+	Stage   Stage
+}
+
+// FeatureGate holds the known features and which of them are enabled. It
+// implements pflag.Value. It is safe for concurrent use.
+type FeatureGate struct {
+	known map[Feature]Spec
+
+	mu      sync.RWMutex
+	enabled map[Feature]bool
+}
+
+// New returns a FeatureGate for the known features, each in its default state.
+func New(known map[Feature]Spec) *FeatureGate {
+	return &FeatureGate{
+		known:   known,
+		enabled: map[Feature]bool{},
+	}
+}
+
+// Enabled reports whether the feature is enabled. Unknown features are
+// disabled.
+func (g *FeatureGate) Enabled(feature Feature) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if enabled, ok := g.enabled[feature]; ok {
+		return enabled
+	}
+
+	return g.known[feature].Default
+}
+
+// Set parses a comma-separated list of Feature=bool pairs. Unknown features
+// and invalid values are rejected and leave the gate unchanged.
+func (g *FeatureGate) Set(value string) error {
+	updates := map[Feature]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, rawValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("missing bool value for %s", name)
+		}
+
+		feature := Feature(strings.TrimSpace(name))
+		if _, ok := g.known[feature]; !ok {
+			return fmt.Errorf("unrecognized feature gate: %s", feature)
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s=%s, err: %v", feature, rawValue, err)
+		}
+
+		updates[feature] = enabled
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for feature, enabled := range updates {
+		g.enabled[feature] = enabled
+	}
+
+	return nil
+}
+
+// String returns the explicitly set features as Feature=bool pairs, sorted.
+func (g *FeatureGate) String() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	pairs := []string{}
+	for feature, enabled := range g.enabled {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", feature, enabled))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// Type implements pflag.Value.
+func (g *FeatureGate) Type() string {
+	return "mapStringBool"
+}
+
+// KnownFeatures returns a description of every known feature, sorted, for
+// use in help text.
+func (g *FeatureGate) KnownFeatures() []string {
+	known := []string{}
+	for feature, spec := range g.known {
+		known = append(known, fmt.Sprintf("%s=true|false (%s - default=%t)", feature, spec.Stage, spec.Default))
+	}
+	sort.Strings(known)
+
+	return known
+}
@@ -0,0 +1,101 @@
+package featuregate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	alphaFeature Feature = "AlphaFeature"
+	betaFeature  Feature = "BetaFeature"
+)
+
+var testFeatures = map[Feature]Spec{
+	alphaFeature: {Default: false, Stage: Alpha},
+	betaFeature:  {Default: true, Stage: Beta},
+}
+
+func TestFeatureGateSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[Feature]bool
+		wantErr string
+		// wantString is the String of the gate after Set.
+		wantString string
+	}{
+		{name: "defaults", want: map[Feature]bool{alphaFeature: false, betaFeature: true}},
+		{name: "enable alpha", value: "AlphaFeature=true", want: map[Feature]bool{alphaFeature: true, betaFeature: true}, wantString: "AlphaFeature=true"},
+		{
+			name: "several with spaces", value: " AlphaFeature=true , BetaFeature=false ,",
+			want: map[Feature]bool{alphaFeature: true, betaFeature: false}, wantString: "AlphaFeature=true,BetaFeature=false",
+		},
+		{name: "last wins", value: "AlphaFeature=true,AlphaFeature=false", want: map[Feature]bool{alphaFeature: false, betaFeature: true}, wantString: "AlphaFeature=false"},
+		{name: "unknown feature", value: "AlphaFeature=true,Unknown=true", wantErr: "unrecognized feature gate: Unknown"},
+		{name: "missing value", value: "AlphaFeature", wantErr: "missing bool value for AlphaFeature"},
+		{name: "invalid value", value: "AlphaFeature=yes", wantErr: `invalid value of AlphaFeature=yes, err: strconv.ParseBool: parsing "yes": invalid syntax`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := New(testFeatures)
+
+			err := gate.Set(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Set(%q) = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				// A rejected value leaves the gate unchanged.
+				if gate.Enabled(alphaFeature) || gate.String() != "" {
+					t.Errorf("gate = %q after a rejected Set, want it unchanged", gate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Set(%q) = %v", tt.value, err)
+			}
+
+			got := map[Feature]bool{}
+			for feature := range testFeatures {
+				got[feature] = gate.Enabled(feature)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enabled = %v, want %v", got, tt.want)
+			}
+			if gate.String() != tt.wantString {
+				t.Errorf("String() = %q, want %q", gate.String(), tt.wantString)
+			}
+		})
+	}
+}
+
+func TestFeatureGateUnknownDisabled(t *testing.T) {
+	if New(testFeatures).Enabled("Unknown") {
+		t.Error("unknown feature enabled")
+	}
+}
+
+func TestFeatureGateFlag(t *testing.T) {
+	gate := New(testFeatures)
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Var(gate, "feature-gates", "")
+
+	if err := flags.Parse([]string{"--feature-gates=AlphaFeature=true", "--feature-gates=BetaFeature=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if !gate.Enabled(alphaFeature) || gate.Enabled(betaFeature) {
+		t.Errorf("gate = %q, want repeated flags to accumulate", gate)
+	}
+}
+
+func TestKnownFeatures(t *testing.T) {
+	want := []string{
+		"AlphaFeature=true|false (ALPHA - default=false)",
+		"BetaFeature=true|false (BETA - default=true)",
+	}
+	if got := New(testFeatures).KnownFeatures(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownFeatures() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,89 @@
+// Package heartbeat periodically renews a Lease so that external tooling can
+// observe the liveness of a controller.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"k8s.io/utils/ptr"
+)
+
+// Heartbeat renews a Lease on a fixed interval.
+type Heartbeat struct {
+	kubeClient kubernetes.Interface
+
+	namespace string
+	name      string
+	holder    string
+	interval  time.Duration
+}
+
+// New returns a Heartbeat renewing the Lease namespace/name on behalf of
+// holder every interval.
+func New(kubeClient kubernetes.Interface, namespace, name, holder string, interval time.Duration) *Heartbeat {
+	return &Heartbeat{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		name:       name,
+		holder:     holder,
+		interval:   interval,
+	}
+}
+
+// Run renews the Lease until stopCh is closed.
+func (h *Heartbeat) Run(stopCh <-chan struct{}) {
+	klog.Infof("Renewing heartbeat lease %s/%s every %s", h.namespace, h.name, h.interval)
+
+	wait.Until(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+		defer cancel()
+
+		if err := h.renew(ctx); err != nil {
+			utilruntime.HandleError(fmt.Errorf("error renewing heartbeat lease %s/%s: %w", h.namespace, h.name, err))
+		}
+	}, h.interval, stopCh)
+}
+
+// renew creates the Lease if it does not exist and otherwise updates its
+// holder and renew time.
+func (h *Heartbeat) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+
+	// A heartbeat is considered stale after three missed renewals.
+	duration := ptr.To(int32(3 * h.interval / time.Second))
+
+	lease, err := h.kubeClient.CoordinationV1().Leases(h.namespace).Get(ctx, h.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = h.kubeClient.CoordinationV1().Leases(h.namespace).Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      h.name,
+				Namespace: h.namespace,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(h.holder),
+				LeaseDurationSeconds: duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = ptr.To(h.holder)
+	lease.Spec.LeaseDurationSeconds = duration
+	lease.Spec.RenewTime = &now
+
+	_, err = h.kubeClient.CoordinationV1().Leases(h.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,42 @@
+// Package logsampler thins out routine log messages.
+package logsampler
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Sampler allows one in every n calls to Sample. It is safe for concurrent use.
+// A nil Sampler allows every call.
+type Sampler struct {
+	every   uint64
+	counter atomic.Uint64
+}
+
+// New returns a Sampler allowing approximately the given fraction of calls.
+// Rates of 1 or more allow every call; rates of 0 or less allow none.
+func New(rate float64) *Sampler {
+	if rate >= 1 {
+		return &Sampler{every: 1}
+	}
+
+	if rate <= 0 {
+		return &Sampler{}
+	}
+
+	return &Sampler{every: uint64(math.Round(1 / rate))}
+}
+
+// Sample reports whether the current call should be logged. The first call is
+// always allowed.
+func (s *Sampler) Sample() bool {
+	if s == nil {
+		return true
+	}
+
+	if s.every == 0 {
+		return false
+	}
+
+	return (s.counter.Add(1)-1)%s.every == 0
+}
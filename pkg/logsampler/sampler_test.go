@@ -0,0 +1,68 @@
+package logsampler
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		sampler *Sampler
+		want    int
+	}{
+		{name: "nil", want: 100},
+		{name: "every call", sampler: New(1), want: 100},
+		{name: "above one", sampler: New(2), want: 100},
+		{name: "tenth", sampler: New(0.1), want: 10},
+		{name: "third", sampler: New(0.3), want: 34},
+		{name: "none", sampler: New(0), want: 0},
+		{name: "negative", sampler: New(-1), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampled := 0
+			for i := 0; i < 100; i++ {
+				if tt.sampler.Sample() {
+					sampled++
+				}
+			}
+			if sampled != tt.want {
+				t.Errorf("sampled %d of 100 calls, want %d", sampled, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplerFirstCall(t *testing.T) {
+	if !New(0.01).Sample() {
+		t.Error("first call not sampled")
+	}
+}
+
+func TestSamplerConcurrent(t *testing.T) {
+	sampler := New(0.25)
+
+	var mu sync.Mutex
+	sampled := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if sampler.Sample() {
+					mu.Lock()
+					sampled++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sampled != 200 {
+		t.Errorf("sampled %d of 800 concurrent calls, want 200", sampled)
+	}
+}
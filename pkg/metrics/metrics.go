@@ -0,0 +1,181 @@
+// Package metrics exposes the Prometheus metrics for the Aurora controllers.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "aurora_controller"
+
+// Registry holds every metric exported by the controllers.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// UnmanagedSecretSkipped counts the reconciles where an existing secret
+	// without the managed-by label was left untouched.
+	UnmanagedSecretSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unmanaged_secret_skipped_total",
+		Help:      "Number of times an existing secret not managed by the controller was skipped instead of overwritten.",
+	}, []string{"namespace", "secret"})
+
+	// NamespaceProvisionDuration observes the time from a namespace's
+	// creation to the creation of its image pull secret. It has no labels so
+	// that its cardinality does not grow with the number of namespaces.
+	NamespaceProvisionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "namespace_provision_duration_seconds",
+		Help:      "Time from namespace creation to the creation of its image pull secret.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 14),
+	})
+
+	// UnconvergedObjects is the number of objects whose last sync failed, per
+	// controller. Syncs that asked to be requeued are not counted.
+	UnconvergedObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "unconverged_objects",
+		Help:      "Number of objects whose last sync failed, rather than asked to be requeued.",
+	}, []string{"controller"})
+
+	// FailingObjects is the number of objects whose last sync failed, per
+	// controller, as recorded by the sweeps of the controller.
+	FailingObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "failing_objects",
+		Help:      "Number of objects whose last sync failed.",
+	}, []string{"controller"})
+
+	// LastSweepObjects is the number of objects of the latest full sweep by
+	// the outcome of their first sync, per controller.
+	LastSweepObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sweep_objects",
+		Help:      "Number of objects of the latest full sweep by outcome: succeeded, deferred or failed.",
+	}, []string{"controller", "outcome"})
+
+	// OrphanedSecrets is the number of managed secrets left in namespaces
+	// the controller no longer reconciles, as of the latest scan.
+	OrphanedSecrets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orphaned_secrets",
+		Help:      "Number of managed secrets in namespaces out of scope.",
+	})
+
+	// ManagedSecrets is the number of secrets carrying the managed-by label,
+	// as currently cached.
+	ManagedSecrets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_secrets_total",
+		Help:      "Number of secrets managed by the controller across the cluster.",
+	})
+
+	// InjectedServiceAccounts is the number of service accounts referencing
+	// a managed image pull secret, as currently cached.
+	InjectedServiceAccounts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "injected_serviceaccounts_total",
+		Help:      "Number of service accounts referencing an image pull secret managed by the controller across the cluster.",
+	})
+
+	// CompliantObjects is the number of objects a read-only controller found
+	// in the desired state, per controller.
+	CompliantObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "compliant_objects",
+		Help:      "Number of objects in the desired state, in read-only mode.",
+	}, []string{"controller"})
+
+	// NoncompliantObjects is the number of objects a read-only controller
+	// found drifted from the desired state, per controller.
+	NoncompliantObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "noncompliant_objects",
+		Help:      "Number of objects drifted from the desired state, in read-only mode.",
+	}, []string{"controller"})
+
+	// FieldManagerConflicts counts the server-side applies of service
+	// accounts that conflicted with another field manager and were not
+	// forced, per namespace.
+	FieldManagerConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "field_manager_conflicts_total",
+		Help:      "Number of service account applies that conflicted with another field manager.",
+	}, []string{"namespace"})
+
+	// PullFailuresWithManagedSecret counts the pods reported backing off from
+	// image pulls while referencing the managed secret.
+	PullFailuresWithManagedSecret = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pull_failures_with_managed_secret_total",
+		Help:      "Number of pods backing off from image pulls despite referencing the managed secret.",
+	}, []string{"namespace"})
+
+	// MassChangeGuardTripped is 1 once the mass change guard has halted
+	// every write, until the controller is restarted.
+	MassChangeGuardTripped = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mass_change_guard_tripped",
+		Help:      "1 once the mass change guard has halted every write, until the controller is restarted.",
+	})
+
+	// BuildInfo is always 1, labelled with the version and commit of the
+	// running controller.
+	BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Always 1, labelled with the version and commit the controller was built from.",
+	}, []string{"version", "commit"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		UnmanagedSecretSkipped,
+		NamespaceProvisionDuration,
+		UnconvergedObjects,
+		FailingObjects,
+		LastSweepObjects,
+		OrphanedSecrets,
+		ManagedSecrets,
+		InjectedServiceAccounts,
+		CompliantObjects,
+		NoncompliantObjects,
+		PullFailuresWithManagedSecret,
+		FieldManagerConflicts,
+		MassChangeGuardTripped,
+		BuildInfo,
+	)
+}
+
+// RegisterConfigInfo registers aurora_controller_config_info, always 1 and
+// labelled with the running configuration, so that dashboards and alerts can
+// key off it. It must be called once, with non-sensitive values only.
+func RegisterConfigInfo(config map[string]string) {
+	configInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "config_info",
+		Help:        "Always 1, labelled with the running configuration of the controller.",
+		ConstLabels: config,
+	})
+	configInfo.Set(1)
+
+	Registry.MustRegister(configInfo)
+}
+
+// DeleteNamespace removes the series labelled with the namespace, so that
+// deleted namespaces do not grow the cardinality of the metrics.
+func DeleteNamespace(namespace string) {
+	UnmanagedSecretSkipped.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	PullFailuresWithManagedSecret.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+	FieldManagerConflicts.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+}
+
+// Handler returns the HTTP handler serving the registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteNamespace(t *testing.T) {
+	vecs := map[string]*prometheus.CounterVec{
+		"unmanaged_secret_skipped_total":          UnmanagedSecretSkipped,
+		"pull_failures_with_managed_secret_total": PullFailuresWithManagedSecret,
+		"field_manager_conflicts_total":           FieldManagerConflicts,
+	}
+	for _, vec := range vecs {
+		vec.Reset()
+	}
+	UnmanagedSecretSkipped.WithLabelValues("team", "aurora-pull").Inc()
+	UnmanagedSecretSkipped.WithLabelValues("team", "registry-mirror").Inc()
+	UnmanagedSecretSkipped.WithLabelValues("other", "aurora-pull").Inc()
+	PullFailuresWithManagedSecret.WithLabelValues("team").Inc()
+	PullFailuresWithManagedSecret.WithLabelValues("other").Inc()
+	FieldManagerConflicts.WithLabelValues("team").Inc()
+	FieldManagerConflicts.WithLabelValues("other").Inc()
+
+	DeleteNamespace("team")
+
+	for name, vec := range vecs {
+		if got := testutil.CollectAndCount(vec); got != 1 {
+			t.Errorf("%s has %d series after deleting namespace team, want only the one of namespace other", name, got)
+		}
+	}
+	if got := testutil.ToFloat64(UnmanagedSecretSkipped.WithLabelValues("other", "aurora-pull")); got != 1 {
+		t.Errorf("series of namespace other = %v, want 1", got)
+	}
+}
+
+func TestInfoMetrics(t *testing.T) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues("v1.2.3", "abc1234").Set(1)
+	RegisterConfigInfo(map[string]string{"secret_name": "aurora-pull", "workers": "2"})
+
+	expected := `
+# HELP aurora_controller_build_info Always 1, labelled with the version and commit the controller was built from.
+# TYPE aurora_controller_build_info gauge
+aurora_controller_build_info{commit="abc1234",version="v1.2.3"} 1
+# HELP aurora_controller_config_info Always 1, labelled with the running configuration of the controller.
+# TYPE aurora_controller_config_info gauge
+aurora_controller_config_info{secret_name="aurora-pull",workers="2"} 1
+`
+	if err := testutil.GatherAndCompare(Registry, strings.NewReader(expected), "aurora_controller_build_info", "aurora_controller_config_info"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package redact masks credential values in text bound for the logs.
+package redact
+
+import "regexp"
+
+// Mask replaces every redacted value.
+const Mask = "***"
+
+var (
+	// credentialField matches the credential fields of a dockerconfigjson,
+	// and the data keys of docker config secrets, in JSON, including JSON
+	// quoted inside another string.
+	credentialField = regexp.MustCompile(`(\\*"(?:auth|password|identitytoken|registrytoken|\.dockerconfigjson|\.dockercfg)\\*"\s*:\s*\\*")[^"\\]*`)
+
+	// dataBytes matches the byte slices of a Go formatted object, such as
+	// the data values of a secret, whatever their key.
+	dataBytes = regexp.MustCompile(`\[(?:[0-9]{1,3} )+[0-9]{1,3}\]`)
+)
+
+// String returns the text with the credential values it holds, such as those
+// of a dockerconfigjson or of a formatted secret, replaced by Mask. It is
+// meant for error messages that may quote an object or a credential payload.
+func String(text string) string {
+	text = credentialField.ReplaceAllString(text, "${1}"+Mask)
+	return dataBytes.ReplaceAllString(text, Mask)
+}
+
+// Error returns the message of the error with its credential values masked,
+// or an empty string for a nil error.
+func Error(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return String(err.Error())
+}
@@ -0,0 +1,61 @@
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestString(t *testing.T) {
+	const dockerConfigJSON = `{"auths":{"registry.example.com":{"username":"user","password":"s3cret","auth":"dXNlcjpzM2NyZXQ="}}}`
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aurora-pull", Namespace: "team"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfigJSON)},
+	}
+
+	tests := []struct {
+		name string
+		text string
+		// keep is text that must survive the masking.
+		keep []string
+	}{
+		{name: "dockerconfigjson", text: dockerConfigJSON, keep: []string{"registry.example.com", `"username":"user"`}},
+		{name: "quoted dockerconfigjson", text: fmt.Sprintf("invalid credential %q", dockerConfigJSON), keep: []string{"invalid credential", "registry.example.com"}},
+		{name: "formatted secret", text: fmt.Sprintf("creating secret %v", secret), keep: []string{"aurora-pull", "team"}},
+		{name: "secret as JSON", text: `{"metadata":{"name":"aurora-pull"},"stringData":{".dockerconfigjson":"{\"auths\":{}}"}}`, keep: []string{"aurora-pull"}},
+		{name: "no credential", text: "secrets \"aurora-pull\" is forbidden", keep: []string{"secrets \"aurora-pull\" is forbidden"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := String(tt.text)
+
+			for _, credential := range []string{"s3cret", "dXNlcjpzM2NyZXQ=", `{\"auths\":{}}`} {
+				if strings.Contains(got, credential) {
+					t.Errorf("String() = %s, contains %s", got, credential)
+				}
+			}
+			for _, keep := range tt.keep {
+				if !strings.Contains(got, keep) {
+					t.Errorf("String() = %s, want it to keep %s", got, keep)
+				}
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	if got := Error(nil); got != "" {
+		t.Errorf("Error(nil) = %q, want empty", got)
+	}
+
+	err := fmt.Errorf("creating secret: %w", errors.New(`credential {"auths":{"r":{"auth":"dXNlcjpwYXNz"}}} rejected`))
+	if got := Error(err); strings.Contains(got, "dXNlcjpwYXNz") || !strings.Contains(got, "creating secret") {
+		t.Errorf("Error() = %s, want the message with the credential masked", got)
+	}
+}
@@ -19,10 +19,14 @@ package signals
 import (
 	"os"
 	"os/signal"
+	"sync"
 )
 
 var onlyOneSignalHandler = make(chan struct{})
 
+// shutdown closes the stop channel returned by SetupSignalHandler.
+var shutdown = func() {}
+
 // SetupSignalHandler registered for SIGTERM and SIGINT. A stop channel is returned
 // which is closed on one of these signals. If a second signal is caught, the program
 // is terminated with exit code 1.
@@ -30,14 +34,23 @@ func SetupSignalHandler() (stopCh <-chan struct{}) {
 	close(onlyOneSignalHandler) // panics when called twice
 
 	stop := make(chan struct{})
+	var once sync.Once
+	shutdown = func() { once.Do(func() { close(stop) }) }
+
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, shutdownSignals...)
 	go func() {
 		<-c
-		close(stop)
+		shutdown()
 		<-c
 		os.Exit(1) // second signal. Exit directly.
 	}()
 
 	return stop
 }
+
+// RequestShutdown closes the stop channel returned by SetupSignalHandler as if a
+// shutdown signal had been received. It is safe to call more than once.
+func RequestShutdown() {
+	shutdown()
+}